@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// parseAdminUserIDs reads a comma separated list of user IDs allowed to use
+// the /api/admin endpoints.
+func parseAdminUserIDs(s string) (map[uuid.UUID]bool, error) {
+	admins := map[uuid.UUID]bool{}
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := uuid.Parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user ID %q: %w", field, err)
+		}
+		admins[id] = true
+	}
+	return admins, nil
+}
+
+func (cfg *apiConfig) isAdmin(userID uuid.UUID) bool {
+	return cfg.adminUserIDs[userID]
+}
@@ -34,9 +34,9 @@ async function createVideoDraft() {
       },
       body: JSON.stringify({ title, description }),
     });
-    const data = await res.json();
+    const { data, error } = await res.json();
     if (!res.ok) {
-      throw new Error(`Failed to create video draft: ${data.error}`);
+      throw new Error(`Failed to create video draft: ${error.message}`);
     }
 
     const videoID = data.id;
@@ -61,9 +61,9 @@ async function login() {
       },
       body: JSON.stringify({ email, password }),
     });
-    const data = await res.json();
+    const { data, error } = await res.json();
     if (!res.ok) {
-      throw new Error(`Failed to login: ${data.error}`);
+      throw new Error(`Failed to login: ${error.message}`);
     }
 
     if (data.token) {
@@ -92,8 +92,8 @@ async function signup() {
       body: JSON.stringify({ email, password }),
     });
     if (!res.ok) {
-      const data = await res.json();
-      throw new Error(`Failed to create user: ${data.error}`);
+      const { error } = await res.json();
+      throw new Error(`Failed to create user: ${error.message}`);
     }
     console.log('User created!');
     await login();
@@ -138,8 +138,8 @@ async function uploadThumbnail(videoID) {
       body: formData,
     });
     if (!res.ok) {
-      const data = await res.json();
-      throw new Error(`Failed to upload thumbnail. Error: ${data.error}`);
+      const { error } = await res.json();
+      throw new Error(`Failed to upload thumbnail. Error: ${error.message}`);
     }
 
     await res.json();
@@ -171,8 +171,8 @@ async function uploadVideoFile(videoID) {
       body: formData,
     });
     if (!res.ok) {
-      const data = await res.json();
-      throw new Error(`Failed to upload video file. Error: ${data.error}`);
+      const { error } = await res.json();
+      throw new Error(`Failed to upload video file. Error: ${error.message}`);
     }
 
     console.log('Video uploaded!');
@@ -195,11 +195,11 @@ async function getVideos() {
       },
     });
     if (!res.ok) {
-      const data = await res.json();
-      throw new Error(`Failed to get videos. Error: ${data.error}`);
+      const { error } = await res.json();
+      throw new Error(`Failed to get videos. Error: ${error.message}`);
     }
 
-    const videos = await res.json();
+    const { data: videos } = await res.json();
     const videoList = document.getElementById('video-list');
     videoList.innerHTML = '';
     for (const video of videos) {
@@ -241,7 +241,7 @@ async function getVideo(videoID) {
       throw new Error('Failed to get video.');
     }
 
-    const video = await res.json();
+    const { data: video } = await res.json();
     viewVideo(video);
   } catch (error) {
     alert(`Error: ${error.message}`);
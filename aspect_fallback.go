@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// aspectFallback controls what a video that is neither 16:9 nor 9:16 is
+// labeled, and so which key prefix it's stored under.
+//
+//	other       every such video is "other"
+//	reduced     the ratio in lowest terms, a 2560x1080 video is "64:27"
+//	dimensions  the video's size, "2560x1080"
+type aspectFallback string
+
+const (
+	aspectFallbackOther      aspectFallback = "other"
+	aspectFallbackReduced    aspectFallback = "reduced"
+	aspectFallbackDimensions aspectFallback = "dimensions"
+)
+
+func parseAspectFallback(s string) (aspectFallback, error) {
+	switch f := aspectFallback(s); f {
+	case aspectFallbackOther, aspectFallbackReduced, aspectFallbackDimensions:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown aspect ratio fallback %q", s)
+}
+
+// aspectRatioLabel is getVideoAspectRatio with "other" replaced according
+// to the configured fallback.
+func (cfg *apiConfig) aspectRatioLabel(width, height int) (string, error) {
+	label, err := getVideoAspectRatio(width, height)
+	if err != nil || label != "other" {
+		return label, err
+	}
+	switch cfg.aspectFallback {
+	case aspectFallbackReduced:
+		d := gcd(width, height)
+		return fmt.Sprintf("%d:%d", width/d, height/d), nil
+	case aspectFallbackDimensions:
+		return fmt.Sprintf("%dx%d", width, height), nil
+	}
+	return label, nil
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// aspectFallbackPrefix turns a fallback label into a key segment, colons
+// are awkward in keys so a reduced 64:27 becomes 64x27.
+func aspectFallbackPrefix(aspectRatio string) string {
+	if aspectRatio == "" {
+		return "other"
+	}
+	return strings.ReplaceAll(aspectRatio, ":", "x")
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseAspectFallback(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    aspectFallback
+		wantErr bool
+	}{
+		{in: "other", want: aspectFallbackOther},
+		{in: "reduced", want: aspectFallbackReduced},
+		{in: "dimensions", want: aspectFallbackDimensions},
+		{in: "", wantErr: true},
+		{in: "Reduced", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseAspectFallback(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseAspectFallback(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAspectRatioLabel(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback aspectFallback
+		width    int
+		height   int
+		want     string
+	}{
+		{name: "landscape is unaffected", fallback: aspectFallbackReduced, width: 1920, height: 1080, want: "16:9"},
+		{name: "portrait is unaffected", fallback: aspectFallbackDimensions, width: 1080, height: 1920, want: "9:16"},
+		{name: "21:9 as other", fallback: aspectFallbackOther, width: 2560, height: 1080, want: "other"},
+		{name: "21:9 reduced", fallback: aspectFallbackReduced, width: 2560, height: 1080, want: "64:27"},
+		{name: "21:9 dimensions", fallback: aspectFallbackDimensions, width: 2560, height: 1080, want: "2560x1080"},
+		{name: "square reduced", fallback: aspectFallbackReduced, width: 720, height: 720, want: "1:1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{aspectFallback: tt.fallback}
+			got, err := cfg.aspectRatioLabel(tt.width, tt.height)
+			if err != nil {
+				t.Fatalf("aspectRatioLabel: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("aspectRatioLabel(%d, %d) = %q, want %q", tt.width, tt.height, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAspectFallbackPrefix(t *testing.T) {
+	tests := []struct {
+		aspectRatio string
+		want        string
+	}{
+		{aspectRatio: "", want: "other"},
+		{aspectRatio: "other", want: "other"},
+		{aspectRatio: "64:27", want: "64x27"},
+		{aspectRatio: "2560x1080", want: "2560x1080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.aspectRatio, func(t *testing.T) {
+			if got := aspectFallbackPrefix(tt.aspectRatio); got != tt.want {
+				t.Errorf("aspectFallbackPrefix(%q) = %q, want %q", tt.aspectRatio, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoAspectFallback(t *testing.T) {
+	tests := []struct {
+		fallback   aspectFallback
+		wantPrefix string
+	}{
+		{fallback: aspectFallbackOther, wantPrefix: "other/"},
+		{fallback: aspectFallbackReduced, wantPrefix: "64x27/"},
+		{fallback: aspectFallbackDimensions, wantPrefix: "2560x1080/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.fallback), func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.aspectFallback = tt.fallback
+			installFakeFFmpeg(t, cfg, fakeProbe(2560, 1080))
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, _ := cfg.videoKeyFromURL(*stored.VideoURL)
+			if !strings.HasPrefix(key, tt.wantPrefix) {
+				t.Errorf("key = %q, want prefix %q", key, tt.wantPrefix)
+			}
+		})
+	}
+}
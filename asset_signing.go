@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// signAssetURL adds an expiring signature to URLs of files in the assets
+// directory. Other URLs, and every URL while no signing secret is set, are
+// returned as they are. Stored URLs stay unsigned, they're signed each time
+// they're handed out.
+func (cfg *apiConfig) signAssetURL(assetURL string) string {
+	if len(cfg.assetSigningSecret) == 0 {
+		return assetURL
+	}
+	name, ok := cfg.assetFileName(assetURL)
+	if !ok {
+		return assetURL
+	}
+	query := storage.SignedQuery(cfg.assetSigningSecret, name, time.Now().Add(cfg.presignTTL))
+	return assetURL + "?" + query.Encode()
+}
+
+func (cfg *apiConfig) signAssetURLs(urls map[string]string) map[string]string {
+	if len(cfg.assetSigningSecret) == 0 || urls == nil {
+		return urls
+	}
+	signed := maps.Clone(urls)
+	for name, u := range signed {
+		signed[name] = cfg.signAssetURL(u)
+	}
+	return signed
+}
+
+// requireAssetSignature only lets requests for assets through that carry a
+// valid, unexpired signature from signAssetURL, so knowing a file's name
+// isn't enough to fetch it.
+func (cfg *apiConfig) requireAssetSignature(next http.Handler) http.Handler {
+	if len(cfg.assetSigningSecret) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/assets/")
+		err := storage.VerifySignedQuery(cfg.assetSigningSecret, name, r.URL.Query(), time.Now())
+		if errors.Is(err, storage.ErrSignatureExpired) {
+			respondWithError(w, http.StatusForbidden, "Asset URL has expired", nil)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusForbidden, "Asset URL isn't signed", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAssetURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     string
+		url        string
+		wantSigned bool
+	}{
+		{name: "asset", secret: "secret", url: "http://localhost:8091/assets/a.png", wantSigned: true},
+		{name: "no secret", url: "http://localhost:8091/assets/a.png"},
+		{name: "not an asset", secret: "secret", url: "https://cdn.example.com/a.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.assetSigningSecret = []byte(tt.secret)
+			got := cfg.signAssetURL(tt.url)
+			if !tt.wantSigned {
+				if got != tt.url {
+					t.Errorf("signAssetURL(%q) = %q, want it unchanged", tt.url, got)
+				}
+				return
+			}
+			base, query, _ := strings.Cut(got, "?")
+			if base != tt.url || !strings.Contains(query, "signature=") || !strings.Contains(query, "expires=") {
+				t.Errorf("signAssetURL(%q) = %q, want it signed", tt.url, got)
+			}
+		})
+	}
+}
+
+func TestRequireAssetSignature(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		// target builds the request path from a URL signAssetURL handed out
+		target   func(signed string) string
+		ttl      time.Duration
+		wantCode int
+		wantBody string
+	}{
+		{name: "valid signature", secret: "secret", target: func(s string) string { return s }, wantCode: http.StatusOK},
+		{
+			name:   "tampered signature",
+			secret: "secret",
+			target: func(s string) string {
+				u, _ := url.Parse(s)
+				q := u.Query()
+				q.Set("signature", strings.Repeat("A", len(q.Get("signature"))))
+				u.RawQuery = q.Encode()
+				return u.String()
+			},
+			wantCode: http.StatusForbidden,
+			wantBody: "isn't signed",
+		},
+		{
+			name:   "signature for another file",
+			secret: "secret",
+			target: func(s string) string {
+				return strings.Replace(s, "/assets/thumb.png", "/assets/other.png", 1)
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{name: "expired signature", secret: "secret", target: func(s string) string { return s }, ttl: -time.Minute, wantCode: http.StatusForbidden, wantBody: "expired"},
+		{name: "unsigned", secret: "secret", target: func(s string) string { u, _ := url.Parse(s); u.RawQuery = ""; return u.String() }, wantCode: http.StatusForbidden},
+		{name: "signing off", target: func(s string) string { return s }, wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.assetSigningSecret = []byte(tt.secret)
+			if tt.ttl != 0 {
+				cfg.presignTTL = tt.ttl
+			}
+			for _, name := range []string{"thumb.png", "other.png"} {
+				if err := os.WriteFile(filepath.Join(cfg.assetsRoot, name), []byte("png "+name), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			handler := cfg.requireAssetSignature(http.StripPrefix("/assets", http.FileServer(http.Dir(cfg.assetsRoot))))
+
+			signed := cfg.signAssetURL(cfg.assetURL("thumb.png"))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target(signed), nil))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if rec.Code == http.StatusOK && rec.Body.String() != "png thumb.png" {
+				t.Errorf("body = %q, want the thumbnail", rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to mention %q", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"strings"
 )
 
 func (cfg apiConfig) ensureAssetsDir() error {
@@ -10,3 +11,14 @@ func (cfg apiConfig) ensureAssetsDir() error {
 	}
 	return nil
 }
+
+// assetURL is the absolute URL of a file served from the assets directory.
+func (cfg *apiConfig) assetURL(fileName string) string {
+	return cfg.assetBaseURL + "/" + fileName
+}
+
+// assetFileName is the inverse of assetURL, ok is false for URLs that don't
+// point into the assets directory.
+func (cfg *apiConfig) assetFileName(assetURL string) (string, bool) {
+	return strings.CutPrefix(assetURL, cfg.assetBaseURL+"/")
+}
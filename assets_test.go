@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAssetFileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		assetURL string
+		want     string
+		wantOK   bool
+	}{
+		{name: "default base", base: "http://localhost:8091/assets", assetURL: "http://localhost:8091/assets/a.png", want: "a.png", wantOK: true},
+		{name: "configured base", base: "https://cdn.example.com/media", assetURL: "https://cdn.example.com/media/a.png", want: "a.png", wantOK: true},
+		{name: "another host", base: "https://cdn.example.com/media", assetURL: "http://localhost:8091/assets/a.png"},
+		{name: "a sibling path", base: "https://cdn.example.com/media", assetURL: "https://cdn.example.com/media-old/a.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{assetBaseURL: tt.base}
+			got, ok := cfg.assetFileName(tt.assetURL)
+			if ok != tt.wantOK || ok && got != tt.want {
+				t.Errorf("assetFileName(%q) = %q, %v, want %q, %v", tt.assetURL, got, ok, tt.want, tt.wantOK)
+			}
+			if tt.wantOK && cfg.assetURL(got) != tt.assetURL {
+				t.Errorf("assetURL(%q) = %q, want %q", got, cfg.assetURL(got), tt.assetURL)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadThumbnailAssetBaseURL(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+	}{
+		{name: "localhost", base: "http://localhost:8091/assets"},
+		{name: "behind a domain", base: "https://videos.example.com/assets"},
+		{name: "on a CDN path", base: "https://cdn.example.com/tubely/static"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.assetBaseURL = tt.base
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadThumbnail(rec, newThumbnailRequest(t, video.ID, token, "image/png", encodePNG(t, 1280, 720), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var resp videoResponse
+			decodeData(t, rec, &resp)
+			urls := []string{*resp.ThumbnailURL}
+			for _, sizeURL := range resp.ThumbnailSizes {
+				urls = append(urls, sizeURL)
+			}
+			for _, u := range urls {
+				if !strings.HasPrefix(u, tt.base+"/") {
+					t.Errorf("URL %s isn't below %s", u, tt.base)
+				}
+			}
+			if _, ok := cfg.thumbnailAssetPath(*resp.ThumbnailURL); !ok {
+				t.Errorf("thumbnail URL %s doesn't map back to a file", *resp.ThumbnailURL)
+			}
+		})
+	}
+}
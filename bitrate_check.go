@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// bitrateThreshold is the lowest bitrate a source whose short side is at
+// least height pixels is expected to have.
+type bitrateThreshold struct {
+	height        int
+	bitsPerSecond int64
+}
+
+// parseBitrateThresholds reads a comma separated HEIGHT=KBPS list such as
+// "1080=4000,720=2000", sorted tallest first.
+func parseBitrateThresholds(spec string) ([]bitrateThreshold, error) {
+	thresholds := []bitrateThreshold{}
+	if strings.TrimSpace(spec) == "" {
+		return thresholds, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		h, kbps, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		height, herr := strconv.Atoi(h)
+		rate, rerr := strconv.ParseInt(kbps, 10, 64)
+		if !ok || herr != nil || rerr != nil || height <= 0 || rate <= 0 {
+			return nil, fmt.Errorf("invalid threshold %q, expected HEIGHT=KBPS", pair)
+		}
+		thresholds = append(thresholds, bitrateThreshold{height: height, bitsPerSecond: rate * 1000})
+	}
+	slices.SortFunc(thresholds, func(a, b bitrateThreshold) int {
+		return b.height - a.height
+	})
+	return thresholds, nil
+}
+
+// lowBitrate reports whether the source is more heavily compressed than
+// its resolution calls for, in which case re-encoding it will show. The
+// container's bitrate is used when ffprobe knows it and the average over
+// the file otherwise. Sources smaller than every threshold, or whose
+// bitrate can't be told, are never flagged.
+func (cfg *apiConfig) lowBitrate(probe videoProbe, sizeBytes int64) bool {
+	bitrate := probe.Bitrate
+	if bitrate <= 0 {
+		bitrate = averageBitrate(sizeBytes, probe.Duration)
+	}
+	if bitrate <= 0 {
+		return false
+	}
+	return bitrate < bitrateTarget(cfg.bitrateThresholds, min(probe.Width, probe.Height))
+}
+
+// bitrateTarget is the bitrate expected of a video whose short side is
+// short pixels, zero when it's smaller than every threshold.
+func bitrateTarget(thresholds []bitrateThreshold, short int) int64 {
+	for _, t := range thresholds {
+		if short >= t.height {
+			return t.bitsPerSecond
+		}
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseBitrateThresholds(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []bitrateThreshold
+		wantErr bool
+	}{
+		{name: "empty", spec: "", want: []bitrateThreshold{}},
+		{name: "sorted tallest first", spec: "720=2000, 1080=4000,480=800", want: []bitrateThreshold{
+			{height: 1080, bitsPerSecond: 4_000_000},
+			{height: 720, bitsPerSecond: 2_000_000},
+			{height: 480, bitsPerSecond: 800_000},
+		}},
+		{name: "missing rate", spec: "1080", wantErr: true},
+		{name: "not a number", spec: "1080=fast", wantErr: true},
+		{name: "zero height", spec: "0=4000", wantErr: true},
+		{name: "negative rate", spec: "1080=-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBitrateThresholds(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("thresholds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLowBitrate(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+
+	tests := []struct {
+		name      string
+		probe     videoProbe
+		sizeBytes int64
+		want      bool
+	}{
+		{name: "low 1080p", probe: videoProbe{Width: 1920, Height: 1080, Bitrate: 1_000_000}, want: true},
+		{name: "high 1080p", probe: videoProbe{Width: 1920, Height: 1080, Bitrate: 8_000_000}},
+		{name: "portrait uses the short side", probe: videoProbe{Width: 720, Height: 1280, Bitrate: 3_000_000}},
+		{name: "below every threshold", probe: videoProbe{Width: 320, Height: 180, Bitrate: 1000}},
+		{name: "averaged over the file", probe: videoProbe{Width: 1280, Height: 720, Duration: 10}, sizeBytes: 1_000_000, want: true},
+		{name: "unknown bitrate", probe: videoProbe{Width: 1920, Height: 1080}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.lowBitrate(tt.probe, tt.sizeBytes); got != tt.want {
+				t.Errorf("lowBitrate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// probeWithBitrate is fakeProbe with the container bitrate set.
+func probeWithBitrate(width, height int, bitsPerSecond int64) string {
+	return fmt.Sprintf(`{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "h264", "width": %d, "height": %d},
+			{"index": 1, "codec_type": "audio", "codec_name": "aac"}
+		],
+		"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "10.000000", "bit_rate": "%d"}
+	}`, width, height, bitsPerSecond)
+}
+
+func TestHandlerUploadVideoLowBitrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		bitrate int64
+		want    bool
+	}{
+		{name: "low bitrate source", bitrate: 1_000_000, want: true},
+		{name: "high bitrate source", bitrate: 8_000_000, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			installFakeFFmpeg(t, cfg, probeWithBitrate(1920, 1080, tt.bitrate))
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var resp struct {
+				LowBitrate bool `json:"low_bitrate"`
+			}
+			decodeData(t, rec, &resp)
+			if resp.LowBitrate != tt.want {
+				t.Errorf("low_bitrate = %v, want %v", resp.LowBitrate, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type chapter struct {
+	Title        string  `json:"title"`
+	StartSeconds float64 `json:"startSeconds"`
+}
+
+// validateChapters checks that every chapter has a title fit for a WebVTT
+// cue, and that start times don't go backwards and fall inside the video.
+func validateChapters(chapters []chapter, duration float64) *validationError {
+	var errs []fieldError
+	if len(chapters) == 0 {
+		errs = append(errs, fieldError{Field: "body", Message: "needs at least one chapter"})
+	}
+	for i, c := range chapters {
+		field := fmt.Sprintf("[%d]", i)
+		switch {
+		case strings.TrimSpace(c.Title) == "":
+			errs = append(errs, fieldError{Field: field + ".title", Message: "is required"})
+		case strings.ContainsAny(c.Title, "\r\n") || strings.Contains(c.Title, "-->"):
+			errs = append(errs, fieldError{Field: field + ".title", Message: "can't contain line breaks or -->"})
+		}
+		switch {
+		case math.IsNaN(c.StartSeconds) || c.StartSeconds < 0 || c.StartSeconds >= duration:
+			errs = append(errs, fieldError{Field: field + ".startSeconds", Message: fmt.Sprintf("must be within the video's %.3f seconds", duration)})
+		case i > 0 && c.StartSeconds < chapters[i-1].StartSeconds:
+			errs = append(errs, fieldError{Field: field + ".startSeconds", Message: "can't be before the previous chapter"})
+		}
+	}
+	if len(errs) > 0 {
+		return &validationError{Fields: errs}
+	}
+	return nil
+}
+
+// chaptersVTT renders chapters as a WebVTT file, each chapter running until
+// the next one starts and the last one until the end of the video.
+func chaptersVTT(chapters []chapter, duration float64) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i, c := range chapters {
+		end := duration
+		if i+1 < len(chapters) {
+			end = chapters[i+1].StartSeconds
+		}
+		fmt.Fprintf(&b, "\n%d\n%s --> %s\n%s\n", i+1, vttTimestamp(c.StartSeconds), vttTimestamp(end), strings.TrimSpace(c.Title))
+	}
+	return b.String()
+}
+
+// vttTimestamp formats seconds as hh:mm:ss.ttt.
+func vttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3_600_000, ms/60_000%60, ms/1000%60, ms%1000)
+}
+
+// chaptersKey places a video's chapters next to its primary object, named
+// after the video rather than the object, which identical uploads share
+// under content-hash naming.
+func chaptersKey(key string, videoID uuid.UUID) string {
+	return path.Join(path.Dir(key), videoID.String()+"_chapters.vtt")
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateChapters(t *testing.T) {
+	tests := []struct {
+		name       string
+		chapters   []chapter
+		wantFields []string
+	}{
+		{
+			name:     "valid",
+			chapters: []chapter{{Title: "Intro", StartSeconds: 0}, {Title: "Middle", StartSeconds: 30}, {Title: "End", StartSeconds: 59.5}},
+		},
+		{
+			name:     "same start twice",
+			chapters: []chapter{{Title: "A", StartSeconds: 10}, {Title: "B", StartSeconds: 10}},
+		},
+		{name: "no chapters", chapters: []chapter{}, wantFields: []string{"body"}},
+		{
+			name:       "out of order",
+			chapters:   []chapter{{Title: "A", StartSeconds: 20}, {Title: "B", StartSeconds: 10}},
+			wantFields: []string{"[1].startSeconds"},
+		},
+		{
+			name:       "at the end of the video",
+			chapters:   []chapter{{Title: "A", StartSeconds: 0}, {Title: "B", StartSeconds: 60}},
+			wantFields: []string{"[1].startSeconds"},
+		},
+		{
+			name:       "negative start",
+			chapters:   []chapter{{Title: "A", StartSeconds: -1}},
+			wantFields: []string{"[0].startSeconds"},
+		},
+		{
+			name:       "not a number",
+			chapters:   []chapter{{Title: "A", StartSeconds: math.NaN()}},
+			wantFields: []string{"[0].startSeconds"},
+		},
+		{
+			name:       "bad titles",
+			chapters:   []chapter{{Title: " ", StartSeconds: 0}, {Title: "a\nb", StartSeconds: 1}, {Title: "a --> b", StartSeconds: 2}},
+			wantFields: []string{"[0].title", "[1].title", "[2].title"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verr := validateChapters(tt.chapters, 60)
+			var got []string
+			if verr != nil {
+				for _, f := range verr.Fields {
+					got = append(got, f.Field)
+				}
+			}
+			if !slices.Equal(got, tt.wantFields) {
+				t.Errorf("invalid fields = %v, want %v", got, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestChaptersVTT(t *testing.T) {
+	got := chaptersVTT([]chapter{{Title: " Intro ", StartSeconds: 0}, {Title: "Part two", StartSeconds: 65.25}}, 3725.5)
+	want := "WEBVTT\n" +
+		"\n1\n00:00:00.000 --> 00:01:05.250\nIntro\n" +
+		"\n2\n00:01:05.250 --> 01:02:05.500\nPart two\n"
+	if got != want {
+		t.Errorf("chaptersVTT =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestVTTTimestamp(t *testing.T) {
+	tests := []struct {
+		seconds float64
+		want    string
+	}{
+		{seconds: 0, want: "00:00:00.000"},
+		{seconds: 1.25, want: "00:00:01.250"},
+		{seconds: 59.999, want: "00:00:59.999"},
+		{seconds: 3600, want: "01:00:00.000"},
+		{seconds: 36000 + 61.5, want: "10:01:01.500"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := vttTimestamp(tt.seconds); got != tt.want {
+				t.Errorf("vttTimestamp(%v) = %s, want %s", tt.seconds, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerVideoChapters(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		duration float64
+		wantCode int
+	}{
+		{name: "valid chapters", body: `[{"title": "Intro", "startSeconds": 0}, {"title": "Outro", "startSeconds": 50}]`, duration: 60, wantCode: http.StatusOK},
+		{name: "out of order", body: `[{"title": "Intro", "startSeconds": 30}, {"title": "Outro", "startSeconds": 10}]`, duration: 60, wantCode: http.StatusBadRequest},
+		{name: "out of range", body: `[{"title": "Intro", "startSeconds": 0}, {"title": "Outro", "startSeconds": 90}]`, duration: 60, wantCode: http.StatusBadRequest},
+		{name: "unknown field", body: `[{"title": "Intro", "start": 0}]`, duration: 60, wantCode: http.StatusBadRequest},
+		{name: "unknown duration", body: `[{"title": "Intro", "startSeconds": 0}]`, wantCode: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+			mem.Put(context.Background(), "landscape/abc.mp4", strings.NewReader("video"), "video/mp4")
+			videoURL := cfg.videoURL("landscape/abc.mp4")
+			video.VideoURL = &videoURL
+			video.Duration = tt.duration
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+
+			req := newVideoRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/chapters", video.ID, strings.NewReader(tt.body), token)
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoChapters(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key := chaptersKey("landscape/abc.mp4", video.ID)
+			obj, ok := mem.Lookup(key)
+			if rec.Code != http.StatusOK {
+				if ok || stored.ChaptersURL != nil {
+					t.Error("rejected chapters were stored")
+				}
+				return
+			}
+			if !ok || obj.ContentType != "text/vtt" || !strings.HasPrefix(string(obj.Data), "WEBVTT\n") {
+				t.Fatalf("stored %q of %s under %s, want a WebVTT file", obj.Data, obj.ContentType, key)
+			}
+			if !strings.Contains(string(obj.Data), "00:00:50.000 --> 00:01:00.000\nOutro") {
+				t.Errorf("last chapter doesn't run to the end of the video:\n%s", obj.Data)
+			}
+			if stored.ChaptersURL == nil || *stored.ChaptersURL != cfg.videoURL(key) {
+				t.Errorf("chapters URL = %v, want %s", stored.ChaptersURL, cfg.videoURL(key))
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// racingStorage stores "theirs" under the final key of a promotion just
+// before it happens, like a concurrent upload of the same key would.
+type racingStorage struct {
+	storage.Storage
+}
+
+func (s *racingStorage) Copy(ctx context.Context, srcKey, dstKey string, opts ...func(*storage.PutOptions)) error {
+	if strings.Contains(srcKey, "staging/") && strings.HasSuffix(dstKey, ".mp4") {
+		if err := s.Storage.Put(ctx, dstKey, strings.NewReader("theirs"), "video/mp4"); err != nil {
+			return err
+		}
+	}
+	return s.Storage.Copy(ctx, srcKey, dstKey, opts...)
+}
+
+func TestHandlerUploadVideoConditionalPut(t *testing.T) {
+	tests := []struct {
+		name           string
+		conditionalPut bool
+		race           bool
+		wantData       string
+	}{
+		{name: "new object", conditionalPut: true, wantData: "fake video"},
+		{name: "existing object is kept", conditionalPut: true, race: true, wantData: "theirs"},
+		{name: "existing object is overwritten when disabled", race: true, wantData: "fake video"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.conditionalPut = tt.conditionalPut
+			if tt.race {
+				cfg.storage = &racingStorage{Storage: mem}
+			}
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.VideoURL == nil {
+				t.Fatal("video URL wasn't set")
+			}
+			key, ok := cfg.videoKeyFromURL(*stored.VideoURL)
+			if !ok {
+				t.Fatalf("video URL %s isn't ours", *stored.VideoURL)
+			}
+			res, err := mem.Get(context.Background(), key, "")
+			if err != nil {
+				t.Fatalf("Get(%s): %v", key, err)
+			}
+			defer res.Body.Close()
+			data, _ := io.ReadAll(res.Body)
+			if string(data) != tt.wantData {
+				t.Errorf("stored video = %q, want %q", data, tt.wantData)
+			}
+			for _, k := range mem.Keys() {
+				if strings.Contains(k, "staging/") {
+					t.Errorf("staging object %s was left behind", k)
+				}
+			}
+		})
+	}
+}
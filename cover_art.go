@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// embedCoverArt returns a copy of the processed MP4 at videoPath with the
+// image at coverPath attached as its poster, which players and file
+// managers show for downloaded files. Streams are copied, not re-encoded.
+// The caller removes the returned file.
+func (cfg *apiConfig) embedCoverArt(videoPath, coverPath string, profile outputProfile) (string, error) {
+	outputFilePath, err := tempOutputPath(videoPath, "tubely-cover-*.mp4")
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command(
+		cfg.ffmpegPath,
+		"-y",
+		"-i", videoPath,
+		"-i", coverPath,
+		"-map", "0:v:0",
+		"-map", "0:a?",
+		"-map", "0:s?",
+		"-map", "1",
+		"-c", "copy",
+		"-disposition:v:1", "attached_pic",
+		"-movflags", profile.movflags,
+		"-f", "mp4",
+		outputFilePath,
+	)
+
+	logCommand(cmd)
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputFilePath)
+		return "", err
+	}
+	return outputFilePath, nil
+}
+
+// coverArtPath is the local file of the video's thumbnail, ok is false when
+// cover art is off, the video has no thumbnail or it isn't one of ours.
+func (cfg *apiConfig) coverArtPath(thumbnailURL *string) (string, bool) {
+	if !cfg.coverArt || thumbnailURL == nil {
+		return "", false
+	}
+	return cfg.thumbnailAssetPath(*thumbnailURL)
+}
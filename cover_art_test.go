@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// installCoverArtFFmpeg is installFakeFFmpeg with an ffmpeg that marks the
+// output of a cover art embed, so the stored file shows whether it got one.
+func installCoverArtFFmpeg(t *testing.T, cfg *apiConfig) string {
+	t.Helper()
+	installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+	logPath := filepath.Join(t.TempDir(), "ffmpeg.log")
+	cfg.ffmpegPath = fakeCommand(t, "ffmpeg", `echo "$@" >> `+logPath+`
+in=
+prev=
+for arg; do
+	if [ "$prev" = "-i" ] && [ -z "$in" ]; then in=$arg; fi
+	prev=$arg
+done
+cp "$in" "$arg"
+case "$*" in *attached_pic*) printf '[cover]' >> "$arg";; esac
+`)
+	return logPath
+}
+
+func TestCoverArtPath(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	ours := cfg.assetURL("thumb.png")
+	theirs := "https://example.com/thumb.png"
+
+	tests := []struct {
+		name      string
+		coverArt  bool
+		thumbnail *string
+		wantOK    bool
+	}{
+		{name: "off", coverArt: false, thumbnail: &ours, wantOK: false},
+		{name: "no thumbnail", coverArt: true, thumbnail: nil, wantOK: false},
+		{name: "someone else's thumbnail", coverArt: true, thumbnail: &theirs, wantOK: false},
+		{name: "our thumbnail", coverArt: true, thumbnail: &ours, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.coverArt = tt.coverArt
+			got, ok := cfg.coverArtPath(tt.thumbnail)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got != filepath.Join(cfg.assetsRoot, "thumb.png") {
+				t.Errorf("path = %q, want thumb.png in the assets dir", got)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoCoverArt(t *testing.T) {
+	tests := []struct {
+		name      string
+		coverArt  bool
+		thumbnail bool
+		wantCover bool
+	}{
+		{name: "embedded", coverArt: true, thumbnail: true, wantCover: true},
+		{name: "no thumbnail", coverArt: true, thumbnail: false, wantCover: false},
+		{name: "off", coverArt: false, thumbnail: true, wantCover: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.coverArt = tt.coverArt
+			logPath := installCoverArtFFmpeg(t, cfg)
+			video, token := newTestVideo(t, cfg)
+			var thumbnailPath string
+			if tt.thumbnail {
+				resp := uploadThumbnail(t, cfg, video.ID, token, nil)
+				thumbnailPath, _ = cfg.thumbnailAssetPath(*resp.ThumbnailURL)
+			}
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, _ := cfg.videoKeyFromURL(*stored.VideoURL)
+			obj, ok := mem.Lookup(key)
+			if !ok {
+				t.Fatalf("%s wasn't stored", key)
+			}
+			if got := bytes.HasSuffix(obj.Data, []byte("[cover]")); got != tt.wantCover {
+				t.Errorf("stored video has cover art = %v, want %v", got, tt.wantCover)
+			}
+
+			log, _ := os.ReadFile(logPath)
+			var embed string
+			for _, line := range strings.Split(string(log), "\n") {
+				if strings.Contains(line, "attached_pic") {
+					embed = line
+				}
+			}
+			if tt.wantCover && !strings.Contains(embed, "-i "+thumbnailPath) {
+				t.Errorf("embed command = %q, want the thumbnail %s as an input", embed, thumbnailPath)
+			}
+			if !tt.wantCover && embed != "" {
+				t.Errorf("unexpected embed command %q", embed)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// copyDuplicate stores video's object under key by copying an identical
+// object the user already has, which keeps the bytes inside the bucket.
+// Matches are found by the content hash recorded on upload, the video's
+// own previous upload included. copied is false when there's no match or
+// every match's object is gone, the caller uploads the content then.
+func (cfg *apiConfig) copyDuplicate(ctx context.Context, video database.Video, key string, opts ...func(*storage.PutOptions)) (copied bool, err error) {
+	matches, err := cfg.db.GetVideosByContentHash(video.UserID, video.ContentHash)
+	if err != nil {
+		return false, err
+	}
+	for _, match := range matches {
+		srcKey, ok := cfg.videoKeyFromURL(*match.VideoURL)
+		if !ok || srcKey == key {
+			continue
+		}
+		copyCtx, cancel := cfg.storageContext(ctx)
+		err := cfg.storage.Copy(copyCtx, srcKey, key, opts...)
+		cancel()
+		if errors.Is(err, storage.ErrNotFound) {
+			slog.Info("Identical object is gone, trying the next match", "src", srcKey)
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		slog.Info("Copied identical object instead of uploading", "video_id", video.ID, "src", srcKey, "key", key)
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// recordingStorage remembers which keys were uploaded and which copies
+// succeeded.
+type recordingStorage struct {
+	storage.Storage
+	mu     sync.Mutex
+	puts   []string
+	copies map[string]string
+}
+
+func (s *recordingStorage) Put(ctx context.Context, key string, r io.Reader, contentType string, opts ...func(*storage.PutOptions)) error {
+	s.mu.Lock()
+	s.puts = append(s.puts, key)
+	s.mu.Unlock()
+	return s.Storage.Put(ctx, key, r, contentType, opts...)
+}
+
+func (s *recordingStorage) Copy(ctx context.Context, srcKey, dstKey string, opts ...func(*storage.PutOptions)) error {
+	if err := s.Storage.Copy(ctx, srcKey, dstKey, opts...); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.copies[srcKey] = dstKey
+	s.mu.Unlock()
+	return nil
+}
+
+// uploadedVideo uploads data as video and returns its stored key.
+func uploadedVideo(t *testing.T, cfg *apiConfig, video database.Video, token string, data []byte) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", data, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload status = %d: %s", rec.Code, rec.Body)
+	}
+	stored, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := cfg.videoKeyFromURL(*stored.VideoURL)
+	return key
+}
+
+func TestHandlerUploadVideoDedupCopy(t *testing.T) {
+	tests := []struct {
+		name       string
+		dedupCopy  bool
+		second     string
+		sourceGone bool
+		wantCopy   bool
+	}{
+		{name: "identical content is copied", dedupCopy: true, second: "same video", wantCopy: true},
+		{name: "different content is uploaded", dedupCopy: true, second: "other video", wantCopy: false},
+		{name: "gone source falls back to an upload", dedupCopy: true, second: "same video", sourceGone: true, wantCopy: false},
+		{name: "deduplication off", dedupCopy: false, second: "same video", wantCopy: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.dedupCopy = tt.dedupCopy
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			first, token := newTestVideo(t, cfg)
+			second := newUserVideo(t, cfg, first)
+
+			firstKey := uploadedVideo(t, cfg, first, token, []byte("same video"))
+			if tt.sourceGone {
+				mem.Delete(context.Background(), firstKey)
+			}
+			rec := &recordingStorage{Storage: mem, copies: map[string]string{}}
+			cfg.storage = rec
+			secondKey := uploadedVideo(t, cfg, second, token, []byte(tt.second))
+
+			if secondKey == firstKey {
+				t.Fatalf("both videos stored under %s, want a key of its own", secondKey)
+			}
+			copied := rec.copies[firstKey] == secondKey
+			if copied != tt.wantCopy {
+				t.Errorf("copied from %s = %v, want %v (copies %v)", firstKey, copied, tt.wantCopy, rec.copies)
+			}
+			uploaded := false
+			for _, key := range rec.puts {
+				if strings.Contains(key, "staging/") {
+					uploaded = true
+				}
+			}
+			if uploaded == tt.wantCopy {
+				t.Errorf("content uploaded = %v, want %v (puts %v)", uploaded, !tt.wantCopy, rec.puts)
+			}
+			obj, ok := mem.Lookup(secondKey)
+			if !ok || string(obj.Data) != tt.second {
+				t.Errorf("stored %q, want %q", obj.Data, tt.second)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// checkDiskSpace rejects an upload of size bytes when writing it to dir
+// would leave less than cfg.minFreeDisk free. Processing writes several
+// copies of a video, failing up front beats running out of space halfway.
+// Unknown sizes count as zero. It responds itself, and records the rejection
+// against videoID, when it returns false.
+func (cfg *apiConfig) checkDiskSpace(w http.ResponseWriter, videoID uuid.UUID, dir string, size int64) bool {
+	if cfg.minFreeDisk <= 0 {
+		return true
+	}
+	free, err := freeDiskBytes(dir)
+	if err != nil {
+		// not knowing is no reason to turn uploads away
+		slog.Warn("Couldn't check free disk space", "dir", dir, "err", err)
+		return true
+	}
+	if free < uint64(cfg.minFreeDisk)+uint64(max(size, 0)) {
+		cfg.failUpload(w, videoID, http.StatusInsufficientStorage, "Not enough disk space to process the upload, try again later", fmt.Errorf("%d bytes free in %s", free, dir))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+func freeDiskBytes(dir string) (uint64, error) {
+	return 0, errors.New("free disk space isn't available on this platform")
+}
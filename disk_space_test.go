@@ -0,0 +1,114 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// Low space is simulated by asking for more headroom than the temp
+// directory has, relative to what it really has free.
+
+func TestCheckDiskSpace(t *testing.T) {
+	free, err := freeDiskBytes(os.TempDir())
+	if err != nil {
+		t.Skipf("can't stat the temp directory: %v", err)
+	}
+	const margin = 64 << 20
+	if free < 2*margin {
+		t.Skipf("only %d bytes free", free)
+	}
+	tests := []struct {
+		name        string
+		minFreeDisk int64
+		size        int64
+		want        bool
+	}{
+		{name: "check disabled", minFreeDisk: 0, size: math.MaxInt64, want: true},
+		{name: "plenty of space", minFreeDisk: 1, size: 1024, want: true},
+		{name: "unknown size fits", minFreeDisk: int64(free) - margin, size: -1, want: true},
+		{name: "upload fits", minFreeDisk: int64(free) - margin, size: 1 << 20, want: true},
+		{name: "upload doesn't fit", minFreeDisk: int64(free) - margin, size: 2 * margin, want: false},
+		{name: "too little left already", minFreeDisk: math.MaxInt64 / 2, size: 0, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.minFreeDisk = tt.minFreeDisk
+			video, _ := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			if got := cfg.checkDiskSpace(rec, video.ID, os.TempDir(), tt.size); got != tt.want {
+				t.Fatalf("checkDiskSpace = %v, want %v", got, tt.want)
+			}
+			if tt.want {
+				return
+			}
+			if rec.Code != http.StatusInsufficientStorage {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusInsufficientStorage)
+			}
+			events, err := cfg.db.GetUploadEvents(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0].Event != database.UploadEventFailed {
+				t.Errorf("upload events = %+v, want the rejection", events)
+			}
+		})
+	}
+}
+
+func TestHandlersRejectLowDiskSpace(t *testing.T) {
+	tests := []struct {
+		name     string
+		lowSpace bool
+		upload   func(t *testing.T, cfg *apiConfig) int
+		wantCode int
+	}{
+		{name: "multipart upload", upload: uploadMultipart, wantCode: http.StatusOK},
+		{name: "multipart upload on a full disk", lowSpace: true, upload: uploadMultipart, wantCode: http.StatusInsufficientStorage},
+		{name: "tus upload", upload: uploadTus, wantCode: http.StatusCreated},
+		{name: "tus upload on a full disk", lowSpace: true, upload: uploadTus, wantCode: http.StatusInsufficientStorage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.minFreeDisk = 1
+			if tt.lowSpace {
+				cfg.minFreeDisk = math.MaxInt64 / 2
+			}
+			logPath := installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+
+			if got := tt.upload(t, cfg); got != tt.wantCode {
+				t.Fatalf("status = %d, want %d", got, tt.wantCode)
+			}
+			if !tt.lowSpace {
+				return
+			}
+			if _, err := os.Stat(logPath); err == nil {
+				t.Error("a rejected upload was processed")
+			}
+			if keys := mem.Keys(); len(keys) != 0 {
+				t.Errorf("stored %v for a rejected upload", keys)
+			}
+		})
+	}
+}
+
+func uploadMultipart(t *testing.T, cfg *apiConfig) int {
+	video, token := newTestVideo(t, cfg)
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil))
+	return rec.Code
+}
+
+func uploadTus(t *testing.T, cfg *apiConfig) int {
+	video, token := newTestVideo(t, cfg)
+	return tusCreate(cfg, video.ID, token, 1024, "").Code
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"mime"
+	"strings"
+	"unicode"
+)
+
+// downloadDisposition builds an attachment Content-Disposition naming the
+// file after title. Characters that are awkward in file names are replaced,
+// non-ASCII titles are encoded by mime.FormatMediaType.
+func downloadDisposition(title, ext string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if name == "" {
+		name = "video"
+	}
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name + ext})
+}
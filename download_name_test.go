@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestDownloadDisposition(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		ext   string
+		want  string
+	}{
+		{name: "plain title", title: "Boots", ext: ".mp4", want: "attachment; filename=Boots.mp4"},
+		{name: "spaces are quoted", title: "My video", ext: ".mp4", want: `attachment; filename="My video.mp4"`},
+		{name: "path separators", title: `a/b\c`, ext: ".mp4", want: "attachment; filename=a_b_c.mp4"},
+		{name: "control characters", title: "a\nb", ext: ".mp4", want: "attachment; filename=a_b.mp4"},
+		{name: "empty title", title: "  ", ext: ".mov", want: "attachment; filename=video.mov"},
+		{name: "non ascii", title: "Café", ext: ".mp4", want: "attachment; filename*=utf-8''Caf%C3%A9.mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := downloadDisposition(tt.title, tt.ext); got != tt.want {
+				t.Errorf("downloadDisposition(%q, %q) = %q, want %q", tt.title, tt.ext, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// checkProcessedDuration re-probes a processed file and compares its
+// duration with the source's. Remuxing with -c copy shouldn't change it,
+// when it moves by more than cfg.durationTolerance the timestamps were
+// likely mangled. Sources without a known duration can't be checked.
+func (cfg *apiConfig) checkProcessedDuration(processedPath string, sourceDuration float64) error {
+	if cfg.durationTolerance <= 0 || sourceDuration <= 0 {
+		return nil
+	}
+	probe, err := cfg.probeVideo(processedPath)
+	if err != nil {
+		return fmt.Errorf("couldn't probe processed video: %w", err)
+	}
+	if durationMismatch(sourceDuration, probe.Duration, cfg.durationTolerance) {
+		return fmt.Errorf("processed video lasts %.3fs, the upload %.3fs", probe.Duration, sourceDuration)
+	}
+	return nil
+}
+
+func durationMismatch(source, processed float64, tolerance time.Duration) bool {
+	return math.Abs(processed-source) > tolerance.Seconds()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// probeWithDuration is fakeProbe lasting duration seconds.
+func probeWithDuration(duration float64) string {
+	return strings.Replace(fakeProbe(320, 180), `"duration": "10.000000"`, fmt.Sprintf(`"duration": "%f"`, duration), 1)
+}
+
+// installDurationProbe makes ffprobe report sourceDuration for uploads and
+// processedDuration for the faststart output.
+func installDurationProbe(t *testing.T, cfg *apiConfig, sourceDuration, processedDuration float64) {
+	t.Helper()
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "source.json")
+	processedPath := filepath.Join(dir, "processed.json")
+	if err := os.WriteFile(sourcePath, []byte(probeWithDuration(sourceDuration)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(processedPath, []byte(probeWithDuration(processedDuration)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.ffprobePath = fakeCommand(t, "ffprobe", `for arg; do
+	case "$arg" in
+	*tubely-processed-*) cat `+processedPath+`; exit 0 ;;
+	esac
+done
+cat `+sourcePath+"\n")
+}
+
+func TestDurationMismatch(t *testing.T) {
+	tests := []struct {
+		name              string
+		source, processed float64
+		tolerance         time.Duration
+		want              bool
+	}{
+		{name: "identical", source: 10, processed: 10, tolerance: 500 * time.Millisecond},
+		{name: "within tolerance", source: 10, processed: 10.4, tolerance: 500 * time.Millisecond},
+		{name: "shorter within tolerance", source: 10, processed: 9.6, tolerance: 500 * time.Millisecond},
+		{name: "longer", source: 10, processed: 11, tolerance: 500 * time.Millisecond, want: true},
+		{name: "shorter", source: 10, processed: 4, tolerance: 500 * time.Millisecond, want: true},
+		{name: "lost entirely", source: 10, processed: 0, tolerance: time.Second, want: true},
+		{name: "zero tolerance", source: 10, processed: 10.001, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := durationMismatch(tt.source, tt.processed, tt.tolerance); got != tt.want {
+				t.Errorf("durationMismatch(%v, %v, %v) = %v, want %v", tt.source, tt.processed, tt.tolerance, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckProcessedDuration(t *testing.T) {
+	tests := []struct {
+		name              string
+		source, processed float64
+		tolerance         time.Duration
+		wantErr           bool
+	}{
+		{name: "matches", source: 10, processed: 10.2, tolerance: 500 * time.Millisecond},
+		{name: "diverges", source: 10, processed: 5, tolerance: 500 * time.Millisecond, wantErr: true},
+		{name: "check disabled", source: 10, processed: 5},
+		{name: "unknown source duration", source: 0, processed: 5, tolerance: 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.durationTolerance = tt.tolerance
+			installDurationProbe(t, cfg, tt.source, tt.processed)
+			err := cfg.checkProcessedDuration(filepath.Join(t.TempDir(), "tubely-processed-1.mp4"), tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkProcessedDuration err = %v, want one %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoDurationCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		processed   float64
+		strict      bool
+		wantCode    int
+		wantWarning bool
+	}{
+		{name: "matching duration", processed: 10, wantCode: http.StatusOK},
+		{name: "matching duration in strict mode", processed: 10.1, strict: true, wantCode: http.StatusOK},
+		{name: "diverging duration is logged", processed: 3, wantCode: http.StatusOK, wantWarning: true},
+		{name: "diverging duration fails in strict mode", processed: 3, strict: true, wantCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.durationCheckStrict = tt.strict
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			installDurationProbe(t, cfg, 10, tt.processed)
+			video, token := newTestVideo(t, cfg)
+
+			buf := &bytes.Buffer{}
+			defer slog.SetDefault(slog.Default())
+			slog.SetDefault(slog.New(slog.NewTextHandler(buf, nil)))
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			warned := strings.Contains(buf.String(), "duration doesn't match")
+			if warned != tt.wantWarning {
+				t.Errorf("warning logged = %v, want %v", warned, tt.wantWarning)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotURL := stored.VideoURL != nil; gotURL != (tt.wantCode == http.StatusOK) {
+				t.Errorf("video URL set = %v after a %d", gotURL, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// encodingProfile holds the libx264 settings variants are encoded with.
+// Screencasts keep text sharp with a slower preset and a sharper scaler,
+// motion-heavy video trades some of that for bitrate where it moves.
+type encodingProfile struct {
+	name   string
+	preset string
+	crf    int
+	// tune is left out of the command when empty
+	tune string
+	// scaler picks the swscale algorithm, ffmpeg's bicubic when empty
+	scaler string
+}
+
+// defaultEncodingProfiles are the profiles uploads and categories can pick
+// from, by name.
+func defaultEncodingProfiles() map[string]encodingProfile {
+	return map[string]encodingProfile{
+		"baseline":   {name: "baseline", preset: "veryfast", crf: 23},
+		"screencast": {name: "screencast", preset: "medium", crf: 20, tune: "stillimage", scaler: "lanczos"},
+		"motion":     {name: "motion", preset: "fast", crf: 21, tune: "film"},
+	}
+}
+
+func encodingProfileNames(profiles map[string]encodingProfile) string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// parseCategoryEncodingProfiles reads a comma separated CATEGORY=PROFILE
+// list such as "tutorials=screencast,sports=motion", naming profiles from
+// available.
+func parseCategoryEncodingProfiles(spec string, available map[string]encodingProfile) (map[string]encodingProfile, error) {
+	profiles := map[string]encodingProfile{}
+	if strings.TrimSpace(spec) == "" {
+		return profiles, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		category, name, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || category == "" {
+			return nil, fmt.Errorf("invalid mapping %q, expected CATEGORY=PROFILE", pair)
+		}
+		profile, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q for category %s, expected one of %s", name, category, encodingProfileNames(available))
+		}
+		profiles[category] = profile
+	}
+	return profiles, nil
+}
+
+// encodingProfileFor is the profile a video of the given category is
+// encoded with unless the upload picks one itself.
+func (cfg *apiConfig) encodingProfileFor(category string) encodingProfile {
+	if profile, ok := cfg.categoryEncodingProfiles[category]; ok {
+		return profile
+	}
+	return cfg.encodingProfile
+}
+
+// uploadEncodingProfile is the profile an upload of a video in category is
+// encoded with, the one named by the upload's encoding_profile when it has
+// one. It reports false for unknown names.
+func (cfg *apiConfig) uploadEncodingProfile(category, name string) (encodingProfile, bool) {
+	if name == "" {
+		return cfg.encodingProfileFor(category), true
+	}
+	profile, ok := cfg.encodingProfiles[name]
+	return profile, ok
+}
+
+func (cfg *apiConfig) encodingProfileMessage(name string) string {
+	return fmt.Sprintf("Unknown encoding_profile %q, expected one of %s", name, encodingProfileNames(cfg.encodingProfiles))
+}
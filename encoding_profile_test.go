@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeArgs(t *testing.T) {
+	profiles := defaultEncodingProfiles()
+	v := Variant{Name: "720p", Height: 720}
+
+	tests := []struct {
+		name    string
+		profile string
+		width   int
+		height  int
+		want    []string
+	}{
+		{name: "baseline", profile: "baseline", width: 1920, height: 1080, want: []string{
+			"-vf", "scale=-2:720", "-c:v", "libx264", "-preset", "veryfast", "-crf", "23",
+		}},
+		{name: "screencast", profile: "screencast", width: 1920, height: 1080, want: []string{
+			"-vf", "scale=-2:720:flags=lanczos", "-c:v", "libx264", "-preset", "medium", "-crf", "20", "-tune", "stillimage",
+		}},
+		{name: "motion", profile: "motion", width: 1920, height: 1080, want: []string{
+			"-vf", "scale=-2:720", "-c:v", "libx264", "-preset", "fast", "-crf", "21", "-tune", "film",
+		}},
+		{name: "portrait screencast", profile: "screencast", width: 1080, height: 1920, want: []string{
+			"-vf", "scale=720:-2:flags=lanczos", "-c:v", "libx264", "-preset", "medium", "-crf", "20", "-tune", "stillimage",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := v.encodeArgs(tt.width, tt.height, profiles[tt.profile]); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("encodeArgs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCategoryEncodingProfiles(t *testing.T) {
+	profiles := defaultEncodingProfiles()
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", spec: "", want: map[string]string{}},
+		{name: "several", spec: "tutorials=screencast, sports=motion", want: map[string]string{"tutorials": "screencast", "sports": "motion"}},
+		{name: "missing profile", spec: "tutorials", wantErr: true},
+		{name: "missing category", spec: "=motion", wantErr: true},
+		{name: "unknown profile", spec: "tutorials=sharp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCategoryEncodingProfiles(tt.spec, profiles)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			names := map[string]string{}
+			for category, profile := range got {
+				names[category] = profile.name
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("profiles = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadEncodingProfile(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	cfg.categoryEncodingProfiles = map[string]encodingProfile{"tutorials": cfg.encodingProfiles["screencast"]}
+
+	tests := []struct {
+		name     string
+		category string
+		profile  string
+		want     string
+		wantOK   bool
+	}{
+		{name: "default", want: "baseline", wantOK: true},
+		{name: "unmapped category", category: "music", want: "baseline", wantOK: true},
+		{name: "mapped category", category: "tutorials", want: "screencast", wantOK: true},
+		{name: "upload overrides category", category: "tutorials", profile: "motion", want: "motion", wantOK: true},
+		{name: "unknown name", profile: "sharp", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := cfg.uploadEncodingProfile(tt.category, tt.profile)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got.name != tt.want {
+				t.Errorf("profile = %q, want %q", got.name, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoEncodingProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   map[string]string
+		wantCode int
+		wantArgs string
+	}{
+		{name: "baseline by default", wantCode: http.StatusOK, wantArgs: "-preset veryfast -crf 23"},
+		{name: "by category", values: map[string]string{"category": "tutorials"}, wantCode: http.StatusOK, wantArgs: "-preset medium -crf 20 -tune stillimage"},
+		{name: "by form field", values: map[string]string{"category": "tutorials", "encoding_profile": "motion"}, wantCode: http.StatusOK, wantArgs: "-preset fast -crf 21 -tune film"},
+		{name: "unknown name", values: map[string]string{"encoding_profile": "sharp"}, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.videoCategories = []string{"tutorials"}
+			cfg.categoryEncodingProfiles = map[string]encodingProfile{"tutorials": cfg.encodingProfiles["screencast"]}
+			logPath := installFakeFFmpeg(t, cfg, fakeProbe(1920, 1080))
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), tt.values))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantArgs == "" {
+				return
+			}
+			log, err := os.ReadFile(logPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encodes := 0
+			for _, line := range strings.Split(string(log), "\n") {
+				if !strings.Contains(line, "libx264") {
+					continue
+				}
+				encodes++
+				if !strings.Contains(line, tt.wantArgs) {
+					t.Errorf("ffmpeg %s, want %q", line, tt.wantArgs)
+				}
+			}
+			if encodes == 0 {
+				t.Errorf("no variant was encoded:\n%s", log)
+			}
+		})
+	}
+}
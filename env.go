@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func loadEnv(name string) string {
+	env := os.Getenv(name)
+	if env == "" {
+		log.Fatalf("%s environment variable is not set", name)
+	}
+	return env
+}
+
+func loadEnvDefault(name, fallback string) string {
+	env := os.Getenv(name)
+	if env == "" {
+		return fallback
+	}
+	return env
+}
+
+func loadEnvInt(name string, fallback int) int {
+	env := os.Getenv(name)
+	if env == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(env)
+	if err != nil {
+		log.Fatalf("%s environment variable must be an integer: %v", name, err)
+	}
+	return n
+}
+
+func loadEnvBool(name string, fallback bool) bool {
+	env := os.Getenv(name)
+	if env == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(env)
+	if err != nil {
+		log.Fatalf("%s environment variable must be a boolean: %v", name, err)
+	}
+	return b
+}
+
+func loadEnvFloat(name string, fallback float64) float64 {
+	env := os.Getenv(name)
+	if env == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(env, 64)
+	if err != nil {
+		log.Fatalf("%s environment variable must be a number: %v", name, err)
+	}
+	return f
+}
+
+func loadEnvDuration(name string, fallback time.Duration) time.Duration {
+	env := os.Getenv(name)
+	if env == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(env)
+	if err != nil {
+		log.Fatalf("%s environment variable must be a duration: %v", name, err)
+	}
+	return d
+}
+
+// loadEnvList reads a comma separated list, skipping blank entries.
+func loadEnvList(name string, fallback []string) []string {
+	var list []string
+	for _, field := range strings.Split(os.Getenv(name), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			list = append(list, field)
+		}
+	}
+	if len(list) == 0 {
+		return fallback
+	}
+	return list
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// handlerAdminUserTenant moves a user into a tenant. Their future uploads
+// are stored under the tenant's key prefix, objects they already have stay
+// where they are. Admins inside a tenant are confined to it, they can only
+// manage its users and only put them in it. No admin can move themselves.
+func (cfg *apiConfig) handlerAdminUserTenant(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		TenantID string `json:"tenant_id"`
+	}
+
+	targetID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+	if !cfg.isAdmin(userID) {
+		respondWithError(w, http.StatusForbidden, "Admin access required", nil)
+		return
+	}
+
+	params := parameters{}
+	if verr := decodeJSONBody(r, &params); verr != nil {
+		respondWithValidationError(w, verr)
+		return
+	}
+	if params.TenantID != "" && !tenantIDPattern.MatchString(params.TenantID) {
+		respondWithError(w, http.StatusBadRequest, "tenant_id must be lowercase letters, digits and dashes", nil)
+		return
+	}
+	if targetID == userID {
+		respondWithError(w, http.StatusForbidden, "You can't change your own tenant", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUser(targetID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found", nil)
+		return
+	}
+	callerTenant, err := cfg.userTenant(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if callerTenant != "" && (user.TenantID != callerTenant || params.TenantID != callerTenant) {
+		respondWithError(w, http.StatusForbidden, "You can only manage users of your own tenant", nil)
+		return
+	}
+	if err := cfg.db.SetUserTenant(targetID, params.TenantID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
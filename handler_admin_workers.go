@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+func (cfg *apiConfig) handlerAdminWorkers(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+	if !cfg.isAdmin(userID) {
+		respondWithError(w, http.StatusForbidden, "Admin access required", nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.workers.stats())
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// directUploadPrefix is where browsers put files they upload straight to the
+// bucket, one folder per video inside its tenant's prefix.
+func directUploadPrefix(tenantID string, videoID uuid.UUID) string {
+	return fmt.Sprintf("%sdirect/%s/", tenantKeyPrefix(tenantID), videoID)
+}
+
+// handlerDirectUploadPolicy signs a POST policy that lets the browser upload
+// the video straight to the bucket. Size and content type are enforced by the
+// bucket itself. Once the upload went through, the client hands the key to
+// handlerDirectUploadCommit.
+func (cfg *apiConfig) handlerDirectUploadPolicy(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		storage.PresignedPost
+		Key       string    `json:"key"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	presigner, ok := cfg.storage.(storage.PostPresigner)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Storage backend doesn't support direct uploads", nil)
+		return
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't upload to this video", nil)
+		return
+	}
+	if !cfg.checkVideoQuota(w, video) {
+		return
+	}
+
+	tenant, err := cfg.userTenant(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get tenant", err)
+		return
+	}
+	key := directUploadPrefix(tenant, videoID) + uuid.New().String() + ".mp4"
+	expiresAt := time.Now().UTC().Add(cfg.uploadPolicyTTL)
+	post, err := presigner.PresignPost(r.Context(), key, cfg.uploadPolicyTTL, storage.PostPolicy{
+		MaxSize:           cfg.maxUploadSize,
+		ContentTypePrefix: cfg.uploadPolicyTypePrefix,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign upload policy", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		PresignedPost: post,
+		Key:           key,
+		ExpiresAt:     expiresAt,
+	})
+}
+
+// handlerDirectUploadCommit processes a video the browser uploaded under a
+// policy from handlerDirectUploadPolicy, just like a regular upload. The
+// uploaded object is removed afterwards either way.
+func (cfg *apiConfig) handlerDirectUploadCommit(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Key             string `json:"key" validate:"required"`
+		Category        string `json:"category"`
+		EncodingProfile string `json:"encoding_profile"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	// rejections end up in the audit trail like failures further in
+	fail := func(code int, msg string, err error) {
+		cfg.failUpload(w, videoID, code, msg, err)
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		fail(http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		fail(http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	params := parameters{}
+	if verr := decodeJSONBody(r, &params); verr != nil {
+		respondWithValidationError(w, verr)
+		return
+	}
+	// only keys we handed out for this video, nothing else in the bucket
+	key, err := sanitizeKey(params.Key)
+	if err != nil {
+		fail(http.StatusBadRequest, "Invalid key", err)
+		return
+	}
+	tenant, err := cfg.userTenant(userID)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Couldn't get tenant", err)
+		return
+	}
+	name, ok := strings.CutPrefix(key, directUploadPrefix(tenant, videoID))
+	if !ok || name == "" || strings.Contains(name, "/") {
+		fail(http.StatusBadRequest, "Key doesn't belong to this video", nil)
+		return
+	}
+
+	if !cfg.uploadLimiter.acquire(userID) {
+		fail(http.StatusTooManyRequests, "Too many uploads in progress", nil)
+		return
+	}
+	defer cfg.uploadLimiter.release(userID)
+
+	metadata, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		fail(http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if metadata.UserID != userID {
+		fail(http.StatusForbidden, "You can't upload to this video", nil)
+		return
+	}
+	if !cfg.checkVideoQuota(w, metadata) {
+		return
+	}
+
+	if params.Category != "" {
+		if !cfg.validCategory(params.Category) {
+			fail(http.StatusBadRequest, cfg.categoryMessage(), nil)
+			return
+		}
+		metadata.Category = params.Category
+	}
+	encoding, ok := cfg.uploadEncodingProfile(metadata.Category, params.EncodingProfile)
+	if !ok {
+		fail(http.StatusBadRequest, cfg.encodingProfileMessage(params.EncodingProfile), nil)
+		return
+	}
+
+	headCtx, cancel := cfg.storageContext(r.Context())
+	info, err := cfg.storage.Head(headCtx, key)
+	cancel()
+	if errors.Is(err, storage.ErrNotFound) {
+		fail(http.StatusNotFound, "Nothing was uploaded under this key", err)
+		return
+	}
+	if err != nil {
+		fail(http.StatusInternalServerError, "Couldn't check upload", err)
+		return
+	}
+	if !cfg.checkDiskSpace(w, videoID, os.TempDir(), info.Size) {
+		return
+	}
+	defer func() {
+		// cleanup has to happen even if the request was cancelled
+		ctx, cancel := cfg.storageContext(context.Background())
+		defer cancel()
+		if err := cfg.storage.Delete(ctx, key); err != nil {
+			slog.Warn("Couldn't delete direct upload", "key", key, "err", err)
+		}
+	}()
+
+	mediaType, _, err := mime.ParseMediaType(info.ContentType)
+	if err != nil {
+		fail(http.StatusBadRequest, "Unable to get mediaType", err)
+		return
+	}
+	if mediaType != "video/mp4" {
+		fail(http.StatusBadRequest, "Only video/mp4 uploads are supported", nil)
+		return
+	}
+
+	uploadPath, err := cfg.downloadToTemp(r.Context(), key)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Couldn't download upload", err)
+		return
+	}
+	defer os.Remove(uploadPath)
+	file, err := os.Open(uploadPath)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Couldn't read upload", err)
+		return
+	}
+	defer file.Close()
+
+	cfg.processUpload(w, r, metadata, file, mediaType, path.Base(key), cfg.outputProfile, encoding)
+}
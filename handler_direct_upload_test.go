@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// postStorage is a MemoryStorage that also signs form uploads, recording
+// the policy it was asked to sign.
+type postStorage struct {
+	*storage.MemoryStorage
+	policy storage.PostPolicy
+}
+
+func (s *postStorage) PresignPost(ctx context.Context, key string, ttl time.Duration, policy storage.PostPolicy) (storage.PresignedPost, error) {
+	s.policy = policy
+	return storage.PresignedPost{
+		URL:    "https://bucket.example.com",
+		Fields: map[string]string{"key": key, "policy": "signed"},
+	}, nil
+}
+
+func TestHandlerDirectUploadPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		presigns  bool
+		otherUser bool
+		wantCode  int
+	}{
+		{name: "signs a policy", presigns: true, wantCode: http.StatusOK},
+		{name: "someone else's video", presigns: true, otherUser: true, wantCode: http.StatusForbidden},
+		{name: "backend without form uploads", wantCode: http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.maxUploadSize = 1 << 20
+			cfg.uploadPolicyTTL = 15 * time.Minute
+			cfg.uploadPolicyTypePrefix = "video/mp4"
+			store := &postStorage{MemoryStorage: mem}
+			if tt.presigns {
+				cfg.storage = store
+			}
+			video, token := newTestVideo(t, cfg)
+			if tt.otherUser {
+				_, token = newTestVideo(t, cfg)
+			}
+
+			req := newVideoRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/direct-upload", video.ID, nil, token)
+			rec := httptest.NewRecorder()
+			cfg.handlerDirectUploadPolicy(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				URL       string            `json:"url"`
+				Fields    map[string]string `json:"fields"`
+				Key       string            `json:"key"`
+				ExpiresAt time.Time         `json:"expires_at"`
+			}
+			decodeData(t, rec, &resp)
+			if !strings.HasPrefix(resp.Key, directUploadPrefix("", video.ID)) || resp.Fields["key"] != resp.Key {
+				t.Errorf("key = %q, fields = %v, want a key under %s", resp.Key, resp.Fields, directUploadPrefix("", video.ID))
+			}
+			if store.policy.MaxSize != 1<<20 || store.policy.ContentTypePrefix != "video/mp4" {
+				t.Errorf("policy = %+v, want at most %d bytes of video/mp4", store.policy, 1<<20)
+			}
+			if until := time.Until(resp.ExpiresAt); until <= 14*time.Minute || until > 15*time.Minute {
+				t.Errorf("policy expires in %v, want 15m", until)
+			}
+		})
+	}
+}
+
+func TestHandlerDirectUploadCommit(t *testing.T) {
+	tests := []struct {
+		name string
+		// key is what the client commits, relative to the video's direct
+		// upload prefix unless it starts with /
+		key         string
+		contentType string
+		upload      bool
+		wantCode    int
+	}{
+		{name: "uploaded video", key: "abc.mp4", contentType: "video/mp4", upload: true, wantCode: http.StatusOK},
+		{name: "nothing uploaded", key: "abc.mp4", wantCode: http.StatusNotFound},
+		{name: "not mp4", key: "abc.mp4", contentType: "video/webm", upload: true, wantCode: http.StatusBadRequest},
+		{name: "key outside the prefix", key: "/landscape/abc.mp4", contentType: "video/mp4", upload: true, wantCode: http.StatusBadRequest},
+		{name: "nested key", key: "a/abc.mp4", contentType: "video/mp4", upload: true, wantCode: http.StatusBadRequest},
+		{name: "traversal out of the prefix", key: "../../landscape/abc.mp4", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			video, token := newTestVideo(t, cfg)
+			key := directUploadPrefix("", video.ID) + tt.key
+			if strings.HasPrefix(tt.key, "/") {
+				key = tt.key[1:]
+			}
+			if tt.upload {
+				mem.Put(context.Background(), key, strings.NewReader("fake video"), tt.contentType)
+			}
+
+			body := strings.NewReader(`{"key": "` + key + `"}`)
+			req := newVideoRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/direct-upload/commit", video.ID, body, token)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cfg.handlerDirectUploadCommit(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+
+			_, stillThere := mem.Lookup(key)
+			// only uploads of this video are ever touched, and those are
+			// removed processed or not
+			wantThere := strings.Contains(tt.key, "/")
+			if tt.upload && stillThere != wantThere {
+				t.Errorf("uploaded object kept = %v, want %v", stillThere, wantThere)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.VideoURL == nil {
+				t.Error("video URL wasn't set")
+			}
+		})
+	}
+}
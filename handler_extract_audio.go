@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+type audioFormat struct {
+	codec       string
+	extension   string
+	contentType string
+}
+
+var audioFormats = map[string]audioFormat{
+	"aac": {codec: "aac", extension: "m4a", contentType: "audio/mp4"},
+	"mp3": {codec: "libmp3lame", extension: "mp3", contentType: "audio/mpeg"},
+}
+
+func (cfg *apiConfig) extractAudio(filePath string, format audioFormat) (string, error) {
+	outputFilePath, err := tempOutputPath(filePath, "tubely-audio-*."+format.extension)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command(
+		cfg.ffmpegPath,
+		"-y",
+		"-i", filePath,
+		"-vn",
+		"-c:a", format.codec,
+		outputFilePath,
+	)
+
+	logCommand(cmd)
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputFilePath)
+		return "", err
+	}
+	return outputFilePath, nil
+}
+
+// audioKey places the audio track under the audio/ prefix, mirroring the
+// video's own key, e.g. landscape/abc.mp4 becomes audio/landscape/abc.m4a.
+func audioKey(videoKey string, format audioFormat) string {
+	base := strings.TrimSuffix(videoKey, path.Ext(videoKey))
+	return fmt.Sprintf("audio/%s.%s", base, format.extension)
+}
+
+func (cfg *apiConfig) handlerExtractAudio(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		AudioURL string `json:"audio_url"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't extract audio from this video", nil)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video hasn't been uploaded yet", nil)
+		return
+	}
+	key, ok := cfg.videoKeyFromURL(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't locate video object", nil)
+		return
+	}
+
+	videoPath, err := cfg.downloadToTemp(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video object is missing", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't download video", err)
+		return
+	}
+	defer os.Remove(videoPath)
+
+	probe, err := cfg.probeVideo(videoPath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to probe video", err)
+		return
+	}
+	if !probe.HasAudio {
+		respondWithError(w, http.StatusUnprocessableEntity, "Video has no audio stream", nil)
+		return
+	}
+
+	audioPath, err := cfg.extractAudio(videoPath, cfg.audioFormat)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't extract audio", err)
+		return
+	}
+	defer os.Remove(audioPath)
+
+	audioFile, err := os.Open(audioPath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't extract audio", err)
+		return
+	}
+	defer audioFile.Close()
+	length, err := contentLength(audioFile)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't extract audio", err)
+		return
+	}
+
+	objectKey := audioKey(key, cfg.audioFormat)
+	if err = cfg.storePromoted(r.Context(), objectKey, audioFile, cfg.audioFormat.contentType, length); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store audio", err)
+		return
+	}
+
+	audioURL, _, err := cfg.presignGet(r.Context(), objectKey, cfg.presignTTL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign audio URL", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response{
+		AudioURL: audioURL,
+	})
+}
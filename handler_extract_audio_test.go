@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAudioKey(t *testing.T) {
+	tests := []struct {
+		key    string
+		format string
+		want   string
+	}{
+		{key: "landscape/abc.mp4", format: "aac", want: "audio/landscape/abc.m4a"},
+		{key: "landscape/abc.mp4", format: "mp3", want: "audio/landscape/abc.mp3"},
+		{key: "tenants/t1/portrait/abc.mov", format: "aac", want: "audio/tenants/t1/portrait/abc.m4a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+" "+tt.format, func(t *testing.T) {
+			if got := audioKey(tt.key, audioFormats[tt.format]); got != tt.want {
+				t.Errorf("audioKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractAudio(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		fail      bool
+		wantCodec string
+		wantExt   string
+	}{
+		{name: "aac", format: "aac", wantCodec: "-c:a aac", wantExt: ".m4a"},
+		{name: "mp3", format: "mp3", wantCodec: "-c:a libmp3lame", wantExt: ".mp3"},
+		{name: "ffmpeg fails", format: "aac", fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			dir := t.TempDir()
+			argsFile := filepath.Join(dir, "args")
+			script := `for last; do :; done; echo "$@" > ` + argsFile + `; printf audio > "$last"`
+			if tt.fail {
+				script = "exit 1"
+			}
+			cfg.ffmpegPath = fakeCommand(t, "ffmpeg", script)
+			videoPath := filepath.Join(dir, "video.mp4")
+
+			audioPath, err := cfg.extractAudio(videoPath, audioFormats[tt.format])
+			if tt.fail {
+				if err == nil {
+					t.Fatal("extractAudio succeeded with a failing ffmpeg")
+				}
+				entries, _ := os.ReadDir(dir)
+				if len(entries) != 0 {
+					t.Errorf("left files behind: %v", entries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractAudio: %v", err)
+			}
+			if filepath.Ext(audioPath) != tt.wantExt {
+				t.Errorf("output %s doesn't end in %s", audioPath, tt.wantExt)
+			}
+			args, err := os.ReadFile(argsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(args), "-i "+videoPath+" -vn "+tt.wantCodec) {
+				t.Errorf("ffmpeg args = %s, want the video stripped and %s", args, tt.wantCodec)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// handlerRestoreOriginal starts restoring a video's archived original upload,
+// the restored copy stays readable for the requested number of days.
+func (cfg *apiConfig) handlerRestoreOriginal(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Days int `json:"days"`
+	}
+
+	restorer, ok := cfg.storage.(storage.Restorer)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Storage backend doesn't support restores", nil)
+		return
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	params := parameters{Days: 7}
+	if verr := decodeJSONBody(r, &params); verr != nil {
+		respondWithValidationError(w, verr)
+		return
+	}
+	if params.Days < 1 {
+		respondWithError(w, http.StatusBadRequest, "Days must be at least 1", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't restore this video", nil)
+		return
+	}
+	if video.OriginalKey == "" {
+		respondWithError(w, http.StatusNotFound, "Video has no preserved original", nil)
+		return
+	}
+
+	ctx, cancel := cfg.storageContext(r.Context())
+	defer cancel()
+	err = restorer.Restore(ctx, video.OriginalKey, params.Days)
+	switch {
+	case errors.Is(err, storage.ErrNotArchived):
+		respondWithError(w, http.StatusConflict, "Original isn't archived, it can be read directly", err)
+		return
+	case errors.Is(err, storage.ErrRestoreInProgress):
+		respondWithError(w, http.StatusConflict, "Restore already in progress", err)
+		return
+	case errors.Is(err, storage.ErrNotFound):
+		respondWithError(w, http.StatusNotFound, "Original object is missing", err)
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore original", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
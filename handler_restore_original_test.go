@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+func TestHandlerRestoreOriginal(t *testing.T) {
+	tests := []struct {
+		name         string
+		storageClass string
+		noOriginal   bool
+		body         string
+		wantCode     int
+	}{
+		{name: "archived original", storageClass: "GLACIER", wantCode: http.StatusAccepted},
+		{name: "deep archive with days", storageClass: "DEEP_ARCHIVE", body: `{"days": 3}`, wantCode: http.StatusAccepted},
+		{name: "original isn't archived", storageClass: "STANDARD", wantCode: http.StatusConflict},
+		{name: "no original", noOriginal: true, wantCode: http.StatusNotFound},
+		{name: "days below one", storageClass: "GLACIER", body: `{"days": 0}`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+			if !tt.noOriginal {
+				video.OriginalKey = "originals/landscape/abc.mp4"
+				mem.Put(context.Background(), video.OriginalKey, strings.NewReader("video"), "video/mp4", storage.WithStorageClass(tt.storageClass))
+				if err := cfg.db.UpdateVideo(video); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			req := newVideoRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/original/restore", video.ID, strings.NewReader(tt.body), token)
+			rec := httptest.NewRecorder()
+			cfg.handlerRestoreOriginal(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			restored := slices.Contains(mem.Restores(), video.OriginalKey)
+			if restored != (tt.wantCode == http.StatusAccepted) {
+				t.Errorf("restore requested = %v after a %d", restored, rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoPreservesOriginal(t *testing.T) {
+	cfg, mem := newTestConfig(t)
+	cfg.preserveOriginals = true
+	cfg.originalsStorageClass = "GLACIER"
+	installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+	video, token := newTestVideo(t, cfg)
+
+	req := newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil)
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	stored, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored.OriginalKey, "originals/landscape/") {
+		t.Fatalf("OriginalKey = %q, want it under originals/", stored.OriginalKey)
+	}
+	obj, ok := mem.Lookup(stored.OriginalKey)
+	if !ok {
+		t.Fatalf("original %s wasn't stored, have %v", stored.OriginalKey, mem.Keys())
+	}
+	if obj.StorageClass != "GLACIER" || string(obj.Data) != "fake video" {
+		t.Errorf("original = %q in %s, want the upload in GLACIER", obj.Data, obj.StorageClass)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+const maxShareTTL = 30 * 24 * time.Hour
+
+func (cfg *apiConfig) handlerShareCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ExpiresInSeconds int `json:"expires_in_seconds"`
+	}
+	type response struct {
+		database.ShareToken
+		Token string `json:"token"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	params := parameters{}
+	if verr := decodeJSONBody(r, &params); verr != nil {
+		respondWithValidationError(w, verr)
+		return
+	}
+	ttl := cfg.shareTTL
+	if params.ExpiresInSeconds != 0 {
+		ttl = time.Duration(params.ExpiresInSeconds) * time.Second
+	}
+	if ttl <= 0 || ttl > maxShareTTL {
+		respondWithError(w, http.StatusBadRequest, "Share links must expire within 30 days", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't share this video", nil)
+		return
+	}
+
+	shareToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create share token", err)
+		return
+	}
+
+	share, err := cfg.db.CreateShareToken(database.CreateShareTokenParams{
+		VideoID:   videoID,
+		TokenHash: auth.HashToken(shareToken),
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save share token", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response{
+		ShareToken: share,
+		Token:      shareToken,
+	})
+}
+
+func (cfg *apiConfig) handlerShareRevoke(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+	shareIDString := r.PathValue("shareID")
+	shareID, err := uuid.Parse(shareIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid share ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't manage shares of this video", nil)
+		return
+	}
+
+	share, err := cfg.db.GetShareToken(shareID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get share", err)
+		return
+	}
+	if share.VideoID != videoID {
+		respondWithError(w, http.StatusNotFound, "Share not found", nil)
+		return
+	}
+
+	err = cfg.db.RevokeShareToken(shareID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke share", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerShareResolve turns a share token into a presigned video URL. It
+// needs no JWT, holding the token is what grants access. With download=true
+// the URL makes browsers download the video under its title.
+func (cfg *apiConfig) handlerShareResolve(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Title     string    `json:"title"`
+		VideoURL  string    `json:"video_url"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	share, err := cfg.db.GetShareTokenByHash(auth.HashToken(r.PathValue("shareToken")))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get share", err)
+		return
+	}
+	if share.ID == uuid.Nil || share.RevokedAt != nil || time.Now().After(share.ExpiresAt) {
+		respondWithError(w, http.StatusNotFound, "Share link is invalid or has expired", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(share.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.PublishState == database.VideoPublishDraft {
+		respondWithError(w, http.StatusNotFound, "Share link is invalid or has expired", nil)
+		return
+	}
+	if video.Expired(time.Now()) {
+		respondWithError(w, http.StatusGone, "Video has expired", nil)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video hasn't been uploaded yet", nil)
+		return
+	}
+	key, ok := cfg.videoKeyFromURL(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't locate video object", nil)
+		return
+	}
+
+	// never hand out a URL that outlives the share itself
+	ttl := min(cfg.presignTTL, time.Until(share.ExpiresAt))
+	opts := []func(*storage.PresignOptions){}
+	if r.URL.Query().Get("download") == "true" {
+		// make browsers save the file under the video's title
+		opts = append(opts, storage.WithResponseContentDisposition(downloadDisposition(video.Title, path.Ext(key))))
+	}
+	videoURL, expiresAt, err := cfg.presignGet(r.Context(), key, ttl, opts...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URL", err)
+		return
+	}
+
+	cfg.views.record(video.ID)
+
+	respondWithJSON(w, http.StatusOK, response{
+		Title:     video.Title,
+		VideoURL:  videoURL,
+		ExpiresAt: expiresAt.UTC(),
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerShareCreate(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		otherUser bool
+		wantCode  int
+	}{
+		{name: "default expiry", body: ``, wantCode: http.StatusCreated},
+		{name: "custom expiry", body: `{"expires_in_seconds": 3600}`, wantCode: http.StatusCreated},
+		{name: "negative expiry", body: `{"expires_in_seconds": -1}`, wantCode: http.StatusBadRequest},
+		{name: "beyond 30 days", body: `{"expires_in_seconds": 2678400}`, wantCode: http.StatusBadRequest},
+		{name: "someone else's video", otherUser: true, wantCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+			if tt.otherUser {
+				_, token = newTestVideo(t, cfg)
+			}
+
+			req := newVideoRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/share", video.ID, strings.NewReader(tt.body), token)
+			rec := httptest.NewRecorder()
+			cfg.handlerShareCreate(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
+
+func TestShareLifecycle(t *testing.T) {
+	cfg, mem := newTestConfig(t)
+	video, token := newTestVideo(t, cfg)
+	mem.Put(context.Background(), "landscape/abc.mp4", strings.NewReader("video"), "video/mp4")
+	videoURL := cfg.videoURL("landscape/abc.mp4")
+	video.VideoURL = &videoURL
+	video.PublishState = database.VideoPublishPublished
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		t.Fatal(err)
+	}
+
+	req := newVideoRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/share", video.ID, nil, token)
+	rec := httptest.NewRecorder()
+	cfg.handlerShareCreate(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body)
+	}
+	var share struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}
+	decodeData(t, rec, &share)
+
+	resolve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/shared/"+share.Token, nil)
+		req.SetPathValue("shareToken", share.Token)
+		rec := httptest.NewRecorder()
+		cfg.handlerShareResolve(rec, req)
+		return rec
+	}
+
+	rec = resolve()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("resolve status = %d: %s", rec.Code, rec.Body)
+	}
+	var resolved struct {
+		Title    string `json:"title"`
+		VideoURL string `json:"video_url"`
+	}
+	decodeData(t, rec, &resolved)
+	if resolved.Title != video.Title || !strings.HasPrefix(resolved.VideoURL, "memory://landscape/abc.mp4?") {
+		t.Errorf("resolved = %+v, want a presigned URL for the video", resolved)
+	}
+
+	req = newVideoRequest(http.MethodDelete, "/api/videos/"+video.ID.String()+"/share/"+share.ID, video.ID, nil, token)
+	req.SetPathValue("shareID", share.ID)
+	rec = httptest.NewRecorder()
+	cfg.handlerShareRevoke(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke status = %d: %s", rec.Code, rec.Body)
+	}
+
+	if rec := resolve(); rec.Code != http.StatusNotFound {
+		t.Errorf("resolving a revoked share status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandlerShareResolveDownload(t *testing.T) {
+	cfg, mem := newTestConfig(t)
+	video, token := newTestVideo(t, cfg)
+	mem.Put(context.Background(), "landscape/abc.mp4", strings.NewReader("video"), "video/mp4")
+	videoURL := cfg.videoURL("landscape/abc.mp4")
+	video.VideoURL = &videoURL
+	video.PublishState = database.VideoPublishPublished
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		t.Fatal(err)
+	}
+	req := newVideoRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/share", video.ID, nil, token)
+	rec := httptest.NewRecorder()
+	cfg.handlerShareCreate(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body)
+	}
+	var share struct {
+		Token string `json:"token"`
+	}
+	decodeData(t, rec, &share)
+
+	tests := []struct {
+		name            string
+		query           string
+		wantDisposition string
+	}{
+		{name: "streaming", query: ""},
+		{name: "download", query: "?download=true", wantDisposition: `attachment; filename="Test video.mp4"`},
+		{name: "download off", query: "?download=false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/shared/"+share.Token+tt.query, nil)
+			req.SetPathValue("shareToken", share.Token)
+			rec := httptest.NewRecorder()
+			cfg.handlerShareResolve(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var resolved struct {
+				VideoURL string `json:"video_url"`
+			}
+			decodeData(t, rec, &resolved)
+			u, err := url.Parse(resolved.VideoURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := u.Query().Get("response-content-disposition"); got != tt.wantDisposition {
+				t.Errorf("response-content-disposition = %q, want %q", got, tt.wantDisposition)
+			}
+		})
+	}
+}
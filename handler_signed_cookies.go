@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/cloudfront/sign"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// handlerVideoSignedCookies hands out CloudFront signed cookies covering every
+// object of a video (the primary file, its variants and any stream
+// segments), so players can fetch them without presigning each URL.
+func (cfg *apiConfig) handlerVideoSignedCookies(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	if cfg.cookieSigner == nil {
+		respondWithError(w, http.StatusNotImplemented, "Signed cookies aren't configured", nil)
+		return
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't access this video", nil)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video hasn't been uploaded yet", nil)
+		return
+	}
+	key, ok := cfg.videoKeyFromURL(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't locate video object", nil)
+		return
+	}
+
+	expiresAt := time.Now().UTC().Add(cfg.presignTTL)
+	policy := &sign.Policy{
+		Statements: []sign.Statement{{
+			Resource: cfg.videoURL(strings.TrimSuffix(key, path.Ext(key))) + "*",
+			Condition: sign.Condition{
+				DateLessThan: sign.NewAWSEpochTime(expiresAt),
+			},
+		}},
+	}
+
+	cookies, err := cfg.cookieSigner.SignWithPolicy(policy, func(o *sign.CookieOptions) {
+		o.Path = signedCookiePath(key)
+		o.Domain = cfg.cfCookieDomain
+		o.Secure = true
+		o.SameSite = http.SameSiteNoneMode
+		o.Expires = expiresAt
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign cookies", err)
+		return
+	}
+	for _, c := range cookies {
+		http.SetCookie(w, c)
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		ExpiresAt: expiresAt,
+	})
+}
+
+// signedCookiePath is the narrowest cookie path covering the objects of the
+// video stored at key. Browsers only match cookie paths on whole segments,
+// so it's the directory holding the video and its siblings, e.g.
+// landscape/abc.mp4 gives /landscape/, and the policy's resource keeps the
+// cookies from granting anything but that video. A key without a directory
+// gives /.
+func signedCookiePath(key string) string {
+	dir := path.Dir(key)
+	if dir == "." {
+		return "/"
+	}
+	return "/" + dir + "/"
+}
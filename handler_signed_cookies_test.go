@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/cloudfront/sign"
+)
+
+func TestSignedCookiePath(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "landscape/abc.mp4", want: "/landscape/"},
+		{key: "tenants/t1/portrait/abc.mp4", want: "/tenants/t1/portrait/"},
+		{key: "abc.mp4", want: "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := signedCookiePath(tt.key); got != tt.want {
+				t.Errorf("signedCookiePath(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerVideoSignedCookies(t *testing.T) {
+	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		noSigner  bool
+		otherUser bool
+		wantCode  int
+	}{
+		{name: "owner gets cookies", wantCode: http.StatusOK},
+		{name: "someone else's video", otherUser: true, wantCode: http.StatusForbidden},
+		{name: "not configured", noSigner: true, wantCode: http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			if !tt.noSigner {
+				cfg.cookieSigner = sign.NewCookieSigner("KEYPAIRID", privKey)
+			}
+			cfg.cfCookieDomain = "cdn.example.com"
+			video, token := newTestVideo(t, cfg)
+			if tt.otherUser {
+				_, token = newTestVideo(t, cfg)
+			}
+			mem.Put(context.Background(), "landscape/abc.mp4", strings.NewReader("video"), "video/mp4")
+			videoURL := cfg.videoURL("landscape/abc.mp4")
+			video.VideoURL = &videoURL
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+
+			req := newVideoRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/cookies", video.ID, nil, token)
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoSignedCookies(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			cookies := rec.Result().Cookies()
+			if tt.wantCode != http.StatusOK {
+				if len(cookies) != 0 {
+					t.Errorf("got cookies with a %d: %v", rec.Code, cookies)
+				}
+				return
+			}
+
+			names := map[string]bool{}
+			for _, c := range cookies {
+				names[c.Name] = true
+				if c.Path != "/landscape/" || c.Domain != "cdn.example.com" || !c.Secure {
+					t.Errorf("cookie %s has path %q, domain %q, secure %v", c.Name, c.Path, c.Domain, c.Secure)
+				}
+			}
+			for _, name := range []string{"CloudFront-Policy", "CloudFront-Signature", "CloudFront-Key-Pair-Id"} {
+				if !names[name] {
+					t.Errorf("missing %s cookie, got %v", name, names)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestHandlersMemoryStorage uploads a video and its thumbnail through the
+// handlers, backed by the in-memory storage newTestConfig sets up, and
+// reads the video back.
+func TestHandlersMemoryStorage(t *testing.T) {
+	tests := []struct {
+		name       string
+		width      int
+		height     int
+		wantPrefix string
+	}{
+		{name: "landscape", width: 1920, height: 1080, wantPrefix: "landscape/"},
+		{name: "portrait", width: 1080, height: 1920, wantPrefix: "portrait/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			installFakeFFmpeg(t, cfg, fakeProbe(tt.width, tt.height))
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("video upload status = %d: %s", rec.Code, rec.Body)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.VideoURL == nil {
+				t.Fatal("video URL wasn't set")
+			}
+			key, ok := cfg.videoKeyFromURL(*stored.VideoURL)
+			if !ok {
+				t.Fatalf("video URL %q doesn't name a stored object", *stored.VideoURL)
+			}
+			if !strings.HasPrefix(key, tt.wantPrefix) {
+				t.Errorf("key = %q, want prefix %q", key, tt.wantPrefix)
+			}
+			obj, ok := mem.Lookup(key)
+			if !ok {
+				t.Fatalf("object %q wasn't stored", key)
+			}
+			if string(obj.Data) != "fake video" || obj.ContentType != "video/mp4" {
+				t.Errorf("object = %q of %s, want %q of video/mp4", obj.Data, obj.ContentType, "fake video")
+			}
+
+			thumbnail := encodePNG(t, 64, 36)
+			rec = httptest.NewRecorder()
+			cfg.handlerUploadThumbnail(rec, newThumbnailRequest(t, video.ID, token, "image/png", thumbnail, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("thumbnail upload status = %d: %s", rec.Code, rec.Body)
+			}
+			stored, err = cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.ThumbnailURL == nil {
+				t.Fatal("thumbnail URL wasn't set")
+			}
+			filePath, ok := cfg.thumbnailAssetPath(*stored.ThumbnailURL)
+			if !ok {
+				t.Fatalf("thumbnail URL %q isn't an asset", *stored.ThumbnailURL)
+			}
+			if _, err := os.Stat(filePath); err != nil {
+				t.Errorf("thumbnail file: %v", err)
+			}
+
+			req := newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String(), video.ID, nil, token)
+			rec = httptest.NewRecorder()
+			cfg.handlerVideoGet(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET status = %d: %s", rec.Code, rec.Body)
+			}
+			var got videoResponse
+			decodeData(t, rec, &got)
+			if got.VideoURL == nil || *got.VideoURL != cfg.videoURL(key) {
+				t.Errorf("GET video URL = %v, want %s", got.VideoURL, cfg.videoURL(key))
+			}
+		})
+	}
+}
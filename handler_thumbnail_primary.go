@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// setPrimaryThumbnail makes the thumbnail the one the video shows.
+func setPrimaryThumbnail(video *database.Video, thumbnail database.VideoThumbnail) {
+	thumbnailURL := thumbnail.URL
+	video.ThumbnailURL = &thumbnailURL
+	video.ThumbnailSizes = thumbnail.Sizes
+	video.BlurHash = thumbnail.BlurHash
+}
+
+// handlerThumbnailPrimary picks which of the uploaded thumbnails the video
+// shows.
+func (cfg *apiConfig) handlerThumbnailPrimary(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ThumbnailID uuid.UUID `json:"thumbnail_id" validate:"required"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	params := parameters{}
+	if verr := decodeJSONBody(r, &params); verr != nil {
+		respondWithValidationError(w, verr)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't edit this video", nil)
+		return
+	}
+
+	thumbnail, err := cfg.db.GetVideoThumbnail(params.ThumbnailID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thumbnail", err)
+		return
+	}
+	if thumbnail.VideoID != videoID {
+		respondWithError(w, http.StatusNotFound, "Thumbnail not found", nil)
+		return
+	}
+
+	setPrimaryThumbnail(&video, thumbnail)
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	resp, err := cfg.videoDetailResponse(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list thumbnails", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// uploadThumbnail uploads a PNG thumbnail and returns the response.
+func uploadThumbnail(t *testing.T, cfg *apiConfig, videoID uuid.UUID, token string, values map[string]string) videoResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadThumbnail(rec, newThumbnailRequest(t, videoID, token, "image/png", encodePNG(t, 64, 36), values))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("thumbnail upload status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp videoResponse
+	decodeData(t, rec, &resp)
+	return resp
+}
+
+func TestHandlerUploadThumbnailCandidates(t *testing.T) {
+	tests := []struct {
+		name    string
+		uploads []map[string]string
+		// wantPrimary is the index of the upload the video shows
+		wantPrimary int
+	}{
+		{name: "one upload is primary", uploads: []map[string]string{nil}, wantPrimary: 0},
+		{name: "the first upload stays primary", uploads: []map[string]string{nil, nil, nil}, wantPrimary: 0},
+		{
+			name:        "an upload asked to be primary replaces it",
+			uploads:     []map[string]string{nil, {"primary": "true"}, nil},
+			wantPrimary: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+
+			var resp videoResponse
+			for _, values := range tt.uploads {
+				resp = uploadThumbnail(t, cfg, video.ID, token, values)
+			}
+			if len(resp.Thumbnails) != len(tt.uploads) {
+				t.Fatalf("thumbnails = %d, want %d", len(resp.Thumbnails), len(tt.uploads))
+			}
+			seen := map[string]bool{}
+			for _, thumbnail := range resp.Thumbnails {
+				if thumbnail.VideoID != video.ID {
+					t.Errorf("thumbnail video = %s, want %s", thumbnail.VideoID, video.ID)
+				}
+				if seen[thumbnail.URL] {
+					t.Errorf("thumbnail %s was overwritten", thumbnail.URL)
+				}
+				seen[thumbnail.URL] = true
+			}
+			if want := resp.Thumbnails[tt.wantPrimary].URL; resp.ThumbnailURL == nil || *resp.ThumbnailURL != want {
+				t.Errorf("thumbnail URL = %v, want %s", resp.ThumbnailURL, want)
+			}
+
+			// the video's own GET lists them too
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoGet(rec, newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String(), video.ID, nil, token))
+			var got videoResponse
+			decodeData(t, rec, &got)
+			if len(got.Thumbnails) != len(tt.uploads) {
+				t.Errorf("GET thumbnails = %d, want %d", len(got.Thumbnails), len(tt.uploads))
+			}
+		})
+	}
+}
+
+func TestHandlerThumbnailPrimary(t *testing.T) {
+	tests := []struct {
+		name string
+		// body builds the request from the video's second thumbnail and one
+		// belonging to another video
+		body      func(own, other uuid.UUID) string
+		otherUser bool
+		wantCode  int
+		wantOwn   bool
+	}{
+		{
+			name:     "switches the primary",
+			body:     func(own, other uuid.UUID) string { return `{"thumbnail_id":"` + own.String() + `"}` },
+			wantCode: http.StatusOK,
+			wantOwn:  true,
+		},
+		{
+			name:     "another video's thumbnail",
+			body:     func(own, other uuid.UUID) string { return `{"thumbnail_id":"` + other.String() + `"}` },
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "unknown thumbnail",
+			body:     func(own, other uuid.UUID) string { return `{"thumbnail_id":"` + uuid.NewString() + `"}` },
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "no thumbnail",
+			body:     func(own, other uuid.UUID) string { return `{}` },
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:      "someone else's video",
+			body:      func(own, other uuid.UUID) string { return `{"thumbnail_id":"` + own.String() + `"}` },
+			otherUser: true,
+			wantCode:  http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+			uploadThumbnail(t, cfg, video.ID, token, nil)
+			own := uploadThumbnail(t, cfg, video.ID, token, nil).Thumbnails[1]
+			otherVideo, otherToken := newTestVideo(t, cfg)
+			other := uploadThumbnail(t, cfg, otherVideo.ID, otherToken, nil).Thumbnails[0]
+
+			if tt.otherUser {
+				token = otherToken
+			}
+			req := newVideoRequest(http.MethodPatch, "/api/videos/"+video.ID.String()+"/thumbnail/primary", video.ID, strings.NewReader(tt.body(own.ID, other.ID)), token)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cfg.handlerThumbnailPrimary(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isOwn := stored.ThumbnailURL != nil && *stored.ThumbnailURL == own.URL; isOwn != tt.wantOwn {
+				t.Errorf("thumbnail URL = %v, switched %v, want %v", stored.ThumbnailURL, isOwn, tt.wantOwn)
+			}
+			if tt.wantOwn && stored.BlurHash != own.BlurHash {
+				t.Errorf("blurhash = %q, want the primary's %q", stored.BlurHash, own.BlurHash)
+			}
+		})
+	}
+}
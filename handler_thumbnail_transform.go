@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerThumbnailTransform rotates and/or flips the video's primary
+// thumbnail without a new upload. The result is stored as a new candidate
+// that becomes the primary, the original stays available to switch back to.
+func (cfg *apiConfig) handlerThumbnailTransform(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	params := thumbnailTransform{}
+	if verr := decodeJSONBody(r, &params); verr != nil {
+		respondWithValidationError(w, verr)
+		return
+	}
+	if verr := validateThumbnailTransform(params); verr != nil {
+		respondWithValidationError(w, verr)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't edit this video", nil)
+		return
+	}
+	if video.ThumbnailURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no thumbnail", nil)
+		return
+	}
+	srcPath, ok := cfg.thumbnailAssetPath(*video.ThumbnailURL)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't locate thumbnail", nil)
+		return
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open thumbnail", err)
+		return
+	}
+	img, _, err := image.Decode(src)
+	src.Close()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode thumbnail", err)
+		return
+	}
+	img = params.apply(img)
+	// a quarter turn can leave it larger than the frame, capped like uploads
+	if cfg.thumbnailCapToVideo {
+		if capped, ok := capToVideoFrame(img, video.Width, video.Height); ok {
+			img = capped
+		}
+	}
+
+	baseName, err := newAssetBaseName()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create image name", err)
+		return
+	}
+	mediaType := thumbnailMediaType(srcPath)
+	fileName, err := sanitizeKey(fmt.Sprintf("%s.%s", baseName, strings.Split(mediaType, "/")[1]))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create image name", err)
+		return
+	}
+	if err := writeImage(filepath.Join(cfg.assetsRoot, fileName), img, mediaType); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store thumbnail", err)
+		return
+	}
+	sizes, err := cfg.storeThumbnailSizes(img, baseName, mediaType)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't resize thumbnail", err)
+		return
+	}
+
+	thumbnail, err := cfg.db.CreateVideoThumbnail(database.CreateVideoThumbnailParams{
+		VideoID:  videoID,
+		URL:      cfg.assetURL(fileName),
+		Sizes:    sizes,
+		BlurHash: thumbnailBlurHash(img),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save thumbnail", err)
+		return
+	}
+	setPrimaryThumbnail(&video, thumbnail)
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	resp, err := cfg.videoDetailResponse(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list thumbnails", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerTusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", "creation,checksum")
+	w.Header().Set("Tus-Checksum-Algorithm", tusChecksumAlgorithmNames())
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(cfg.maxUploadSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerTusCreate starts a resumable upload for a video. The file type and
+// name may be passed as filetype and filename in Upload-Metadata, the
+// video's category and an encoding profile as category and encoding_profile.
+func (cfg *apiConfig) handlerTusCreate(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't upload to this video", nil)
+		return
+	}
+	if !cfg.checkVideoQuota(w, video) {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Length", err)
+		return
+	}
+	if length > cfg.maxUploadSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload can't exceed %d bytes", cfg.maxUploadSize), nil)
+		return
+	}
+	fits, err := cfg.fitsStorageQuota(video, length)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check storage quota", err)
+		return
+	}
+	if !fits {
+		respondWithError(w, http.StatusRequestEntityTooLarge, storageQuotaMessage(cfg.storageQuota), nil)
+		return
+	}
+	if !cfg.checkDiskSpace(w, videoID, cfg.tusDir, length) {
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Metadata", err)
+		return
+	}
+	mediaType := "video/mp4"
+	if filetype := metadata["filetype"]; filetype != "" {
+		mediaType, _, err = mime.ParseMediaType(filetype)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Unable to get mediaType", err)
+			return
+		}
+	}
+	// the declared type is kept, processing relabels it and checks the
+	// relabeling holds up
+	if normalized, _ := cfg.normalizeMediaType(mediaType, metadata["filename"]); normalized != "video/mp4" {
+		respondWithError(w, http.StatusBadRequest, "Only video/mp4 uploads are supported", nil)
+		return
+	}
+
+	category := video.Category
+	if metadata["category"] != "" {
+		if !cfg.validCategory(metadata["category"]) {
+			respondWithError(w, http.StatusBadRequest, cfg.categoryMessage(), nil)
+			return
+		}
+		category = metadata["category"]
+	}
+	if _, ok := cfg.uploadEncodingProfile(category, metadata["encoding_profile"]); !ok {
+		respondWithError(w, http.StatusBadRequest, cfg.encodingProfileMessage(metadata["encoding_profile"]), nil)
+		return
+	}
+
+	upload, err := cfg.db.CreateTusUpload(database.CreateTusUploadParams{
+		VideoID:         videoID,
+		UserID:          userID,
+		Length:          length,
+		MediaType:       mediaType,
+		FileName:        metadata["filename"],
+		Category:        metadata["category"],
+		EncodingProfile: metadata["encoding_profile"],
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload", err)
+		return
+	}
+	f, err := os.Create(cfg.tusUploadPath(upload.ID))
+	if err != nil {
+		cfg.db.DeleteTusUpload(upload.ID)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload", err)
+		return
+	}
+	f.Close()
+
+	w.Header().Set("Location", fmt.Sprintf("/api/tus/%s", upload.ID))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// getTusUpload loads the upload named in the path and makes sure it belongs
+// to the caller. It responds itself when it returns false.
+func (cfg *apiConfig) getTusUpload(w http.ResponseWriter, r *http.Request) (database.TusUpload, bool) {
+	uploadID, err := uuid.Parse(r.PathValue("uploadID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid upload ID", err)
+		return database.TusUpload{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.TusUpload{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.TusUpload{}, false
+	}
+
+	upload, err := cfg.db.GetTusUpload(uploadID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return database.TusUpload{}, false
+	}
+	if upload.ID == uuid.Nil || upload.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Upload not found", nil)
+		return database.TusUpload{}, false
+	}
+	return upload, true
+}
+
+func (cfg *apiConfig) handlerTusHead(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	upload, ok := cfg.getTusUpload(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// handlerTusPatch appends a chunk to an upload. Whatever arrived is kept even
+// if the connection drops, so the client can resume from the offset HEAD
+// reports. Chunks sent with an Upload-Checksum are different: they're kept
+// only once they're complete and match it, a corrupted chunk is dropped so
+// the client can send just that chunk again. The chunk completing the
+// upload runs it through processUpload, whose response is returned.
+func (cfg *apiConfig) handlerTusPatch(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream", nil)
+		return
+	}
+	upload, ok := cfg.getTusUpload(w, r)
+	if !ok {
+		return
+	}
+
+	if !cfg.tusLocks.tryLock(upload.ID) {
+		respondWithError(w, http.StatusLocked, "Upload is already being written to", nil)
+		return
+	}
+	defer cfg.tusLocks.unlock(upload.ID)
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Offset", err)
+		return
+	}
+	if offset != upload.Offset {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Upload-Offset must be %d", upload.Offset), nil)
+		return
+	}
+	checksum, digest, err := parseTusChecksum(r.Header.Get("Upload-Checksum"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Checksum", err)
+		return
+	}
+
+	f, err := os.OpenFile(cfg.tusUploadPath(upload.ID), os.O_RDWR, 0)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open upload", err)
+		return
+	}
+	defer f.Close()
+	// drop anything past the recorded offset left behind by a crash
+	if err := f.Truncate(upload.Offset); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open upload", err)
+		return
+	}
+	if _, err := f.Seek(upload.Offset, io.SeekStart); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open upload", err)
+		return
+	}
+
+	var dst io.Writer = f
+	if checksum != nil {
+		dst = io.MultiWriter(f, checksum)
+	}
+	n, copyErr := io.Copy(dst, io.LimitReader(r.Body, upload.Length-upload.Offset))
+	if checksum != nil && (copyErr != nil || !bytes.Equal(checksum.Sum(nil), digest)) {
+		// a partial chunk can't be verified either, none of it is kept
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		if err := f.Truncate(upload.Offset); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't discard upload chunk", err)
+			return
+		}
+		if copyErr != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't write upload chunk", copyErr)
+			return
+		}
+		respondWithError(w, statusChecksumMismatch, "Chunk doesn't match its Upload-Checksum", nil)
+		return
+	}
+	upload.Offset += n
+	if err := cfg.db.SetTusUploadOffset(upload.ID, upload.Offset); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save upload progress", err)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if copyErr != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't write upload chunk", copyErr)
+		return
+	}
+	if upload.Offset < upload.Length {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// the upload is complete, from here on it's a regular upload. It's only
+	// removed once processed, until then the client can retry with an empty
+	// PATCH, and uploads nobody comes back for are reaped.
+	if !cfg.uploadLimiter.acquire(upload.UserID) {
+		cfg.failUpload(w, upload.VideoID, http.StatusTooManyRequests, "Too many uploads in progress", nil)
+		return
+	}
+	defer cfg.uploadLimiter.release(upload.UserID)
+
+	metadata, err := cfg.db.GetVideo(upload.VideoID)
+	if err != nil {
+		cfg.failUpload(w, upload.VideoID, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if metadata.UserID != upload.UserID {
+		cfg.failUpload(w, upload.VideoID, http.StatusForbidden, "You can't upload to this video", nil)
+		return
+	}
+	// other uploads may have finished while this one was in flight
+	if !cfg.checkVideoQuota(w, metadata) {
+		return
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		cfg.failUpload(w, upload.VideoID, http.StatusInternalServerError, "Couldn't read upload", err)
+		return
+	}
+
+	// the categories may have been reconfigured since the upload started
+	if upload.Category != "" {
+		if !cfg.validCategory(upload.Category) {
+			cfg.failUpload(w, upload.VideoID, http.StatusBadRequest, cfg.categoryMessage(), nil)
+			return
+		}
+		metadata.Category = upload.Category
+	}
+	encoding, ok := cfg.uploadEncodingProfile(metadata.Category, upload.EncodingProfile)
+	if !ok {
+		cfg.failUpload(w, upload.VideoID, http.StatusBadRequest, cfg.encodingProfileMessage(upload.EncodingProfile), nil)
+		return
+	}
+
+	if cfg.processUpload(w, r, metadata, f, upload.MediaType, upload.FileName, cfg.outputProfile, encoding) {
+		cfg.removeTusUpload(upload.ID)
+	}
+}
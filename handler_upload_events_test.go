@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestUploadEventSequence(t *testing.T) {
+	tests := []struct {
+		name       string
+		probe      string
+		wantCode   int
+		wantEvents []string
+	}{
+		{
+			name:     "successful upload",
+			probe:    fakeProbe(320, 180),
+			wantCode: http.StatusOK,
+			wantEvents: []string{
+				database.UploadEventReceived,
+				database.UploadEventProbed,
+				database.UploadEventProcessed,
+				database.UploadEventStored,
+				database.UploadEventCommitted,
+			},
+		},
+		{
+			name:     "rejected after probing",
+			probe:    fakeProbe(8000, 180),
+			wantCode: http.StatusBadRequest,
+			wantEvents: []string{
+				database.UploadEventReceived,
+				database.UploadEventFailed,
+			},
+		},
+		{
+			name:     "unreadable upload",
+			probe:    "ffprobe: invalid data",
+			wantCode: http.StatusInternalServerError,
+			wantEvents: []string{
+				database.UploadEventReceived,
+				database.UploadEventFailed,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			installFakeFFmpeg(t, cfg, tt.probe)
+			video, token := newTestVideo(t, cfg)
+
+			req := newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil)
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("upload status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+
+			req = newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/events", video.ID, nil, token)
+			rec = httptest.NewRecorder()
+			cfg.handlerUploadEvents(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("events status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			var events []database.UploadEvent
+			decodeData(t, rec, &events)
+
+			var got []string
+			for _, e := range events {
+				got = append(got, e.Event)
+			}
+			if !slices.Equal(got, tt.wantEvents) {
+				t.Errorf("events = %v, want %v", got, tt.wantEvents)
+			}
+			if last := events[len(events)-1]; last.Event == database.UploadEventFailed && last.Details == "" {
+				t.Error("failed event has no details")
+			}
+		})
+	}
+}
+
+func TestHandlerUploadEventsAccess(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	video, ownerToken := newTestVideo(t, cfg)
+	_, otherToken := newTestVideo(t, cfg)
+	cfg.recordUploadEvent(video.ID, database.UploadEventReceived, "video/mp4 upload")
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+	}{
+		{name: "owner", token: ownerToken, wantCode: http.StatusOK},
+		{name: "another user", token: otherToken, wantCode: http.StatusForbidden},
+		{name: "no token", wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/events", video.ID, nil, tt.token)
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadEvents(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
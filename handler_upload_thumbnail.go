@@ -1,11 +1,12 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
-	"log"
+	"log/slog"
 	"mime"
 	"net/http"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"strings"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
@@ -30,7 +32,7 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
@@ -39,32 +41,33 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	const maxMemory = 10 << 20
 	r.ParseMultipartForm(maxMemory)
 
-	// "thumbnail" should match the HTML form input name
+	// the field names should match the HTML form input name
 	// `file` is an `io.Reader` that we can read from to get the image data
-	file, header, err := r.FormFile("thumbnail")
+	file, header, err := formFileAny(r, cfg.thumbnailFieldNames)
 	if err != nil {
-		log.Println(err)
 		respondWithError(w, http.StatusBadRequest, "Unable to parse form file", err)
 		return
 	}
 	defer file.Close()
 
 	contentTypeHeader := header.Header.Get("Content-Type")
+	if contentTypeHeader == "" {
+		// ParseMediaType's "no media type" wouldn't tell the client much
+		respondWithError(w, http.StatusBadRequest, "Missing Content-Type on file part", nil)
+		return
+	}
 	mediaType, _, err := mime.ParseMediaType(contentTypeHeader)
 	if err != nil {
-		log.Println(err)
 		respondWithError(w, http.StatusBadRequest, "Unable to get mediaType", err)
 		return
 	}
 	if mediaType != "image/jpeg" && mediaType != "image/png" {
-		log.Println(err)
 		respondWithError(w, http.StatusBadRequest, "Unable to get mediaType", err)
 		return
 	}
 
 	metadata, err := cfg.db.GetVideo(videoID)
 	if err != nil {
-		log.Println(err)
 		respondWithError(w, http.StatusBadRequest, "Unable to get video metadata", err)
 		return
 	}
@@ -73,35 +76,109 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	randomBytes := make([]byte, 32)
-	if _, err = rand.Read(randomBytes); err != nil {
-		log.Println(err)
-		respondWithError(w, http.StatusInternalServerError, "Unable to create image name", err)
+	// resizing and the placeholder are best effort, an image we can't decode
+	// is still stored as uploaded
+	img, _, err := image.Decode(file)
+	if err != nil {
+		if cfg.thumbnailAspectStrict {
+			respondWithError(w, http.StatusBadRequest, "Unable to decode thumbnail to check its aspect ratio", err)
+			return
+		}
+		slog.Warn("Couldn't decode thumbnail, storing it as is", "video_id", videoID, "err", err)
+		img = nil
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to read thumbnail", err)
 		return
 	}
+	// the upload is stored as is unless it's cropped or scaled here
+	transformed := false
+	blurHash := ""
+	if img != nil {
+		if cfg.thumbnailCrop.enabled() {
+			img = centerCrop(img, cfg.thumbnailCrop)
+			transformed = true
+		}
+		if cfg.thumbnailCapToVideo {
+			if capped, ok := capToVideoFrame(img, metadata.Width, metadata.Height); ok {
+				img = capped
+				transformed = true
+			}
+		}
+		if thumbnailAspectMismatch(img.Bounds().Dx(), img.Bounds().Dy(), metadata.AspectRatio, cfg.thumbnailAspectTolerance) {
+			if cfg.thumbnailAspectStrict {
+				respondWithError(w, http.StatusBadRequest, "Thumbnail aspect ratio doesn't match the video", nil)
+				return
+			}
+			slog.Info("Thumbnail doesn't match the video's aspect ratio", "video_id", videoID, "aspect_ratio", metadata.AspectRatio)
+		}
+		blurHash = thumbnailBlurHash(img)
+	}
 
-	fileName := base64.RawURLEncoding.EncodeToString(randomBytes)
+	baseName, err := newAssetBaseName()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to create image name", err)
+		return
+	}
 	fileExtension := strings.Split(mediaType, "/")[1]
-	fileName = fmt.Sprintf("%s.%s", fileName, fileExtension)
-	filePath := filepath.Join(cfg.assetsRoot, fileName)
-
-	newFile, err := os.Create(filePath) 
+	fileName, err := sanitizeKey(fmt.Sprintf("%s.%s", baseName, fileExtension))
 	if err != nil {
-		log.Println(err)
-		respondWithError(w, http.StatusUnauthorized, "Not your video m8", nil)
+		respondWithError(w, http.StatusInternalServerError, "Unable to create image name", err)
 		return
 	}
+	filePath := filepath.Join(cfg.assetsRoot, fileName)
+
+	if transformed {
+		// the upload itself isn't what we serve anymore, store the result
+		if err = writeImage(filePath, img, mediaType); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to store thumbnail", err)
+			return
+		}
+	} else {
+		newFile, err := os.Create(filePath)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to store thumbnail", err)
+			return
+		}
+
+		io.Copy(newFile, file)
+	}
 
-	io.Copy(newFile, file)
+	thumbnailURL := cfg.assetURL(fileName)
 
-	thumbnailURL := fmt.Sprintf("http://localhost:%s/assets/%s", cfg.port, fileName)
-	metadata.ThumbnailURL = &thumbnailURL
+	sizes := map[string]string{}
+	if img != nil {
+		sizes, err = cfg.storeThumbnailSizes(img, baseName, mediaType)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to resize thumbnail", err)
+			return
+		}
+	}
 
-	if err = cfg.db.UpdateVideo(metadata); err != nil {
-		log.Println(err)
-		respondWithError(w, http.StatusInternalServerError, "Unable to update video", err)
+	// every upload is kept as a candidate, it only replaces what the video
+	// shows if it's the first one or asked to be primary
+	thumbnail, err := cfg.db.CreateVideoThumbnail(database.CreateVideoThumbnailParams{
+		VideoID:  videoID,
+		URL:      thumbnailURL,
+		Sizes:    sizes,
+		BlurHash: blurHash,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to save thumbnail", err)
 		return
 	}
+	if metadata.ThumbnailURL == nil || r.FormValue("primary") == "true" {
+		setPrimaryThumbnail(&metadata, thumbnail)
+		if err = cfg.db.UpdateVideo(metadata); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to update video", err)
+			return
+		}
+	}
 
-	respondWithJSON(w, http.StatusOK, metadata)
+	resp, err := cfg.videoDetailResponse(metadata)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to list thumbnails", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, resp)
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// encodePNG returns a solid PNG of the given size.
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, solidImage(width, height, color.RGBA{200, 100, 0, 255})); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newThumbnailRequest builds a multipart thumbnail upload of data.
+func newThumbnailRequest(t *testing.T, videoID uuid.UUID, token, contentType string, data []byte, values map[string]string) *http.Request {
+	t.Helper()
+	body, formType := multipartBody(t, "thumbnail", "thumb.png", contentType, data, values)
+	req := newVideoRequest(http.MethodPost, "/api/thumbnail_upload/"+videoID.String(), videoID, body, token)
+	req.Header.Set("Content-Type", formType)
+	return req
+}
+
+func TestHandlerUploadThumbnail(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         func(t *testing.T) []byte
+		contentType  string
+		aspectStrict bool
+		wantCode     int
+		wantSizes    int
+		wantBlurHash bool
+	}{
+		{
+			name:         "decodable image",
+			data:         func(t *testing.T) []byte { return encodePNG(t, 1280, 720) },
+			contentType:  "image/png",
+			wantCode:     http.StatusOK,
+			wantSizes:    2,
+			wantBlurHash: true,
+		},
+		{
+			name:        "undecodable image is stored as uploaded",
+			data:        func(t *testing.T) []byte { return []byte("not a png") },
+			contentType: "image/png",
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:         "undecodable image with a strict aspect check",
+			data:         func(t *testing.T) []byte { return []byte("not a png") },
+			contentType:  "image/png",
+			aspectStrict: true,
+			wantCode:     http.StatusBadRequest,
+		},
+		{
+			name:        "not an image type",
+			data:        func(t *testing.T) []byte { return []byte("GIF89a") },
+			contentType: "image/gif",
+			wantCode:    http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.thumbnailAspectStrict = tt.aspectStrict
+			video, token := newTestVideo(t, cfg)
+			data := tt.data(t)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadThumbnail(rec, newThumbnailRequest(t, video.ID, token, tt.contentType, data, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var resp videoResponse
+			decodeData(t, rec, &resp)
+			if resp.ThumbnailURL == nil {
+				t.Fatal("thumbnail URL wasn't set")
+			}
+			if len(resp.ThumbnailSizes) != tt.wantSizes {
+				t.Errorf("thumbnail sizes = %v, want %d", resp.ThumbnailSizes, tt.wantSizes)
+			}
+			if (resp.BlurHash != "") != tt.wantBlurHash {
+				t.Errorf("blurhash = %q, want one %v", resp.BlurHash, tt.wantBlurHash)
+			}
+			stored, err := os.ReadFile(filepath.Join(cfg.assetsRoot, filepath.Base(strings.Split(*resp.ThumbnailURL, "?")[0])))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(stored, data) {
+				t.Error("stored thumbnail isn't the upload")
+			}
+		})
+	}
+}
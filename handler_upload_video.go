@@ -1,81 +1,296 @@
 package main
 
 import (
-	"bytes"
-	"crypto/rand"
-	"encoding/base64"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"mime"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
 	"github.com/google/uuid"
 )
 
-func processVideoForFastStart(filePath string) (string, error) {
-	outputFilePath := fmt.Sprintf("%s.processing", filePath)
+// tempOutputPath reserves a uniquely named file next to filePath for ffmpeg
+// to write into. The file already exists, so ffmpeg must be run with -y.
+func tempOutputPath(filePath, pattern string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(filePath), pattern)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// contentLength stats f so its size can be passed on to the storage backend.
+// An empty file always means processing went wrong, so it's an error.
+func contentLength(f *os.File) (func(*storage.PutOptions), error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return nil, fmt.Errorf("%s is empty", f.Name())
+	}
+	return storage.WithContentLength(info.Size()), nil
+}
+
+func (cfg *apiConfig) processVideoForFastStart(filePath string, profile outputProfile) (string, error) {
+	outputFilePath, err := tempOutputPath(filePath, "tubely-processed-*.mp4")
+	if err != nil {
+		return "", err
+	}
 	cmd := exec.Command(
-		"ffmpeg",
+		cfg.ffmpegPath,
+		"-y",
 		"-i", filePath,
 		"-c", "copy",
-		"-movflags", "faststart",
+		"-movflags", profile.movflags,
 		"-f", "mp4",
 		outputFilePath,
 	)
 
+	logCommand(cmd)
 	if err := cmd.Run(); err != nil {
+		os.Remove(outputFilePath)
 		return "", err
 	}
 	return outputFilePath, nil
 }
 
-func getVideoAspectRatio(filePath string) (string, error) {
-	cmd := exec.Command(
-		"ffprobe",
-		"-v", "error",
-		"-print_format", "json",
-		"-show_streams",
-		filePath,
-	)
+// processVideoWithValidation runs processVideoForFastStart and, when enabled,
+// confirms the moov atom really ended up in front since some ffmpeg builds
+// silently ignore -movflags faststart. A file that still isn't faststart is
+// kept after the retries run out, it plays, just not progressively, and is
+// reported through the returned bool.
+func (cfg *apiConfig) processVideoWithValidation(filePath string, profile outputProfile) (string, bool, error) {
+	for attempt := 1; ; attempt++ {
+		processedPath, err := cfg.processVideoForFastStart(filePath, profile)
+		if err != nil || !cfg.faststartValidate {
+			return processedPath, err == nil, err
+		}
 
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Run()
+		ok, err := isFastStart(processedPath)
+		if err != nil {
+			slog.Warn("Couldn't verify faststart", "path", processedPath, "err", err)
+			return processedPath, true, nil
+		}
+		if ok {
+			return processedPath, true, nil
+		}
 
-	var data struct {
-		Streams []struct {
-			CodecType string `json:"codec_type"`
-			Width     int    `json:"width"`
-			Height    int    `json:"height"`
-		} `json:"streams"`
+		slog.Warn("moov atom isn't at the front after faststart", "path", processedPath, "attempt", attempt)
+		if attempt > cfg.faststartRetries {
+			return processedPath, false, nil
+		}
+		os.Remove(processedPath)
 	}
+}
 
-	json.Unmarshal(out.Bytes(), &data)
+// storePromoted uploads r to a staging key and only copies it to key once
+// the upload fully succeeded, so readers never see a half-written object.
+// The staging copy lives under key's tenant prefix and is always cleaned
+// up. With storage.WithIfAbsent in opts the promotion fails with
+// storage.ErrAlreadyExists instead of overwriting.
+func (cfg *apiConfig) storePromoted(ctx context.Context, key string, r io.Reader, contentType string, opts ...func(*storage.PutOptions)) error {
+	stagingKey := fmt.Sprintf("%sstaging/%s", tenantScope(key), uuid.New())
+	defer func() {
+		// cleanup has to happen even if the request was cancelled
+		cleanupCtx, cancel := cfg.storageContext(context.Background())
+		defer cancel()
+		cfg.storage.Delete(cleanupCtx, stagingKey)
+	}()
 
-	for _, s := range data.Streams {
-		if s.CodecType == "video" && s.Width > 0 && s.Height > 0 {
+	ctx, cancel := cfg.storageContext(ctx)
+	defer cancel()
 
-			ratio := (s.Width * 1000) / s.Height // INT division
+	if err := cfg.storage.Put(ctx, stagingKey, r, contentType, opts...); err != nil {
+		return err
+	}
+	return cfg.storage.Copy(ctx, stagingKey, key, opts...)
+}
+
+// storeVariant encodes v from the processed source on the worker pool and
+// stores it next to the primary object. Cancelling ctx stops the encode,
+// even one the pool already started.
+func (cfg *apiConfig) storeVariant(ctx context.Context, temps *tempCleanup, videoID uuid.UUID, sourcePath, primaryKey string, v Variant, probe videoProbe, profile outputProfile, encoding encodingProfile, opts ...func(*storage.PutOptions)) (database.VideoVariant, error) {
+	var variantPath string
+	err := cfg.workers.run(ctx, func() error {
+		// the job may have waited in the queue past a cancellation
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var err error
+		variantPath, err = cfg.transcodeVariantResumable(ctx, videoID, sourcePath, v, probe, profile, encoding)
+		return err
+	})
+	if err != nil {
+		return database.VideoVariant{}, fmt.Errorf("couldn't encode %s variant: %w", v.Name, err)
+	}
+	temps.track(variantPath)
+	defer temps.remove(variantPath)
 
-			switch {
-			case ratio >= 1700 && ratio <= 1850:
-				return "16:9", nil
-			case ratio >= 520 && ratio <= 600:
-				return "9:16", nil
-			default:
-				return "other", nil
+	variantFile, err := os.Open(variantPath)
+	if err != nil {
+		return database.VideoVariant{}, err
+	}
+	defer variantFile.Close()
+
+	length, err := contentLength(variantFile)
+	if err != nil {
+		return database.VideoVariant{}, err
+	}
+	if err := cfg.storePromoted(ctx, variantKey(primaryKey, v), variantFile, "video/mp4", append(opts, length)...); err != nil {
+		return database.VideoVariant{}, err
+	}
+	return cfg.variantRecord(primaryKey, v, probe), nil
+}
+
+// variantFailure is a rendition that couldn't be made for an upload that
+// was stored anyway. Clients only get a generic reason, what went wrong in
+// ffmpeg or storage is logged.
+type variantFailure struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+const variantFailureReason = "couldn't be encoded or stored"
+
+// storeVariants encodes and stores every rendition worth having for the
+// source, at most cfg.variantParallelism at a time. A rendition that fails
+// is reported in the returned failures and recorded as failed, unless
+// cfg.variantsStrict is set: then the first failure cancels the encodes
+// still running or waiting and is returned as the error. It returns the
+// records in ladder order and the keys it wrote, which on error the caller
+// removes.
+func (cfg *apiConfig) storeVariants(ctx context.Context, temps *tempCleanup, videoID uuid.UUID, sourcePath, primaryKey string, probe videoProbe, profile outputProfile, encoding encodingProfile, reusable func(string) bool, opts ...func(*storage.PutOptions)) ([]database.VideoVariant, []variantFailure, []string, error) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ladder := variantsFor(probe.Width, probe.Height, probe.Bitrate, cfg.bitrateThresholds)
+	variants := make([]database.VideoVariant, len(ladder))
+	stored := make([]bool, len(ladder))
+	errs := make([]error, len(ladder))
+	// encodes killed by the cancellation fail too, only the failure that
+	// caused it is reported
+	var failOnce sync.Once
+	var firstErr error
+	fail := func(err error) {
+		failOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	sem := make(chan struct{}, max(cfg.variantParallelism, 1))
+	var wg sync.WaitGroup
+	for i, v := range ladder {
+		if reusable(variantKey(primaryKey, v)) {
+			variants[i] = cfg.variantRecord(primaryKey, v, probe)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				fail(ctx.Err())
+				return
+			}
+			defer func() { <-sem }()
+			variant, err := cfg.storeVariant(ctx, temps, videoID, sourcePath, primaryKey, v, probe, profile, encoding, opts...)
+			if err != nil {
+				errs[i] = err
+				if cfg.variantsStrict {
+					fail(err)
+				}
+				return
+			}
+			variants[i] = variant
+			stored[i] = true
+		}()
+	}
+	wg.Wait()
+	cfg.removeEmptyTranscodeDir(videoID)
+
+	keys := []string{}
+	for i, v := range ladder {
+		if stored[i] {
+			keys = append(keys, variantKey(primaryKey, v))
+		}
+	}
+	if firstErr != nil {
+		return nil, nil, keys, firstErr
+	}
+	// a cancelled request isn't a variant failing
+	if err := parent.Err(); err != nil {
+		return nil, nil, keys, err
+	}
+
+	failures := []variantFailure{}
+	for i, v := range ladder {
+		if errs[i] != nil {
+			slog.Warn("Couldn't make video variant, storing the upload without it", "video_id", videoID, "variant", v.Name, "err", errs[i])
+			failures = append(failures, variantFailure{Name: v.Name, Reason: variantFailureReason})
+			width, height := v.dimensions(probe.Width, probe.Height)
+			variants[i] = database.VideoVariant{
+				Name:   v.Name,
+				Width:  width,
+				Height: height,
+				Status: database.VariantStatusFailed,
 			}
 		}
 	}
+	return variants, failures, keys, nil
+}
+
+// storePreviewGIF renders the preview GIF on the worker pool and stores it
+// next to the primary object.
+func (cfg *apiConfig) storePreviewGIF(ctx context.Context, temps *tempCleanup, sourcePath, primaryKey string, probe videoProbe, opts ...func(*storage.PutOptions)) error {
+	var gifPath string
+	err := cfg.workers.run(ctx, func() error {
+		var err error
+		gifPath, err = cfg.generatePreviewGIF(sourcePath, probe.Duration)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	temps.track(gifPath)
+	defer temps.remove(gifPath)
 
-	return "other", nil
+	gifFile, err := os.Open(gifPath)
+	if err != nil {
+		return err
+	}
+	defer gifFile.Close()
+
+	length, err := contentLength(gifFile)
+	if err != nil {
+		return err
+	}
+	return cfg.storePromoted(ctx, previewGIFKey(primaryKey), gifFile, "image/gif", append(opts, length)...)
+}
+
+func (cfg *apiConfig) variantRecord(primaryKey string, v Variant, probe videoProbe) database.VideoVariant {
+	width, height := v.dimensions(probe.Width, probe.Height)
+	return database.VideoVariant{
+		Name:   v.Name,
+		Width:  width,
+		Height: height,
+		URL:    cfg.videoURL(variantKey(primaryKey, v)),
+		Status: database.VariantStatusReady,
+	}
 }
 
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
@@ -87,141 +302,573 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// rejections end up in the audit trail like failures further in
+	fail := func(code int, msg string, err error) {
+		cfg.failUpload(w, videoID, code, msg, err)
+	}
+
 	// auth
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		fail(http.StatusUnauthorized, "Couldn't find JWT", err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		fail(http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	if !cfg.uploadLimiter.acquire(userID) {
+		fail(http.StatusTooManyRequests, "Too many uploads in progress", nil)
 		return
 	}
+	defer cfg.uploadLimiter.release(userID)
 
 	// ensure request comes from the video owner
 	metadata, err := cfg.db.GetVideo(videoID)
 	if err != nil {
-		log.Println(err)
-		respondWithError(w, http.StatusBadRequest, "Unable to get video metadata", err)
+		fail(http.StatusBadRequest, "Unable to get video metadata", err)
 		return
 	}
 	if metadata.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "Not your video m8", nil)
+		fail(http.StatusUnauthorized, "Not your video m8", nil)
+		return
+	}
+	if !cfg.checkVideoQuota(w, metadata) {
+		return
+	}
+	if !cfg.checkDiskSpace(w, videoID, os.TempDir(), r.ContentLength) {
 		return
 	}
 
-	const maxMemory = 1 << 30
-	r.Body = http.MaxBytesReader(w, r.Body, maxMemory)
-	if err := r.ParseMultipartForm(maxMemory); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Upload too large or invalid multipart form", err)
+	// the body cap is enforced separately so large uploads spill to disk
+	// early instead of being buffered in memory
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.maxUploadSize)
+	if err := r.ParseMultipartForm(cfg.multipartMemory); err != nil {
+		fail(http.StatusBadRequest, "Upload too large or invalid multipart form", err)
 		return
 	}
 
-	// "video" should match the HTML form input name
+	// the container layout can be picked per upload
+	profile := cfg.outputProfile
+	if profileName := r.FormValue("output_profile"); profileName != "" {
+		var ok bool
+		profile, ok = outputProfiles[profileName]
+		if !ok {
+			fail(http.StatusBadRequest, fmt.Sprintf("Unknown output_profile %q", profileName), nil)
+			return
+		}
+	}
+
+	if category := r.FormValue("category"); category != "" {
+		if !cfg.validCategory(category) {
+			fail(http.StatusBadRequest, cfg.categoryMessage(), nil)
+			return
+		}
+		metadata.Category = category
+	}
+
+	// the encoding follows the category unless the upload asks otherwise
+	encodingName := r.FormValue("encoding_profile")
+	encoding, ok := cfg.uploadEncodingProfile(metadata.Category, encodingName)
+	if !ok {
+		fail(http.StatusBadRequest, cfg.encodingProfileMessage(encodingName), nil)
+		return
+	}
+
+	// optional retention deadline for ephemeral uploads
+	if expiresAtField := r.FormValue("expires_at"); expiresAtField != "" {
+		expiresAt, err := parseExpiresAt(expiresAtField)
+		if err != nil {
+			fail(http.StatusBadRequest, "Invalid expires_at", err)
+			return
+		}
+		metadata.ExpiresAt = &expiresAt
+	}
+
+	// the field names should match the HTML form input name
 	// `file` is an `io.Reader` that we can read from to get the video data
-	file, header, err := r.FormFile("video")
+	file, header, err := formFileAny(r, cfg.videoFieldNames)
 	if err != nil {
-		log.Println(err)
-		respondWithError(w, http.StatusBadRequest, "Unable to parse form file", err)
+		fail(http.StatusBadRequest, "Unable to parse form file", err)
 		return
 	}
 	defer file.Close()
 
 	// ensure correct mime type
 	contentTypeHeader := header.Header.Get("Content-Type")
+	if contentTypeHeader == "" {
+		// ParseMediaType's "no media type" wouldn't tell the client much
+		fail(http.StatusBadRequest, "Missing Content-Type on file part", nil)
+		return
+	}
 	mediaType, _, err := mime.ParseMediaType(contentTypeHeader)
 	if err != nil {
-		log.Println(err)
-		respondWithError(w, http.StatusBadRequest, "Unable to get mediaType", err)
+		fail(http.StatusBadRequest, "Unable to get mediaType", err)
 		return
 	}
-	if mediaType != "video/mp4" {
-		log.Println(err)
-		respondWithError(w, http.StatusBadRequest, "Unable to get mediaType", err)
+	// processing relabels it again, and checks the relabeling holds up
+	if normalized, _ := cfg.normalizeMediaType(mediaType, header.Filename); normalized != "video/mp4" {
+		fail(http.StatusBadRequest, "Unable to get mediaType", err)
+		return
+	}
+
+	cfg.processUpload(w, r, metadata, file, mediaType, header.Filename, profile, encoding)
+}
+
+// processUpload runs an uploaded video through probing, faststart
+// processing and variant encoding, stores the results and responds with the
+// updated video. Clients sending Prefer: respond-async instead get a 202
+// pointing at the video's status as soon as the upload is received, and
+// processing carries on in the background. It reports whether the upload
+// was stored, or handed off to be, so callers know its source can go.
+func (cfg *apiConfig) processUpload(w http.ResponseWriter, r *http.Request, metadata database.Video, src io.Reader, mediaType, fileName string, profile outputProfile, encoding encodingProfile) (handled bool) {
+	videoID := metadata.ID
+	fail := func(code int, msg string, err error) {
+		cfg.failUpload(w, videoID, code, msg, err)
+	}
+
+	// checked again when processing starts, this just spares receiving an
+	// upload that would be turned away anyway
+	if metadata.Status == database.VideoStatusProcessing {
+		fail(http.StatusConflict, "Video is already being processed", nil)
 		return
 	}
 
 	tempFile, err := os.CreateTemp("", "tubely-upload.mp4")
 	if err != nil {
-		log.Println(err)
-		respondWithError(w, http.StatusInternalServerError, "Unable to create temp file", err)
+		fail(http.StatusInternalServerError, "Unable to create temp file", err)
 		return
 	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close() // defer = LIFO, so close needs to be used second
+	// the temp file is handed off to processReceivedUpload once the upload
+	// is fully received
+	temps := &tempCleanup{}
+	defer temps.run()
+	temps.trackFile(tempFile)
 
-	if _, err = io.Copy(tempFile, file); err != nil {
-		log.Println(err)
-		respondWithError(w, http.StatusInternalServerError, "Unable to copy to temp file", nil)
+	size, err := io.Copy(tempFile, src)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Unable to copy to temp file", err)
+		return
+	}
+	fits, err := cfg.fitsStorageQuota(metadata, size)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Unable to check storage quota", err)
+		return
+	}
+	if !fits {
+		fail(http.StatusRequestEntityTooLarge, storageQuotaMessage(cfg.storageQuota), nil)
 		return
 	}
 	tempFile.Seek(0, io.SeekStart)
+	cfg.recordUploadEvent(videoID, database.UploadEventReceived, fmt.Sprintf("%s upload", mediaType))
 
-	// random video name
-	randomBytes := make([]byte, 32)
-	if _, err = rand.Read(randomBytes); err != nil {
-		log.Println(err)
-		respondWithError(w, http.StatusInternalServerError, "Unable to create image name", err)
+	// from here on the upload is being processed, if it fails the video
+	// falls back to its previous status, or failed if it never had one
+	previousStatus := metadata.Status
+	if metadata.VideoURL == nil {
+		previousStatus = database.VideoStatusFailed
+	}
+	started, err := cfg.startVideoProcessing(videoID)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Unable to update video status", err)
 		return
 	}
+	if !started {
+		fail(http.StatusConflict, "Video is already being processed", nil)
+		return
+	}
+	received := temps.handOff()
 
-	fileName := base64.RawURLEncoding.EncodeToString(randomBytes)
-	fileExtension := strings.Split(mediaType, "/")[1]
-	fileName = fmt.Sprintf("%s.%s", fileName, fileExtension)
+	if !preferAsync(r) {
+		return cfg.processReceivedUpload(w, r, metadata, tempFile, received, size, previousStatus, mediaType, fileName, profile, encoding)
+	}
+	// the request's context ends with this response, processing mustn't
+	// and nobody reads its response anymore. It keeps the request's upload
+	// slot, and shutdown waits for it.
+	bg := r.WithContext(context.WithoutCancel(r.Context()))
+	cfg.uploadLimiter.retain(metadata.UserID)
+	cfg.uploadJobs.Add(1)
+	go func() {
+		defer cfg.uploadJobs.Done()
+		defer cfg.uploadLimiter.release(metadata.UserID)
+		cfg.processReceivedUpload(discardResponseWriter{}, bg, metadata, tempFile, received, size, previousStatus, mediaType, fileName, profile, encoding)
+	}()
+
+	statusURL := fmt.Sprintf("/api/videos/%s/status", videoID)
+	w.Header().Set("Preference-Applied", "respond-async")
+	w.Header().Set("Location", statusURL)
+	respondWithJSON(w, http.StatusAccepted, map[string]string{
+		"status":     database.VideoStatusProcessing,
+		"status_url": statusURL,
+	})
+	return true
+}
 
-	aspectRatio, err := getVideoAspectRatio(tempFile.Name())
+// failUpload responds with an error and records it in the upload's audit
+// trail, which is where clients of async uploads find it.
+func (cfg *apiConfig) failUpload(w http.ResponseWriter, videoID uuid.UUID, code int, msg string, err error) {
+	details := msg
 	if err != nil {
-		log.Println(err)
-		respondWithError(w, http.StatusInternalServerError, "Unable to get file aspect ratio", err)
-		return
+		details = fmt.Sprintf("%s: %v", msg, err)
 	}
+	cfg.recordUploadEvent(videoID, database.UploadEventFailed, details)
+	respondWithError(w, code, msg, err)
+}
 
-	switch aspectRatio {
-	case "16:9":
-		fileName = fmt.Sprintf("landscape/%s", fileName)
-	case "9:16":
-		fileName = fmt.Sprintf("portrait/%s", fileName)
-	default:
-		fileName = fmt.Sprintf("other/%s", fileName)
+// processReceivedUpload is the part of processUpload after the upload is
+// in tempFile and the video is marked processing. It owns tempFile, which
+// temps already tracks, and, if processing fails, puts previousStatus
+// back. It reports whether the video was stored.
+func (cfg *apiConfig) processReceivedUpload(w http.ResponseWriter, r *http.Request, metadata database.Video, tempFile *os.File, temps *tempCleanup, size int64, previousStatus, mediaType, fileName string, profile outputProfile, encoding encodingProfile) (processed bool) {
+	videoID := metadata.ID
+	fail := func(code int, msg string, err error) {
+		cfg.failUpload(w, videoID, code, msg, err)
 	}
+	declaredType := mediaType
+	mediaType, relabeled := cfg.normalizeMediaType(mediaType, fileName)
+	// every temp file this upload produces is tracked in temps, which
+	// already holds tempFile, so no return path can leave one behind
+	defer temps.run()
 
-	processedPath, err := processVideoForFastStart(tempFile.Name())
+	// the previous upload's objects are listed now, committing replaces
+	// the variant and caption records they're found through
+	staleKeys, err := cfg.videoObjectKeys(metadata)
 	if err != nil {
-		log.Println(err)
-		respondWithError(w, http.StatusInternalServerError, "Unable to process video for fast start", err)
+		fail(http.StatusInternalServerError, "Unable to list video objects", err)
 		return
 	}
-	defer os.Remove(processedPath)
 
-	processedFile, err := os.Open(processedPath)
+	defer func() {
+		if !processed {
+			if err := cfg.setVideoStatus(videoID, previousStatus); err != nil {
+				slog.Error("Couldn't restore video status", "video_id", videoID, "err", err)
+			}
+		}
+	}()
+
+	probe, err := cfg.probeVideo(tempFile.Name())
+	if err != nil {
+		fail(http.StatusInternalServerError, "Unable to probe video", err)
+		return
+	}
+	if probe.Encrypted {
+		fail(http.StatusUnprocessableEntity, "Encrypted/DRM-protected media not supported", nil)
+		return
+	}
+	if err := checkUploadType(cfg.uploadTypeCheck, mediaType, fileName, probe); err != nil {
+		fail(http.StatusBadRequest, "Upload doesn't match its declared content type", err)
+		return
+	}
+	if relabeled && probe.containerType() != "video/mp4" {
+		fail(http.StatusBadRequest, "Upload doesn't match its declared content type", fmt.Errorf("%s upload isn't an MP4", declaredType))
+		return
+	}
+	if probe.Width <= 0 || probe.Height <= 0 {
+		fail(http.StatusBadRequest, "Video has no valid video stream", nil)
+		return
+	}
+	if probe.Width > cfg.maxVideoDimension || probe.Height > cfg.maxVideoDimension {
+		fail(http.StatusBadRequest, fmt.Sprintf("Video resolution can't exceed %dx%d", cfg.maxVideoDimension, cfg.maxVideoDimension), nil)
+		return
+	}
+	if cfg.requireAudio && !probe.HasAudio {
+		fail(http.StatusUnprocessableEntity, "Video must have an audio track", nil)
+		return
+	}
+	aspectRatio, err := cfg.aspectRatioLabel(probe.Width, probe.Height)
 	if err != nil {
-		log.Println(err)
-		respondWithError(w, http.StatusInternalServerError, "Unable to process video for fast start", err)
+		fail(http.StatusBadRequest, "Video has no valid video stream", err)
+		return
+	}
+	cfg.recordUploadEvent(videoID, database.UploadEventProbed, fmt.Sprintf("%dx%d, %s", probe.Width, probe.Height, aspectRatio))
+
+	processedPath, fastStart, err := cfg.processVideoWithValidation(tempFile.Name(), profile)
+	if err != nil {
+		if cfg.faststartStrict {
+			fail(http.StatusInternalServerError, "Unable to process video for fast start", err)
+			return
+		}
+		// the upload itself is still playable, store it untouched
+		slog.Warn("Faststart processing failed, storing the original upload", "video_id", videoID, "err", err)
+		processedPath = tempFile.Name()
+	} else {
+		temps.track(processedPath)
+		if err := cfg.checkProcessedDuration(processedPath, probe.Duration); err != nil {
+			if cfg.durationCheckStrict {
+				fail(http.StatusInternalServerError, "Processing changed the video's duration", err)
+				return
+			}
+			slog.Warn("Processed video's duration doesn't match the upload", "video_id", videoID, "err", err)
+		}
+	}
+	cfg.recordUploadEvent(videoID, database.UploadEventProcessed, fmt.Sprintf("faststart=%t", fastStart))
+
+	// only the stored primary gets the poster, variants, previews and
+	// hashes keep working from processedPath where the attached picture
+	// can't be mistaken for the video
+	primaryPath := processedPath
+	if coverPath, ok := cfg.coverArtPath(metadata.ThumbnailURL); ok && fastStart {
+		coveredPath, err := cfg.embedCoverArt(processedPath, coverPath, profile)
+		if err != nil {
+			slog.Warn("Couldn't embed cover art", "video_id", videoID, "err", err)
+		} else {
+			temps.track(coveredPath)
+			primaryPath = coveredPath
+		}
+	}
+
+	processedFile, err := os.Open(primaryPath)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Unable to process video for fast start", err)
 		return
 	}
 	defer processedFile.Close()
+	processedLength, err := contentLength(processedFile)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Unable to process video for fast start", err)
+		return
+	}
+
+	// the primary's SHA-256 lets clients verify downloads, matches
+	// identical uploads when deduplication is on and names the object under
+	// hash key naming, it's read once for all of them
+	metadata.ContentHash, err = contentHash(processedFile)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Unable to process video for fast start", err)
+		return
+	}
+
+	fileExtension := strings.Split(mediaType, "/")[1]
+	fileName, exists, err := cfg.chooseObjectKey(r.Context(), metadata, processedFile, fileExtension, aspectRatio)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Unable to create video name", err)
+		return
+	}
+
+	// every object written under a final key is tracked so a later failure
+	// can remove it again, objects we merely reuse are left alone
+	storedKeys := []string{}
+	removeStored := func() {
+		ctx, cancel := cfg.storageContext(context.Background())
+		defer cancel()
+		for _, key := range storedKeys {
+			cfg.storage.Delete(ctx, key)
+		}
+	}
+	reusable := func(key string) bool {
+		if !cfg.keyNaming.deterministic {
+			return false
+		}
+		ok, err := cfg.objectExists(r.Context(), key)
+		return err == nil && ok
+	}
+
+	tags := storage.WithTags(cfg.objectTags(metadata, aspectRatio))
+
+	if exists {
+		slog.Info("Object already exists, reusing it", "key", fileName)
+	} else {
+		checksum := storage.WithMetadata(map[string]string{"sha256": metadata.ContentHash})
+		opts := []func(*storage.PutOptions){tags, processedLength, checksum}
+		if cfg.conditionalPut {
+			opts = append(opts, storage.WithIfAbsent())
+		}
+		copied := false
+		if cfg.dedupCopy {
+			copied, err = cfg.copyDuplicate(r.Context(), metadata, fileName, opts...)
+			if err != nil && !errors.Is(err, storage.ErrAlreadyExists) {
+				slog.Warn("Couldn't copy identical object, uploading instead", "video_id", videoID, "err", err)
+				err = nil
+			}
+		}
+		if !copied && err == nil {
+			err = cfg.storePromoted(r.Context(), fileName, processedFile, mediaType, opts...)
+		}
+		switch {
+		case errors.Is(err, storage.ErrAlreadyExists):
+			// someone stored the same key first, theirs is the result
+			slog.Info("Object appeared while uploading, reusing it", "key", fileName)
+		case err != nil:
+			fail(http.StatusInternalServerError, "Unable to update video", err)
+			return
+		default:
+			storedKeys = append(storedKeys, fileName)
+		}
+	}
+
+	if cfg.preserveOriginals {
+		scope := tenantScope(fileName)
+		originalKey := fmt.Sprintf("%soriginals/%s", scope, strings.TrimPrefix(fileName, scope))
+		if !reusable(originalKey) {
+			if _, err = tempFile.Seek(0, io.SeekStart); err != nil {
+				removeStored()
+				fail(http.StatusInternalServerError, "Unable to read original upload", err)
+				return
+			}
+			originalLength, err := contentLength(tempFile)
+			if err != nil {
+				removeStored()
+				fail(http.StatusInternalServerError, "Unable to read original upload", err)
+				return
+			}
+			ctx, cancel := cfg.storageContext(r.Context())
+			err = cfg.storage.Put(ctx, originalKey, tempFile, mediaType, storage.WithStorageClass(cfg.originalsStorageClass), tags, originalLength)
+			cancel()
+			if err != nil {
+				removeStored()
+				fail(http.StatusInternalServerError, "Unable to store original upload", err)
+				return
+			}
+			storedKeys = append(storedKeys, originalKey)
+		}
+		metadata.OriginalKey = originalKey
+	}
 
-	if _, err = cfg.s3Client.PutObject(r.Context(), &s3.PutObjectInput{
-		Bucket:      &cfg.s3Bucket,
-		Key:         &fileName,
-		Body:        processedFile,
-		ContentType: &mediaType,
-	}); err != nil {
-		log.Println(err)
-		respondWithError(w, http.StatusInternalServerError, "Unable to update video", err)
+	variants, failedVariants, variantKeys, err := cfg.storeVariants(r.Context(), temps, videoID, processedPath, fileName, probe, profile, encoding, reusable, tags)
+	storedKeys = append(storedKeys, variantKeys...)
+	if err != nil {
+		removeStored()
+		fail(http.StatusInternalServerError, "Unable to encode video variant", err)
 		return
 	}
+	for _, failure := range failedVariants {
+		cfg.recordUploadEvent(videoID, database.UploadEventVariantFailed, fmt.Sprintf("%s: %s", failure.Name, failure.Reason))
+	}
+
+	// the preview is a nice to have, failing to make one doesn't fail the
+	// upload
+	metadata.PreviewGIFURL = nil
+	if cfg.previewGIF {
+		if err := cfg.storePreviewGIF(r.Context(), temps, processedPath, fileName, probe, tags); err != nil {
+			slog.Warn("Couldn't create preview GIF", "video_id", videoID, "err", err)
+		} else {
+			storedKeys = append(storedKeys, previewGIFKey(fileName))
+			previewURL := cfg.videoURL(previewGIFKey(fileName))
+			metadata.PreviewGIFURL = &previewURL
+		}
+	}
+
+	// the probe's stream indexes are the upload's, and faststart processing
+	// only keeps one subtitle track anyway, so extract from the upload
+	subtitleKeys, captions := cfg.storeSubtitles(r.Context(), videoID, tempFile.Name(), fileName, probe.Subtitles, tags)
+	storedKeys = append(storedKeys, subtitleKeys...)
+
+	// like the preview, a missing hash only means the video can't be
+	// matched against others
+	metadata.PHash = ""
+	if cfg.perceptualHashing {
+		err := cfg.workers.run(r.Context(), func() error {
+			var err error
+			metadata.PHash, err = cfg.perceptualHash(r.Context(), processedPath, probe.Duration)
+			return err
+		})
+		if err != nil {
+			slog.Warn("Couldn't compute perceptual hash", "video_id", videoID, "err", err)
+		}
+	}
+
+	cfg.recordUploadEvent(videoID, database.UploadEventStored, fmt.Sprintf("%s with %d variants", fileName, len(variants)-len(failedVariants)))
 
-	videoURL := fmt.Sprintf("https://%s/%s", cfg.s3CfDistribution, fileName)
+	videoURL := cfg.videoURL(fileName)
 	metadata.VideoURL = &videoURL
+	metadata.AspectRatio = aspectRatio
+	metadata.DynamicRange = probe.dynamicRange()
+	metadata.FastStart = fastStart
+	metadata.Duration = probe.Duration
+	metadata.Width = probe.Width
+	metadata.Height = probe.Height
+	metadata.VideoCodec = probe.VideoCodec
+	// only advice for the uploader, the video is stored either way
+	metadata.LowBitrate = cfg.lowBitrate(probe, size)
+	// describes the previous upload, it's probed again on demand
+	metadata.ProbeJSON = ""
+	metadata.Status = database.VideoStatusReady
 
-	if err = cfg.db.UpdateVideo(metadata); err != nil {
-		log.Println(err)
-		respondWithError(w, http.StatusInternalServerError, "Unable to update video", err)
+	// the quota counts what the upload takes up in storage: the primary,
+	// its variants, the original, preview and captions
+	uploadKeys := append([]string{fileName}, subtitleKeys...)
+	if metadata.OriginalKey != "" {
+		uploadKeys = append(uploadKeys, metadata.OriginalKey)
+	}
+	if metadata.PreviewGIFURL != nil {
+		uploadKeys = append(uploadKeys, previewGIFKey(fileName))
+	}
+	for _, v := range variants {
+		if key, ok := cfg.videoKeyFromURL(v.URL); ok && v.Status != database.VariantStatusFailed {
+			uploadKeys = append(uploadKeys, key)
+		}
+	}
+	objects, err := cfg.objectSizes(r.Context(), uploadKeys)
+	if err != nil {
+		removeStored()
+		fail(http.StatusInternalServerError, "Unable to check storage quota", err)
 		return
 	}
+	var storedBytes int64
+	for _, obj := range objects {
+		storedBytes += obj.SizeBytes
+	}
 
-	respondWithJSON(w, http.StatusOK, metadata)
+	// other uploads may have used up the quota while this one was
+	// processed, so check again while recording the size
+	previousSize, previousStored := metadata.SizeBytes, metadata.StoredBytes
+	reserved, err := cfg.reserveStorage(metadata, size, storedBytes)
+	if err != nil {
+		removeStored()
+		fail(http.StatusInternalServerError, "Unable to check storage quota", err)
+		return
+	}
+	if !reserved {
+		removeStored()
+		fail(http.StatusRequestEntityTooLarge, storageQuotaMessage(cfg.storageQuota), nil)
+		return
+	}
+	metadata.SizeBytes = size
+	metadata.StoredBytes = storedBytes
+
+	// the video never points at the new upload without its variants
+	if err = cfg.db.UpdateVideoUpload(metadata, variants, captions); err != nil {
+		removeStored()
+		if _, err := cfg.db.ReserveVideoBytes(videoID, metadata.UserID, previousSize, previousStored, 0); err != nil {
+			slog.Error("Couldn't restore video size", "video_id", videoID, "err", err)
+		}
+		fail(http.StatusInternalServerError, "Unable to update video", err)
+		return
+	}
+	processed = true
+	cfg.presignCache.invalidate(staleKeys)
+	cfg.statusWatchers.notify(videoID)
+	cfg.recordUploadEvent(videoID, database.UploadEventCommitted, "")
+
+	if len(failedVariants) > 0 {
+		respondWithJSON(w, http.StatusMultiStatus, newPartialUploadResponse(cfg.videoResponse(metadata), variants, failedVariants))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.videoResponse(metadata))
+	return
+}
+
+// partialUploadResponse is the video as stored plus which renditions made
+// it. The upload is playable, only some of its variants are missing.
+type partialUploadResponse struct {
+	videoResponse
+	AvailableVariants []string         `json:"available_variants"`
+	FailedVariants    []variantFailure `json:"failed_variants"`
+}
+
+func newPartialUploadResponse(video videoResponse, variants []database.VideoVariant, failures []variantFailure) partialUploadResponse {
+	available := make([]string, 0, len(variants))
+	for _, v := range variants {
+		if v.Status != database.VariantStatusFailed {
+			available = append(available, v.Name)
+		}
+	}
+	return partialUploadResponse{
+		videoResponse:     video,
+		AvailableVariants: available,
+		FailedVariants:    failures,
+	}
 }
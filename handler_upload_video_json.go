@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// handlerUploadVideoJSON is an alternative to handlerUploadVideo for clients
+// that can only send JSON. The clip comes base64 encoded in the body, so
+// it's meant for small files only and capped at cfg.maxJSONUploadSize.
+func (cfg *apiConfig) handlerUploadVideoJSON(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ContentType     string     `json:"contentType" validate:"required"`
+		Data            string     `json:"data" validate:"required"`
+		ExpiresAt       *time.Time `json:"expires_at"`
+		Category        string     `json:"category"`
+		EncodingProfile string     `json:"encoding_profile"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	// rejections end up in the audit trail like failures further in
+	fail := func(code int, msg string, err error) {
+		cfg.failUpload(w, videoID, code, msg, err)
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		fail(http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		fail(http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	if !cfg.uploadLimiter.acquire(userID) {
+		fail(http.StatusTooManyRequests, "Too many uploads in progress", nil)
+		return
+	}
+	defer cfg.uploadLimiter.release(userID)
+
+	metadata, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		fail(http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if metadata.UserID != userID {
+		fail(http.StatusForbidden, "You can't upload to this video", nil)
+		return
+	}
+	if !cfg.checkVideoQuota(w, metadata) {
+		return
+	}
+	if !cfg.checkDiskSpace(w, videoID, os.TempDir(), r.ContentLength) {
+		return
+	}
+
+	// leave room for the JSON around the encoded data
+	const envelopeSlack = 4 << 10
+	r.Body = http.MaxBytesReader(w, r.Body, int64(base64.StdEncoding.EncodedLen(int(cfg.maxJSONUploadSize)))+envelopeSlack)
+	params := parameters{}
+	if verr := decodeJSONBody(r, &params); verr != nil {
+		respondWithValidationError(w, verr)
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(params.ContentType)
+	if err != nil || mediaType != "video/mp4" {
+		fail(http.StatusBadRequest, "Only video/mp4 uploads are supported", err)
+		return
+	}
+	if int64(base64.StdEncoding.DecodedLen(len(params.Data))) > cfg.maxJSONUploadSize+2 {
+		fail(http.StatusRequestEntityTooLarge, fmt.Sprintf("Decoded video can't exceed %d bytes", cfg.maxJSONUploadSize), nil)
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(params.Data)
+	if err != nil {
+		fail(http.StatusBadRequest, "Data isn't valid base64", err)
+		return
+	}
+	if int64(len(data)) > cfg.maxJSONUploadSize {
+		fail(http.StatusRequestEntityTooLarge, fmt.Sprintf("Decoded video can't exceed %d bytes", cfg.maxJSONUploadSize), nil)
+		return
+	}
+	if len(data) == 0 {
+		fail(http.StatusBadRequest, "Data is empty", nil)
+		return
+	}
+
+	if params.ExpiresAt != nil {
+		expiresAt, err := validExpiresAt(*params.ExpiresAt)
+		if err != nil {
+			fail(http.StatusBadRequest, "Invalid expires_at", err)
+			return
+		}
+		metadata.ExpiresAt = &expiresAt
+	}
+
+	if params.Category != "" {
+		if !cfg.validCategory(params.Category) {
+			fail(http.StatusBadRequest, cfg.categoryMessage(), nil)
+			return
+		}
+		metadata.Category = params.Category
+	}
+
+	encoding, ok := cfg.uploadEncodingProfile(metadata.Category, params.EncodingProfile)
+	if !ok {
+		fail(http.StatusBadRequest, cfg.encodingProfileMessage(params.EncodingProfile), nil)
+		return
+	}
+
+	cfg.processUpload(w, r, metadata, bytes.NewReader(data), mediaType, "", cfg.outputProfile, encoding)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerUploadVideoJSON(t *testing.T) {
+	clip := base64.StdEncoding.EncodeToString([]byte("fake video"))
+	tests := []struct {
+		name     string
+		body     string
+		maxSize  int64
+		wantCode int
+	}{
+		{name: "valid clip", body: fmt.Sprintf(`{"contentType": "video/mp4", "data": %q}`, clip), wantCode: http.StatusOK},
+		{name: "not mp4", body: fmt.Sprintf(`{"contentType": "video/webm", "data": %q}`, clip), wantCode: http.StatusBadRequest},
+		{name: "not base64", body: `{"contentType": "video/mp4", "data": "!!!"}`, wantCode: http.StatusBadRequest},
+		{name: "missing data", body: `{"contentType": "video/mp4"}`, wantCode: http.StatusBadRequest},
+		{name: "empty data", body: `{"contentType": "video/mp4", "data": ""}`, wantCode: http.StatusBadRequest},
+		{name: "decoded clip too large", body: fmt.Sprintf(`{"contentType": "video/mp4", "data": %q}`, clip), maxSize: 4, wantCode: http.StatusRequestEntityTooLarge},
+		{name: "past expiry", body: fmt.Sprintf(`{"contentType": "video/mp4", "data": %q, "expires_at": "2000-01-01T00:00:00Z"}`, clip), wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			if tt.maxSize > 0 {
+				cfg.maxJSONUploadSize = tt.maxSize
+			}
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			video, token := newTestVideo(t, cfg)
+
+			req := newVideoRequest(http.MethodPost, "/api/video_upload/"+video.ID.String()+"/json", video.ID, strings.NewReader(tt.body), token)
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideoJSON(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				if keys := mem.Keys(); len(keys) != 0 {
+					t.Errorf("rejected upload stored %v", keys)
+				}
+				return
+			}
+			stored, _ := cfg.db.GetVideo(video.ID)
+			key, _ := cfg.videoKeyFromURL(*stored.VideoURL)
+			if obj, ok := mem.Lookup(key); !ok || string(obj.Data) != "fake video" {
+				t.Errorf("stored %q under %s, want the decoded clip", obj.Data, key)
+			}
+		})
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// faultyStorage fails the operations that have an error set and passes
+// everything else through.
+type faultyStorage struct {
+	storage.Storage
+	putErr  error
+	copyErr error
+	// undeletable keys are reported as failures by DeleteMany
+	undeletable map[string]bool
+}
+
+func (s *faultyStorage) Put(ctx context.Context, key string, r io.Reader, contentType string, opts ...func(*storage.PutOptions)) error {
+	if s.putErr != nil {
+		return s.putErr
+	}
+	return s.Storage.Put(ctx, key, r, contentType, opts...)
+}
+
+func (s *faultyStorage) Copy(ctx context.Context, srcKey, dstKey string, opts ...func(*storage.PutOptions)) error {
+	if s.copyErr != nil {
+		return s.copyErr
+	}
+	return s.Storage.Copy(ctx, srcKey, dstKey, opts...)
+}
+
+func (s *faultyStorage) DeleteMany(ctx context.Context, keys []string) ([]storage.DeleteFailure, error) {
+	deletable := []string{}
+	failures := []storage.DeleteFailure{}
+	for _, key := range keys {
+		if s.undeletable[key] {
+			failures = append(failures, storage.DeleteFailure{Key: key, Message: "injected failure"})
+			continue
+		}
+		deletable = append(deletable, key)
+	}
+	more, err := s.Storage.DeleteMany(ctx, deletable)
+	return append(failures, more...), err
+}
+
+func TestStorePromoted(t *testing.T) {
+	errInjected := errors.New("injected failure")
+	tests := []struct {
+		name     string
+		existing bool
+		putErr   error
+		copyErr  error
+		opts     []func(*storage.PutOptions)
+		wantErr  error
+		wantKeys []string
+		wantData string
+	}{
+		{
+			name:     "promotes to the final key",
+			wantKeys: []string{"videos/a.mp4"},
+			wantData: "new",
+		},
+		{
+			name:     "overwrites by default",
+			existing: true,
+			wantKeys: []string{"videos/a.mp4"},
+			wantData: "new",
+		},
+		{
+			name:    "failed staging upload",
+			putErr:  errInjected,
+			wantErr: errInjected,
+		},
+		{
+			name:    "failed promotion leaves nothing behind",
+			copyErr: errInjected,
+			wantErr: errInjected,
+		},
+		{
+			name:     "if absent keeps the existing object",
+			existing: true,
+			opts:     []func(*storage.PutOptions){storage.WithIfAbsent()},
+			wantErr:  storage.ErrAlreadyExists,
+			wantKeys: []string{"videos/a.mp4"},
+			wantData: "old",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			if tt.existing {
+				mem.Put(context.Background(), "videos/a.mp4", strings.NewReader("old"), "video/mp4")
+			}
+			cfg.storage = &faultyStorage{Storage: mem, putErr: tt.putErr, copyErr: tt.copyErr}
+
+			err := cfg.storePromoted(context.Background(), "videos/a.mp4", strings.NewReader("new"), "video/mp4", tt.opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("storePromoted err = %v, want %v", err, tt.wantErr)
+			}
+			if got := mem.Keys(); !slices.Equal(got, tt.wantKeys) {
+				t.Errorf("stored keys = %v, want %v", got, tt.wantKeys)
+			}
+			if obj, ok := mem.Lookup("videos/a.mp4"); ok && string(obj.Data) != tt.wantData {
+				t.Errorf("final object = %q, want %q", obj.Data, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestTempOutputPath(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "upload.mp4")
+
+	const n = 20
+	paths := make([]string, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			path, err := tempOutputPath(source, "tubely-processed-*.mp4")
+			if err != nil {
+				t.Error(err)
+			}
+			paths[i] = path
+		}()
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if seen[path] {
+			t.Errorf("%s was handed out twice", path)
+		}
+		seen[path] = true
+		if filepath.Dir(path) != dir {
+			t.Errorf("%s isn't next to the source", path)
+		}
+		if filepath.Ext(path) != ".mp4" {
+			t.Errorf("%s lost the pattern's extension", path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s wasn't reserved: %v", path, err)
+		}
+	}
+}
+
+// fakeProbe is ffprobe's output for an H.264 MP4 of the given size with an
+// audio track.
+func fakeProbe(width, height int) string {
+	return fmt.Sprintf(`{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "h264", "width": %d, "height": %d},
+			{"index": 1, "codec_type": "audio", "codec_name": "aac"}
+		],
+		"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "10.000000", "bit_rate": "8000000"}
+	}`, width, height)
+}
+
+// installFakeFFmpeg points cfg at stand-ins for ffprobe, which always
+// prints probe, and ffmpeg, which copies its first input to its output.
+// Every ffmpeg command line is appended to the returned log.
+func installFakeFFmpeg(t *testing.T, cfg *apiConfig, probe string) string {
+	t.Helper()
+	dir := t.TempDir()
+	probePath := filepath.Join(dir, "probe.json")
+	if err := os.WriteFile(probePath, []byte(probe), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(dir, "ffmpeg.log")
+	cfg.ffprobePath = fakeCommand(t, "ffprobe", "cat "+probePath+"\n")
+	cfg.ffmpegPath = fakeCommand(t, "ffmpeg", `echo "$@" >> `+logPath+`
+in=
+prev=
+for arg; do
+	if [ "$prev" = "-i" ] && [ -z "$in" ]; then in=$arg; fi
+	prev=$arg
+done
+cp "$in" "$arg"
+`)
+	return logPath
+}
+
+// newUploadRequest builds a multipart video upload of data for videoID.
+func newUploadRequest(t *testing.T, videoID uuid.UUID, token, field, fileName, contentType string, data []byte, values map[string]string) *http.Request {
+	t.Helper()
+	body, formType := multipartBody(t, field, fileName, contentType, data, values)
+	req := newVideoRequest(http.MethodPost, "/api/video_upload/"+videoID.String(), videoID, body, token)
+	req.Header.Set("Content-Type", formType)
+	return req
+}
+
+func TestHandlerUploadVideoResolution(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		maxDimension  int
+		wantCode      int
+	}{
+		{name: "small video", width: 320, height: 180, maxDimension: 7680, wantCode: http.StatusOK},
+		{name: "at the limit", width: 640, height: 360, maxDimension: 640, wantCode: http.StatusOK},
+		{name: "too wide", width: 8000, height: 180, maxDimension: 7680, wantCode: http.StatusBadRequest},
+		{name: "too tall", width: 180, height: 8000, maxDimension: 7680, wantCode: http.StatusBadRequest},
+		{name: "no video stream", width: 0, height: 0, maxDimension: 7680, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.maxVideoDimension = tt.maxDimension
+			installFakeFFmpeg(t, cfg, fakeProbe(tt.width, tt.height))
+			video, token := newTestVideo(t, cfg)
+
+			req := newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil)
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotURL := stored.VideoURL != nil; gotURL != (tt.wantCode == http.StatusOK) {
+				t.Errorf("video URL set = %v after a %d", gotURL, rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoEncrypted(t *testing.T) {
+	tests := []struct {
+		name     string
+		probe    string
+		wantCode int
+	}{
+		{name: "clear video", probe: fakeProbe(320, 180), wantCode: http.StatusOK},
+		{
+			name: "protected sample entry",
+			probe: `{
+				"streams": [{"index": 0, "codec_type": "video", "codec_name": "h264", "codec_tag_string": "encv", "width": 320, "height": 180}],
+				"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "10.000000"}
+			}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "encryption side data",
+			probe: `{
+				"streams": [{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 320, "height": 180,
+					"side_data_list": [{"side_data_type": "Encryption initialization data"}]}],
+				"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "10.000000"}
+			}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			logPath := installFakeFFmpeg(t, cfg, tt.probe)
+			video, token := newTestVideo(t, cfg)
+
+			req := newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil)
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode == http.StatusOK {
+				return
+			}
+			if !strings.Contains(rec.Body.String(), "Encrypted/DRM-protected media not supported") {
+				t.Errorf("body = %s, want the DRM message", rec.Body)
+			}
+			if _, err := os.Stat(logPath); !errors.Is(err, os.ErrNotExist) {
+				t.Error("ffmpeg ran on an encrypted upload")
+			}
+			if keys := mem.Keys(); len(keys) != 0 {
+				t.Errorf("rejected upload stored %v", keys)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoFaststartFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		strict   bool
+		wantCode int
+	}{
+		{name: "stores the original upload", wantCode: http.StatusOK},
+		{name: "strict fails the upload", strict: true, wantCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.faststartStrict = tt.strict
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			cfg.ffmpegPath = fakeCommand(t, "ffmpeg", "exit 1\n")
+			video, token := newTestVideo(t, cfg)
+
+			req := newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil)
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.strict {
+				if stored.VideoURL != nil || len(mem.Keys()) != 0 {
+					t.Errorf("failed upload stored %v", mem.Keys())
+				}
+				return
+			}
+			if stored.FastStart {
+				t.Error("video stored as faststart without processing")
+			}
+			key, _ := cfg.videoKeyFromURL(*stored.VideoURL)
+			if obj, ok := mem.Lookup(key); !ok || string(obj.Data) != "fake video" {
+				t.Errorf("stored %q under %s, want the original upload", obj.Data, key)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoSizeLimits(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxUploadSize   int64
+		multipartMemory int64
+		wantCode        int
+	}{
+		{name: "buffered in memory", maxUploadSize: 1 << 20, multipartMemory: 1 << 20, wantCode: http.StatusOK},
+		{name: "spilled to disk", maxUploadSize: 1 << 20, multipartMemory: 16, wantCode: http.StatusOK},
+		{name: "over the upload cap", maxUploadSize: 512, multipartMemory: 1 << 20, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.maxUploadSize = tt.maxUploadSize
+			cfg.multipartMemory = tt.multipartMemory
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			video, token := newTestVideo(t, cfg)
+			data := bytes.Repeat([]byte("v"), 4<<10)
+
+			req := newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", data, nil)
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			stored, _ := cfg.db.GetVideo(video.ID)
+			key, _ := cfg.videoKeyFromURL(*stored.VideoURL)
+			if obj, ok := mem.Lookup(key); !ok || !bytes.Equal(obj.Data, data) {
+				t.Errorf("stored %d bytes under %s, want the %d uploaded", len(obj.Data), key, len(data))
+			}
+		})
+	}
+}
+
+func TestContentLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    int64
+		wantErr bool
+	}{
+		{name: "sized file", data: "video", want: 5},
+		{name: "empty file", data: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "video.mp4")
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			opt, err := contentLength(f)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("contentLength err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var o storage.PutOptions
+			opt(&o)
+			if o.ContentLength != tt.want {
+				t.Errorf("ContentLength = %d, want %d", o.ContentLength, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// handlerUserVideosDelete removes all of the caller's videos and their
+// stored objects. Videos whose objects couldn't all be removed are kept so
+// the request can be retried.
+func (cfg *apiConfig) handlerUserVideosDelete(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		DeletedVideos  int                     `json:"deleted_videos"`
+		DeletedObjects int                     `json:"deleted_objects"`
+		FailedVideos   int                     `json:"failed_videos"`
+		Failures       []storage.DeleteFailure `json:"failures"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	videos, err := cfg.db.GetVideos(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	keysByVideo := make([][]string, len(videos))
+	allKeys := []string{}
+	for i, video := range videos {
+		keys, err := cfg.videoObjectKeys(video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't list video objects", err)
+			return
+		}
+		// objects a video of another user reuses stay in place
+		keys, err = cfg.unsharedObjectKeys(keys, videos)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't list video objects", err)
+			return
+		}
+		keysByVideo[i] = keys
+		allKeys = append(allKeys, keys...)
+	}
+	cfg.presignCache.invalidate(allKeys)
+
+	ctx, cancel := cfg.storageContext(r.Context())
+	defer cancel()
+	failures, err := cfg.storage.DeleteMany(ctx, allKeys)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video objects", err)
+		return
+	}
+	failed := map[string]bool{}
+	for _, f := range failures {
+		failed[f.Key] = true
+	}
+
+	resp := response{
+		DeletedObjects: len(allKeys) - len(failed),
+		Failures:       failures,
+	}
+	for i, video := range videos {
+		ok := true
+		for _, key := range keysByVideo[i] {
+			if failed[key] {
+				ok = false
+				break
+			}
+		}
+		if !ok {
+			resp.FailedVideos++
+			continue
+		}
+
+		if err := cfg.db.DeleteVideo(video.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
+			return
+		}
+		cfg.removeTranscodeWork(video.ID)
+		resp.DeletedVideos++
+	}
+
+	code := http.StatusOK
+	if resp.FailedVideos > 0 {
+		code = http.StatusMultiStatus
+	}
+	respondWithJSON(w, code, resp)
+}
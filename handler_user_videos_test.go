@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerUserVideosDelete(t *testing.T) {
+	tests := []struct {
+		name        string
+		undeletable string
+		wantCode    int
+		wantDeleted int
+		wantKept    []string
+		wantGone    []string
+	}{
+		{
+			name:        "deletes every video",
+			wantCode:    http.StatusOK,
+			wantDeleted: 2,
+			wantKept:    []string{"landscape/shared.mp4"},
+			wantGone:    []string{"landscape/own.mp4"},
+		},
+		{
+			name:        "videos with undeletable objects are kept",
+			undeletable: "landscape/own.mp4",
+			wantCode:    http.StatusMultiStatus,
+			wantDeleted: 1,
+			wantKept:    []string{"landscape/shared.mp4", "landscape/own.mp4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.storage = &faultyStorage{Storage: mem, undeletable: map[string]bool{tt.undeletable: true}}
+
+			// the caller owns two videos, one of them stored under the
+			// same object as another user's video
+			own, token := newTestVideo(t, cfg)
+			shared, err := cfg.db.CreateVideo(database.CreateVideoParams{Title: "Shared", UserID: own.UserID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			others, _ := newTestVideo(t, cfg)
+			for video, key := range map[*database.Video]string{&own: "landscape/own.mp4", &shared: "landscape/shared.mp4", &others: "landscape/shared.mp4"} {
+				mem.Put(context.Background(), key, strings.NewReader("video"), "video/mp4")
+				videoURL := cfg.videoURL(key)
+				video.VideoURL = &videoURL
+				if err := cfg.db.UpdateVideo(*video); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/users/me/videos", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			cfg.handlerUserVideosDelete(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			var resp struct {
+				DeletedVideos int `json:"deleted_videos"`
+			}
+			decodeData(t, rec, &resp)
+			if resp.DeletedVideos != tt.wantDeleted {
+				t.Errorf("deleted_videos = %d, want %d", resp.DeletedVideos, tt.wantDeleted)
+			}
+			for _, key := range tt.wantKept {
+				if _, ok := mem.Lookup(key); !ok {
+					t.Errorf("%s was deleted", key)
+				}
+			}
+			for _, key := range tt.wantGone {
+				if _, ok := mem.Lookup(key); ok {
+					t.Errorf("%s wasn't deleted", key)
+				}
+			}
+			if kept, err := cfg.db.GetVideo(others.ID); err != nil || kept.ID != others.ID {
+				t.Errorf("other user's video is gone: %v", err)
+			}
+			remaining, err := cfg.db.GetVideos(own.UserID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(remaining) != 2-tt.wantDeleted {
+				t.Errorf("%d videos left, want %d", len(remaining), 2-tt.wantDeleted)
+			}
+		})
+	}
+}
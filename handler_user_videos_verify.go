@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	verifyStatusOK          = "ok"
+	verifyStatusNotUploaded = "not_uploaded"
+	verifyStatusMissing     = "missing"
+	verifyStatusEmpty       = "empty"
+	verifyStatusError       = "error"
+)
+
+type videoVerifyResult struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	SizeBytes int64     `json:"size_bytes,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// handlerUserVideosVerify checks that every one of the caller's uploaded
+// videos can still be signed and that its object exists and isn't empty.
+func (cfg *apiConfig) handlerUserVideosVerify(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Checked int                 `json:"checked"`
+		Failed  int                 `json:"failed"`
+		Videos  []videoVerifyResult `json:"videos"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	videos, err := cfg.db.GetVideos(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	results := make([]videoVerifyResult, len(videos))
+	sem := make(chan struct{}, max(cfg.verifyConcurrency, 1))
+	var wg sync.WaitGroup
+	for i, video := range videos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = cfg.verifyVideo(r.Context(), video)
+		}()
+	}
+	wg.Wait()
+
+	resp := response{
+		Checked: len(results),
+		Videos:  results,
+	}
+	for _, result := range results {
+		if result.Status != verifyStatusOK && result.Status != verifyStatusNotUploaded {
+			resp.Failed++
+		}
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// verifyVideo presigns a fresh URL for the video, bypassing the cache, and
+// heads its object.
+func (cfg *apiConfig) verifyVideo(ctx context.Context, video database.Video) videoVerifyResult {
+	result := videoVerifyResult{
+		VideoID: video.ID,
+		Title:   video.Title,
+	}
+	if video.VideoURL == nil {
+		result.Status = verifyStatusNotUploaded
+		return result
+	}
+	key, ok := cfg.videoKeyFromURL(*video.VideoURL)
+	if !ok {
+		result.Status = verifyStatusError
+		result.Error = "couldn't locate video object"
+		return result
+	}
+
+	ctx, cancel := cfg.storageContext(ctx)
+	defer cancel()
+	if _, err := cfg.presignWithRetry(ctx, key, cfg.presignTTL); err != nil {
+		result.Status = verifyStatusError
+		result.Error = "couldn't sign video URL: " + err.Error()
+		return result
+	}
+	info, err := cfg.storage.Head(ctx, key)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		result.Status = verifyStatusMissing
+	case err != nil:
+		result.Status = verifyStatusError
+		result.Error = err.Error()
+	case info.Size == 0:
+		result.Status = verifyStatusEmpty
+	default:
+		result.Status = verifyStatusOK
+		result.SizeBytes = info.Size
+	}
+	return result
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// slowHeadStorage counts how many Heads run at once, each taking a while.
+type slowHeadStorage struct {
+	storage.Storage
+	running, maxRunning atomic.Int32
+}
+
+func (s *slowHeadStorage) Head(ctx context.Context, key string) (storage.ObjectInfo, error) {
+	n := s.running.Add(1)
+	defer s.running.Add(-1)
+	for {
+		m := s.maxRunning.Load()
+		if n <= m || s.maxRunning.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return s.Storage.Head(ctx, key)
+}
+
+type verifyResponse struct {
+	Checked int                 `json:"checked"`
+	Failed  int                 `json:"failed"`
+	Videos  []videoVerifyResult `json:"videos"`
+}
+
+func verifyVideos(t *testing.T, cfg *apiConfig, token string) verifyResponse {
+	t.Helper()
+	req := newVideoRequest(http.MethodGet, "/api/users/me/videos/verify", uuid.Nil, nil, token)
+	rec := httptest.NewRecorder()
+	cfg.handlerUserVideosVerify(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp verifyResponse
+	decodeData(t, rec, &resp)
+	return resp
+}
+
+func TestHandlerUserVideosVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		// videoURL is the stored URL, or none for a video that was never
+		// uploaded. If stored, object is stored under the URL's key.
+		videoURL   string
+		stored     bool
+		object     string
+		wantStatus string
+		wantSize   int64
+	}{
+		{name: "present", videoURL: "landscape/ok.mp4", stored: true, object: "video", wantStatus: verifyStatusOK, wantSize: 5},
+		{name: "missing", videoURL: "landscape/missing.mp4", wantStatus: verifyStatusMissing},
+		{name: "empty", videoURL: "landscape/empty.mp4", stored: true, wantStatus: verifyStatusEmpty},
+		{name: "never uploaded", wantStatus: verifyStatusNotUploaded},
+		{name: "somewhere else", videoURL: "https://elsewhere.example.com/a.mp4", wantStatus: verifyStatusError},
+	}
+
+	cfg, mem := newTestConfig(t)
+	first, token := newTestVideo(t, cfg)
+	want := map[uuid.UUID]int{}
+	for i, tt := range tests {
+		video := first
+		if i > 0 {
+			video = newUserVideo(t, cfg, first)
+		}
+		video.Title = tt.name
+		if tt.videoURL != "" {
+			videoURL := tt.videoURL
+			if !strings.HasPrefix(videoURL, "https://") {
+				videoURL = cfg.videoURL(tt.videoURL)
+			}
+			video.VideoURL = &videoURL
+		}
+		if tt.stored {
+			mem.Put(context.Background(), tt.videoURL, strings.NewReader(tt.object), "video/mp4")
+		}
+		if err := cfg.db.UpdateVideo(video); err != nil {
+			t.Fatal(err)
+		}
+		want[video.ID] = i
+	}
+	// someone else's videos aren't checked
+	newTestVideo(t, cfg)
+
+	resp := verifyVideos(t, cfg, token)
+	if resp.Checked != len(tests) {
+		t.Errorf("checked = %d, want %d", resp.Checked, len(tests))
+	}
+	// missing, empty and unlocatable objects are failures, videos that
+	// were never uploaded aren't
+	if resp.Failed != 3 {
+		t.Errorf("failed = %d, want 3", resp.Failed)
+	}
+	for _, result := range resp.Videos {
+		i, ok := want[result.VideoID]
+		if !ok {
+			t.Errorf("result for unexpected video %s", result.VideoID)
+			continue
+		}
+		tt := tests[i]
+		t.Run(tt.name, func(t *testing.T) {
+			if result.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q (%s)", result.Status, tt.wantStatus, result.Error)
+			}
+			if result.SizeBytes != tt.wantSize {
+				t.Errorf("size = %d, want %d", result.SizeBytes, tt.wantSize)
+			}
+			if result.Title != tt.name {
+				t.Errorf("title = %q, want %q", result.Title, tt.name)
+			}
+		})
+	}
+}
+
+func TestHandlerUserVideosVerifyConcurrency(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		videos      int
+		wantMax     int32
+	}{
+		{name: "bounded", concurrency: 2, videos: 6, wantMax: 2},
+		{name: "one at a time", concurrency: 1, videos: 3, wantMax: 1},
+		{name: "unset runs one at a time", concurrency: 0, videos: 3, wantMax: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			store := &slowHeadStorage{Storage: mem}
+			cfg.storage = store
+			cfg.verifyConcurrency = tt.concurrency
+			video, token := newTestVideo(t, cfg)
+			for i := range tt.videos {
+				if i > 0 {
+					video = newUserVideo(t, cfg, video)
+				}
+				markUploaded(t, cfg, video, nil)
+				mem.Put(context.Background(), "landscape/"+video.ID.String()+".mp4", strings.NewReader("video"), "video/mp4")
+			}
+
+			resp := verifyVideos(t, cfg, token)
+			if resp.Failed != 0 {
+				t.Errorf("failed = %d, want 0: %+v", resp.Failed, resp.Videos)
+			}
+			if got := store.maxRunning.Load(); got != tt.wantMax {
+				t.Errorf("concurrent checks = %d, want %d", got, tt.wantMax)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxAnalyticsDays = 90
+
+// handlerVideoAnalytics reports a video's views to its owner, in hour or day
+// buckets over the last days (7 by default). Every bucket in the range is
+// listed, including empty ones.
+func (cfg *apiConfig) handlerVideoAnalytics(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		TotalViews int64                     `json:"total_views"`
+		Interval   string                    `json:"interval"`
+		Buckets    []database.VideoViewCount `json:"buckets"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	var step time.Duration
+	switch interval {
+	case "", "day":
+		interval = "day"
+		step = 24 * time.Hour
+	case "hour":
+		step = time.Hour
+	default:
+		respondWithError(w, http.StatusBadRequest, "interval must be hour or day", nil)
+		return
+	}
+	days := 7
+	if daysParam := r.URL.Query().Get("days"); daysParam != "" {
+		days, err = strconv.Atoi(daysParam)
+		if err != nil || days < 1 || days > maxAnalyticsDays {
+			respondWithError(w, http.StatusBadRequest, "days must be between 1 and 90", err)
+			return
+		}
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't view analytics of this video", nil)
+		return
+	}
+
+	// the range ends with the current bucket and spans days in total
+	end := time.Now().UTC().Truncate(step)
+	start := end.Add(-time.Duration(days) * 24 * time.Hour).Add(step)
+	hourly, err := cfg.db.GetVideoViews(videoID, start)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video views", err)
+		return
+	}
+
+	buckets := []database.VideoViewCount{}
+	index := map[time.Time]int{}
+	for t := start; !t.After(end); t = t.Add(step) {
+		index[t] = len(buckets)
+		buckets = append(buckets, database.VideoViewCount{VideoID: videoID, Bucket: t})
+	}
+	for _, vc := range hourly {
+		if i, ok := index[vc.Bucket.UTC().Truncate(step)]; ok {
+			buckets[i].Count += vc.Count
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		TotalViews: video.ViewCount,
+		Interval:   interval,
+		Buckets:    buckets,
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// captionFileNames names each caption track after its language, numbering
+// repeats of a language from the second track on: en.vtt, en-2.vtt.
+func captionFileNames(captions []database.VideoCaption) []string {
+	seen := map[string]int{}
+	names := make([]string, len(captions))
+	for i, caption := range captions {
+		seen[caption.Language]++
+		if n := seen[caption.Language]; n > 1 {
+			names[i] = fmt.Sprintf("%s-%d.vtt", caption.Language, n)
+		} else {
+			names[i] = caption.Language + ".vtt"
+		}
+	}
+	return names
+}
+
+// handlerVideoCaptionsZip streams every caption track of the video as one
+// zip archive. Tracks are copied from storage straight into the response,
+// so the archive is never held in memory.
+func (cfg *apiConfig) handlerVideoCaptionsZip(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't download these captions", nil)
+		return
+	}
+
+	captions, err := cfg.db.GetVideoCaptions(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video captions", err)
+		return
+	}
+	if len(captions) == 0 {
+		respondWithError(w, http.StatusNotFound, "Video has no captions", nil)
+		return
+	}
+	keys := make([]string, len(captions))
+	for i, caption := range captions {
+		key, ok := cfg.videoKeyFromURL(caption.URL)
+		if !ok {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't locate caption object", nil)
+			return
+		}
+		keys[i] = key
+	}
+
+	// the first track is fetched before any headers go out, so a storage
+	// outage is still reported as an error rather than an empty archive
+	first, err := cfg.storage.Get(r.Context(), keys[0], "")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't fetch captions", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", downloadDisposition(video.Title+" captions", ".zip"))
+	w.WriteHeader(http.StatusOK)
+
+	// headers are already sent, all we can do on failure is log and cut the
+	// archive short
+	zw := zip.NewWriter(w)
+	for i, name := range captionFileNames(captions) {
+		body := first.Body
+		if i > 0 {
+			obj, err := cfg.storage.Get(r.Context(), keys[i], "")
+			if err != nil {
+				slog.Warn("Couldn't fetch captions", "video_id", videoID, "key", keys[i], "err", err)
+				return
+			}
+			body = obj.Body
+		}
+		err := copyZipEntry(zw, name, body)
+		body.Close()
+		if err != nil {
+			slog.Warn("Couldn't stream captions", "video_id", videoID, "key", keys[i], "err", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		slog.Warn("Couldn't finish captions archive", "video_id", videoID, "err", err)
+	}
+}
+
+func copyZipEntry(zw *zip.Writer, name string, src io.Reader) error {
+	dst, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
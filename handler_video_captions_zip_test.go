@@ -0,0 +1,119 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestCaptionFileNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		languages []string
+		want      []string
+	}{
+		{name: "none", languages: nil, want: []string{}},
+		{name: "distinct", languages: []string{"en", "fr"}, want: []string{"en.vtt", "fr.vtt"}},
+		{name: "repeats numbered", languages: []string{"en", "fr", "en", "en"}, want: []string{"en.vtt", "fr.vtt", "en-2.vtt", "en-3.vtt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captions := make([]database.VideoCaption, len(tt.languages))
+			for i, language := range tt.languages {
+				captions[i].Language = language
+			}
+			if got := captionFileNames(captions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("captionFileNames = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerVideoCaptionsZip(t *testing.T) {
+	cfg, mem := newTestConfig(t)
+	video, token := newTestVideo(t, cfg)
+	bare := newUserVideo(t, cfg, video)
+	_, strangerToken := newTestVideo(t, cfg)
+
+	tracks := map[string]string{
+		"captions/en.vtt":   "WEBVTT\n\nhello",
+		"captions/fr.vtt":   "WEBVTT\n\nbonjour",
+		"captions/en-2.vtt": "WEBVTT\n\nhi",
+	}
+	for key, body := range tracks {
+		mem.Put(context.Background(), key, strings.NewReader(body), "text/vtt")
+	}
+	videoURL := cfg.videoURL("landscape/abc.mp4")
+	video.VideoURL = &videoURL
+	captions := []database.VideoCaption{
+		{Language: "en", Label: "English", URL: cfg.videoURL("captions/en.vtt")},
+		{Language: "fr", Label: "Français", URL: cfg.videoURL("captions/fr.vtt")},
+		{Language: "en", Label: "English (simple)", URL: cfg.videoURL("captions/en-2.vtt")},
+	}
+	if err := cfg.db.UpdateVideoUpload(video, nil, captions); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		video       database.Video
+		token       string
+		wantCode    int
+		wantEntries map[string]string
+	}{
+		{name: "owner", video: video, token: token, wantCode: http.StatusOK, wantEntries: map[string]string{
+			"en.vtt":   tracks["captions/en.vtt"],
+			"fr.vtt":   tracks["captions/fr.vtt"],
+			"en-2.vtt": tracks["captions/en-2.vtt"],
+		}},
+		{name: "no token", video: video, token: "", wantCode: http.StatusUnauthorized},
+		{name: "not the owner", video: video, token: strangerToken, wantCode: http.StatusForbidden},
+		{name: "no captions", video: bare, token: token, wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newVideoRequest(http.MethodGet, "/api/videos/"+tt.video.ID.String()+"/captions.zip", tt.video.ID, nil, tt.token)
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoCaptionsZip(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantEntries == nil {
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/zip" {
+				t.Errorf("Content-Type = %q, want application/zip", ct)
+			}
+			zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for _, f := range zr.File {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := io.ReadAll(rc)
+				rc.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[f.Name] = string(data)
+			}
+			if !reflect.DeepEqual(got, tt.wantEntries) {
+				t.Errorf("entries = %v, want %v", got, tt.wantEntries)
+			}
+		})
+	}
+}
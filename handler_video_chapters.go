@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// handlerVideoChapters replaces the video's chapters with the JSON array in
+// the body and stores them as a WebVTT file next to the video.
+func (cfg *apiConfig) handlerVideoChapters(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't edit this video", nil)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video hasn't been uploaded yet", nil)
+		return
+	}
+	if video.Duration <= 0 {
+		// uploads from before durations were recorded
+		respondWithError(w, http.StatusUnprocessableEntity, "Video duration is unknown, upload it again to add chapters", nil)
+		return
+	}
+	key, ok := cfg.videoKeyFromURL(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't locate video object", nil)
+		return
+	}
+
+	chapters := []chapter{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&chapters); err != nil {
+		respondWithValidationError(w, &validationError{Fields: []fieldError{{
+			Field:   "body",
+			Message: err.Error(),
+		}}})
+		return
+	}
+	if verr := validateChapters(chapters, video.Duration); verr != nil {
+		respondWithValidationError(w, verr)
+		return
+	}
+
+	objectKey := chaptersKey(key, video.ID)
+	vtt := chaptersVTT(chapters, video.Duration)
+	if err := cfg.storePromoted(r.Context(), objectKey, strings.NewReader(vtt), "text/vtt"); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store chapters", err)
+		return
+	}
+
+	chaptersURL := cfg.videoURL(objectKey)
+	// a video that already had chapters keeps pointing at the new ones, any
+	// other video would leave them orphaned if the update fails
+	replaced := video.ChaptersURL != nil && *video.ChaptersURL == chaptersURL
+	video.ChaptersURL = &chaptersURL
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		if !replaced {
+			ctx, cancel := cfg.storageContext(context.Background())
+			cfg.storage.Delete(ctx, objectKey)
+			cancel()
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.videoResponse(video))
+}
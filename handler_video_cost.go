@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// handlerVideoCost roughly prices a month of the video: every object it
+// has in storage at the configured per-GB rate, objects other videos reuse
+// split evenly between them, plus egress estimated as the primary file
+// served once per view over the last costWindowDays. Views are counted per
+// playback, not per Range request.
+// Thumbnails kept in the assets directory aren't in object storage and
+// don't count.
+func (cfg *apiConfig) handlerVideoCost(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		costEstimate
+		Views   int64        `json:"views"`
+		Objects []objectSize `json:"objects"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	allowed, err := cfg.canInspect(userID, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check access", err)
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, "You can't view the cost of this video", nil)
+		return
+	}
+
+	keys, err := cfg.videoObjectKeys(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list video objects", err)
+		return
+	}
+	if video.ThumbnailURL != nil {
+		if key, ok := cfg.videoKeyFromURL(*video.ThumbnailURL); ok {
+			keys = append(keys, key)
+		}
+	}
+	objects, err := cfg.objectSizes(r.Context(), keys)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't inspect video objects", err)
+		return
+	}
+
+	shares, err := cfg.objectShares(video, keys)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't inspect video objects", err)
+		return
+	}
+
+	var primaryKey string
+	if video.VideoURL != nil {
+		primaryKey, _ = cfg.videoKeyFromURL(*video.VideoURL)
+	}
+	var storageBytes, primaryBytes int64
+	for i, obj := range objects {
+		objects[i].SharedBy = shares[obj.Key]
+		storageBytes += objects[i].chargedBytes()
+		if obj.Key == primaryKey {
+			primaryBytes = obj.SizeBytes
+		}
+	}
+
+	since := time.Now().UTC().Add(-costWindowDays * 24 * time.Hour)
+	counts, err := cfg.db.GetVideoViews(videoID, since)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video views", err)
+		return
+	}
+	var views int64
+	for _, vc := range counts {
+		views += int64(vc.Count)
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		costEstimate: cfg.costRates.estimate(storageBytes, views*primaryBytes),
+		Views:        views,
+		Objects:      objects,
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+type estimateParams struct {
+	DurationSeconds float64  `json:"durationSeconds" validate:"required"`
+	Resolution      string   `json:"resolution" validate:"required"`
+	Variants        []string `json:"variants"`
+}
+
+// validateEstimateParams checks the request and returns the variants to
+// estimate. Without a variants list it's the ones an upload
+// of that size would get, whatever its bitrate.
+func validateEstimateParams(params estimateParams) ([]Variant, *validationError) {
+	var errs []fieldError
+	if params.DurationSeconds <= 0 {
+		errs = append(errs, fieldError{Field: "durationSeconds", Message: "must be positive"})
+	}
+	var width, height int
+	if _, err := fmt.Sscanf(params.Resolution, "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+		errs = append(errs, fieldError{Field: "resolution", Message: "must be WIDTHxHEIGHT, e.g. 1920x1080"})
+	}
+	if len(errs) > 0 {
+		return nil, &validationError{Fields: errs}
+	}
+
+	possible := variantsFor(width, height, 0, nil)
+	if params.Variants == nil {
+		return possible, nil
+	}
+	variants := []Variant{}
+	for _, name := range params.Variants {
+		i := slices.IndexFunc(possible, func(v Variant) bool { return v.Name == name })
+		if i < 0 {
+			errs = append(errs, fieldError{Field: "variants", Message: fmt.Sprintf("%q isn't a variant of a %s source", name, params.Resolution)})
+			continue
+		}
+		variants = append(variants, possible[i])
+	}
+	if len(errs) > 0 {
+		return nil, &validationError{Fields: errs}
+	}
+	return variants, nil
+}
+
+// handlerVideoEstimate predicts how long processing an upload will take,
+// so clients can show an ETA before they start it. It doesn't account for
+// other uploads queued on the worker pool.
+func (cfg *apiConfig) handlerVideoEstimate(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	if _, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms); err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	params := estimateParams{}
+	if verr := decodeJSONBody(r, &params); verr != nil {
+		respondWithValidationError(w, verr)
+		return
+	}
+	variants, verr := validateEstimateParams(params)
+	if verr != nil {
+		respondWithValidationError(w, verr)
+		return
+	}
+
+	parallel := min(cfg.variantParallelism, cfg.workers.stats().Workers)
+	respondWithJSON(w, http.StatusOK, cfg.processingModel.estimate(params.DurationSeconds, variants, parallel))
+}
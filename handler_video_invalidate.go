@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// handlerVideoInvalidate evicts the video's objects from the presign
+// cache, for when they changed behind the API's back. Replacing, deleting
+// or making a video private already does this.
+func (cfg *apiConfig) handlerVideoInvalidate(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Invalidated int `json:"invalidated"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	allowed, err := cfg.canInspect(userID, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check access", err)
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, "You can't invalidate this video", nil)
+		return
+	}
+
+	n, err := cfg.invalidateVideoURLs(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list video objects", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{Invalidated: n})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerVideoInvalidate(t *testing.T) {
+	cfg, mem := newTestConfig(t)
+	counting := &countingStorage{Storage: mem}
+	cfg.storage = counting
+	video, token := newTestVideo(t, cfg)
+	_, strangerToken := newTestVideo(t, cfg)
+	mem.Put(context.Background(), "landscape/abc.mp4", strings.NewReader("video"), "video/mp4")
+	videoURL := cfg.videoURL("landscape/abc.mp4")
+	video.VideoURL = &videoURL
+	video.Visibility = database.VideoVisibilityPublic
+	video.PublishState = database.VideoPublishPublished
+	video.ProbeJSON = fakeProbe(1280, 720)
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		t.Fatal(err)
+	}
+
+	signedURL := func() string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoRenditions(rec, newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/renditions", video.ID, nil, ""))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("renditions status = %d: %s", rec.Code, rec.Body)
+		}
+		var got []rendition
+		decodeData(t, rec, &got)
+		return got[0].URL
+	}
+	invalidate := func(token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoInvalidate(rec, newVideoRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/invalidate", video.ID, nil, token))
+		return rec
+	}
+
+	first := signedURL()
+	if again := signedURL(); again != first {
+		t.Fatalf("second request got %s, want the cached %s", again, first)
+	}
+
+	tests := []struct {
+		name            string
+		token           string
+		wantCode        int
+		wantInvalidated int
+	}{
+		{name: "no token", token: "", wantCode: http.StatusUnauthorized},
+		{name: "not the owner", token: strangerToken, wantCode: http.StatusForbidden},
+		{name: "owner", token: token, wantCode: http.StatusOK, wantInvalidated: 1},
+		{name: "nothing left to invalidate", token: token, wantCode: http.StatusOK, wantInvalidated: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := invalidate(tt.token)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Invalidated int `json:"invalidated"`
+			}
+			decodeData(t, rec, &resp)
+			if resp.Invalidated != tt.wantInvalidated {
+				t.Errorf("invalidated = %d, want %d", resp.Invalidated, tt.wantInvalidated)
+			}
+		})
+	}
+
+	if fresh := signedURL(); fresh == first {
+		t.Errorf("request after invalidating got the stale %s", first)
+	}
+	if got := counting.presigns.Load(); got != 2 {
+		t.Errorf("presigns = %d, want 2", got)
+	}
+}
+
+func TestHandlerVideoMetaUpdateInvalidatesPrivate(t *testing.T) {
+	tests := []struct {
+		visibility string
+		wantCached bool
+	}{
+		{visibility: database.VideoVisibilityPrivate, wantCached: false},
+		{visibility: database.VideoVisibilityPublic, wantCached: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.visibility, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+			videoURL := cfg.videoURL("landscape/abc.mp4")
+			video.VideoURL = &videoURL
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := cfg.presignGet(context.Background(), "landscape/abc.mp4", cfg.presignTTL); err != nil {
+				t.Fatal(err)
+			}
+
+			body := strings.NewReader(`{"visibility":"` + tt.visibility + `"}`)
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoMetaUpdate(rec, newVideoRequest(http.MethodPatch, "/api/videos/"+video.ID.String(), video.ID, body, token))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			_, cached := cfg.presignCache.get(presignCacheKey{key: "landscape/abc.mp4"}, cfg.presignTTL, time.Now())
+			if cached != tt.wantCached {
+				t.Errorf("URL still cached = %v, want %v", cached, tt.wantCached)
+			}
+		})
+	}
+}
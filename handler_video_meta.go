@@ -1,8 +1,11 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
@@ -19,17 +22,15 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+	if verr := decodeJSONBody(r, &params); verr != nil {
+		respondWithValidationError(w, verr)
 		return
 	}
 	params.UserID = userID
@@ -40,7 +41,95 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, video)
+	respondWithJSON(w, http.StatusCreated, cfg.videoResponse(video))
+}
+
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       *string    `json:"title" validate:"nonempty,max=200"`
+		Description *string    `json:"description" validate:"max=5000"`
+		ExpiresAt   *time.Time `json:"expires_at"`
+		Visibility  *string    `json:"visibility"`
+		Category    *string    `json:"category"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	params := parameters{}
+	if verr := decodeJSONBody(r, &params); verr != nil {
+		respondWithValidationError(w, verr)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't edit this video", nil)
+		return
+	}
+
+	if params.Title != nil {
+		video.Title = *params.Title
+	}
+	if params.Description != nil {
+		video.Description = *params.Description
+	}
+	if params.ExpiresAt != nil {
+		expiresAt, err := validExpiresAt(*params.ExpiresAt)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid expires_at", err)
+			return
+		}
+		video.ExpiresAt = &expiresAt
+	}
+	if params.Visibility != nil {
+		switch *params.Visibility {
+		case database.VideoVisibilityPrivate, database.VideoVisibilityPublic:
+			video.Visibility = *params.Visibility
+		default:
+			respondWithError(w, http.StatusBadRequest, "visibility must be private or public", nil)
+			return
+		}
+	}
+	if params.Category != nil {
+		if !cfg.validCategory(*params.Category) {
+			respondWithError(w, http.StatusBadRequest, cfg.categoryMessage(), nil)
+			return
+		}
+		video.Category = *params.Category
+	}
+
+	err = cfg.db.UpdateVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+	if video.Visibility == database.VideoVisibilityPrivate {
+		if _, err := cfg.invalidateVideoURLs(video); err != nil {
+			slog.Warn("Couldn't invalidate presigned URLs", "video_id", videoID, "err", err)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.videoResponse(video))
 }
 
 func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
@@ -56,7 +145,7 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
@@ -71,12 +160,40 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
 		return
 	}
+	// the records listing the video's objects are about to go
+	if _, err := cfg.invalidateVideoURLs(video); err != nil {
+		slog.Warn("Couldn't invalidate presigned URLs", "video_id", videoID, "err", err)
+	}
+
+	// objects another video reuses under the same key stay in place
+	keys, err := cfg.videoObjectKeys(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list video objects", err)
+		return
+	}
+	keys, err = cfg.unsharedObjectKeys(keys, []database.Video{video})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list video objects", err)
+		return
+	}
+	ctx, cancel := cfg.storageContext(r.Context())
+	defer cancel()
+	failures, err := cfg.storage.DeleteMany(ctx, keys)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video objects", err)
+		return
+	}
+	if len(failures) > 0 {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video objects", errors.New(failures[0].Message))
+		return
+	}
 
 	err = cfg.db.DeleteVideo(videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
 	}
+	cfg.removeTranscodeWork(videoID)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -94,8 +211,50 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
+	if cfg.hiddenDraft(r, video) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if video.Expired(time.Now()) {
+		respondWithError(w, http.StatusGone, "Video has expired", nil)
+		return
+	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	resp, err := cfg.videoDetailResponse(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list thumbnails", err)
+		return
+	}
+	if r.URL.Query().Get("inlineThumbnail") == "true" && video.ThumbnailURL != nil {
+		if dataURI, ok := cfg.inlineThumbnail(*video.ThumbnailURL); ok {
+			resp.ThumbnailURL = &dataURI
+			resp.ThumbnailInline = true
+		}
+	}
+
+	code := http.StatusOK
+	switch video.Status {
+	case database.VideoStatusProcessing:
+		// a previous upload's URL would play the wrong thing, nothing
+		// playable is handed out until processing is done
+		resp.VideoURL = nil
+		resp.PreviewGIFURL = nil
+		code = cfg.processingStatusCode
+	case database.VideoStatusFailed:
+		details, err := cfg.db.GetLastUploadFailure(videoID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get upload failure", err)
+			return
+		}
+		// failure details are "message: error", only the message is
+		// meant for clients
+		resp.StatusError, _, _ = strings.Cut(details, ": ")
+	}
+	if acceptsXML(r) {
+		respondWithXML(w, code, newVideoXML(resp))
+		return
+	}
+	respondWithJSON(w, code, resp)
 }
 
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
@@ -104,17 +263,26 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	var videos []database.Video
+	if category := r.URL.Query().Get("category"); category != "" {
+		if !cfg.validCategory(category) {
+			respondWithError(w, http.StatusBadRequest, cfg.categoryMessage(), nil)
+			return
+		}
+		videos, err = cfg.db.GetVideosInCategory(userID, category)
+	} else {
+		videos, err = cfg.db.GetVideos(userID)
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, videos)
+	respondWithJSON(w, http.StatusOK, cfg.videoResponses(videos))
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerVideoMetaUpdate(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            string
+		otherUser       bool
+		wantCode        int
+		wantTitle       string
+		wantDescription string
+	}{
+		{name: "title and description", body: `{"title": "New title", "description": "New description"}`, wantCode: http.StatusOK, wantTitle: "New title", wantDescription: "New description"},
+		{name: "title only", body: `{"title": "New title"}`, wantCode: http.StatusOK, wantTitle: "New title", wantDescription: "A video for tests"},
+		{name: "empty body changes nothing", body: ``, wantCode: http.StatusOK, wantTitle: "Test video", wantDescription: "A video for tests"},
+		{name: "invalid visibility", body: `{"visibility": "unlisted"}`, wantCode: http.StatusBadRequest, wantTitle: "Test video", wantDescription: "A video for tests"},
+		{name: "someone else's video", body: `{"title": "New title"}`, otherUser: true, wantCode: http.StatusForbidden, wantTitle: "Test video", wantDescription: "A video for tests"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+			if tt.otherUser {
+				_, token = newTestVideo(t, cfg)
+			}
+
+			req := newVideoRequest(http.MethodPatch, "/api/videos/"+video.ID.String(), video.ID, strings.NewReader(tt.body), token)
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoMetaUpdate(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if rec.Code == http.StatusOK {
+				var resp videoResponse
+				decodeData(t, rec, &resp)
+				if resp.Title != tt.wantTitle {
+					t.Errorf("response title = %q, want %q", resp.Title, tt.wantTitle)
+				}
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Title != tt.wantTitle || stored.Description != tt.wantDescription {
+				t.Errorf("stored = %q, %q, want %q, %q", stored.Title, stored.Description, tt.wantTitle, tt.wantDescription)
+			}
+			if stored.Visibility != video.Visibility {
+				t.Errorf("visibility = %q, want %q", stored.Visibility, video.Visibility)
+			}
+		})
+	}
+}
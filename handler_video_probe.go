@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// handlerVideoProbe returns ffprobe's full output for the stored video to its
+// owner or an admin. The output is cached on the video, so the object is
+// only downloaded the first time after each upload.
+func (cfg *apiConfig) handlerVideoProbe(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	allowed, err := cfg.canInspect(userID, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check access", err)
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, "You can't probe this video", nil)
+		return
+	}
+	if video.ProbeJSON != "" {
+		respondWithJSON(w, http.StatusOK, json.RawMessage(video.ProbeJSON))
+		return
+	}
+
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video hasn't been uploaded yet", nil)
+		return
+	}
+	key, ok := cfg.videoKeyFromURL(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't locate video object", nil)
+		return
+	}
+
+	videoPath, err := cfg.downloadToTemp(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video object is missing", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't download video", err)
+		return
+	}
+	defer os.Remove(videoPath)
+
+	out, err := cfg.probeVideoRaw(videoPath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to probe video", err)
+		return
+	}
+	if !json.Valid(out) {
+		respondWithError(w, http.StatusInternalServerError, "ffprobe returned invalid JSON", nil)
+		return
+	}
+	if err := cfg.db.SetVideoProbe(videoID, string(out)); err != nil {
+		// the result is still good, it just gets probed again next time
+		slog.Warn("Couldn't cache probe output", "video_id", videoID, "err", err)
+	}
+
+	respondWithJSON(w, http.StatusOK, json.RawMessage(out))
+}
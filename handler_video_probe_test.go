@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerVideoProbe(t *testing.T) {
+	tests := []struct {
+		name       string
+		uploaded   bool
+		otherUser  bool
+		admin      bool
+		wantCode   int
+		wantWidth  int
+		wantFormat string
+	}{
+		{name: "owner", uploaded: true, wantCode: http.StatusOK, wantWidth: 1280, wantFormat: "mov,mp4,m4a,3gp,3g2,mj2"},
+		{name: "admin", uploaded: true, otherUser: true, admin: true, wantCode: http.StatusOK, wantWidth: 1280, wantFormat: "mov,mp4,m4a,3gp,3g2,mj2"},
+		{name: "someone else", uploaded: true, otherUser: true, wantCode: http.StatusForbidden},
+		{name: "nothing uploaded", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			installFakeFFmpeg(t, cfg, fakeProbe(1280, 720))
+			video, token := newTestVideo(t, cfg)
+			if tt.uploaded {
+				mem.Put(context.Background(), "landscape/abc.mp4", strings.NewReader("fake video"), "video/mp4")
+				videoURL := cfg.videoURL("landscape/abc.mp4")
+				video.VideoURL = &videoURL
+				if err := cfg.db.UpdateVideo(video); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.otherUser {
+				other, otherToken := newTestVideo(t, cfg)
+				token = otherToken
+				if tt.admin {
+					cfg.adminUserIDs[other.UserID] = true
+				}
+			}
+
+			probe := func() *httptest.ResponseRecorder {
+				rec := httptest.NewRecorder()
+				cfg.handlerVideoProbe(rec, newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/probe", video.ID, nil, token))
+				return rec
+			}
+			rec := probe()
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Streams []struct {
+					CodecType string `json:"codec_type"`
+					Width     int    `json:"width"`
+				} `json:"streams"`
+				Format struct {
+					FormatName string `json:"format_name"`
+					Duration   string `json:"duration"`
+				} `json:"format"`
+			}
+			decodeData(t, rec, &resp)
+			if len(resp.Streams) != 2 || resp.Streams[0].Width != tt.wantWidth {
+				t.Errorf("streams = %+v, want a %dpx wide video and audio", resp.Streams, tt.wantWidth)
+			}
+			if resp.Format.FormatName != tt.wantFormat || resp.Format.Duration == "" {
+				t.Errorf("format = %+v, want %s with a duration", resp.Format, tt.wantFormat)
+			}
+
+			// later requests are answered from the cache without the object
+			mem.Delete(context.Background(), "landscape/abc.mp4")
+			cfg.ffprobePath = fakeCommand(t, "ffprobe", "exit 1\n")
+			cached := probe()
+			if cached.Code != http.StatusOK {
+				t.Fatalf("cached status = %d: %s", cached.Code, cached.Body)
+			}
+			var first, second struct {
+				Data json.RawMessage `json:"data"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &first)
+			json.Unmarshal(cached.Body.Bytes(), &second)
+			if !jsonEqual(t, first.Data, second.Data) {
+				t.Errorf("cached probe = %s, want %s", second.Data, first.Data)
+			}
+		})
+	}
+}
+
+// jsonEqual reports whether a and b encode the same value.
+func jsonEqual(t *testing.T, a, b json.RawMessage) bool {
+	t.Helper()
+	var va, vb any
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatalf("decoding %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("decoding %s: %v", b, err)
+	}
+	ea, _ := json.Marshal(va)
+	eb, _ := json.Marshal(vb)
+	return string(ea) == string(eb)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// requestUserID returns the user the request's JWT belongs to, ok is false
+// for requests without a valid one.
+func (cfg *apiConfig) requestUserID(r *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// hiddenDraft reports whether the video is a draft the request's user
+// doesn't own. Drafts don't exist as far as anyone but their owner knows.
+func (cfg *apiConfig) hiddenDraft(r *http.Request, video database.Video) bool {
+	if video.PublishState != database.VideoPublishDraft {
+		return false
+	}
+	userID, ok := cfg.requestUserID(r)
+	return !ok || userID != video.UserID
+}
+
+// publicVideo reports whether anyone may view the video without a JWT.
+func publicVideo(video database.Video) bool {
+	return video.Visibility == database.VideoVisibilityPublic && video.PublishState != database.VideoPublishDraft
+}
+
+// checkVideoAccess responds with an error and returns false unless the
+// request may view the video. Private videos and drafts are only for their
+// owner, forbidden is what anyone else is told.
+func (cfg *apiConfig) checkVideoAccess(w http.ResponseWriter, r *http.Request, video database.Video, forbidden string) bool {
+	if publicVideo(video) {
+		return true
+	}
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, forbidden, nil)
+		return false
+	}
+	return true
+}
+
+// handlerVideoPublish takes a video live. Publishing is one way, a published
+// video can be made private but not a draft again.
+func (cfg *apiConfig) handlerVideoPublish(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't publish this video", nil)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusConflict, "Upload the video before publishing it", nil)
+		return
+	}
+
+	video.PublishState = database.VideoPublishPublished
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.videoResponse(video))
+}
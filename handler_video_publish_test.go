@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHiddenDraft(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	video, ownerToken := newTestVideo(t, cfg)
+	_, strangerToken := newTestVideo(t, cfg)
+
+	tests := []struct {
+		name  string
+		state string
+		token string
+		want  bool
+	}{
+		{name: "draft for its owner", state: database.VideoPublishDraft, token: ownerToken, want: false},
+		{name: "draft for a stranger", state: database.VideoPublishDraft, token: strangerToken, want: true},
+		{name: "draft for anonymous", state: database.VideoPublishDraft, token: "", want: true},
+		{name: "draft for a bad token", state: database.VideoPublishDraft, token: "not-a-jwt", want: true},
+		{name: "published for a stranger", state: database.VideoPublishPublished, token: strangerToken, want: false},
+		{name: "published for anonymous", state: database.VideoPublishPublished, token: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := video
+			v.PublishState = tt.state
+			req := newVideoRequest(http.MethodGet, "/api/videos/"+v.ID.String(), v.ID, nil, tt.token)
+			if got := cfg.hiddenDraft(req, v); got != tt.want {
+				t.Errorf("hiddenDraft = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerVideoPublish(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	uploaded, ownerToken := newTestVideo(t, cfg)
+	videoURL := cfg.videoURL("landscape/abc.mp4")
+	uploaded.VideoURL = &videoURL
+	if err := cfg.db.UpdateVideo(uploaded); err != nil {
+		t.Fatal(err)
+	}
+	empty := newUserVideo(t, cfg, uploaded)
+	_, strangerToken := newTestVideo(t, cfg)
+
+	tests := []struct {
+		name     string
+		video    database.Video
+		token    string
+		wantCode int
+	}{
+		{name: "no token", video: uploaded, token: "", wantCode: http.StatusUnauthorized},
+		{name: "bad token", video: uploaded, token: "not-a-jwt", wantCode: http.StatusUnauthorized},
+		{name: "not the owner", video: uploaded, token: strangerToken, wantCode: http.StatusForbidden},
+		{name: "not uploaded", video: empty, token: ownerToken, wantCode: http.StatusConflict},
+		{name: "owner", video: uploaded, token: ownerToken, wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newVideoRequest(http.MethodPost, "/api/videos/"+tt.video.ID.String()+"/publish", tt.video.ID, nil, tt.token)
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoPublish(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			want := database.VideoPublishDraft
+			if tt.wantCode == http.StatusOK {
+				want = database.VideoPublishPublished
+			}
+			got, err := cfg.db.GetVideo(tt.video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.PublishState != want {
+				t.Errorf("publish_state = %q, want %q", got.PublishState, want)
+			}
+		})
+	}
+}
+
+func TestDraftLifecycle(t *testing.T) {
+	cfg, mem := newTestConfig(t)
+	video, ownerToken := newTestVideo(t, cfg)
+	_, strangerToken := newTestVideo(t, cfg)
+	if video.PublishState != database.VideoPublishDraft {
+		t.Fatalf("new video publish_state = %q, want %q", video.PublishState, database.VideoPublishDraft)
+	}
+	mem.Put(context.Background(), "landscape/abc.mp4", strings.NewReader("video"), "video/mp4")
+	videoURL := cfg.videoURL("landscape/abc.mp4")
+	video.VideoURL = &videoURL
+	video.Visibility = database.VideoVisibilityPublic
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(token string) int {
+		req := newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String(), video.ID, nil, token)
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoGet(rec, req)
+		return rec.Code
+	}
+	redirect := func(token string) int {
+		req := newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/redirect", video.ID, nil, token)
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoRedirect(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name     string
+		do       func(string) int
+		token    string
+		wantCode int
+	}{
+		{name: "owner sees the draft", do: get, token: ownerToken, wantCode: http.StatusOK},
+		{name: "stranger doesn't", do: get, token: strangerToken, wantCode: http.StatusNotFound},
+		{name: "anonymous doesn't", do: get, token: "", wantCode: http.StatusNotFound},
+		{name: "anonymous can't stream it", do: redirect, token: "", wantCode: http.StatusUnauthorized},
+		{name: "stranger can't stream it", do: redirect, token: strangerToken, wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run("draft/"+tt.name, func(t *testing.T) {
+			if code := tt.do(tt.token); code != tt.wantCode {
+				t.Errorf("status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	req := newVideoRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/publish", video.ID, nil, ownerToken)
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoPublish(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("publish status = %d: %s", rec.Code, rec.Body)
+	}
+	var published database.Video
+	decodeData(t, rec, &published)
+	if published.PublishState != database.VideoPublishPublished {
+		t.Errorf("publish_state = %q, want %q", published.PublishState, database.VideoPublishPublished)
+	}
+
+	if code := get(strangerToken); code != http.StatusOK {
+		t.Errorf("stranger status after publishing = %d, want %d", code, http.StatusOK)
+	}
+	if code := get(""); code != http.StatusOK {
+		t.Errorf("anonymous status after publishing = %d, want %d", code, http.StatusOK)
+	}
+	if code := redirect(""); code != http.StatusFound {
+		t.Errorf("anonymous redirect after publishing = %d, want %d", code, http.StatusFound)
+	}
+}
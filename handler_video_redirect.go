@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// handlerVideoRedirect is a stable link to a video: every request gets
+// redirected to a freshly presigned URL, so links embedded elsewhere never
+// expire the way presigned URLs do. Public videos need no JWT, private ones
+// only redirect their owner.
+func (cfg *apiConfig) handlerVideoRedirect(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+
+	if !cfg.checkVideoAccess(w, r, video, "You can't view this video") {
+		return
+	}
+
+	if video.Expired(time.Now()) {
+		respondWithError(w, http.StatusGone, "Video has expired", nil)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video hasn't been uploaded yet", nil)
+		return
+	}
+	key, ok := cfg.videoKeyFromURL(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't locate video object", nil)
+		return
+	}
+
+	// bypass the presign cache, the whole point is a URL with its full
+	// lifetime ahead of it
+	ctx, cancel := cfg.storageContext(r.Context())
+	defer cancel()
+	videoURL, err := cfg.presignWithRetry(ctx, key, cfg.presignTTL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URL", err)
+		return
+	}
+
+	cfg.views.record(videoID)
+
+	// the redirect itself must not be cached past the URL's lifetime
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, videoURL, http.StatusFound)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerVideoRedirect(t *testing.T) {
+	tests := []struct {
+		name         string
+		visibility   string
+		publishState string
+		// caller is "owner", "other" or "" for an anonymous request
+		caller   string
+		expired  bool
+		wantCode int
+	}{
+		{name: "public video", visibility: database.VideoVisibilityPublic, publishState: database.VideoPublishPublished, wantCode: http.StatusFound},
+		{name: "private video, anonymous", visibility: database.VideoVisibilityPrivate, publishState: database.VideoPublishPublished, wantCode: http.StatusUnauthorized},
+		{name: "private video, owner", visibility: database.VideoVisibilityPrivate, publishState: database.VideoPublishPublished, caller: "owner", wantCode: http.StatusFound},
+		{name: "private video, someone else", visibility: database.VideoVisibilityPrivate, publishState: database.VideoPublishPublished, caller: "other", wantCode: http.StatusForbidden},
+		{name: "public draft, anonymous", visibility: database.VideoVisibilityPublic, publishState: database.VideoPublishDraft, wantCode: http.StatusUnauthorized},
+		{name: "public draft, owner", visibility: database.VideoVisibilityPublic, publishState: database.VideoPublishDraft, caller: "owner", wantCode: http.StatusFound},
+		{name: "expired", visibility: database.VideoVisibilityPublic, publishState: database.VideoPublishPublished, expired: true, wantCode: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			counting := &countingStorage{Storage: mem}
+			cfg.storage = counting
+			video, ownerToken := newTestVideo(t, cfg)
+			_, otherToken := newTestVideo(t, cfg)
+			mem.Put(context.Background(), "landscape/abc.mp4", strings.NewReader("video"), "video/mp4")
+			videoURL := cfg.videoURL("landscape/abc.mp4")
+			video.VideoURL = &videoURL
+			video.Visibility = tt.visibility
+			video.PublishState = tt.publishState
+			if tt.expired {
+				past := time.Now().Add(-time.Hour)
+				video.ExpiresAt = &past
+			}
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+			token := map[string]string{"owner": ownerToken, "other": otherToken}[tt.caller]
+
+			var locations []string
+			for range 2 {
+				req := newVideoRequest(http.MethodGet, "/v/"+video.ID.String(), video.ID, nil, token)
+				rec := httptest.NewRecorder()
+				cfg.handlerVideoRedirect(rec, req)
+				if rec.Code != tt.wantCode {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+				}
+				if rec.Code != http.StatusFound {
+					return
+				}
+				if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+					t.Errorf("Cache-Control = %q, want no-store", got)
+				}
+				locations = append(locations, rec.Header().Get("Location"))
+			}
+
+			if !strings.HasPrefix(locations[0], "https://example.com/landscape/abc.mp4?") {
+				t.Errorf("redirected to %s, want a presigned URL of the video", locations[0])
+			}
+			if locations[0] == locations[1] {
+				t.Errorf("both redirects went to %s, want a fresh URL each time", locations[0])
+			}
+			if got := counting.presigns.Load(); got != 2 {
+				t.Errorf("presigns = %d, want 2", got)
+			}
+		})
+	}
+}
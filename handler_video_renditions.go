@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// rendition is a playable file of a video. Variants that failed to encode
+// are listed too, with their status and without a URL.
+type rendition struct {
+	Name      string     `json:"name"`
+	Width     int        `json:"width"`
+	Height    int        `json:"height"`
+	Bitrate   int64      `json:"bitrate"`
+	Codec     string     `json:"codec"`
+	URL       string     `json:"url,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Status    string     `json:"status"`
+}
+
+// averageBitrate is the bits per second of a file of the given size, zero
+// when either is unknown.
+func averageBitrate(sizeBytes int64, duration float64) int64 {
+	if sizeBytes <= 0 || duration <= 0 {
+		return 0
+	}
+	return int64(float64(sizeBytes*8) / duration)
+}
+
+func utcTime(t time.Time) *time.Time {
+	t = t.UTC()
+	return &t
+}
+
+// handlerVideoRenditions lists the stored video and every downscaled
+// variant with a presigned URL, largest first, so players can switch
+// quality without HLS. Access follows the same rules as /v/{videoID}.
+func (cfg *apiConfig) handlerVideoRenditions(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+
+	if !cfg.checkVideoAccess(w, r, video, "You can't view this video") {
+		return
+	}
+
+	if video.Expired(time.Now()) {
+		respondWithError(w, http.StatusGone, "Video has expired", nil)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video hasn't been uploaded yet", nil)
+		return
+	}
+	key, ok := cfg.videoKeyFromURL(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't locate video object", nil)
+		return
+	}
+
+	videoURL, expiresAt, err := cfg.presignGet(r.Context(), key, cfg.presignTTL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URL", err)
+		return
+	}
+	renditions := []rendition{{
+		Name:      "original",
+		Width:     video.Width,
+		Height:    video.Height,
+		Bitrate:   averageBitrate(video.SizeBytes, video.Duration),
+		Codec:     video.VideoCodec,
+		URL:       videoURL,
+		ExpiresAt: utcTime(expiresAt),
+		Status:    database.VariantStatusReady,
+	}}
+
+	variants, err := cfg.db.GetVideoVariants(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video variants", err)
+		return
+	}
+	for _, v := range variants {
+		if v.Status == database.VariantStatusFailed {
+			renditions = append(renditions, rendition{
+				Name:   v.Name,
+				Width:  v.Width,
+				Height: v.Height,
+				Status: v.Status,
+			})
+			continue
+		}
+		variantKey, ok := cfg.videoKeyFromURL(v.URL)
+		if !ok {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't locate variant object", nil)
+			return
+		}
+		// variant sizes aren't recorded, the object itself knows
+		ctx, cancel := cfg.storageContext(r.Context())
+		info, err := cfg.storage.Head(ctx, variantKey)
+		cancel()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get variant object", err)
+			return
+		}
+		variantURL, expiresAt, err := cfg.presignGet(r.Context(), variantKey, cfg.presignTTL)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't sign variant URL", err)
+			return
+		}
+		renditions = append(renditions, rendition{
+			Name:      v.Name,
+			Width:     v.Width,
+			Height:    v.Height,
+			Bitrate:   averageBitrate(info.Size, video.Duration),
+			Codec:     variantCodec,
+			URL:       variantURL,
+			ExpiresAt: utcTime(expiresAt),
+			Status:    database.VariantStatusReady,
+		})
+	}
+
+	sort.SliceStable(renditions, func(i, j int) bool {
+		return renditions[i].Width*renditions[i].Height > renditions[j].Width*renditions[j].Height
+	})
+	respondWithJSON(w, http.StatusOK, renditions)
+}
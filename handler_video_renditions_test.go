@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestAverageBitrate(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		duration float64
+		want     int64
+	}{
+		{name: "one megabyte over ten seconds", size: 1_000_000, duration: 10, want: 800_000},
+		{name: "fractional duration", size: 1000, duration: 0.5, want: 16000},
+		{name: "unknown size", duration: 10},
+		{name: "unknown duration", size: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := averageBitrate(tt.size, tt.duration); got != tt.want {
+				t.Errorf("averageBitrate(%d, %v) = %d, want %d", tt.size, tt.duration, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerVideoRenditions(t *testing.T) {
+	type wantRendition struct {
+		name          string
+		width, height int
+		bitrate       int64
+		codec         string
+		status        string
+	}
+	// every file is a copy of the upload, 100kB over the probe's 10s
+	upload := []byte(strings.Repeat("x", 100_000))
+	tests := []struct {
+		name          string
+		width, height int
+		// failOn makes ffmpeg fail commands containing it
+		failOn string
+		want   []wantRendition
+	}{
+		{
+			name:  "only the upload",
+			width: 640, height: 360,
+			failOn: "never-matches",
+			want: []wantRendition{
+				{name: "original", width: 640, height: 360, bitrate: 80_000, codec: "h264", status: database.VariantStatusReady},
+			},
+		},
+		{
+			name:  "variants sorted by resolution",
+			width: 1920, height: 1080,
+			failOn: "scale=-2:720",
+			want: []wantRendition{
+				{name: "original", width: 1920, height: 1080, bitrate: 80_000, codec: "h264", status: database.VariantStatusReady},
+				{name: "720p", width: 1280, height: 720, status: database.VariantStatusFailed},
+				{name: "480p", width: 854, height: 480, bitrate: 80_000, codec: variantCodec, status: database.VariantStatusReady},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			installFakeFFmpeg(t, cfg, fakeProbe(tt.width, tt.height))
+			ffprobePath := cfg.ffprobePath
+			installFailingFFmpeg(t, cfg, tt.failOn)
+			cfg.ffprobePath = ffprobePath
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", upload, nil))
+			if rec.Code != http.StatusOK && rec.Code != http.StatusMultiStatus {
+				t.Fatalf("upload status = %d: %s", rec.Code, rec.Body)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, ok := cfg.videoKeyFromURL(*stored.VideoURL)
+			if !ok {
+				t.Fatalf("video URL %q doesn't name a stored object", *stored.VideoURL)
+			}
+
+			rec = httptest.NewRecorder()
+			cfg.handlerVideoRenditions(rec, newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/renditions", video.ID, nil, token))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var got []rendition
+			decodeData(t, rec, &got)
+			if len(got) != len(tt.want) {
+				t.Fatalf("renditions = %+v, want %d", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				r := got[i]
+				if r.Name != want.name || r.Width != want.width || r.Height != want.height {
+					t.Errorf("rendition %d = %s %dx%d, want %s %dx%d", i, r.Name, r.Width, r.Height, want.name, want.width, want.height)
+				}
+				if r.Bitrate != want.bitrate || r.Codec != want.codec || r.Status != want.status {
+					t.Errorf("%s = %d bps %q %s, want %d bps %q %s", r.Name, r.Bitrate, r.Codec, r.Status, want.bitrate, want.codec, want.status)
+				}
+				if want.status == database.VariantStatusFailed {
+					if r.URL != "" || r.ExpiresAt != nil {
+						t.Errorf("%s has URL %q expiring %v, want none", r.Name, r.URL, r.ExpiresAt)
+					}
+					continue
+				}
+				wantKey := key
+				if want.name != "original" {
+					wantKey = variantKey(key, Variant{Name: want.name})
+				}
+				if !strings.HasPrefix(r.URL, "memory://"+wantKey+"?") || !strings.Contains(r.URL, "expires=") {
+					t.Errorf("%s URL = %q, want %s signed", r.Name, r.URL, wantKey)
+				}
+				if r.ExpiresAt == nil || r.ExpiresAt.Before(time.Now()) {
+					t.Errorf("%s expires at %v, want in the future", r.Name, r.ExpiresAt)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerVideoRenditionsAccess(t *testing.T) {
+	tests := []struct {
+		name       string
+		visibility string
+		draft      bool
+		owner      bool
+		noUpload   bool
+		wantCode   int
+	}{
+		{name: "public", visibility: database.VideoVisibilityPublic, wantCode: http.StatusOK},
+		{name: "private for the owner", visibility: database.VideoVisibilityPrivate, owner: true, wantCode: http.StatusOK},
+		{name: "private for anyone", visibility: database.VideoVisibilityPrivate, wantCode: http.StatusUnauthorized},
+		{name: "public draft", visibility: database.VideoVisibilityPublic, draft: true, wantCode: http.StatusUnauthorized},
+		{name: "not uploaded", visibility: database.VideoVisibilityPublic, noUpload: true, wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+			if !tt.noUpload {
+				videoURL := cfg.videoURL("landscape/abc.mp4")
+				video.VideoURL = &videoURL
+			}
+			video.Visibility = tt.visibility
+			video.PublishState = database.VideoPublishPublished
+			if tt.draft {
+				video.PublishState = database.VideoPublishDraft
+			}
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.owner {
+				token = ""
+			}
+
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoRenditions(rec, newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/renditions", video.ID, nil, token))
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
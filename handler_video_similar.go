@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// handlerVideoSimilar lists the caller's other videos whose perceptual hash
+// is within max_distance bits of this one's, closest first. Only the
+// caller's own videos are compared, near duplicates of someone else's
+// uploads aren't theirs to see.
+func (cfg *apiConfig) handlerVideoSimilar(w http.ResponseWriter, r *http.Request) {
+	type similarVideo struct {
+		videoResponse
+		Distance int `json:"distance"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret, cfg.jwtLeeway, cfg.jwtAlgorithms)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	maxDistance := cfg.similarDistance
+	if s := r.URL.Query().Get("max_distance"); s != "" {
+		maxDistance, err = strconv.Atoi(s)
+		if err != nil || maxDistance < 0 || maxDistance > 64 {
+			respondWithError(w, http.StatusBadRequest, "max_distance must be between 0 and 64", err)
+			return
+		}
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't view this video", nil)
+		return
+	}
+	if video.PHash == "" {
+		respondWithError(w, http.StatusUnprocessableEntity, "Video has no perceptual hash", nil)
+		return
+	}
+
+	candidates, err := cfg.db.GetHashedVideos(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+	similar := []similarVideo{}
+	for _, candidate := range candidates {
+		if candidate.ID == video.ID {
+			continue
+		}
+		distance, err := hammingDistance(video.PHash, candidate.PHash)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't compare perceptual hashes", err)
+			return
+		}
+		if distance <= maxDistance {
+			similar = append(similar, similarVideo{
+				videoResponse: cfg.videoResponse(candidate),
+				Distance:      distance,
+			})
+		}
+	}
+	sort.SliceStable(similar, func(i, j int) bool {
+		return similar[i].Distance < similar[j].Distance
+	})
+
+	respondWithJSON(w, http.StatusOK, similar)
+}
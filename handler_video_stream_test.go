@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerVideoStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		byteRange string
+		otherUser bool
+		noToken   bool
+		wantCode  int
+		wantBody  string
+		wantRange string
+	}{
+		{name: "whole video", wantCode: http.StatusOK, wantBody: "0123456789"},
+		{name: "range", byteRange: "bytes=2-4", wantCode: http.StatusPartialContent, wantBody: "234", wantRange: "bytes 2-4/10"},
+		{name: "range past the end", byteRange: "bytes=20-", wantCode: http.StatusRequestedRangeNotSatisfiable},
+		{name: "no token", noToken: true, wantCode: http.StatusUnauthorized},
+		{name: "someone else's video", otherUser: true, wantCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+			if tt.otherUser {
+				_, token = newTestVideo(t, cfg)
+			}
+			mem.Put(context.Background(), "landscape/a.mp4", strings.NewReader("0123456789"), "video/mp4")
+			videoURL := cfg.videoURL("landscape/a.mp4")
+			video.VideoURL = &videoURL
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/stream", nil)
+			req.SetPathValue("videoID", video.ID.String())
+			if !tt.noToken {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			if tt.byteRange != "" {
+				req.Header.Set("Range", tt.byteRange)
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoStream(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantBody == "" {
+				return
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+			if got := rec.Header().Get("Content-Range"); got != tt.wantRange {
+				t.Errorf("Content-Range = %q, want %q", got, tt.wantRange)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "video/mp4" {
+				t.Errorf("Content-Type = %q, want video/mp4", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// handlerVideoThumbnail serves the video's thumbnail bytes itself, for
+// clients that can't follow a redirect to a signed or CDN URL. Thumbnails
+// in the assets directory are read from disk, ones that live in object
+// storage are streamed from there. Access follows the redirect handler:
+// public videos need no JWT, private ones and drafts only their owner.
+func (cfg *apiConfig) handlerVideoThumbnail(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+
+	if !cfg.checkVideoAccess(w, r, video, "You can't view this thumbnail") {
+		return
+	}
+
+	if video.ThumbnailURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no thumbnail", nil)
+		return
+	}
+
+	// shared caches may only keep thumbnails anyone could fetch
+	scope := "private"
+	if publicVideo(video) {
+		scope = "public"
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, int(cfg.thumbnailCacheMaxAge.Seconds())))
+
+	if filePath, ok := cfg.thumbnailAssetPath(*video.ThumbnailURL); ok {
+		cfg.serveThumbnailFile(w, r, filePath)
+		return
+	}
+	key, ok := cfg.videoKeyFromURL(*video.ThumbnailURL)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't locate thumbnail", nil)
+		return
+	}
+	cfg.serveThumbnailObject(w, r, key)
+}
+
+// serveThumbnailFile leaves conditional and range requests to
+// http.ServeContent. Thumbnail file names change with every upload, so the
+// name is a good enough ETag.
+func (cfg *apiConfig) serveThumbnailFile(w http.ResponseWriter, r *http.Request, filePath string) {
+	file, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Thumbnail file is missing", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read thumbnail", err)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read thumbnail", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", thumbnailMediaType(filePath))
+	w.Header().Set("ETag", strconv.Quote(path.Base(filePath)))
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+func (cfg *apiConfig) serveThumbnailObject(w http.ResponseWriter, r *http.Request, key string) {
+	etag := strconv.Quote(path.Base(key))
+	if r.Header.Get("If-None-Match") == etag {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	obj, err := cfg.storage.Get(r.Context(), key, "")
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Thumbnail object is missing", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't fetch thumbnail", err)
+		return
+	}
+	defer obj.Body.Close()
+
+	contentType := obj.ContentType
+	if contentType == "" {
+		contentType = thumbnailMediaType(key)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(obj.ContentLength, 10))
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+
+	// headers are already sent, all we can do on failure is log
+	if _, err := io.Copy(w, obj.Body); err != nil {
+		slog.Warn("Couldn't stream thumbnail", "key", key, "err", err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerVideoThumbnail(t *testing.T) {
+	cfg, mem := newTestConfig(t)
+	pngData := encodePNG(t, 64, 36)
+	jpegData := []byte("\xff\xd8\xff fake jpeg")
+
+	if err := os.WriteFile(filepath.Join(cfg.assetsRoot, "thumb.png"), pngData, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.Put(context.Background(), "thumbnails/thumb.jpg", bytes.NewReader(jpegData), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	withThumbnail := func(video database.Video, thumbnailURL string, visibility string) database.Video {
+		t.Helper()
+		video.ThumbnailURL = &thumbnailURL
+		video.Visibility = visibility
+		video.PublishState = database.VideoPublishPublished
+		if err := cfg.db.UpdateVideo(video); err != nil {
+			t.Fatal(err)
+		}
+		return video
+	}
+	fileVideo, token := newTestVideo(t, cfg)
+	fileVideo = withThumbnail(fileVideo, cfg.assetURL("thumb.png"), database.VideoVisibilityPublic)
+	objectVideo := withThumbnail(newUserVideo(t, cfg, fileVideo), cfg.videoURL("thumbnails/thumb.jpg"), database.VideoVisibilityPublic)
+	privateVideo := withThumbnail(newUserVideo(t, cfg, fileVideo), cfg.videoURL("thumbnails/thumb.jpg"), database.VideoVisibilityPrivate)
+	missingVideo := withThumbnail(newUserVideo(t, cfg, fileVideo), cfg.videoURL("thumbnails/gone.jpg"), database.VideoVisibilityPublic)
+	bare := newUserVideo(t, cfg, fileVideo)
+	_, strangerToken := newTestVideo(t, cfg)
+
+	tests := []struct {
+		name             string
+		video            database.Video
+		token            string
+		wantCode         int
+		wantBody         []byte
+		wantContentType  string
+		wantCacheControl string
+	}{
+		{name: "file", video: fileVideo, wantCode: http.StatusOK, wantBody: pngData, wantContentType: "image/png", wantCacheControl: "public, max-age=3600"},
+		{name: "object", video: objectVideo, wantCode: http.StatusOK, wantBody: jpegData, wantContentType: "image/jpeg", wantCacheControl: "public, max-age=3600"},
+		{name: "private for its owner", video: privateVideo, token: token, wantCode: http.StatusOK, wantBody: jpegData, wantContentType: "image/jpeg", wantCacheControl: "private, max-age=3600"},
+		{name: "private for anonymous", video: privateVideo, wantCode: http.StatusUnauthorized},
+		{name: "private for a stranger", video: privateVideo, token: strangerToken, wantCode: http.StatusForbidden},
+		{name: "no thumbnail", video: bare, token: token, wantCode: http.StatusNotFound},
+		{name: "missing object", video: missingVideo, wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newVideoRequest(http.MethodGet, "/api/videos/"+tt.video.ID.String()+"/thumbnail", tt.video.ID, nil, tt.token)
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoThumbnail(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantBody == nil {
+				return
+			}
+			if !bytes.Equal(rec.Body.Bytes(), tt.wantBody) {
+				t.Errorf("body = %q, want %q", rec.Body.Bytes(), tt.wantBody)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", ct, tt.wantContentType)
+			}
+			if cc := rec.Header().Get("Cache-Control"); cc != tt.wantCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", cc, tt.wantCacheControl)
+			}
+			if rec.Header().Get("ETag") == "" {
+				t.Error("ETag is empty")
+			}
+		})
+	}
+}
+
+func TestHandlerVideoThumbnailNotModified(t *testing.T) {
+	cfg, mem := newTestConfig(t)
+	mem.Put(context.Background(), "thumbnails/thumb.jpg", bytes.NewReader([]byte("jpeg")), "image/jpeg")
+	if err := os.WriteFile(filepath.Join(cfg.assetsRoot, "thumb.png"), encodePNG(t, 64, 36), 0644); err != nil {
+		t.Fatal(err)
+	}
+	video, _ := newTestVideo(t, cfg)
+	video.Visibility = database.VideoVisibilityPublic
+	video.PublishState = database.VideoPublishPublished
+
+	tests := []struct {
+		name         string
+		thumbnailURL string
+	}{
+		{name: "file", thumbnailURL: cfg.assetURL("thumb.png")},
+		{name: "object", thumbnailURL: cfg.videoURL("thumbnails/thumb.jpg")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			video.ThumbnailURL = &tt.thumbnailURL
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+			req := newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/thumbnail", video.ID, nil, "")
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoThumbnail(rec, req)
+			etag := rec.Header().Get("ETag")
+			if rec.Code != http.StatusOK || etag == "" {
+				t.Fatalf("status = %d, ETag %q: %s", rec.Code, etag, rec.Body)
+			}
+
+			req = newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/thumbnail", video.ID, nil, "")
+			req.Header.Set("If-None-Match", etag)
+			rec = httptest.NewRecorder()
+			cfg.handlerVideoThumbnail(rec, req)
+			if rec.Code != http.StatusNotModified {
+				t.Errorf("revalidation status = %d, want %d", rec.Code, http.StatusNotModified)
+			}
+		})
+	}
+}
@@ -2,10 +2,12 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -22,6 +24,39 @@ const (
 
 var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
 
+// signingMethod is the algorithm MakeJWT signs with.
+var signingMethod = jwt.SigningMethodHS256
+
+// hmacAlgorithms are the algorithms a shared secret can verify. Anything
+// else, none and the asymmetric ones included, can't be allowed.
+var hmacAlgorithms = []string{
+	jwt.SigningMethodHS256.Alg(),
+	jwt.SigningMethodHS384.Alg(),
+	jwt.SigningMethodHS512.Alg(),
+}
+
+// DefaultAlgorithms only accepts tokens signed the way MakeJWT signs them.
+var DefaultAlgorithms = []string{signingMethod.Alg()}
+
+// ParseAlgorithms checks a list of allowed JWT algorithms such as
+// []string{"HS256", "HS512"}. Every entry must be an HMAC algorithm and the
+// one MakeJWT signs with must be among them, or the server couldn't accept
+// its own tokens.
+func ParseAlgorithms(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, errors.New("no algorithms allowed")
+	}
+	for _, name := range names {
+		if !slices.Contains(hmacAlgorithms, name) {
+			return nil, fmt.Errorf("unsupported algorithm %q, expected one of %s", name, strings.Join(hmacAlgorithms, ", "))
+		}
+	}
+	if !slices.Contains(names, signingMethod.Alg()) {
+		return nil, fmt.Errorf("%s must be allowed, tokens are issued with it", signingMethod.Alg())
+	}
+	return names, nil
+}
+
 func HashPassword(password string) (string, error) {
 	hash, err := argon2id.CreateHash(password, argon2id.DefaultParams)
 	if err != nil {
@@ -44,7 +79,7 @@ func MakeJWT(
 	expiresIn time.Duration,
 ) (string, error) {
 	signingKey := []byte(tokenSecret)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+	token := jwt.NewWithClaims(signingMethod, jwt.RegisteredClaims{
 		Issuer:    string(TokenTypeAccess),
 		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
@@ -53,12 +88,24 @@ func MakeJWT(
 	return token.SignedString(signingKey)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+// ValidateJWT checks an access token and returns its user ID. leeway is the
+// clock skew tolerated when checking the expiry and not-before claims.
+// Tokens whose alg header isn't in algorithms are rejected before their
+// signature is looked at.
+func ValidateJWT(tokenString, tokenSecret string, leeway time.Duration, algorithms []string) (uuid.UUID, error) {
 	claimsStruct := jwt.RegisteredClaims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&claimsStruct,
-		func(token *jwt.Token) (any, error) { return []byte(tokenSecret), nil },
+		func(token *jwt.Token) (any, error) {
+			// the secret must never be handed to a non-HMAC verifier
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+			}
+			return []byte(tokenSecret), nil
+		},
+		jwt.WithLeeway(leeway),
+		jwt.WithValidMethods(algorithms),
 	)
 	if err != nil {
 		return uuid.Nil, err
@@ -106,6 +153,14 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(token), nil
 }
 
+// HashToken hashes an opaque token for storage. Unlike passwords these tokens
+// are random and long, so a fast unsalted hash is enough and keeps them
+// searchable.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
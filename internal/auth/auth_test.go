@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// signToken signs claims for userID the way MakeJWT does, but with the
+// given method and validity window.
+func signToken(t *testing.T, method jwt.SigningMethod, userID uuid.UUID, notBefore, expiresAt time.Time) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeAccess),
+		IssuedAt:  jwt.NewNumericDate(notBefore),
+		NotBefore: jwt.NewNumericDate(notBefore),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		Subject:   userID.String(),
+	})
+	signed, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestValidateJWTLeeway(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		notBefore time.Time
+		expiresAt time.Time
+		leeway    time.Duration
+		wantErr   bool
+	}{
+		{name: "valid", notBefore: now.Add(-time.Minute), expiresAt: now.Add(time.Minute), leeway: 5 * time.Second},
+		{name: "expired within leeway", notBefore: now.Add(-time.Minute), expiresAt: now.Add(-3 * time.Second), leeway: 5 * time.Second},
+		{name: "expired beyond leeway", notBefore: now.Add(-time.Minute), expiresAt: now.Add(-10 * time.Second), leeway: 5 * time.Second, wantErr: true},
+		{name: "expired without leeway", notBefore: now.Add(-time.Minute), expiresAt: now.Add(-3 * time.Second), wantErr: true},
+		{name: "issued ahead within leeway", notBefore: now.Add(3 * time.Second), expiresAt: now.Add(time.Minute), leeway: 5 * time.Second},
+		{name: "issued ahead beyond leeway", notBefore: now.Add(10 * time.Second), expiresAt: now.Add(time.Minute), leeway: 5 * time.Second, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := uuid.New()
+			token := signToken(t, jwt.SigningMethodHS256, userID, tt.notBefore, tt.expiresAt)
+			got, err := ValidateJWT(token, "secret", tt.leeway, DefaultAlgorithms)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateJWT err = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && got != userID {
+				t.Errorf("ValidateJWT = %s, want %s", got, userID)
+			}
+		})
+	}
+}
+
+func TestMakeJWTRoundTrip(t *testing.T) {
+	userID := uuid.New()
+	token, err := MakeJWT(userID, "secret", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(token, "other-secret", 0, DefaultAlgorithms); err == nil {
+		t.Error("token validated with the wrong secret")
+	}
+	got, err := ValidateJWT(token, "secret", 0, DefaultAlgorithms)
+	if err != nil {
+		t.Fatalf("ValidateJWT: %v", err)
+	}
+	if got != userID {
+		t.Errorf("ValidateJWT = %s, want %s", got, userID)
+	}
+}
+
+func TestParseAlgorithms(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		wantErr bool
+	}{
+		{name: "default", names: []string{"HS256"}},
+		{name: "several HMAC", names: []string{"HS512", "HS256", "HS384"}},
+		{name: "empty", names: nil, wantErr: true},
+		{name: "none", names: []string{"HS256", "none"}, wantErr: true},
+		{name: "asymmetric", names: []string{"HS256", "RS256"}, wantErr: true},
+		{name: "without the signing algorithm", names: []string{"HS512"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAlgorithms(tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAlgorithms err = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && !slices.Equal(got, tt.names) {
+				t.Errorf("ParseAlgorithms = %v, want %v", got, tt.names)
+			}
+		})
+	}
+}
+
+func TestValidateJWTAlgorithms(t *testing.T) {
+	now := time.Now()
+	userID := uuid.New()
+	claims := jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeAccess),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		Subject:   userID.String(),
+	}
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSigned, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		algorithms []string
+		wantErr    bool
+	}{
+		{name: "HS256", token: signToken(t, jwt.SigningMethodHS256, userID, now, now.Add(time.Minute)), algorithms: DefaultAlgorithms},
+		{name: "none", token: unsigned, algorithms: DefaultAlgorithms, wantErr: true},
+		{name: "RS256", token: rsaSigned, algorithms: DefaultAlgorithms, wantErr: true},
+		{name: "HS512 not allowed", token: signToken(t, jwt.SigningMethodHS512, userID, now, now.Add(time.Minute)), algorithms: DefaultAlgorithms, wantErr: true},
+		{name: "HS512 allowed", token: signToken(t, jwt.SigningMethodHS512, userID, now, now.Add(time.Minute)), algorithms: []string{"HS256", "HS512"}},
+		// even a misconfigured list can't hand the secret to a non-HMAC verifier
+		{name: "RS256 allowed by mistake", token: rsaSigned, algorithms: []string{"HS256", "RS256"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateJWT(tt.token, "secret", 0, tt.algorithms)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateJWT err = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && got != userID {
+				t.Errorf("ValidateJWT = %s, want %s", got, userID)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// VideoCaption is a subtitle track of a video, stored as WebVTT.
+type VideoCaption struct {
+	VideoID  uuid.UUID `json:"-"`
+	Language string    `json:"language"`
+	Label    string    `json:"label"`
+	URL      string    `json:"url"`
+}
+
+// ReplaceVideoCaptions swaps out every caption track of a video, so a
+// re-upload never leaves stale tracks behind.
+func (c Client) ReplaceVideoCaptions(videoID uuid.UUID, captions []VideoCaption) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceVideoCaptions(tx, videoID, captions); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceVideoCaptions(tx *sql.Tx, videoID uuid.UUID, captions []VideoCaption) error {
+	if _, err := tx.Exec(`DELETE FROM video_captions WHERE video_id = ?`, videoID); err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO video_captions (
+		video_id,
+		language,
+		label,
+		url
+	) VALUES (?, ?, ?, ?)
+	`
+	for _, caption := range captions {
+		if _, err := tx.Exec(query, videoID, caption.Language, caption.Label, caption.URL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetVideoCaptions lists a video's caption tracks in the order they appear
+// in the upload.
+func (c Client) GetVideoCaptions(videoID uuid.UUID) ([]VideoCaption, error) {
+	query := `
+	SELECT
+		video_id,
+		language,
+		label,
+		url
+	FROM video_captions
+	WHERE video_id = ?
+	ORDER BY rowid
+	`
+
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	captions := []VideoCaption{}
+	for rows.Next() {
+		var caption VideoCaption
+		if err := rows.Scan(&caption.VideoID, &caption.Language, &caption.Label, &caption.URL); err != nil {
+			return nil, err
+		}
+		captions = append(captions, caption)
+	}
+	return captions, rows.Err()
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -25,6 +26,11 @@ func NewClient(pathToDB string) (Client, error) {
 
 }
 
+// Close closes the database, nothing may use the client afterwards.
+func (c Client) Close() error {
+	return c.db.Close()
+}
+
 func (c *Client) autoMigrate() error {
 	userTable := `
 	CREATE TABLE IF NOT EXISTS users (
@@ -72,9 +78,235 @@ func (c *Client) autoMigrate() error {
 	if err != nil {
 		return err
 	}
+
+	variantTable := `
+	CREATE TABLE IF NOT EXISTS video_variants (
+		video_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		width INTEGER NOT NULL,
+		height INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		PRIMARY KEY(video_id, name),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(variantTable)
+	if err != nil {
+		return err
+	}
+
+	shareTokenTable := `
+	CREATE TABLE IF NOT EXISTS share_tokens (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL,
+		revoked_at TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(shareTokenTable)
+	if err != nil {
+		return err
+	}
+
+	uploadEventTable := `
+	CREATE TABLE IF NOT EXISTS upload_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		video_id TEXT NOT NULL,
+		event TEXT NOT NULL,
+		details TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(uploadEventTable)
+	if err != nil {
+		return err
+	}
+
+	videoThumbnailTable := `
+	CREATE TABLE IF NOT EXISTS video_thumbnails (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		url TEXT NOT NULL,
+		sizes TEXT NOT NULL DEFAULT '{}',
+		blurhash TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(videoThumbnailTable)
+	if err != nil {
+		return err
+	}
+
+	videoViewTable := `
+	CREATE TABLE IF NOT EXISTS video_views (
+		video_id TEXT NOT NULL,
+		bucket TIMESTAMP NOT NULL,
+		count INTEGER NOT NULL,
+		PRIMARY KEY(video_id, bucket),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(videoViewTable)
+	if err != nil {
+		return err
+	}
+
+	transcodeSegmentTable := `
+	CREATE TABLE IF NOT EXISTS transcode_segments (
+		video_id TEXT NOT NULL,
+		job TEXT NOT NULL,
+		segment INTEGER NOT NULL,
+		completed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(video_id, job, segment),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(transcodeSegmentTable)
+	if err != nil {
+		return err
+	}
+
+	tusUploadTable := `
+	CREATE TABLE IF NOT EXISTS tus_uploads (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		length INTEGER NOT NULL,
+		upload_offset INTEGER NOT NULL DEFAULT 0,
+		media_type TEXT NOT NULL,
+		file_name TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(tusUploadTable)
+	if err != nil {
+		return err
+	}
+
+	videoCaptionTable := `
+	CREATE TABLE IF NOT EXISTS video_captions (
+		video_id TEXT NOT NULL,
+		language TEXT NOT NULL,
+		label TEXT NOT NULL DEFAULT '',
+		url TEXT NOT NULL,
+		PRIMARY KEY(video_id, url),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(videoCaptionTable)
+	if err != nil {
+		return err
+	}
+
+	videoColumns := []struct {
+		name       string
+		definition string
+		backfill   string
+	}{
+		{"aspect_ratio", "TEXT NOT NULL DEFAULT ''", ""},
+		{"original_key", "TEXT NOT NULL DEFAULT ''", ""},
+		{"blurhash", "TEXT NOT NULL DEFAULT ''", ""},
+		{"dynamic_range", "TEXT NOT NULL DEFAULT 'SDR'", ""},
+		{"faststart", "BOOLEAN NOT NULL DEFAULT TRUE", ""},
+		{"status", "TEXT NOT NULL DEFAULT 'pending'", "UPDATE videos SET status = 'ready' WHERE video_url IS NOT NULL"},
+		{"thumbnail_sizes", "TEXT NOT NULL DEFAULT '{}'", ""},
+		{"expires_at", "TIMESTAMP", ""},
+		{"preview_gif_url", "TEXT", ""},
+		{"size_bytes", "INTEGER NOT NULL DEFAULT 0", ""},
+		{"duration", "REAL NOT NULL DEFAULT 0", ""},
+		{"chapters_url", "TEXT", ""},
+		{"visibility", "TEXT NOT NULL DEFAULT 'private'", ""},
+		{"view_count", "INTEGER NOT NULL DEFAULT 0", ""},
+		{"probe_json", "TEXT NOT NULL DEFAULT ''", ""},
+		{"category", "TEXT NOT NULL DEFAULT ''", ""},
+		{"phash", "TEXT NOT NULL DEFAULT ''", ""},
+		{"publish_state", "TEXT NOT NULL DEFAULT 'draft'", "UPDATE videos SET publish_state = 'published'"},
+		{"low_bitrate", "BOOLEAN NOT NULL DEFAULT FALSE", ""},
+		{"width", "INTEGER NOT NULL DEFAULT 0", ""},
+		{"height", "INTEGER NOT NULL DEFAULT 0", ""},
+		{"content_hash", "TEXT NOT NULL DEFAULT ''", ""},
+		{"stored_bytes", "INTEGER NOT NULL DEFAULT 0", "UPDATE videos SET stored_bytes = size_bytes"},
+		{"video_codec", "TEXT NOT NULL DEFAULT ''", ""},
+	}
+	for _, col := range videoColumns {
+		added, err := c.addColumnIfMissing("videos", col.name, col.definition)
+		if err != nil {
+			return err
+		}
+		if added && col.backfill != "" {
+			if _, err := c.db.Exec(col.backfill); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := c.addColumnIfMissing("users", "tenant_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfMissing("video_variants", "status", "TEXT NOT NULL DEFAULT 'ready'"); err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfMissing("tus_uploads", "encoding_profile", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfMissing("tus_uploads", "category", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	added, err := c.addColumnIfMissing("tus_uploads", "updated_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	if added {
+		// uploads from before activity was tracked get a full expiry window
+		if _, err := c.db.Exec("UPDATE tus_uploads SET updated_at = ?", time.Now().UTC()); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// addColumnIfMissing lets older databases pick up columns that were added
+// after their tables were first created. It reports whether the column had
+// to be added.
+func (c *Client) addColumnIfMissing(table, column, definition string) (bool, error) {
+	rows, err := c.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return false, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	rows.Close()
+
+	if _, err := c.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (c Client) Reset() error {
 	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
 		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
@@ -82,6 +314,30 @@ func (c Client) Reset() error {
 	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
 		return fmt.Errorf("failed to reset table users: %w", err)
 	}
+	if _, err := c.db.Exec("DELETE FROM share_tokens"); err != nil {
+		return fmt.Errorf("failed to reset table share_tokens: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM tus_uploads"); err != nil {
+		return fmt.Errorf("failed to reset table tus_uploads: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM transcode_segments"); err != nil {
+		return fmt.Errorf("failed to reset table transcode_segments: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_thumbnails"); err != nil {
+		return fmt.Errorf("failed to reset table video_thumbnails: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_views"); err != nil {
+		return fmt.Errorf("failed to reset table video_views: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM upload_events"); err != nil {
+		return fmt.Errorf("failed to reset table upload_events: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_variants"); err != nil {
+		return fmt.Errorf("failed to reset table video_variants: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_captions"); err != nil {
+		return fmt.Errorf("failed to reset table video_captions: %w", err)
+	}
 	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
 		return fmt.Errorf("failed to reset table videos: %w", err)
 	}
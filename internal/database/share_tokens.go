@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ShareToken struct {
+	ID        uuid.UUID  `json:"id"`
+	VideoID   uuid.UUID  `json:"video_id"`
+	TokenHash string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+type CreateShareTokenParams struct {
+	VideoID   uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+func (c Client) CreateShareToken(params CreateShareTokenParams) (ShareToken, error) {
+	id := uuid.New()
+	query := `
+		INSERT INTO share_tokens (
+			id,
+			video_id,
+			token_hash,
+			created_at,
+			expires_at
+		) VALUES (?, ?, ?, CURRENT_TIMESTAMP, ?)
+	`
+	_, err := c.db.Exec(query, id, params.VideoID, params.TokenHash, params.ExpiresAt)
+	if err != nil {
+		return ShareToken{}, err
+	}
+
+	return c.GetShareToken(id)
+}
+
+const shareTokenColumns = `
+			id,
+			video_id,
+			token_hash,
+			created_at,
+			expires_at,
+			revoked_at`
+
+func scanShareToken(row rowScanner) (ShareToken, error) {
+	var st ShareToken
+	err := row.Scan(&st.ID, &st.VideoID, &st.TokenHash, &st.CreatedAt, &st.ExpiresAt, &st.RevokedAt)
+	return st, err
+}
+
+func (c Client) GetShareToken(id uuid.UUID) (ShareToken, error) {
+	query := `
+		SELECT` + shareTokenColumns + `
+		FROM share_tokens
+		WHERE id = ?
+	`
+	st, err := scanShareToken(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ShareToken{}, nil
+		}
+		return ShareToken{}, err
+	}
+	return st, nil
+}
+
+func (c Client) GetShareTokenByHash(tokenHash string) (ShareToken, error) {
+	query := `
+		SELECT` + shareTokenColumns + `
+		FROM share_tokens
+		WHERE token_hash = ?
+	`
+	st, err := scanShareToken(c.db.QueryRow(query, tokenHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ShareToken{}, nil
+		}
+		return ShareToken{}, err
+	}
+	return st, nil
+}
+
+func (c Client) RevokeShareToken(id uuid.UUID) error {
+	query := `
+		UPDATE share_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
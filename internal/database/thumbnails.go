@@ -0,0 +1,89 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoThumbnail is one of the thumbnails uploaded for a video. The primary
+// one is copied onto the video itself.
+type VideoThumbnail struct {
+	ID        uuid.UUID      `json:"id"`
+	VideoID   uuid.UUID      `json:"video_id"`
+	URL       string         `json:"url"`
+	Sizes     ThumbnailSizes `json:"sizes"`
+	BlurHash  string         `json:"blurhash"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type CreateVideoThumbnailParams struct {
+	VideoID  uuid.UUID
+	URL      string
+	Sizes    ThumbnailSizes
+	BlurHash string
+}
+
+func (c Client) CreateVideoThumbnail(params CreateVideoThumbnailParams) (VideoThumbnail, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO video_thumbnails (
+		id,
+		video_id,
+		url,
+		sizes,
+		blurhash,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	_, err := c.db.Exec(query, id, params.VideoID, params.URL, params.Sizes, params.BlurHash)
+	if err != nil {
+		return VideoThumbnail{}, err
+	}
+	return c.GetVideoThumbnail(id)
+}
+
+// GetVideoThumbnail returns the zero VideoThumbnail when id doesn't exist.
+func (c Client) GetVideoThumbnail(id uuid.UUID) (VideoThumbnail, error) {
+	query := `
+	SELECT id, video_id, url, sizes, blurhash, created_at
+	FROM video_thumbnails
+	WHERE id = ?
+	`
+	var t VideoThumbnail
+	err := c.db.QueryRow(query, id).Scan(&t.ID, &t.VideoID, &t.URL, &t.Sizes, &t.BlurHash, &t.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoThumbnail{}, nil
+		}
+		return VideoThumbnail{}, err
+	}
+	return t, nil
+}
+
+// GetVideoThumbnails lists a video's thumbnails, oldest first.
+func (c Client) GetVideoThumbnails(videoID uuid.UUID) ([]VideoThumbnail, error) {
+	query := `
+	SELECT id, video_id, url, sizes, blurhash, created_at
+	FROM video_thumbnails
+	WHERE video_id = ?
+	ORDER BY created_at, rowid
+	`
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	thumbnails := []VideoThumbnail{}
+	for rows.Next() {
+		var t VideoThumbnail
+		if err := rows.Scan(&t.ID, &t.VideoID, &t.URL, &t.Sizes, &t.BlurHash, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		thumbnails = append(thumbnails, t)
+	}
+	return thumbnails, rows.Err()
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"github.com/google/uuid"
+)
+
+// GetCompletedSegments lists the segments of a segmented transcode job that
+// already finished, so a restarted job can skip them.
+func (c Client) GetCompletedSegments(videoID uuid.UUID, job string) ([]int, error) {
+	query := `
+	SELECT segment
+	FROM transcode_segments
+	WHERE video_id = ? AND job = ?
+	ORDER BY segment
+	`
+	rows, err := c.db.Query(query, videoID, job)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	segments := []int{}
+	for rows.Next() {
+		var segment int
+		if err := rows.Scan(&segment); err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment)
+	}
+	return segments, rows.Err()
+}
+
+func (c Client) MarkSegmentDone(videoID uuid.UUID, job string, segment int) error {
+	query := `
+	INSERT OR REPLACE INTO transcode_segments (video_id, job, segment, completed_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	_, err := c.db.Exec(query, videoID, job, segment)
+	return err
+}
+
+// DeleteTranscodeSegments forgets a job's progress once its output has been
+// assembled.
+func (c Client) DeleteTranscodeSegments(videoID uuid.UUID, job string) error {
+	_, err := c.db.Exec(`DELETE FROM transcode_segments WHERE video_id = ? AND job = ?`, videoID, job)
+	return err
+}
+
+// DeleteStaleTranscodeSegments forgets the progress of a video's jobs whose
+// names don't start with jobPrefix.
+func (c Client) DeleteStaleTranscodeSegments(videoID uuid.UUID, jobPrefix string) error {
+	query := `
+	DELETE FROM transcode_segments
+	WHERE video_id = ? AND substr(job, 1, ?) != ?
+	`
+	_, err := c.db.Exec(query, videoID, len(jobPrefix), jobPrefix)
+	return err
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TusUpload is the state of a resumable upload that hasn't completed yet.
+type TusUpload struct {
+	ID        uuid.UUID
+	VideoID   uuid.UUID
+	UserID    uuid.UUID
+	Length    int64
+	Offset    int64
+	MediaType string
+	FileName  string
+	// Category, when set, is given to the video once the upload completes
+	Category string
+	// EncodingProfile overrides the profile the video's category picks
+	EncodingProfile string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+const tusUploadColumns = "id, video_id, user_id, length, upload_offset, media_type, file_name, category, encoding_profile, created_at, updated_at"
+
+type CreateTusUploadParams struct {
+	VideoID         uuid.UUID
+	UserID          uuid.UUID
+	Length          int64
+	MediaType       string
+	FileName        string
+	Category        string
+	EncodingProfile string
+}
+
+func (c Client) CreateTusUpload(params CreateTusUploadParams) (TusUpload, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO tus_uploads (
+		id,
+		video_id,
+		user_id,
+		length,
+		upload_offset,
+		media_type,
+		file_name,
+		category,
+		encoding_profile,
+		created_at,
+		updated_at
+	) VALUES (?, ?, ?, ?, 0, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?)
+	`
+	_, err := c.db.Exec(query, id, params.VideoID, params.UserID, params.Length, params.MediaType, params.FileName, params.Category, params.EncodingProfile, time.Now().UTC())
+	if err != nil {
+		return TusUpload{}, err
+	}
+	return c.GetTusUpload(id)
+}
+
+// GetTusUpload returns the zero TusUpload when id doesn't exist.
+func (c Client) GetTusUpload(id uuid.UUID) (TusUpload, error) {
+	query := `
+	SELECT ` + tusUploadColumns + `
+	FROM tus_uploads
+	WHERE id = ?
+	`
+	var u TusUpload
+	err := c.db.QueryRow(query, id).Scan(&u.ID, &u.VideoID, &u.UserID, &u.Length, &u.Offset, &u.MediaType, &u.FileName, &u.Category, &u.EncodingProfile, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TusUpload{}, nil
+		}
+		return TusUpload{}, err
+	}
+	return u, nil
+}
+
+func (c Client) SetTusUploadOffset(id uuid.UUID, offset int64) error {
+	_, err := c.db.Exec(`UPDATE tus_uploads SET upload_offset = ?, updated_at = ? WHERE id = ?`, offset, time.Now().UTC(), id)
+	return err
+}
+
+// GetAbandonedTusUploads lists the uploads nothing was written to since
+// before.
+func (c Client) GetAbandonedTusUploads(before time.Time) ([]TusUpload, error) {
+	query := `
+	SELECT ` + tusUploadColumns + `
+	FROM tus_uploads
+	WHERE updated_at < ?
+	`
+	rows, err := c.db.Query(query, before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []TusUpload{}
+	for rows.Next() {
+		var u TusUpload
+		if err := rows.Scan(&u.ID, &u.VideoID, &u.UserID, &u.Length, &u.Offset, &u.MediaType, &u.FileName, &u.Category, &u.EncodingProfile, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, rows.Err()
+}
+
+func (c Client) DeleteTusUpload(id uuid.UUID) error {
+	_, err := c.db.Exec(`DELETE FROM tus_uploads WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Stages of an upload recorded in the upload_events audit trail.
+const (
+	UploadEventReceived  = "received"
+	UploadEventProbed    = "probed"
+	UploadEventProcessed = "processed"
+	UploadEventStored    = "stored"
+	UploadEventCommitted = "committed"
+	UploadEventFailed    = "failed"
+	// a rendition that couldn't be made, the upload itself went on
+	UploadEventVariantFailed = "variant_failed"
+)
+
+type UploadEvent struct {
+	ID        int64     `json:"id"`
+	VideoID   uuid.UUID `json:"video_id"`
+	Event     string    `json:"event"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (c Client) AppendUploadEvent(videoID uuid.UUID, event, details string) error {
+	query := `
+	INSERT INTO upload_events (video_id, event, details, created_at)
+	VALUES (?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, videoID, event, details, time.Now().UTC())
+	return err
+}
+
+// GetLastUploadFailure returns the details of the video's most recent
+// failed event, empty when no upload of it ever failed.
+func (c Client) GetLastUploadFailure(videoID uuid.UUID) (string, error) {
+	query := `
+	SELECT details
+	FROM upload_events
+	WHERE video_id = ? AND event = ?
+	ORDER BY id DESC
+	LIMIT 1
+	`
+	var details string
+	err := c.db.QueryRow(query, videoID, UploadEventFailed).Scan(&details)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return details, err
+}
+
+// GetUploadEvents returns a video's upload events, oldest first.
+func (c Client) GetUploadEvents(videoID uuid.UUID) ([]UploadEvent, error) {
+	query := `
+	SELECT id, video_id, event, details, created_at
+	FROM upload_events
+	WHERE video_id = ?
+	ORDER BY id
+	`
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []UploadEvent{}
+	for rows.Next() {
+		var e UploadEvent
+		if err := rows.Scan(&e.ID, &e.VideoID, &e.Event, &e.Details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
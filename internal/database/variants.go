@@ -0,0 +1,98 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+type VideoVariant struct {
+	VideoID uuid.UUID `json:"-"`
+	Name    string    `json:"name"`
+	Width   int       `json:"width"`
+	Height  int       `json:"height"`
+	URL     string    `json:"url"`
+	Status  string    `json:"status"`
+}
+
+// A failed variant is recorded without a URL, so clients can tell a
+// rendition that couldn't be made from one that was never attempted.
+const (
+	VariantStatusReady  = "ready"
+	VariantStatusFailed = "failed"
+)
+
+// ReplaceVideoVariants swaps out every stored rendition of a video, so a
+// re-upload never leaves stale renditions behind.
+func (c Client) ReplaceVideoVariants(videoID uuid.UUID, variants []VideoVariant) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceVideoVariants(tx, videoID, variants); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceVideoVariants(tx *sql.Tx, videoID uuid.UUID, variants []VideoVariant) error {
+	if _, err := tx.Exec(`DELETE FROM video_variants WHERE video_id = ?`, videoID); err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO video_variants (
+		video_id,
+		name,
+		width,
+		height,
+		url,
+		status
+	) VALUES (?, ?, ?, ?, ?, ?)
+	`
+	for _, v := range variants {
+		status := v.Status
+		if status == "" {
+			status = VariantStatusReady
+		}
+		if _, err := tx.Exec(query, videoID, v.Name, v.Width, v.Height, v.URL, status); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c Client) GetVideoVariants(videoID uuid.UUID) ([]VideoVariant, error) {
+	query := `
+	SELECT
+		video_id,
+		name,
+		width,
+		height,
+		url,
+		status
+	FROM video_variants
+	WHERE video_id = ?
+	ORDER BY height DESC
+	`
+
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []VideoVariant{}
+	for rows.Next() {
+		var v VideoVariant
+		if err := rows.Scan(&v.VideoID, &v.Name, &v.Width, &v.Height, &v.URL, &v.Status); err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+
+	return variants, nil
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoViewCount is a number of views a video got within the hour starting
+// at Bucket.
+type VideoViewCount struct {
+	VideoID uuid.UUID `json:"-"`
+	Bucket  time.Time `json:"start"`
+	Count   int       `json:"views"`
+}
+
+// AddVideoViews adds the counts to both the hourly buckets and the videos'
+// running totals in one transaction. Counts for videos that were deleted in
+// the meantime are dropped.
+func (c Client) AddVideoViews(counts []VideoViewCount) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	bucketQuery := `
+	INSERT INTO video_views (video_id, bucket, count)
+	SELECT ?, ?, ?
+	WHERE EXISTS (SELECT 1 FROM videos WHERE id = ?)
+	ON CONFLICT(video_id, bucket) DO UPDATE SET count = count + excluded.count
+	`
+	totalQuery := `
+	UPDATE videos
+	SET view_count = view_count + ?
+	WHERE id = ?
+	`
+	for _, vc := range counts {
+		bucket := vc.Bucket.UTC().Truncate(time.Hour)
+		if _, err := tx.Exec(bucketQuery, vc.VideoID, bucket, vc.Count, vc.VideoID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(totalQuery, vc.Count, vc.VideoID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetVideoViews returns a video's hourly view counts since the given time,
+// oldest first. Hours without views are left out.
+func (c Client) GetVideoViews(videoID uuid.UUID, since time.Time) ([]VideoViewCount, error) {
+	query := `
+	SELECT video_id, bucket, count
+	FROM video_views
+	WHERE video_id = ? AND bucket >= ?
+	ORDER BY bucket
+	`
+	rows, err := c.db.Query(query, videoID, since.UTC().Truncate(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []VideoViewCount{}
+	for rows.Next() {
+		var vc VideoViewCount
+		if err := rows.Scan(&vc.VideoID, &vc.Bucket, &vc.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, vc)
+	}
+	return counts, rows.Err()
+}
@@ -2,30 +2,114 @@ package database
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID             uuid.UUID      `json:"id"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	ThumbnailURL   *string        `json:"thumbnail_url"`
+	ThumbnailSizes ThumbnailSizes `json:"thumbnail_sizes"`
+	VideoURL       *string        `json:"video_url"`
+	PreviewGIFURL  *string        `json:"previewGifUrl"`
+	AspectRatio    string         `json:"aspect_ratio"`
+	OriginalKey    string         `json:"-"`
+	BlurHash       string         `json:"blurhash"`
+	DynamicRange   string         `json:"dynamic_range"`
+	FastStart      bool           `json:"faststart"`
+	Status         string         `json:"status"`
+	ExpiresAt      *time.Time     `json:"expires_at"`
+	SizeBytes      int64          `json:"size_bytes"`
+	Duration       float64        `json:"duration"`
+	ChaptersURL    *string        `json:"chapters_url"`
+	Visibility     string         `json:"visibility"`
+	ViewCount      int64          `json:"view_count"`
+	ProbeJSON      string         `json:"-"`
+	Category       string         `json:"category"`
+	PHash          string         `json:"-"`
+	PublishState   string         `json:"publish_state"`
+	LowBitrate     bool           `json:"low_bitrate"`
+	Width          int            `json:"width"`
+	Height         int            `json:"height"`
+	ContentHash    string         `json:"-"`
+	StoredBytes    int64          `json:"stored_bytes"`
+	VideoCodec     string         `json:"video_codec"`
 	CreateVideoParams
 }
 
+// Expired reports whether the video's retention ran out by now.
+func (v Video) Expired(now time.Time) bool {
+	return v.ExpiresAt != nil && !v.ExpiresAt.After(now)
+}
+
+// ThumbnailSizes maps a size name to the URL of the thumbnail scaled to it.
+// It's stored as a JSON object.
+type ThumbnailSizes map[string]string
+
+func (t *ThumbnailSizes) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	case nil:
+		*t = ThumbnailSizes{}
+		return nil
+	default:
+		return fmt.Errorf("unsupported thumbnail sizes type %T", src)
+	}
+	sizes := ThumbnailSizes{}
+	if err := json.Unmarshal(data, &sizes); err != nil {
+		return err
+	}
+	*t = sizes
+	return nil
+}
+
+func (t ThumbnailSizes) Value() (driver.Value, error) {
+	if t == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(map[string]string(t))
+	return string(data), err
+}
+
+// Processing states of a video's upload.
+const (
+	VideoStatusPending    = "pending"
+	VideoStatusProcessing = "processing"
+	VideoStatusReady      = "ready"
+	VideoStatusFailed     = "failed"
+)
+
+// Who may watch a video through its stable link.
+const (
+	VideoVisibilityPrivate = "private"
+	VideoVisibilityPublic  = "public"
+)
+
+// Whether a video is live. Videos start out as drafts only their owner can
+// see.
+const (
+	VideoPublishDraft     = "draft"
+	VideoPublishPublished = "published"
+)
+
 type CreateVideoParams struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
+	Title       string    `json:"title" validate:"required,max=200"`
+	Description string    `json:"description" validate:"max=5000"`
 	UserID      uuid.UUID `json:"user_id"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
@@ -33,13 +117,202 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 		description,
 		thumbnail_url,
 		video_url,
-		user_id
+		user_id,
+		aspect_ratio,
+		original_key,
+		blurhash,
+		dynamic_range,
+		faststart,
+		status,
+		thumbnail_sizes,
+		expires_at,
+		preview_gif_url,
+		size_bytes,
+		duration,
+		chapters_url,
+		visibility,
+		view_count,
+		probe_json,
+		category,
+		phash,
+		publish_state,
+		low_bitrate,
+		width,
+		height,
+		content_hash,
+		stored_bytes,
+		video_codec`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVideo(row rowScanner) (Video, error) {
+	var video Video
+	err := row.Scan(
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.UserID,
+		&video.AspectRatio,
+		&video.OriginalKey,
+		&video.BlurHash,
+		&video.DynamicRange,
+		&video.FastStart,
+		&video.Status,
+		&video.ThumbnailSizes,
+		&video.ExpiresAt,
+		&video.PreviewGIFURL,
+		&video.SizeBytes,
+		&video.Duration,
+		&video.ChaptersURL,
+		&video.Visibility,
+		&video.ViewCount,
+		&video.ProbeJSON,
+		&video.Category,
+		&video.PHash,
+		&video.PublishState,
+		&video.LowBitrate,
+		&video.Width,
+		&video.Height,
+		&video.ContentHash,
+		&video.StoredBytes,
+		&video.VideoCodec,
+	)
+	return video, err
+}
+
+// GetVideos lists a user's videos, leaving out expired ones.
+func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND (expires_at IS NULL OR expires_at > ?)
+	ORDER BY created_at DESC
+	`
+
+	return c.queryVideos(query, userID, time.Now().UTC())
+}
+
+// GetVideosInCategory is GetVideos limited to one category.
+func (c Client) GetVideosInCategory(userID uuid.UUID, category string) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
 	FROM videos
-	WHERE user_id = ?
+	WHERE user_id = ? AND category = ? AND (expires_at IS NULL OR expires_at > ?)
 	ORDER BY created_at DESC
 	`
 
-	rows, err := c.db.Query(query, userID)
+	return c.queryVideos(query, userID, category, time.Now().UTC())
+}
+
+// GetHashedVideos lists a user's videos that have a perceptual hash,
+// leaving out expired ones.
+func (c Client) GetHashedVideos(userID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND phash != '' AND (expires_at IS NULL OR expires_at > ?)
+	`
+
+	return c.queryVideos(query, userID, time.Now().UTC())
+}
+
+// GetVideosByContentHash lists the user's uploaded videos whose
+// stored object has the given content hash, newest first.
+func (c Client) GetVideosByContentHash(userID uuid.UUID, hash string) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND content_hash = ? AND video_url IS NOT NULL
+	ORDER BY updated_at DESC
+	`
+
+	return c.queryVideos(query, userID, hash)
+}
+
+// GetVideosByVideoURL lists every video, of any user, whose primary
+// file is the object at url.
+func (c Client) GetVideosByVideoURL(url string) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE video_url = ?
+	`
+
+	return c.queryVideos(query, url)
+}
+
+// GetExpiredVideos lists every video whose retention ran out before now.
+func (c Client) GetExpiredVideos(now time.Time) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE expires_at IS NOT NULL AND expires_at <= ?
+	`
+
+	return c.queryVideos(query, now.UTC())
+}
+
+// CountUploadedVideos counts the user's videos that have an upload, other
+// than the one excluded and any that expired before now.
+func (c Client) CountUploadedVideos(userID, excludeID uuid.UUID, now time.Time) (int, error) {
+	query := `
+	SELECT COUNT(*)
+	FROM videos
+	WHERE user_id = ? AND id != ? AND video_url IS NOT NULL
+		AND (expires_at IS NULL OR expires_at > ?)
+	`
+
+	var count int
+	err := c.db.QueryRow(query, userID, excludeID, now.UTC()).Scan(&count)
+	return count, err
+}
+
+// GetStoredBytes sums the bytes the user's videos other than the one
+// excluded take up in storage.
+func (c Client) GetStoredBytes(userID, excludeID uuid.UUID) (int64, error) {
+	query := `
+	SELECT COALESCE(SUM(stored_bytes), 0)
+	FROM videos
+	WHERE user_id = ? AND id != ?
+	`
+
+	var total int64
+	err := c.db.QueryRow(query, userID, excludeID).Scan(&total)
+	return total, err
+}
+
+// ReserveVideoBytes records the upload size of a video and the bytes its
+// objects take up in storage, but only if the owner's videos then still
+// store no more than quota bytes. The check and the write happen in one
+// statement, so concurrent uploads can't both squeeze in. A quota of zero
+// or less always succeeds. It reports whether the sizes were recorded.
+func (c Client) ReserveVideoBytes(id, userID uuid.UUID, size, stored, quota int64) (bool, error) {
+	query := `
+	UPDATE videos
+	SET size_bytes = ?, stored_bytes = ?
+	WHERE id = ? AND (? <= 0 OR ? + (
+		SELECT COALESCE(SUM(stored_bytes), 0)
+		FROM videos
+		WHERE user_id = ? AND id != ?
+	) <= ?)
+	`
+
+	result, err := c.db.Exec(query, size, stored, id, quota, stored, userID, id, quota)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (c Client) queryVideos(query string, args ...any) ([]Video, error) {
+	rows, err := c.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -47,17 +320,8 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
@@ -88,29 +352,12 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT` + videoColumns + `
 	FROM videos
 	WHERE id = ?
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -122,6 +369,37 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 }
 
 func (c Client) UpdateVideo(video Video) error {
+	return updateVideo(c.db, video)
+}
+
+// UpdateVideoUpload stores the video together with the variants and
+// captions of its new upload, all or nothing.
+func (c Client) UpdateVideoUpload(video Video, variants []VideoVariant, captions []VideoCaption) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateVideo(tx, video); err != nil {
+		return err
+	}
+	if err := replaceVideoVariants(tx, video.ID, variants); err != nil {
+		return err
+	}
+	if err := replaceVideoCaptions(tx, video.ID, captions); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// execer is what *sql.DB and *sql.Tx have in common, so a write can run
+// on its own or as part of a transaction.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func updateVideo(db execer, video Video) error {
 	query := `
 	UPDATE videos
 	SET
@@ -129,23 +407,141 @@ func (c Client) UpdateVideo(video Video) error {
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
-		user_id = ?
+		user_id = ?,
+		aspect_ratio = ?,
+		original_key = ?,
+		blurhash = ?,
+		dynamic_range = ?,
+		faststart = ?,
+		status = ?,
+		thumbnail_sizes = ?,
+		expires_at = ?,
+		preview_gif_url = ?,
+		duration = ?,
+		chapters_url = ?,
+		visibility = ?,
+		probe_json = ?,
+		category = ?,
+		phash = ?,
+		publish_state = ?,
+		low_bitrate = ?,
+		width = ?,
+		height = ?,
+		content_hash = ?,
+		video_codec = ?
 	WHERE id = ?
 	`
 
-	_, err := c.db.Exec(
+	_, err := db.Exec(
 		query,
 		video.Title,
 		video.Description,
 		&video.ThumbnailURL,
 		&video.VideoURL,
 		video.UserID,
+		video.AspectRatio,
+		video.OriginalKey,
+		video.BlurHash,
+		video.DynamicRange,
+		video.FastStart,
+		video.Status,
+		video.ThumbnailSizes,
+		video.ExpiresAt,
+		video.PreviewGIFURL,
+		video.Duration,
+		video.ChaptersURL,
+		video.Visibility,
+		video.ProbeJSON,
+		video.Category,
+		video.PHash,
+		video.PublishState,
+		video.LowBitrate,
+		video.Width,
+		video.Height,
+		video.ContentHash,
+		video.VideoCodec,
 		video.ID,
 	)
 	return err
 }
 
+// SetVideoProbe caches the ffprobe output of the stored video.
+func (c Client) SetVideoProbe(id uuid.UUID, probeJSON string) error {
+	_, err := c.db.Exec(`UPDATE videos SET probe_json = ? WHERE id = ?`, probeJSON, id)
+	return err
+}
+
+func (c Client) SetVideoStatus(id uuid.UUID, status string) error {
+	query := `
+	UPDATE videos
+	SET status = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, status, id)
+	return err
+}
+
+// StartVideoProcessing marks the video processing unless it already is. It
+// reports whether it did, so only one upload of a video is processed at a
+// time.
+func (c Client) StartVideoProcessing(id uuid.UUID) (bool, error) {
+	query := `
+	UPDATE videos
+	SET status = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status != ?
+	`
+	res, err := c.db.Exec(query, VideoStatusProcessing, id, VideoStatusProcessing)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ResetProcessingVideos settles videos whose processing was cut short by a
+// crash: ready if they still have an earlier upload, failed otherwise.
+func (c Client) ResetProcessingVideos() (int64, error) {
+	query := `
+	UPDATE videos
+	SET status = CASE WHEN video_url IS NULL THEN ? ELSE ? END, updated_at = CURRENT_TIMESTAMP
+	WHERE status = ?
+	`
+	res, err := c.db.Exec(query, VideoStatusFailed, VideoStatusReady, VideoStatusProcessing)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (c Client) DeleteVideo(id uuid.UUID) error {
+	if _, err := c.db.Exec(`DELETE FROM video_variants WHERE video_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(`DELETE FROM video_captions WHERE video_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(`DELETE FROM share_tokens WHERE video_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(`DELETE FROM video_thumbnails WHERE video_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(`DELETE FROM video_views WHERE video_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(`DELETE FROM upload_events WHERE video_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(`DELETE FROM transcode_segments WHERE video_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(`DELETE FROM tus_uploads WHERE video_id = ?`, id); err != nil {
+		return err
+	}
+
 	query := `
 	DELETE FROM videos
 	WHERE id = ?
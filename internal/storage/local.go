@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LocalStorage keeps objects on the local filesystem. Object URLs point at
+// baseURL, which is expected to serve root (e.g. the /assets handler). With
+// a signing secret presigned URLs carry a SignedQuery, which that handler
+// has to verify.
+type LocalStorage struct {
+	root          string
+	baseURL       string
+	signingSecret []byte
+}
+
+func NewLocalStorage(root, baseURL string, signingSecret []byte) *LocalStorage {
+	return &LocalStorage{
+		root:          root,
+		baseURL:       baseURL,
+		signingSecret: signingSecret,
+	}
+}
+
+// path maps a key to its file under root. Keys that would land outside of
+// root, such as ones with ../ or absolute paths, are rejected.
+func (s *LocalStorage) path(key string) (string, error) {
+	rel := filepath.FromSlash(key)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return filepath.Join(s.root, rel), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, contentType string, opts ...func(*PutOptions)) error {
+	o := applyPutOptions(opts)
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if o.IfAbsent {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return ErrAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key, byteRange string) (*GetResult, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(key))
+
+	if byteRange == "" {
+		return &GetResult{
+			Body:          f,
+			ContentType:   contentType,
+			ContentLength: info.Size(),
+		}, nil
+	}
+
+	start, end, err := parseRange(byteRange, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &GetResult{
+		Body: struct {
+			io.Reader
+			io.Closer
+		}{io.NewSectionReader(f, start, end-start+1), f},
+		ContentType:   contentType,
+		ContentLength: end - start + 1,
+		ContentRange:  contentRange(start, end, info.Size()),
+	}, nil
+}
+
+func (s *LocalStorage) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(key)),
+	}, nil
+}
+
+// PresignGet returns a plain URL; local objects are served without signing.
+func (s *LocalStorage) PresignGet(ctx context.Context, key string, ttl time.Duration, opts ...func(*PresignOptions)) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if len(s.signingSecret) == 0 {
+		return fmt.Sprintf("%s/%s", s.baseURL, key), nil
+	}
+	query := SignedQuery(s.signingSecret, key, time.Now().Add(ttl))
+	return fmt.Sprintf("%s/%s?%s", s.baseURL, key, query.Encode()), nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStorage) DeleteMany(ctx context.Context, keys []string) ([]DeleteFailure, error) {
+	return deleteEach(ctx, s, keys)
+}
+
+func (s *LocalStorage) Copy(ctx context.Context, srcKey, dstKey string, opts ...func(*PutOptions)) error {
+	srcPath, err := s.path(srcKey)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(srcPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return s.Put(ctx, dstKey, src, "", opts...)
+}
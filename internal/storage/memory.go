@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Object struct {
+	Data         []byte
+	ContentType  string
+	StorageClass string
+	Tags         map[string]string
+	Metadata     map[string]string
+}
+
+// MemoryStorage keeps objects in memory. It is meant for tests and local
+// experiments, nothing stored here survives a restart.
+type MemoryStorage struct {
+	mu       sync.Mutex
+	objects  map[string]Object
+	restores []string
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		objects: map[string]Object{},
+	}
+}
+
+func (s *MemoryStorage) Put(ctx context.Context, key string, r io.Reader, contentType string, opts ...func(*PutOptions)) error {
+	o := applyPutOptions(opts)
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.objects[key]; exists && o.IfAbsent {
+		return ErrAlreadyExists
+	}
+	s.objects[key] = Object{
+		Data:         data,
+		ContentType:  contentType,
+		StorageClass: o.StorageClass,
+		Tags:         o.Tags,
+		Metadata:     o.Metadata,
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Get(ctx context.Context, key, byteRange string) (*GetResult, error) {
+	obj, ok := s.Lookup(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	size := int64(len(obj.Data))
+	if byteRange == "" {
+		return &GetResult{
+			Body:          io.NopCloser(bytes.NewReader(obj.Data)),
+			ContentType:   obj.ContentType,
+			ContentLength: size,
+		}, nil
+	}
+
+	start, end, err := parseRange(byteRange, size)
+	if err != nil {
+		return nil, err
+	}
+	return &GetResult{
+		Body:          io.NopCloser(bytes.NewReader(obj.Data[start : end+1])),
+		ContentType:   obj.ContentType,
+		ContentLength: end - start + 1,
+		ContentRange:  contentRange(start, end, size),
+	}, nil
+}
+
+func (s *MemoryStorage) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	obj, ok := s.Lookup(key)
+	if !ok {
+		return ObjectInfo{}, ErrNotFound
+	}
+	return ObjectInfo{
+		Size:        int64(len(obj.Data)),
+		ContentType: obj.ContentType,
+	}, nil
+}
+
+func (s *MemoryStorage) PresignGet(ctx context.Context, key string, ttl time.Duration, opts ...func(*PresignOptions)) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	o := applyPresignOptions(opts)
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(time.Now().Add(ttl).Unix(), 10))
+	if o.ResponseContentDisposition != "" {
+		query.Set("response-content-disposition", o.ResponseContentDisposition)
+	}
+	if o.ResponseContentType != "" {
+		query.Set("response-content-type", o.ResponseContentType)
+	}
+	return fmt.Sprintf("memory://%s?%s", key, query.Encode()), nil
+}
+
+func (s *MemoryStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *MemoryStorage) DeleteMany(ctx context.Context, keys []string) ([]DeleteFailure, error) {
+	return deleteEach(ctx, s, keys)
+}
+
+func (s *MemoryStorage) Copy(ctx context.Context, srcKey, dstKey string, opts ...func(*PutOptions)) error {
+	o := applyPutOptions(opts)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[srcKey]
+	if !ok {
+		return ErrNotFound
+	}
+	if _, exists := s.objects[dstKey]; exists && o.IfAbsent {
+		return ErrAlreadyExists
+	}
+	s.objects[dstKey] = obj
+	return nil
+}
+
+// Restore records the request, see Restores.
+func (s *MemoryStorage) Restore(ctx context.Context, key string, days int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	if !ok {
+		return ErrNotFound
+	}
+	if obj.StorageClass != "GLACIER" && obj.StorageClass != "DEEP_ARCHIVE" {
+		return ErrNotArchived
+	}
+	s.restores = append(s.restores, key)
+	return nil
+}
+
+// Restores lists the keys Restore was called for.
+func (s *MemoryStorage) Restores() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.restores...)
+}
+
+// Lookup returns a stored object, for inspecting what handlers uploaded.
+func (s *MemoryStorage) Lookup(key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	return obj, ok
+}
+
+// Keys lists the stored keys in order, for checking nothing was left behind.
+func (s *MemoryStorage) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+// Retryable reports whether err looks transient, such as a dropped
+// connection, a timeout, throttling or a failed credential refresh, so the
+// operation is worth trying again. Errors it can't classify, like a bad
+// configuration, are treated as permanent, as are cancelled contexts.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+type retryableError struct{ retryable bool }
+
+func (e retryableError) Error() string        { return "retryable error" }
+func (e retryableError) RetryableError() bool { return e.retryable }
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "unclassified", err: errors.New("invalid configuration"), want: false},
+		{name: "marked retryable", err: retryableError{retryable: true}, want: true},
+		{name: "marked permanent", err: retryableError{retryable: false}, want: false},
+		{name: "wrapped retryable", err: fmt.Errorf("presign: %w", retryableError{retryable: true}), want: true},
+		{name: "dropped connection", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, want: true},
+		{name: "cancelled", err: context.Canceled, want: false},
+		{name: "deadline", err: context.DeadlineExceeded, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
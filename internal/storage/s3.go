@@ -0,0 +1,359 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+type S3Storage struct {
+	client  *s3.Client
+	presign *s3.PresignClient
+	buckets []string
+	// writes holds a slot per running write while a limit is set
+	writes chan struct{}
+}
+
+func NewS3Storage(client *s3.Client, bucket string) *S3Storage {
+	return NewShardedS3Storage(client, []string{bucket})
+}
+
+// NewShardedS3Storage spreads objects over several buckets. ShardKey names
+// a new key's bucket in its first segment, so the key keeps pointing at it
+// when buckets are added. A bucket can only be dropped from the list once
+// its objects have been moved.
+func NewShardedS3Storage(client *s3.Client, buckets []string) *S3Storage {
+	return &S3Storage{
+		client:  client,
+		presign: s3.NewPresignClient(client),
+		buckets: buckets,
+	}
+}
+
+// LimitWrites caps how many PutObject and CopyObject calls run at once,
+// further writes wait for a slot (or their context) instead of piling onto
+// the connection pool and running into S3's rate limits. Zero or less lifts
+// the limit. It must be called before the storage is used.
+func (s *S3Storage) LimitWrites(n int) {
+	if n <= 0 {
+		s.writes = nil
+		return
+	}
+	s.writes = make(chan struct{}, n)
+}
+
+// acquireWrite blocks until a write slot is free, the returned func gives
+// it back.
+func (s *S3Storage) acquireWrite(ctx context.Context) (func(), error) {
+	if s.writes == nil {
+		return func() {}, nil
+	}
+	select {
+	case s.writes <- struct{}{}:
+		return func() { <-s.writes }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ShardKey picks a bucket for a new key from a hash of it and prefixes the
+// key with the bucket's name. A single bucket leaves keys as they are.
+func (s *S3Storage) ShardKey(key string) string {
+	if len(s.buckets) <= 1 {
+		return key
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return s.buckets[h.Sum32()%uint32(len(s.buckets))] + "/" + key
+}
+
+// bucketFor finds the bucket holding key: the first of its segments naming
+// one of the buckets, which also covers keys derived from a sharded key
+// such as audio/<key>. Keys without one, from before sharding or scratch
+// keys like staging/, are in the first bucket.
+func (s *S3Storage) bucketFor(key string) string {
+	if len(s.buckets) == 1 {
+		return s.buckets[0]
+	}
+	for _, segment := range strings.Split(path.Dir(key), "/") {
+		if slices.Contains(s.buckets, segment) {
+			return segment
+		}
+	}
+	return s.buckets[0]
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, contentType string, opts ...func(*PutOptions)) error {
+	bucket := s.bucketFor(key)
+	o := applyPutOptions(opts)
+	slog.DebugContext(ctx, "S3 PutObject", "bucket", bucket, "key", key, "content_type", contentType, "content_length", o.ContentLength, "storage_class", o.StorageClass)
+	input := &s3.PutObjectInput{
+		Bucket:      &bucket,
+		Key:         &key,
+		Body:        r,
+		ContentType: &contentType,
+	}
+	if o.StorageClass != "" {
+		input.StorageClass = types.StorageClass(o.StorageClass)
+	}
+	if o.ContentLength > 0 {
+		input.ContentLength = aws.Int64(o.ContentLength)
+	}
+	if o.IfAbsent {
+		input.IfNoneMatch = aws.String("*")
+	}
+	if len(o.Tags) > 0 {
+		input.Tagging = aws.String(encodeTags(o.Tags))
+	}
+	if len(o.Metadata) > 0 {
+		input.Metadata = o.Metadata
+	}
+
+	release, err := s.acquireWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	_, err = s.client.PutObject(ctx, input)
+	return translateError(err)
+}
+
+func (s *S3Storage) Get(ctx context.Context, key, byteRange string) (*GetResult, error) {
+	bucket := s.bucketFor(key)
+	slog.DebugContext(ctx, "S3 GetObject", "bucket", bucket, "key", key, "range", byteRange)
+	input := &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}
+	if byteRange != "" {
+		input.Range = &byteRange
+	}
+
+	out, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	result := &GetResult{Body: out.Body}
+	if out.ContentType != nil {
+		result.ContentType = *out.ContentType
+	}
+	if out.ContentLength != nil {
+		result.ContentLength = *out.ContentLength
+	}
+	if out.ContentRange != nil {
+		result.ContentRange = *out.ContentRange
+	}
+	return result, nil
+}
+
+func (s *S3Storage) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	bucket := s.bucketFor(key)
+	slog.DebugContext(ctx, "S3 HeadObject", "bucket", bucket, "key", key)
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return ObjectInfo{}, translateError(err)
+	}
+
+	var info ObjectInfo
+	if out.ContentLength != nil {
+		info.Size = *out.ContentLength
+	}
+	if out.ContentType != nil {
+		info.ContentType = *out.ContentType
+	}
+	return info, nil
+}
+
+func (s *S3Storage) PresignGet(ctx context.Context, key string, ttl time.Duration, opts ...func(*PresignOptions)) (string, error) {
+	bucket := s.bucketFor(key)
+	o := applyPresignOptions(opts)
+	slog.DebugContext(ctx, "S3 presign GetObject", "bucket", bucket, "key", key, "ttl", ttl)
+	input := &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}
+	if o.ResponseContentDisposition != "" {
+		input.ResponseContentDisposition = aws.String(o.ResponseContentDisposition)
+	}
+	if o.ResponseContentType != "" {
+		input.ResponseContentType = aws.String(o.ResponseContentType)
+	}
+
+	req, err := s.presign.PresignGetObject(ctx, input, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+func (s *S3Storage) PresignPost(ctx context.Context, key string, ttl time.Duration, policy PostPolicy) (PresignedPost, error) {
+	bucket := s.bucketFor(key)
+	slog.DebugContext(ctx, "S3 presign PostObject", "bucket", bucket, "key", key, "ttl", ttl, "max_size", policy.MaxSize)
+	req, err := s.presign.PresignPostObject(ctx, &s3.PutObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}, func(o *s3.PresignPostOptions) {
+		o.Expires = ttl
+		o.Conditions = []interface{}{
+			[]interface{}{"content-length-range", 1, policy.MaxSize},
+			[]interface{}{"starts-with", "$Content-Type", policy.ContentTypePrefix},
+		}
+	})
+	if err != nil {
+		return PresignedPost{}, err
+	}
+	return PresignedPost{
+		URL:    req.URL,
+		Fields: req.Values,
+	}, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	bucket := s.bucketFor(key)
+	slog.DebugContext(ctx, "S3 DeleteObject", "bucket", bucket, "key", key)
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	return err
+}
+
+// encodeTags formats tags the way S3 expects them in the Tagging header,
+// as URL query parameters.
+func encodeTags(tags map[string]string) string {
+	values := url.Values{}
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
+
+// maxDeleteBatch is the most keys S3 accepts in a single DeleteObjects call.
+const maxDeleteBatch = 1000
+
+func (s *S3Storage) DeleteMany(ctx context.Context, keys []string) ([]DeleteFailure, error) {
+	// DeleteObjects works on one bucket at a time
+	byBucket := map[string][]string{}
+	for _, key := range keys {
+		bucket := s.bucketFor(key)
+		byBucket[bucket] = append(byBucket[bucket], key)
+	}
+
+	failures := []DeleteFailure{}
+	for bucket, bucketKeys := range byBucket {
+		failures = append(failures, s.deleteBatches(ctx, bucket, bucketKeys)...)
+	}
+	return failures, nil
+}
+
+func (s *S3Storage) deleteBatches(ctx context.Context, bucket string, keys []string) []DeleteFailure {
+	failures := []DeleteFailure{}
+	for start := 0; start < len(keys); start += maxDeleteBatch {
+		batch := keys[start:min(start+maxDeleteBatch, len(keys))]
+		slog.DebugContext(ctx, "S3 DeleteObjects", "bucket", bucket, "keys", len(batch))
+		objects := make([]types.ObjectIdentifier, 0, len(batch))
+		for _, key := range batch {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		out, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: &bucket,
+			Delete: &types.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			// the whole batch failed, report every key in it and carry on
+			// with the rest
+			for _, key := range batch {
+				failures = append(failures, DeleteFailure{Key: key, Message: err.Error()})
+			}
+			continue
+		}
+		for _, e := range out.Errors {
+			failures = append(failures, DeleteFailure{
+				Key:     aws.ToString(e.Key),
+				Message: aws.ToString(e.Message),
+			})
+		}
+	}
+	return failures
+}
+
+func (s *S3Storage) Copy(ctx context.Context, srcKey, dstKey string, opts ...func(*PutOptions)) error {
+	o := applyPutOptions(opts)
+	// the source and destination may live in different buckets
+	srcBucket := s.bucketFor(srcKey)
+	dstBucket := s.bucketFor(dstKey)
+	source := srcBucket + "/" + (&url.URL{Path: srcKey}).EscapedPath()
+	slog.DebugContext(ctx, "S3 CopyObject", "src_bucket", srcBucket, "src", srcKey, "dst_bucket", dstBucket, "dst", dstKey)
+	input := &s3.CopyObjectInput{
+		Bucket:     &dstBucket,
+		Key:        &dstKey,
+		CopySource: &source,
+	}
+	if o.IfAbsent {
+		input.IfNoneMatch = aws.String("*")
+	}
+	release, err := s.acquireWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	_, err = s.client.CopyObject(ctx, input)
+	return translateError(err)
+}
+
+func (s *S3Storage) Restore(ctx context.Context, key string, days int) error {
+	bucket := s.bucketFor(key)
+	slog.DebugContext(ctx, "S3 RestoreObject", "bucket", bucket, "key", key, "days", days)
+	_, err := s.client.RestoreObject(ctx, &s3.RestoreObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+		RestoreRequest: &types.RestoreRequest{
+			Days: aws.Int32(int32(days)),
+			GlacierJobParameters: &types.GlacierJobParameters{
+				Tier: types.TierStandard,
+			},
+		},
+	})
+	return translateError(err)
+}
+
+// translateError maps S3 error codes onto the package's sentinel errors.
+func translateError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound":
+			return ErrNotFound
+		case "InvalidRange":
+			return ErrInvalidRange
+		case "InvalidObjectState":
+			return ErrNotArchived
+		case "RestoreAlreadyInProgress":
+			return ErrRestoreInProgress
+		case "PreconditionFailed":
+			// the only precondition we send is If-None-Match: *
+			return ErrAlreadyExists
+		}
+	}
+	return err
+}
@@ -0,0 +1,459 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// newTestS3Storage points an S3Storage at handler instead of AWS.
+func newTestS3Storage(t *testing.T, handler http.Handler, buckets ...string) *S3Storage {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client := s3.New(s3.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(srv.URL),
+		UsePathStyle:     true,
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+	return NewShardedS3Storage(client, buckets)
+}
+
+// newSigningS3Storage returns an S3Storage with static credentials, which
+// presigning needs, anonymous requests aren't signed. It's never connected
+// to anything.
+func newSigningS3Storage() *S3Storage {
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String("http://localhost"),
+		UsePathStyle: true,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+		}),
+	})
+	return NewShardedS3Storage(client, []string{"bucket"})
+}
+
+func TestS3StorageLimitWrites(t *testing.T) {
+	tests := []struct {
+		name       string
+		limit      int
+		writes     int
+		wantMaxRun int32
+	}{
+		{name: "beyond the limit writes queue", limit: 2, writes: 6, wantMaxRun: 2},
+		{name: "a limit of one serializes", limit: 1, writes: 3, wantMaxRun: 1},
+		{name: "no limit runs them all", limit: 0, writes: 4, wantMaxRun: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var running, maxRunning, arrived atomic.Int32
+			release := make(chan struct{})
+			store := newTestS3Storage(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					m := maxRunning.Load()
+					if n <= m || maxRunning.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				arrived.Add(1)
+				<-release
+				w.WriteHeader(http.StatusOK)
+			}), "bucket")
+			store.LimitWrites(tt.limit)
+
+			var wg sync.WaitGroup
+			errs := make([]error, tt.writes)
+			for i := range tt.writes {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs[i] = store.Put(context.Background(), "key", strings.NewReader("data"), "text/plain")
+				}()
+			}
+
+			// give queued writes every chance to reach the server early
+			deadline := time.Now().Add(2 * time.Second)
+			for arrived.Load() < tt.wantMaxRun && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			time.Sleep(50 * time.Millisecond)
+			if got := running.Load(); got != tt.wantMaxRun {
+				t.Errorf("running writes = %d, want %d", got, tt.wantMaxRun)
+			}
+			close(release)
+			wg.Wait()
+
+			for i, err := range errs {
+				if err != nil {
+					t.Errorf("write %d: %v", i, err)
+				}
+			}
+			if got := maxRunning.Load(); got != tt.wantMaxRun {
+				t.Errorf("max concurrent writes = %d, want %d", got, tt.wantMaxRun)
+			}
+			if got := arrived.Load(); got != int32(tt.writes) {
+				t.Errorf("writes reaching S3 = %d, want %d", got, tt.writes)
+			}
+		})
+	}
+}
+
+func TestS3StorageLimitWritesContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	store := newTestS3Storage(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}), "bucket")
+	store.LimitWrites(1)
+
+	go store.Put(context.Background(), "held", strings.NewReader("data"), "text/plain")
+	for len(store.writes) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// a queued write gives up with its context
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := store.Put(ctx, "queued", strings.NewReader("data"), "text/plain")
+	if err != context.DeadlineExceeded {
+		t.Errorf("queued write err = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestS3StoragePutHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []func(*PutOptions)
+		want map[string]string
+	}{
+		{
+			name: "content type and length",
+			opts: []func(*PutOptions){WithContentLength(4)},
+			want: map[string]string{"Content-Type": "video/mp4", "Content-Length": "4"},
+		},
+		{
+			name: "storage class, tags and metadata",
+			opts: []func(*PutOptions){
+				WithContentLength(4),
+				WithStorageClass("GLACIER"),
+				WithTags(map[string]string{"team": "video"}),
+				WithMetadata(map[string]string{"sha256": "abc"}),
+			},
+			want: map[string]string{
+				"X-Amz-Storage-Class": "GLACIER",
+				"X-Amz-Tagging":       "team=video",
+				"X-Amz-Meta-Sha256":   "abc",
+			},
+		},
+		{
+			name: "if absent",
+			opts: []func(*PutOptions){WithContentLength(4), WithIfAbsent()},
+			want: map[string]string{"If-None-Match": "*"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got http.Header
+			var body []byte
+			store := newTestS3Storage(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Clone()
+				got.Set("Content-Length", strconv.FormatInt(r.ContentLength, 10))
+				body, _ = io.ReadAll(r.Body)
+			}), "bucket")
+
+			if err := store.Put(context.Background(), "videos/a.mp4", strings.NewReader("data"), "video/mp4", tt.opts...); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if string(body) != "data" {
+				t.Errorf("body = %q, want %q", body, "data")
+			}
+			for header, want := range tt.want {
+				if got.Get(header) != want {
+					t.Errorf("%s = %q, want %q", header, got.Get(header), want)
+				}
+			}
+		})
+	}
+}
+
+func TestS3StoragePresignGetOverrides(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []func(*PresignOptions)
+		want  map[string]string
+		unset []string
+	}{
+		{
+			name:  "no overrides",
+			unset: []string{"response-content-disposition", "response-content-type"},
+		},
+		{
+			name:  "download file name",
+			opts:  []func(*PresignOptions){WithResponseContentDisposition(`attachment; filename="My video.mp4"`)},
+			want:  map[string]string{"response-content-disposition": `attachment; filename="My video.mp4"`},
+			unset: []string{"response-content-type"},
+		},
+		{
+			name: "both",
+			opts: []func(*PresignOptions){
+				WithResponseContentDisposition("inline"),
+				WithResponseContentType("application/octet-stream"),
+			},
+			want: map[string]string{
+				"response-content-disposition": "inline",
+				"response-content-type":        "application/octet-stream",
+			},
+		},
+	}
+
+	store := newSigningS3Storage()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := store.PresignGet(context.Background(), "videos/a.mp4", time.Minute, tt.opts...)
+			if err != nil {
+				t.Fatalf("PresignGet: %v", err)
+			}
+			u, err := url.Parse(raw)
+			if err != nil {
+				t.Fatalf("parsing %s: %v", raw, err)
+			}
+			query := u.Query()
+			for param, want := range tt.want {
+				if got := query.Get(param); got != want {
+					t.Errorf("%s = %q, want %q", param, got, want)
+				}
+			}
+			for _, param := range tt.unset {
+				if query.Has(param) {
+					t.Errorf("%s = %q, want it unset", param, query.Get(param))
+				}
+			}
+			// the overrides are part of what's signed
+			if !strings.Contains(query.Get("X-Amz-SignedHeaders"), "host") || query.Get("X-Amz-Signature") == "" {
+				t.Errorf("URL %s isn't signed", raw)
+			}
+		})
+	}
+}
+
+func TestS3StoragePresignPost(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy PostPolicy
+	}{
+		{name: "video uploads", policy: PostPolicy{MaxSize: 1 << 30, ContentTypePrefix: "video/"}},
+		{name: "small mp4 uploads", policy: PostPolicy{MaxSize: 1024, ContentTypePrefix: "video/mp4"}},
+	}
+
+	store := newSigningS3Storage()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post, err := store.PresignPost(context.Background(), "direct/abc.mp4", time.Hour, tt.policy)
+			if err != nil {
+				t.Fatalf("PresignPost: %v", err)
+			}
+			if post.Fields["key"] != "direct/abc.mp4" {
+				t.Errorf("key field = %q, want direct/abc.mp4", post.Fields["key"])
+			}
+			if post.Fields["X-Amz-Signature"] == "" {
+				t.Error("policy isn't signed")
+			}
+
+			raw, err := base64.StdEncoding.DecodeString(post.Fields["policy"])
+			if err != nil {
+				t.Fatalf("decoding policy: %v", err)
+			}
+			var doc struct {
+				Expiration time.Time         `json:"expiration"`
+				Conditions []json.RawMessage `json:"conditions"`
+			}
+			if err := json.Unmarshal(raw, &doc); err != nil {
+				t.Fatalf("parsing policy %s: %v", raw, err)
+			}
+			if until := time.Until(doc.Expiration); until <= 0 || until > time.Hour {
+				t.Errorf("policy expires in %v, want within an hour", until)
+			}
+			conditions := map[string]bool{}
+			for _, c := range doc.Conditions {
+				conditions[string(c)] = true
+			}
+			for _, want := range []string{
+				fmt.Sprintf(`["content-length-range",1,%d]`, tt.policy.MaxSize),
+				fmt.Sprintf(`["starts-with","$Content-Type",%q]`, tt.policy.ContentTypePrefix),
+			} {
+				if !conditions[want] {
+					t.Errorf("policy conditions %s lack %s", raw, want)
+				}
+			}
+		})
+	}
+}
+
+func TestS3StorageIfAbsentPreconditionFailed(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+	}{
+		{name: "new object", status: http.StatusOK},
+		{
+			name:    "existing object",
+			status:  http.StatusPreconditionFailed,
+			body:    `<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`,
+			wantErr: ErrAlreadyExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ifNoneMatch []string
+			var mu sync.Mutex
+			store := newTestS3Storage(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+				mu.Unlock()
+				io.Copy(io.Discard, r.Body)
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(tt.status)
+				if r.URL.Query().Get("x-id") == "CopyObject" && tt.status == http.StatusOK {
+					io.WriteString(w, `<CopyObjectResult><ETag>"abc"</ETag></CopyObjectResult>`)
+					return
+				}
+				io.WriteString(w, tt.body)
+			}), "bucket")
+
+			ctx := context.Background()
+			err := store.Put(ctx, "videos/a.mp4", strings.NewReader("data"), "video/mp4", WithIfAbsent())
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Put err = %v, want %v", err, tt.wantErr)
+			}
+			err = store.Copy(ctx, "staging/a.mp4", "videos/a.mp4", WithIfAbsent())
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Copy err = %v, want %v", err, tt.wantErr)
+			}
+			for i, got := range ifNoneMatch {
+				if got != "*" {
+					t.Errorf("request %d If-None-Match = %q, want *", i, got)
+				}
+			}
+		})
+	}
+}
+
+func TestS3StorageShardKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets []string
+	}{
+		{name: "one bucket", buckets: []string{"videos"}},
+		{name: "two buckets", buckets: []string{"videos-a", "videos-b"}},
+		{name: "three buckets", buckets: []string{"videos-a", "videos-b", "videos-c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &S3Storage{buckets: tt.buckets}
+			again := &S3Storage{buckets: tt.buckets}
+			perBucket := map[string]int{}
+			for i := range 300 {
+				key := fmt.Sprintf("landscape/video-%d.mp4", i)
+				sharded := store.ShardKey(key)
+				if again.ShardKey(key) != sharded {
+					t.Fatalf("ShardKey(%q) isn't deterministic", key)
+				}
+				bucket := store.bucketFor(sharded)
+				if len(tt.buckets) == 1 {
+					if sharded != key {
+						t.Errorf("ShardKey(%q) = %q, want it unchanged", key, sharded)
+					}
+				} else if sharded != bucket+"/"+key {
+					t.Errorf("ShardKey(%q) = %q, want it prefixed with its bucket %s", key, sharded, bucket)
+				}
+				perBucket[bucket]++
+			}
+			// an even spread is 100 per bucket at three
+			for _, bucket := range tt.buckets {
+				if n := perBucket[bucket]; n < 300/len(tt.buckets)/2 {
+					t.Errorf("bucket %s got %d of 300 keys: %v", bucket, n, perBucket)
+				}
+			}
+		})
+	}
+}
+
+func TestS3StorageBucketFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets []string
+		key     string
+		want    string
+	}{
+		{name: "single bucket", buckets: []string{"videos"}, key: "other/a.mp4", want: "videos"},
+		{name: "sharded key", buckets: []string{"a", "b"}, key: "b/landscape/x.mp4", want: "b"},
+		{name: "derived from a sharded key", buckets: []string{"a", "b"}, key: "audio/b/landscape/x.m4a", want: "b"},
+		{name: "tenant scoped", buckets: []string{"a", "b"}, key: "tenants/acme/b/landscape/x.mp4", want: "b"},
+		{name: "bucket name only as the file", buckets: []string{"a", "b"}, key: "landscape/b", want: "a"},
+		{name: "from before sharding", buckets: []string{"a", "b"}, key: "landscape/x.mp4", want: "a"},
+		{name: "scratch key", buckets: []string{"a", "b"}, key: "staging/123", want: "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &S3Storage{buckets: tt.buckets}
+			if got := store.bucketFor(tt.key); got != tt.want {
+				t.Errorf("bucketFor(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestS3StorageShardedPut(t *testing.T) {
+	var mu sync.Mutex
+	paths := map[string]bool{}
+	store := newTestS3Storage(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths[r.URL.Path] = true
+		mu.Unlock()
+	}), "videos-a", "videos-b")
+
+	for i := range 20 {
+		key := store.ShardKey(fmt.Sprintf("landscape/%d.mp4", i))
+		if err := store.Put(context.Background(), key, strings.NewReader("data"), "video/mp4"); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+		bucket := store.bucketFor(key)
+		if want := "/" + bucket + "/" + key; !paths[want] {
+			t.Errorf("Put(%s) didn't reach %s, got %v", key, want, paths)
+		}
+	}
+	buckets := map[string]bool{}
+	for p := range paths {
+		buckets[strings.Split(p, "/")[1]] = true
+	}
+	if len(buckets) != 2 {
+		t.Errorf("writes reached buckets %v, want both", buckets)
+	}
+}
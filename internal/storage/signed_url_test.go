@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySignedQuery(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1_700_000_000, 0)
+	valid := SignedQuery(secret, "thumb.png", now.Add(time.Minute))
+	tests := []struct {
+		name    string
+		query   func() url.Values
+		file    string
+		secret  []byte
+		now     time.Time
+		wantErr error
+	}{
+		{name: "valid", query: func() url.Values { return valid }},
+		{name: "valid until the second it expires", query: func() url.Values { return valid }, now: now.Add(time.Minute)},
+		{name: "expired", query: func() url.Values { return valid }, now: now.Add(time.Minute + time.Second), wantErr: ErrSignatureExpired},
+		{
+			name: "tampered signature",
+			query: func() url.Values {
+				q := url.Values{"expires": valid["expires"]}
+				sig := []byte(valid.Get("signature"))
+				sig[0] ^= 1
+				q.Set("signature", string(sig))
+				return q
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "extended expiry",
+			query: func() url.Values {
+				q := url.Values{"signature": valid["signature"]}
+				q.Set("expires", "9999999999")
+				return q
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{name: "another file", query: func() url.Values { return valid }, file: "other.png", wantErr: ErrInvalidSignature},
+		{name: "another secret", query: func() url.Values { return valid }, secret: []byte("other"), wantErr: ErrInvalidSignature},
+		{name: "unsigned", query: func() url.Values { return url.Values{} }, wantErr: ErrInvalidSignature},
+		{name: "signature not base64", query: func() url.Values { return url.Values{"expires": valid["expires"], "signature": {"!!"}} }, wantErr: ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, key, at := "thumb.png", secret, now
+			if tt.file != "" {
+				file = tt.file
+			}
+			if tt.secret != nil {
+				key = tt.secret
+			}
+			if !tt.now.IsZero() {
+				at = tt.now
+			}
+			if err := VerifySignedQuery(key, file, tt.query(), at); !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifySignedQuery err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLocalStoragePresignGetSigned(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     []byte
+		wantSigned bool
+	}{
+		{name: "without a secret", wantSigned: false},
+		{name: "with a secret", secret: []byte("secret"), wantSigned: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewLocalStorage(t.TempDir(), "http://localhost/assets", tt.secret)
+			raw, err := store.PresignGet(context.Background(), "landscape/a.mp4", time.Minute)
+			if err != nil {
+				t.Fatalf("PresignGet: %v", err)
+			}
+			if !strings.HasPrefix(raw, "http://localhost/assets/landscape/a.mp4") {
+				t.Errorf("URL = %s, want it below the base URL", raw)
+			}
+			u, err := url.Parse(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signed := u.Query().Has("signature"); signed != tt.wantSigned {
+				t.Fatalf("URL %s signed = %v, want %v", raw, signed, tt.wantSigned)
+			}
+			if tt.wantSigned {
+				if err := VerifySignedQuery(tt.secret, "landscape/a.mp4", u.Query(), time.Now()); err != nil {
+					t.Errorf("VerifySignedQuery: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound          = errors.New("object not found")
+	ErrInvalidRange      = errors.New("invalid byte range")
+	ErrNotArchived       = errors.New("object is not archived")
+	ErrRestoreInProgress = errors.New("object restore already in progress")
+	ErrInvalidKey        = errors.New("invalid object key")
+	ErrAlreadyExists     = errors.New("object already exists")
+)
+
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string, opts ...func(*PutOptions)) error
+	Get(ctx context.Context, key, byteRange string) (*GetResult, error)
+	Head(ctx context.Context, key string) (ObjectInfo, error)
+	PresignGet(ctx context.Context, key string, ttl time.Duration, opts ...func(*PresignOptions)) (string, error)
+	Delete(ctx context.Context, key string) error
+	DeleteMany(ctx context.Context, keys []string) ([]DeleteFailure, error)
+	Copy(ctx context.Context, srcKey, dstKey string, opts ...func(*PutOptions)) error
+}
+
+// Sharder is implemented by backends spreading objects over several
+// buckets. ShardKey prefixes a new key with the bucket it's stored in, so the
+// bucket travels with the key into URLs and database rows.
+type Sharder interface {
+	ShardKey(key string) string
+}
+
+// PutOptions tweak how an object is written. Backends ignore options they
+// have no equivalent for.
+type PutOptions struct {
+	// StorageClass selects an S3 storage class such as STANDARD_IA or GLACIER.
+	StorageClass string
+	// Tags are attached to the object, e.g. for cost allocation.
+	Tags map[string]string
+	// Metadata is stored with the object and returned on every GET, S3
+	// sends it as x-amz-meta-* headers.
+	Metadata map[string]string
+	// ContentLength is the exact size of the body, when known, so it can be
+	// streamed without buffering.
+	ContentLength int64
+	// IfAbsent only writes the object if nothing exists under its key yet,
+	// failing with ErrAlreadyExists otherwise. It's the only option Copy
+	// honors.
+	IfAbsent bool
+}
+
+func WithTags(tags map[string]string) func(*PutOptions) {
+	return func(o *PutOptions) {
+		o.Tags = tags
+	}
+}
+
+func WithMetadata(metadata map[string]string) func(*PutOptions) {
+	return func(o *PutOptions) {
+		o.Metadata = metadata
+	}
+}
+
+func WithStorageClass(class string) func(*PutOptions) {
+	return func(o *PutOptions) {
+		o.StorageClass = class
+	}
+}
+
+func WithContentLength(n int64) func(*PutOptions) {
+	return func(o *PutOptions) {
+		o.ContentLength = n
+	}
+}
+
+func WithIfAbsent() func(*PutOptions) {
+	return func(o *PutOptions) {
+		o.IfAbsent = true
+	}
+}
+
+func applyPutOptions(opts []func(*PutOptions)) PutOptions {
+	var o PutOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// PresignOptions override response headers of a presigned GET, e.g. to
+// force a download with a friendly file name. Backends ignore options they
+// have no equivalent for.
+type PresignOptions struct {
+	ResponseContentDisposition string
+	ResponseContentType        string
+}
+
+func WithResponseContentDisposition(disposition string) func(*PresignOptions) {
+	return func(o *PresignOptions) {
+		o.ResponseContentDisposition = disposition
+	}
+}
+
+func WithResponseContentType(contentType string) func(*PresignOptions) {
+	return func(o *PresignOptions) {
+		o.ResponseContentType = contentType
+	}
+}
+
+func applyPresignOptions(opts []func(*PresignOptions)) PresignOptions {
+	var o PresignOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Restorer is implemented by backends with archival storage classes whose
+// objects have to be restored before they can be read.
+type Restorer interface {
+	Restore(ctx context.Context, key string, days int) error
+}
+
+// PostPresigner is implemented by backends that let browsers upload straight
+// to them with an HTML form, under a signed policy.
+type PostPresigner interface {
+	PresignPost(ctx context.Context, key string, ttl time.Duration, policy PostPolicy) (PresignedPost, error)
+}
+
+// PostPolicy holds the constraints signed into a form upload, the backend
+// rejects uploads that break them.
+type PostPolicy struct {
+	// MaxSize is the largest body accepted, in bytes.
+	MaxSize int64
+	// ContentTypePrefix is what the Content-Type form field must start with.
+	ContentTypePrefix string
+}
+
+// PresignedPost is what a browser needs for a form upload: the form fields,
+// including the policy and its signature, are sent along with the file to
+// URL.
+type PresignedPost struct {
+	URL    string            `json:"url"`
+	Fields map[string]string `json:"fields"`
+}
+
+// DeleteFailure reports a key DeleteMany couldn't remove.
+type DeleteFailure struct {
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+// deleteEach is DeleteMany for backends without a batch delete.
+func deleteEach(ctx context.Context, s Storage, keys []string) ([]DeleteFailure, error) {
+	failures := []DeleteFailure{}
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil {
+			failures = append(failures, DeleteFailure{Key: key, Message: err.Error()})
+		}
+	}
+	return failures, nil
+}
+
+// ObjectInfo describes a stored object without fetching its body.
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+}
+
+// GetResult is an object body as returned by Get. ContentRange is only set
+// when a byte range was requested.
+type GetResult struct {
+	Body          io.ReadCloser
+	ContentType   string
+	ContentLength int64
+	ContentRange  string
+}
+
+// parseRange parses a single "bytes=start-end" range header against an
+// object of the given size, returning inclusive offsets.
+func parseRange(header string, size int64) (int64, int64, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, ErrInvalidRange
+	}
+	startStr, endStr, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, ErrInvalidRange
+	}
+
+	var start, end int64
+	switch {
+	case startStr == "":
+		// suffix range, the last n bytes
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, ErrInvalidRange
+		}
+		start = max(size-n, 0)
+		end = size - 1
+	default:
+		var err error
+		start, err = strconv.ParseInt(startStr, 10, 64)
+		if err != nil {
+			return 0, 0, ErrInvalidRange
+		}
+		end = size - 1
+		if endStr != "" {
+			end, err = strconv.ParseInt(endStr, 10, 64)
+			if err != nil {
+				return 0, 0, ErrInvalidRange
+			}
+			end = min(end, size-1)
+		}
+	}
+	if start < 0 || start >= size || end < start {
+		return 0, 0, ErrInvalidRange
+	}
+	return start, end, nil
+}
+
+func contentRange(start, end, size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", start, end, size)
+}
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// backends returns a fresh instance of every backend that runs without a
+// network, so their behavior can be checked against the same table.
+func backends(t *testing.T) map[string]Storage {
+	t.Helper()
+	return map[string]Storage{
+		"memory": NewMemoryStorage(),
+		"local":  NewLocalStorage(t.TempDir(), "http://localhost/assets", nil),
+	}
+}
+
+func readAll(t *testing.T, res *GetResult) string {
+	t.Helper()
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	return string(data)
+}
+
+func TestStorageRoundTrip(t *testing.T) {
+	const content = "0123456789"
+	tests := []struct {
+		name      string
+		byteRange string
+		wantBody  string
+		wantRange string
+		wantErr   error
+	}{
+		{name: "whole object", wantBody: content},
+		{name: "closed range", byteRange: "bytes=2-5", wantBody: "2345", wantRange: "bytes 2-5/10"},
+		{name: "open range", byteRange: "bytes=7-", wantBody: "789", wantRange: "bytes 7-9/10"},
+		{name: "suffix range", byteRange: "bytes=-3", wantBody: "789", wantRange: "bytes 7-9/10"},
+		{name: "end past the object", byteRange: "bytes=8-20", wantBody: "89", wantRange: "bytes 8-9/10"},
+		{name: "start past the object", byteRange: "bytes=10-", wantErr: ErrInvalidRange},
+		{name: "several ranges", byteRange: "bytes=0-1,3-4", wantErr: ErrInvalidRange},
+		{name: "not bytes", byteRange: "items=0-1", wantErr: ErrInvalidRange},
+	}
+
+	for name, store := range backends(t) {
+		ctx := context.Background()
+		if err := store.Put(ctx, "videos/a.mp4", strings.NewReader(content), "video/mp4"); err != nil {
+			t.Fatalf("%s: Put: %v", name, err)
+		}
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				res, err := store.Get(ctx, "videos/a.mp4", tt.byteRange)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Get err = %v, want %v", err, tt.wantErr)
+				}
+				if err != nil {
+					return
+				}
+				if got := readAll(t, res); got != tt.wantBody {
+					t.Errorf("body = %q, want %q", got, tt.wantBody)
+				}
+				if res.ContentLength != int64(len(tt.wantBody)) {
+					t.Errorf("ContentLength = %d, want %d", res.ContentLength, len(tt.wantBody))
+				}
+				if res.ContentRange != tt.wantRange {
+					t.Errorf("ContentRange = %q, want %q", res.ContentRange, tt.wantRange)
+				}
+			})
+		}
+	}
+}
+
+func TestStorageLifecycle(t *testing.T) {
+	for name, store := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := store.Get(ctx, "missing.mp4", ""); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get of a missing key err = %v, want %v", err, ErrNotFound)
+			}
+			if _, err := store.Head(ctx, "missing.mp4"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Head of a missing key err = %v, want %v", err, ErrNotFound)
+			}
+			if err := store.Copy(ctx, "missing.mp4", "copy.mp4"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Copy of a missing key err = %v, want %v", err, ErrNotFound)
+			}
+
+			if err := store.Put(ctx, "a.mp4", strings.NewReader("video"), "video/mp4"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			info, err := store.Head(ctx, "a.mp4")
+			if err != nil {
+				t.Fatalf("Head: %v", err)
+			}
+			if info.Size != 5 || info.ContentType != "video/mp4" {
+				t.Errorf("Head = %+v, want 5 bytes of video/mp4", info)
+			}
+
+			if err := store.Copy(ctx, "a.mp4", "b.mp4"); err != nil {
+				t.Fatalf("Copy: %v", err)
+			}
+			res, err := store.Get(ctx, "b.mp4", "")
+			if err != nil {
+				t.Fatalf("Get of the copy: %v", err)
+			}
+			if got := readAll(t, res); got != "video" {
+				t.Errorf("copy = %q, want %q", got, "video")
+			}
+
+			failures, err := store.DeleteMany(ctx, []string{"a.mp4", "b.mp4", "missing.mp4"})
+			if err != nil {
+				t.Fatalf("DeleteMany: %v", err)
+			}
+			if len(failures) != 0 {
+				t.Errorf("DeleteMany failures = %v, want none", failures)
+			}
+			for _, key := range []string{"a.mp4", "b.mp4"} {
+				if _, err := store.Head(ctx, key); !errors.Is(err, ErrNotFound) {
+					t.Errorf("Head(%s) after delete err = %v, want %v", key, err, ErrNotFound)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoragePutOptions(t *testing.T) {
+	store := NewMemoryStorage()
+	err := store.Put(context.Background(), "a.mp4", strings.NewReader("video"), "video/mp4",
+		WithStorageClass("GLACIER"),
+		WithTags(map[string]string{"team": "video"}),
+		WithMetadata(map[string]string{"sha256": "abc"}),
+	)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	obj, ok := store.Lookup("a.mp4")
+	if !ok {
+		t.Fatal("object wasn't stored")
+	}
+	if string(obj.Data) != "video" || obj.ContentType != "video/mp4" {
+		t.Errorf("object = %q of %s, want %q of video/mp4", obj.Data, obj.ContentType, "video")
+	}
+	if obj.StorageClass != "GLACIER" {
+		t.Errorf("StorageClass = %q, want GLACIER", obj.StorageClass)
+	}
+	if obj.Tags["team"] != "video" {
+		t.Errorf("Tags = %v, want team=video", obj.Tags)
+	}
+	if obj.Metadata["sha256"] != "abc" {
+		t.Errorf("Metadata = %v, want sha256=abc", obj.Metadata)
+	}
+	if _, ok := store.Lookup("b.mp4"); ok {
+		t.Error("Lookup found a key that was never stored")
+	}
+}
+
+func TestStorageIfAbsent(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing bool
+		ifAbsent bool
+		wantErr  error
+		wantData string
+	}{
+		{name: "new object", ifAbsent: true, wantData: "new"},
+		{name: "existing object", existing: true, ifAbsent: true, wantErr: ErrAlreadyExists, wantData: "old"},
+		{name: "overwrites without the condition", existing: true, wantData: "new"},
+	}
+
+	for name, store := range backends(t) {
+		for _, tt := range tests {
+			for _, op := range []string{"put", "copy"} {
+				t.Run(name+"/"+tt.name+"/"+op, func(t *testing.T) {
+					ctx := context.Background()
+					key := op + "/" + tt.name + ".mp4"
+					if tt.existing {
+						if err := store.Put(ctx, key, strings.NewReader("old"), "video/mp4"); err != nil {
+							t.Fatalf("Put: %v", err)
+						}
+					}
+					var opts []func(*PutOptions)
+					if tt.ifAbsent {
+						opts = append(opts, WithIfAbsent())
+					}
+
+					var err error
+					if op == "put" {
+						err = store.Put(ctx, key, strings.NewReader("new"), "video/mp4", opts...)
+					} else {
+						if err := store.Put(ctx, "staging/"+key, strings.NewReader("new"), "video/mp4"); err != nil {
+							t.Fatalf("Put: %v", err)
+						}
+						err = store.Copy(ctx, "staging/"+key, key, opts...)
+					}
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("%s err = %v, want %v", op, err, tt.wantErr)
+					}
+					res, err := store.Get(ctx, key, "")
+					if err != nil {
+						t.Fatalf("Get: %v", err)
+					}
+					if got := readAll(t, res); got != tt.wantData {
+						t.Errorf("object = %q, want %q", got, tt.wantData)
+					}
+				})
+			}
+		}
+	}
+}
@@ -2,33 +2,64 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"strings"
 )
 
+// envelope is the shape of every JSON response: exactly one of Data and
+// Error is set, and RequestID echoes the X-Request-ID of the request.
+type envelope struct {
+	Data      any            `json:"data"`
+	Error     *envelopeError `json:"error"`
+	RequestID string         `json:"requestId"`
+}
+
+type envelopeError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []fieldError `json:"fields,omitempty"`
+}
+
 func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
-	if err != nil {
-		log.Println(err)
-	}
 	if code > 499 {
-		log.Printf("Responding with 5XX error: %s", msg)
+		slog.Error("Responding with 5XX error", "status", code, "msg", msg, "err", err)
+	} else if err != nil {
+		slog.Info("Responding with error", "status", code, "msg", msg, "err", err)
 	}
-	type errorResponse struct {
-		Error string `json:"error"`
-	}
-	respondWithJSON(w, code, errorResponse{
-		Error: msg,
+	respondWithEnvelope(w, code, envelope{
+		Error: &envelopeError{
+			Code:    errorCode(code),
+			Message: msg,
+		},
 	})
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, payload any) {
+	respondWithEnvelope(w, code, envelope{Data: payload})
+}
+
+func respondWithEnvelope(w http.ResponseWriter, code int, env envelope) {
+	env.RequestID = w.Header().Get(requestIDHeader)
 	w.Header().Set("Content-Type", "application/json")
-	dat, err := json.Marshal(payload)
+	dat, err := json.Marshal(env)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
+		slog.Error("Error marshalling JSON", "err", err)
 		w.WriteHeader(500)
 		return
 	}
 	w.WriteHeader(code)
 	w.Write(dat)
 }
+
+// errorCode turns a status code into a stable machine readable code, e.g.
+// 404 becomes "not_found".
+func errorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	text = strings.ReplaceAll(text, "-", " ")
+	text = strings.ReplaceAll(text, "'", "")
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
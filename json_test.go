@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRespondEnvelope(t *testing.T) {
+	tests := []struct {
+		name       string
+		requestID  string
+		respond    func(w http.ResponseWriter)
+		wantStatus int
+		wantData   string
+		wantError  *envelopeError
+	}{
+		{
+			name:      "success",
+			requestID: "req-1",
+			respond: func(w http.ResponseWriter) {
+				respondWithJSON(w, http.StatusOK, map[string]string{"id": "abc"})
+			},
+			wantStatus: http.StatusOK,
+			wantData:   `{"id":"abc"}`,
+		},
+		{
+			name:      "failure",
+			requestID: "req-2",
+			respond: func(w http.ResponseWriter) {
+				respondWithError(w, http.StatusNotFound, "Couldn't find video", errors.New("no rows"))
+			},
+			wantStatus: http.StatusNotFound,
+			wantData:   "null",
+			wantError:  &envelopeError{Code: "not_found", Message: "Couldn't find video"},
+		},
+		{
+			name: "server error without a request ID",
+			respond: func(w http.ResponseWriter) {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't save video", nil)
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantData:   "null",
+			wantError:  &envelopeError{Code: "internal_server_error", Message: "Couldn't save video"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.requestID != "" {
+				req.Header.Set(requestIDHeader, tt.requestID)
+			}
+			requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.respond(w)
+			})).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			var env struct {
+				Data      json.RawMessage `json:"data"`
+				Error     *envelopeError  `json:"error"`
+				RequestID string          `json:"requestId"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+				t.Fatalf("decoding %s: %v", rec.Body, err)
+			}
+			if string(env.Data) != tt.wantData {
+				t.Errorf("data = %s, want %s", env.Data, tt.wantData)
+			}
+			if !reflect.DeepEqual(env.Error, tt.wantError) {
+				t.Errorf("error = %+v, want %+v", env.Error, tt.wantError)
+			}
+			wantID := tt.requestID
+			if wantID == "" {
+				wantID = rec.Header().Get(requestIDHeader)
+				if wantID == "" {
+					t.Fatal("no request ID was generated")
+				}
+			}
+			if env.RequestID != wantID {
+				t.Errorf("requestId = %q, want %q", env.RequestID, wantID)
+			}
+		})
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{status: http.StatusBadRequest, want: "bad_request"},
+		{status: http.StatusNotFound, want: "not_found"},
+		{status: http.StatusRequestEntityTooLarge, want: "request_entity_too_large"},
+		{status: http.StatusNonAuthoritativeInfo, want: "non_authoritative_information"},
+		{status: http.StatusTeapot, want: "im_a_teapot"},
+		{status: 599, want: "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := errorCode(tt.status); got != tt.want {
+				t.Errorf("errorCode(%d) = %q, want %q", tt.status, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// keyNamer builds the object name (without the aspect ratio prefix) for an
+// upload. content is positioned at the start and is rewound afterwards.
+type keyNamer func(video database.Video, content io.ReadSeeker, ext string) (string, error)
+
+// keyNaming is a naming strategy. Deterministic strategies give the same
+// content the same key, so an existing object under that key is reused
+// rather than treated as a collision.
+type keyNaming struct {
+	namer         keyNamer
+	deterministic bool
+}
+
+var keyNamings = map[string]keyNaming{
+	"random":    {namer: randomKey},
+	"timestamp": {namer: timestampKey},
+	"hash":      {namer: contentHashKey, deterministic: true},
+}
+
+const maxKeyAttempts = 3
+
+// chooseObjectKey names an upload and checks whether something already lives
+// under that key. Deterministic keys that exist are returned with exists set,
+// random keys are simply drawn again.
+func (cfg *apiConfig) chooseObjectKey(ctx context.Context, video database.Video, content io.ReadSeeker, ext, aspectRatio string) (key string, exists bool, err error) {
+	tenant, err := cfg.userTenant(video.UserID)
+	if err != nil {
+		return "", false, err
+	}
+	for attempt := 1; attempt <= maxKeyAttempts; attempt++ {
+		name, err := cfg.keyNaming.namer(video, content, ext)
+		if err != nil {
+			return "", false, err
+		}
+		key, err := sanitizeKey(fmt.Sprintf("%s%s/%s", tenantKeyPrefix(tenant), aspectPrefix(aspectRatio), name))
+		if err != nil {
+			return "", false, err
+		}
+		if cfg.lowercaseKeys {
+			key = lowercaseKey(key)
+		}
+		key = cfg.shardKey(key)
+
+		exists, err := cfg.objectExists(ctx, key)
+		if err != nil {
+			return "", false, err
+		}
+		if !exists || cfg.keyNaming.deterministic {
+			return key, exists, nil
+		}
+		slog.Info("Object key is already taken, picking another", "key", key, "attempt", attempt)
+	}
+	return "", false, errors.New("couldn't find a free object key")
+}
+
+// shardKey places a new key in one of the storage's buckets, if it has
+// several.
+func (cfg *apiConfig) shardKey(key string) string {
+	if sharder, ok := cfg.storage.(storage.Sharder); ok {
+		return sharder.ShardKey(key)
+	}
+	return key
+}
+
+func (cfg *apiConfig) objectExists(ctx context.Context, key string) (bool, error) {
+	ctx, cancel := cfg.storageContext(ctx)
+	defer cancel()
+	_, err := cfg.storage.Head(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// lowercaseKey lowercases every folder of key and its extension. The base
+// name is left as it is, random names are base64 and their case matters.
+func lowercaseKey(key string) string {
+	dir, file := path.Split(key)
+	ext := path.Ext(file)
+	return strings.ToLower(dir) + strings.TrimSuffix(file, ext) + strings.ToLower(ext)
+}
+
+func aspectPrefix(aspectRatio string) string {
+	switch aspectRatio {
+	case "16:9":
+		return "landscape"
+	case "9:16":
+		return "portrait"
+	default:
+		return aspectFallbackPrefix(aspectRatio)
+	}
+}
+
+func randomName() (string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+func randomKey(video database.Video, content io.ReadSeeker, ext string) (string, error) {
+	name, err := randomName()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s.%s", name, ext), nil
+}
+
+// timestampKey groups objects by upload day, e.g. 2024/01/15/<rand>.mp4,
+// which keeps listings sortable and lifecycle rules simple.
+func timestampKey(video database.Video, content io.ReadSeeker, ext string) (string, error) {
+	name, err := randomName()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s.%s", time.Now().UTC().Format("2006/01/02"), name, ext), nil
+}
+
+// contentHashKey names objects after the SHA-256 of their content, so the
+// same upload always lands on the same key. The digest the upload already
+// recorded in video.ContentHash is reused rather than reading it again.
+func contentHashKey(video database.Video, content io.ReadSeeker, ext string) (string, error) {
+	hash := video.ContentHash
+	if hash == "" {
+		var err error
+		hash, err = contentHash(content)
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%s.%s", hash, ext), nil
+}
+
+// contentHash returns the hex SHA-256 of content and rewinds it.
+func contentHash(content io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
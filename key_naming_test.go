@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// helloSHA256 is the SHA-256 of "hello".
+const helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func TestKeyNamings(t *testing.T) {
+	tests := []struct {
+		naming string
+		video  database.Video
+		want   string
+	}{
+		{naming: "random", want: `^[A-Za-z0-9_-]{43}\.mp4$`},
+		{naming: "timestamp", want: `^` + time.Now().UTC().Format("2006/01/02") + `/[A-Za-z0-9_-]{43}\.mp4$`},
+		{naming: "hash", want: `^` + helloSHA256 + `\.mp4$`},
+		{naming: "hash", video: database.Video{ContentHash: "recorded"}, want: `^recorded\.mp4$`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.naming, func(t *testing.T) {
+			content := strings.NewReader("hello")
+			got, err := keyNamings[tt.naming].namer(tt.video, content, "mp4")
+			if err != nil {
+				t.Fatalf("namer: %v", err)
+			}
+			if !regexp.MustCompile(tt.want).MatchString(got) {
+				t.Errorf("name = %q, want a match for %s", got, tt.want)
+			}
+			if content.Len() != 5 {
+				t.Errorf("content wasn't rewound, %d bytes left", content.Len())
+			}
+		})
+	}
+}
+
+func TestChooseObjectKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		naming     string
+		aspect     string
+		existing   string
+		wantKey    string
+		wantExists bool
+	}{
+		{name: "hash names after the content", naming: "hash", aspect: "16:9", wantKey: "landscape/" + helloSHA256 + ".mp4"},
+		{name: "existing hash key is reused", naming: "hash", aspect: "9:16", existing: "portrait/" + helloSHA256 + ".mp4", wantKey: "portrait/" + helloSHA256 + ".mp4", wantExists: true},
+		{name: "other aspect ratios", naming: "hash", aspect: "other", wantKey: "other/" + helloSHA256 + ".mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.keyNaming = keyNamings[tt.naming]
+			video, _ := newTestVideo(t, cfg)
+			if tt.existing != "" {
+				mem.Put(context.Background(), tt.existing, strings.NewReader("hello"), "video/mp4")
+			}
+
+			key, exists, err := cfg.chooseObjectKey(context.Background(), video, strings.NewReader("hello"), "mp4", tt.aspect)
+			if err != nil {
+				t.Fatalf("chooseObjectKey: %v", err)
+			}
+			if key != tt.wantKey || exists != tt.wantExists {
+				t.Errorf("chooseObjectKey = %q, %v, want %q, %v", key, exists, tt.wantKey, tt.wantExists)
+			}
+		})
+	}
+}
+
+func TestChooseObjectKeyCollisions(t *testing.T) {
+	tests := []struct {
+		name          string
+		deterministic bool
+		taken         []string
+		wantKey       string
+		wantExists    bool
+		wantErr       bool
+	}{
+		{name: "free key", wantKey: "landscape/a.mp4"},
+		{name: "taken random key is drawn again", taken: []string{"landscape/a.mp4"}, wantKey: "landscape/b.mp4"},
+		{name: "every attempt taken", taken: []string{"landscape/a.mp4", "landscape/b.mp4", "landscape/c.mp4"}, wantErr: true},
+		{name: "taken deterministic key is reused", deterministic: true, taken: []string{"landscape/a.mp4"}, wantKey: "landscape/a.mp4", wantExists: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			names := []string{"a", "b", "c", "d"}
+			cfg.keyNaming = keyNaming{
+				namer: func(video database.Video, content io.ReadSeeker, ext string) (string, error) {
+					name := names[0]
+					names = names[1:]
+					return name + "." + ext, nil
+				},
+				deterministic: tt.deterministic,
+			}
+			for _, key := range tt.taken {
+				mem.Put(context.Background(), key, strings.NewReader("taken"), "video/mp4")
+			}
+			video, _ := newTestVideo(t, cfg)
+
+			key, exists, err := cfg.chooseObjectKey(context.Background(), video, strings.NewReader("hello"), "mp4", "16:9")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("chooseObjectKey err = %v, want error %v", err, tt.wantErr)
+			}
+			if key != tt.wantKey || exists != tt.wantExists {
+				t.Errorf("chooseObjectKey = %q, %v, want %q, %v", key, exists, tt.wantKey, tt.wantExists)
+			}
+		})
+	}
+}
+
+func TestLowercaseKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "landscape/AbC_-9.mp4", want: "landscape/AbC_-9.mp4"},
+		{key: "Landscape/AbC_-9.MP4", want: "landscape/AbC_-9.mp4"},
+		{key: "Tenants/Acme/Portrait/2024/01/02/XyZ.Mov", want: "tenants/acme/portrait/2024/01/02/XyZ.mov"},
+		{key: "Other/NoExtension", want: "other/NoExtension"},
+		{key: "Bare.WEBM", want: "Bare.webm"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := lowercaseKey(tt.key); got != tt.want {
+				t.Errorf("lowercaseKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChooseObjectKeyLowercase(t *testing.T) {
+	tests := []struct {
+		name      string
+		lowercase bool
+		wantKey   string
+	}{
+		{name: "normalized", lowercase: true, wantKey: "landscape/MixedCase.mp4"},
+		{name: "left alone", lowercase: false, wantKey: "landscape/MixedCase.MP4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.keyNaming = keyNamings["hash"]
+			cfg.lowercaseKeys = tt.lowercase
+			video, _ := newTestVideo(t, cfg)
+			video.ContentHash = "MixedCase"
+
+			key, _, err := cfg.chooseObjectKey(context.Background(), video, strings.NewReader("hello"), "MP4", "16:9")
+			if err != nil {
+				t.Fatalf("chooseObjectKey: %v", err)
+			}
+			if key != tt.wantKey {
+				t.Errorf("chooseObjectKey = %q, want %q", key, tt.wantKey)
+			}
+		})
+	}
+}
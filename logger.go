@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+)
+
+// newLogger builds the logger behind slog's package level functions. Format
+// is "text" for reading in a terminal or "json" for log collectors, level
+// one of debug, info, warn and error.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// logCommand logs an external command line before it's run, at debug level.
+func logCommand(cmd *exec.Cmd) {
+	slog.Debug("Running command", "cmd", cmd.String())
+}
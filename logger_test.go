@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     string
+		format    string
+		wantLines int
+		wantErr   bool
+	}{
+		{name: "json at info drops debug", level: "info", format: "json", wantLines: 2},
+		{name: "json at debug", level: "debug", format: "JSON", wantLines: 3},
+		{name: "text at warn", level: "WARN", format: "text", wantLines: 1},
+		{name: "text at error", level: "error", format: "text", wantLines: 0},
+		{name: "unknown level", level: "verbose", format: "json", wantErr: true},
+		{name: "unknown format", level: "info", format: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			logger, err := newLogger(buf, tt.level, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newLogger err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			logger.Debug("Debug line", "step", "probe")
+			logger.Info("Info line", "video_id", "abc")
+			logger.Warn("Warn line", "status", 500)
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if buf.Len() == 0 {
+				lines = nil
+			}
+			if len(lines) != tt.wantLines {
+				t.Fatalf("logged %d lines, want %d:\n%s", len(lines), tt.wantLines, buf)
+			}
+			for _, line := range lines {
+				if strings.EqualFold(tt.format, "json") {
+					var entry map[string]any
+					if err := json.Unmarshal([]byte(line), &entry); err != nil {
+						t.Fatalf("line %q isn't JSON: %v", line, err)
+					}
+					for _, key := range []string{"time", "level", "msg"} {
+						if _, ok := entry[key]; !ok {
+							t.Errorf("line %q has no %s", line, key)
+						}
+					}
+				} else if !strings.Contains(line, "level=") || !strings.Contains(line, "msg=") {
+					t.Errorf("line %q isn't key=value text", line)
+				}
+			}
+		})
+	}
+}
+
+func TestNewLoggerJSONFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := newLogger(buf, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("Uploaded video", "video_id", "abc", "bytes", 42)
+
+	var entry struct {
+		Level   string `json:"level"`
+		Msg     string `json:"msg"`
+		VideoID string `json:"video_id"`
+		Bytes   int    `json:"bytes"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("%s isn't JSON: %v", buf, err)
+	}
+	if entry.Level != "INFO" || entry.Msg != "Uploaded video" || entry.VideoID != "abc" || entry.Bytes != 42 {
+		t.Errorf("entry = %+v, want INFO Uploaded video with video_id abc and 42 bytes", entry)
+	}
+}
+
+func TestLogCommand(t *testing.T) {
+	tests := []struct {
+		level      string
+		wantLogged bool
+	}{
+		{level: "debug", wantLogged: true},
+		{level: "info", wantLogged: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			logger, err := newLogger(buf, tt.level, "text")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer slog.SetDefault(slog.Default())
+			slog.SetDefault(logger)
+
+			logCommand(exec.Command("ffmpeg", "-i", "in.mp4", "out.mp4"))
+			logged := strings.Contains(buf.String(), "ffmpeg -i in.mp4 out.mp4")
+			if logged != tt.wantLogged {
+				t.Errorf("command logged = %v, want %v: %s", logged, tt.wantLogged, buf)
+			}
+		})
+	}
+}
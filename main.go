@@ -2,14 +2,27 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/cloudfront/sign"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -18,27 +31,137 @@ import (
 type apiConfig struct {
 	db               database.Client
 	jwtSecret        string
+	jwtLeeway        time.Duration
+	jwtAlgorithms    []string
 	platform         string
 	filepathRoot     string
 	assetsRoot       string
+	assetBaseURL     string
 	s3Client         *s3.Client
 	s3Bucket         string
 	s3Region         string
 	s3CfDistribution string
-	port             string
-}
+	storage          storage.Storage
+	storageTimeout   time.Duration
+	presignCache     *presignCache
+	tusLocks         *tusLocks
+	tusDir           string
+	tusUploadTTL     time.Duration
+	uploadLimiter    *uploadLimiter
+	workers          *workerPool
+	adminUserIDs     map[uuid.UUID]bool
+	statusWatchers   *statusBroadcaster
+	// uploads still processing in the background after their 202
+	uploadJobs *sync.WaitGroup
+	views      *viewCounter
+	port       string
 
-func loadEnv(name string) string {
-	env := os.Getenv(name)
-	if env == "" {
-		log.Fatalf("%s environment variable is not set", name)
-	}
-	return env
+	maxUploadSize       int64
+	multipartMemory     int64
+	maxJSONUploadSize   int64
+	videoFieldNames     []string
+	thumbnailFieldNames []string
+	ffmpegPath          string
+	ffprobePath         string
+	maxVideoDimension   int
+	requireAudio        bool
+	uploadTypeCheck     uploadTypeCheck
+	mediaTypeOverrides  []string
+	defaultThumbnailURL string
+	thumbnailSizes      []thumbnailSize
+	thumbnailCrop       cropAspect
+
+	transcodeSegmentSeconds int
+	transcodeWorkDir        string
+
+	previewGIF        bool
+	previewGIFSeconds int
+	previewGIFFPS     int
+	previewGIFWidth   int
+
+	thumbnailAspectStrict    bool
+	thumbnailAspectTolerance float64
+	thumbnailCapToVideo      bool
+	thumbnailCacheMaxAge     time.Duration
+
+	faststartValidate bool
+	faststartRetries  int
+	faststartStrict   bool
+
+	durationTolerance   time.Duration
+	durationCheckStrict bool
+
+	keyNaming      keyNaming
+	lowercaseKeys  bool
+	conditionalPut bool
+	dedupCopy      bool
+	outputProfile  outputProfile
+
+	encodingProfiles         map[string]encodingProfile
+	encodingProfile          encodingProfile
+	categoryEncodingProfiles map[string]encodingProfile
+
+	statusWaitTimeout time.Duration
+
+	videoQuota      int
+	adminVideoQuota int
+	storageQuota    int64
+
+	presignTTL  time.Duration
+	shareTTL    time.Duration
+	audioFormat audioFormat
+
+	uploadPolicyTTL        time.Duration
+	uploadPolicyTypePrefix string
+
+	cookieSigner   *sign.CookieSigner
+	cfCookieDomain string
+
+	preserveOriginals     bool
+	originalsStorageClass string
+
+	objectTagTemplates []objectTagTemplate
+
+	verifyConcurrency int
+
+	minFreeDisk int64
+
+	videoCategories []string
+
+	perceptualHashing bool
+	similarDistance   int
+
+	processingStatusCode int
+
+	assetSigningSecret []byte
+
+	bitrateThresholds []bitrateThreshold
+
+	aspectFallback aspectFallback
+
+	presignRetries int
+
+	coverArt bool
+
+	variantParallelism int
+	variantsStrict     bool
+
+	inlineThumbnailMaxBytes int
+
+	processingModel processingModel
+
+	costRates costRates
 }
 
 func main() {
 	godotenv.Load(".env")
 
+	logger, err := newLogger(os.Stderr, loadEnvDefault("LOG_LEVEL", "info"), loadEnvDefault("LOG_FORMAT", "text"))
+	if err != nil {
+		log.Fatalf("Invalid logging config: %v", err)
+	}
+	slog.SetDefault(logger)
+
 	pathToDB := loadEnv("DB_PATH")
 	db, err := database.NewClient(pathToDB)
 	if err != nil {
@@ -46,6 +169,11 @@ func main() {
 	}
 
 	jwtSecret := loadEnv("JWT_SECRET")
+	jwtLeeway := loadEnvDuration("JWT_LEEWAY", 5*time.Second)
+	jwtAlgorithms, err := auth.ParseAlgorithms(loadEnvList("JWT_ALGORITHMS", auth.DefaultAlgorithms))
+	if err != nil {
+		log.Fatalf("Invalid JWT_ALGORITHMS: %v", err)
+	}
 	platform := loadEnv("PLATFORM")
 	filepathRoot := loadEnv("FILEPATH_ROOT")
 	assetsRoot := loadEnv("ASSETS_ROOT")
@@ -53,6 +181,167 @@ func main() {
 	s3Region := loadEnv("S3_REGION")
 	s3CfDistribution := loadEnv("S3_CF_DISTRO")
 	port := loadEnv("PORT")
+	// where the assets directory is reachable from outside, behind a proxy
+	// this is the public domain rather than localhost
+	assetBaseURL := strings.TrimSuffix(loadEnvDefault("ASSET_BASE_URL", fmt.Sprintf("http://localhost:%s/assets", port)), "/")
+	readHeaderTimeout := loadEnvDuration("HTTP_READ_HEADER_TIMEOUT", 10*time.Second)
+	readTimeout := loadEnvDuration("HTTP_READ_TIMEOUT", time.Minute)
+	writeTimeout := loadEnvDuration("HTTP_WRITE_TIMEOUT", time.Minute)
+	idleTimeout := loadEnvDuration("HTTP_IDLE_TIMEOUT", 2*time.Minute)
+	shutdownTimeout := loadEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	storageBackend := loadEnvDefault("STORAGE_BACKEND", "s3")
+	storageTimeout := loadEnvDuration("STORAGE_TIMEOUT", 5*time.Minute)
+	maxConcurrentUploads := loadEnvInt("MAX_CONCURRENT_UPLOADS", 2)
+	workerCount := loadEnvInt("WORKER_COUNT", 2)
+	workerQueueSize := loadEnvInt("WORKER_QUEUE_SIZE", 64)
+	adminUserIDs, err := parseAdminUserIDs(loadEnvDefault("ADMIN_USER_IDS", ""))
+	if err != nil {
+		log.Fatalf("Invalid ADMIN_USER_IDS: %v", err)
+	}
+	maxUploadSize := loadEnvInt("MAX_UPLOAD_SIZE", 1<<30)
+	multipartMemory := loadEnvInt("MULTIPART_MEMORY", 32<<20)
+	maxJSONUploadSize := loadEnvInt("MAX_JSON_UPLOAD_SIZE", 10<<20)
+	videoFieldNames := loadEnvList("VIDEO_FIELD_NAMES", []string{"video"})
+	thumbnailFieldNames := loadEnvList("THUMBNAIL_FIELD_NAMES", []string{"thumbnail"})
+	tusDir := loadEnvDefault("TUS_UPLOAD_DIR", filepath.Join(os.TempDir(), "tubely-tus"))
+	if err := os.MkdirAll(tusDir, 0755); err != nil {
+		log.Fatalf("Couldn't create tus upload directory: %v", err)
+	}
+	tusUploadTTL := loadEnvDuration("TUS_UPLOAD_TTL", 24*time.Hour)
+	ffmpegPath, err := exec.LookPath(loadEnvDefault("FFMPEG_PATH", "ffmpeg"))
+	if err != nil {
+		log.Fatalf("ffmpeg isn't executable: %v", err)
+	}
+	ffprobePath, err := exec.LookPath(loadEnvDefault("FFPROBE_PATH", "ffprobe"))
+	if err != nil {
+		log.Fatalf("ffprobe isn't executable: %v", err)
+	}
+	transcodeSegmentSeconds := loadEnvInt("TRANSCODE_SEGMENT_SECONDS", 0)
+	variantParallelism := loadEnvInt("VARIANT_PARALLELISM", 2)
+	variantsStrict := loadEnvBool("VARIANTS_STRICT", false)
+	costStoragePerGB := loadEnvFloat("COST_STORAGE_PER_GB", 0.023)
+	costEgressPerGB := loadEnvFloat("COST_EGRESS_PER_GB", 0.09)
+	if costStoragePerGB < 0 || costEgressPerGB < 0 {
+		log.Fatalf("COST_STORAGE_PER_GB and COST_EGRESS_PER_GB can't be negative")
+	}
+	remuxSpeed := loadEnvFloat("ESTIMATE_REMUX_SPEED", 50)
+	if remuxSpeed <= 0 {
+		log.Fatalf("ESTIMATE_REMUX_SPEED must be positive")
+	}
+	encodeSpeeds, err := parseEncodeSpeeds(loadEnvDefault("ESTIMATE_ENCODE_SPEEDS", "1080p=1,720p=2,480p=4"))
+	if err != nil {
+		log.Fatalf("Invalid ESTIMATE_ENCODE_SPEEDS: %v", err)
+	}
+	transcodeWorkDir := loadEnvDefault("TRANSCODE_WORK_DIR", filepath.Join(os.TempDir(), "tubely-transcode"))
+	previewGIF := loadEnvBool("PREVIEW_GIF", false)
+	coverArt := loadEnvBool("EMBED_COVER_ART", false)
+	previewGIFSeconds := loadEnvInt("PREVIEW_GIF_SECONDS", 3)
+	previewGIFFPS := loadEnvInt("PREVIEW_GIF_FPS", 10)
+	previewGIFWidth := loadEnvInt("PREVIEW_GIF_WIDTH", 320)
+	maxVideoDimension := loadEnvInt("MAX_VIDEO_DIMENSION", 7680)
+	requireAudio := loadEnvBool("REQUIRE_AUDIO", false)
+	aspectFallback, err := parseAspectFallback(loadEnvDefault("ASPECT_RATIO_FALLBACK", "other"))
+	if err != nil {
+		log.Fatalf("Invalid ASPECT_RATIO_FALLBACK: %v", err)
+	}
+	uploadTypeCheck, err := parseUploadTypeCheck(loadEnvDefault("UPLOAD_TYPE_CHECK", "lenient"))
+	if err != nil {
+		log.Fatalf("Invalid UPLOAD_TYPE_CHECK: %v", err)
+	}
+	mediaTypeOverrides := loadEnvList("MEDIA_TYPE_OVERRIDES", []string{"application/octet-stream", "video/quicktime"})
+	defaultThumbnailURL := loadEnvDefault("DEFAULT_THUMBNAIL_URL", "")
+	inlineThumbnailMaxBytes := loadEnvInt("INLINE_THUMBNAIL_MAX_BYTES", 8<<10)
+	thumbnailSizes, err := parseThumbnailSizes(loadEnvDefault("THUMBNAIL_SIZES", "small=320x180,medium=640x360,large=1280x720"))
+	if err != nil {
+		log.Fatalf("Invalid THUMBNAIL_SIZES: %v", err)
+	}
+	thumbnailCrop, err := parseCropAspect(loadEnvDefault("THUMBNAIL_CROP_ASPECT", ""))
+	if err != nil {
+		log.Fatalf("Invalid THUMBNAIL_CROP_ASPECT: %v", err)
+	}
+	thumbnailAspectStrict := loadEnvBool("THUMBNAIL_ASPECT_STRICT", false)
+	thumbnailAspectTolerance := loadEnvFloat("THUMBNAIL_ASPECT_TOLERANCE", 0.1)
+	thumbnailCapToVideo := loadEnvBool("THUMBNAIL_CAP_TO_VIDEO", false)
+	thumbnailCacheMaxAge := loadEnvDuration("THUMBNAIL_CACHE_MAX_AGE", time.Hour)
+	faststartValidate := loadEnvBool("FASTSTART_VALIDATE", true)
+	faststartRetries := loadEnvInt("FASTSTART_RETRIES", 1)
+	faststartStrict := loadEnvBool("FASTSTART_STRICT", false)
+	durationTolerance := loadEnvDuration("DURATION_TOLERANCE", 500*time.Millisecond)
+	durationCheckStrict := loadEnvBool("DURATION_CHECK_STRICT", false)
+	keyNaming := loadEnvDefault("KEY_NAMING", "random")
+	naming, ok := keyNamings[keyNaming]
+	if !ok {
+		log.Fatalf("Unknown KEY_NAMING %q", keyNaming)
+	}
+	lowercaseKeys := loadEnvBool("KEY_LOWERCASE", false)
+	conditionalPut := loadEnvBool("CONDITIONAL_PUT", false)
+	dedupCopy := loadEnvBool("DEDUP_COPY", false)
+	profileName := loadEnvDefault("OUTPUT_PROFILE", "faststart")
+	profile, ok := outputProfiles[profileName]
+	if !ok {
+		log.Fatalf("Unknown OUTPUT_PROFILE %q", profileName)
+	}
+	encodingName := loadEnvDefault("ENCODING_PROFILE", "baseline")
+	encodingProfiles := defaultEncodingProfiles()
+	encoding, ok := encodingProfiles[encodingName]
+	if !ok {
+		log.Fatalf("Unknown ENCODING_PROFILE %q", encodingName)
+	}
+	categoryEncodingProfiles, err := parseCategoryEncodingProfiles(loadEnvDefault("ENCODING_PROFILE_CATEGORIES", ""), encodingProfiles)
+	if err != nil {
+		log.Fatalf("Invalid ENCODING_PROFILE_CATEGORIES: %v", err)
+	}
+	viewFlushInterval := loadEnvDuration("VIEW_FLUSH_INTERVAL", 10*time.Second)
+	viewBufferSize := loadEnvInt("VIEW_BUFFER_SIZE", 1024)
+	reaperInterval := loadEnvDuration("REAPER_INTERVAL", 10*time.Minute)
+	tempSweepAge := loadEnvDuration("TEMP_SWEEP_AGE", 24*time.Hour)
+	statusWaitTimeout := loadEnvDuration("STATUS_WAIT_TIMEOUT", 30*time.Second)
+	videoQuota := loadEnvInt("VIDEO_QUOTA", 0)
+	adminVideoQuota := loadEnvInt("ADMIN_VIDEO_QUOTA", 0)
+	storageQuota := loadEnvInt("STORAGE_QUOTA_BYTES", 0)
+	presignTTL := loadEnvDuration("PRESIGN_TTL", time.Hour)
+	presignRetries := loadEnvInt("PRESIGN_RETRIES", 2)
+	shareTTL := loadEnvDuration("SHARE_TTL", 7*24*time.Hour)
+	verifyConcurrency := loadEnvInt("VERIFY_CONCURRENCY", 8)
+	minFreeDisk := loadEnvInt("MIN_FREE_DISK_BYTES", 256<<20)
+	videoCategories := loadEnvList("VIDEO_CATEGORIES", []string{})
+	perceptualHashing := loadEnvBool("PERCEPTUAL_HASH", false)
+	similarDistance := loadEnvInt("SIMILAR_MAX_DISTANCE", 10)
+	assetSigningSecret := []byte(loadEnvDefault("ASSET_SIGNING_SECRET", ""))
+	maxS3Writes := loadEnvInt("S3_MAX_CONCURRENT_WRITES", 16)
+	bitrateThresholds, err := parseBitrateThresholds(loadEnvDefault("LOW_BITRATE_KBPS", "2160=12000,1080=4000,720=2000,480=800"))
+	if err != nil {
+		log.Fatalf("Invalid LOW_BITRATE_KBPS: %v", err)
+	}
+	processingStatusCode := loadEnvInt("PROCESSING_STATUS_CODE", http.StatusOK)
+	if processingStatusCode != http.StatusOK && processingStatusCode != http.StatusAccepted {
+		log.Fatalf("PROCESSING_STATUS_CODE must be 200 or 202")
+	}
+	uploadPolicyTTL := loadEnvDuration("UPLOAD_POLICY_TTL", 15*time.Minute)
+	uploadPolicyTypePrefix := loadEnvDefault("UPLOAD_POLICY_CONTENT_TYPE_PREFIX", "video/")
+	audioFormatName := loadEnvDefault("AUDIO_FORMAT", "aac")
+	audioFmt, ok := audioFormats[audioFormatName]
+	if !ok {
+		log.Fatalf("Unknown AUDIO_FORMAT %q", audioFormatName)
+	}
+
+	var cookieSigner *sign.CookieSigner
+	cfKeyPairID := loadEnvDefault("CF_KEY_PAIR_ID", "")
+	cfPrivateKeyPath := loadEnvDefault("CF_PRIVATE_KEY_PATH", "")
+	if cfKeyPairID != "" && cfPrivateKeyPath != "" {
+		privKey, err := sign.LoadPEMPrivKeyFile(cfPrivateKeyPath)
+		if err != nil {
+			log.Fatalf("Couldn't load CloudFront private key: %v", err)
+		}
+		cookieSigner = sign.NewCookieSigner(cfKeyPairID, privKey)
+	}
+	cfCookieDomain := loadEnvDefault("CF_COOKIE_DOMAIN", "")
+	preserveOriginals := loadEnvBool("PRESERVE_ORIGINALS", false)
+	originalsStorageClass := loadEnvDefault("ORIGINALS_STORAGE_CLASS", "GLACIER")
+	objectTagTemplates, err := parseObjectTags(loadEnvDefault("S3_OBJECT_TAGS", ""))
+	if err != nil {
+		log.Fatalf("Invalid S3_OBJECT_TAGS: %v", err)
+	}
 
 	awsConfig, err := config.LoadDefaultConfig(context.TODO(),
 		config.WithRegion(s3Region),
@@ -63,17 +352,148 @@ func main() {
 
 	s3Client := s3.NewFromConfig(awsConfig)
 
+	var store storage.Storage
+	switch storageBackend {
+	case "s3":
+		s3Store := storage.NewShardedS3Storage(s3Client, loadEnvList("S3_BUCKETS", []string{s3Bucket}))
+		s3Store.LimitWrites(maxS3Writes)
+		store = s3Store
+	case "local":
+		store = storage.NewLocalStorage(assetsRoot, assetBaseURL, assetSigningSecret)
+	case "memory":
+		store = storage.NewMemoryStorage()
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q", storageBackend)
+	}
+
 	cfg := apiConfig{
 		db:               db,
 		jwtSecret:        jwtSecret,
+		jwtLeeway:        jwtLeeway,
+		jwtAlgorithms:    jwtAlgorithms,
 		platform:         platform,
 		filepathRoot:     filepathRoot,
 		assetsRoot:       assetsRoot,
+		assetBaseURL:     assetBaseURL,
 		s3Client:         s3Client,
 		s3Bucket:         s3Bucket,
 		s3Region:         s3Region,
 		s3CfDistribution: s3CfDistribution,
+		storage:          store,
+		storageTimeout:   storageTimeout,
+		presignCache:     newPresignCache(),
+		tusLocks:         newTusLocks(),
+		tusDir:           tusDir,
+		tusUploadTTL:     tusUploadTTL,
+		uploadLimiter:    newUploadLimiter(maxConcurrentUploads),
+		workers:          newWorkerPool(workerCount, workerQueueSize),
+		adminUserIDs:     adminUserIDs,
+		statusWatchers:   newStatusBroadcaster(),
+		uploadJobs:       &sync.WaitGroup{},
+		views:            newViewCounter(viewBufferSize),
 		port:             port,
+
+		maxUploadSize:       int64(maxUploadSize),
+		multipartMemory:     int64(multipartMemory),
+		maxJSONUploadSize:   int64(maxJSONUploadSize),
+		videoFieldNames:     videoFieldNames,
+		thumbnailFieldNames: thumbnailFieldNames,
+		ffmpegPath:          ffmpegPath,
+		ffprobePath:         ffprobePath,
+		maxVideoDimension:   maxVideoDimension,
+		requireAudio:        requireAudio,
+		uploadTypeCheck:     uploadTypeCheck,
+		mediaTypeOverrides:  mediaTypeOverrides,
+		defaultThumbnailURL: defaultThumbnailURL,
+		thumbnailSizes:      thumbnailSizes,
+		thumbnailCrop:       thumbnailCrop,
+
+		transcodeSegmentSeconds: transcodeSegmentSeconds,
+		transcodeWorkDir:        transcodeWorkDir,
+
+		previewGIF:        previewGIF,
+		previewGIFSeconds: previewGIFSeconds,
+		previewGIFFPS:     previewGIFFPS,
+		previewGIFWidth:   previewGIFWidth,
+
+		thumbnailAspectStrict:    thumbnailAspectStrict,
+		thumbnailAspectTolerance: thumbnailAspectTolerance,
+		thumbnailCapToVideo:      thumbnailCapToVideo,
+		thumbnailCacheMaxAge:     thumbnailCacheMaxAge,
+
+		faststartValidate: faststartValidate,
+		faststartRetries:  faststartRetries,
+		faststartStrict:   faststartStrict,
+
+		durationTolerance:   durationTolerance,
+		durationCheckStrict: durationCheckStrict,
+
+		keyNaming:      naming,
+		lowercaseKeys:  lowercaseKeys,
+		conditionalPut: conditionalPut,
+		dedupCopy:      dedupCopy,
+		outputProfile:  profile,
+
+		encodingProfiles:         encodingProfiles,
+		encodingProfile:          encoding,
+		categoryEncodingProfiles: categoryEncodingProfiles,
+
+		statusWaitTimeout: statusWaitTimeout,
+
+		videoQuota:      videoQuota,
+		adminVideoQuota: adminVideoQuota,
+		storageQuota:    int64(storageQuota),
+
+		presignTTL:  presignTTL,
+		shareTTL:    shareTTL,
+		audioFormat: audioFmt,
+
+		uploadPolicyTTL:        uploadPolicyTTL,
+		uploadPolicyTypePrefix: uploadPolicyTypePrefix,
+
+		cookieSigner:   cookieSigner,
+		cfCookieDomain: cfCookieDomain,
+
+		preserveOriginals:     preserveOriginals,
+		originalsStorageClass: originalsStorageClass,
+
+		objectTagTemplates: objectTagTemplates,
+
+		verifyConcurrency: verifyConcurrency,
+
+		minFreeDisk: int64(minFreeDisk),
+
+		videoCategories: videoCategories,
+
+		perceptualHashing: perceptualHashing,
+		similarDistance:   similarDistance,
+
+		processingStatusCode: processingStatusCode,
+
+		assetSigningSecret: assetSigningSecret,
+
+		bitrateThresholds: bitrateThresholds,
+
+		aspectFallback: aspectFallback,
+
+		presignRetries: presignRetries,
+
+		coverArt: coverArt,
+
+		variantParallelism: variantParallelism,
+		variantsStrict:     variantsStrict,
+
+		inlineThumbnailMaxBytes: inlineThumbnailMaxBytes,
+
+		processingModel: processingModel{
+			remuxSpeed:   remuxSpeed,
+			encodeSpeeds: encodeSpeeds,
+		},
+
+		costRates: costRates{
+			storagePerGB: costStoragePerGB,
+			egressPerGB:  costEgressPerGB,
+		},
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -81,33 +501,125 @@ func main() {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
 
+	if tempSweepAge > 0 {
+		removed, err := sweepTempFiles(os.TempDir(), tempSweepAge, time.Now())
+		if err != nil {
+			slog.Warn("Couldn't sweep stale temp files", "dir", os.TempDir(), "err", err)
+		} else if removed > 0 {
+			slog.Info("Removed stale temp files", "dir", os.TempDir(), "count", removed)
+		}
+	}
+
+	// nothing is processing yet, whatever says otherwise was cut short
+	if reset, err := cfg.db.ResetProcessingVideos(); err != nil {
+		slog.Warn("Couldn't reset interrupted uploads", "err", err)
+	} else if reset > 0 {
+		slog.Info("Reset interrupted uploads", "count", reset)
+	}
+
+	// stopped once the server is, so views of the last requests are saved
+	viewsCtx, stopViews := context.WithCancel(context.Background())
+	viewsDone := make(chan struct{})
+	go func() {
+		defer close(viewsDone)
+		cfg.views.run(viewsCtx, cfg.db, viewFlushInterval)
+	}()
+
+	if reaperInterval > 0 {
+		go cfg.runVideoReaper(context.Background(), reaperInterval)
+	}
+
 	mux := http.NewServeMux()
 	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
 	mux.Handle("/app/", appHandler)
 
 	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
-	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
+	mux.Handle("/assets/", noCacheMiddleware(cfg.requireAssetSignature(assetsHandler)))
 
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
 
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.HandleFunc("DELETE /api/users/me/videos", cfg.handlerUserVideosDelete)
+	mux.Handle("GET /api/users/me/videos/verify", slowHandler(cfg.handlerUserVideosVerify))
 
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
+	mux.HandleFunc("POST /api/videos/estimate", cfg.handlerVideoEstimate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
-	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
+	mux.HandleFunc("PATCH /api/videos/{videoID}/thumbnail/primary", cfg.handlerThumbnailPrimary)
+	mux.HandleFunc("POST /api/videos/{videoID}/thumbnail/transform", cfg.handlerThumbnailTransform)
+	mux.Handle("POST /api/video_upload/{videoID}", slowHandler(cfg.handlerUploadVideo))
+	mux.Handle("POST /api/video_upload/{videoID}/json", slowHandler(cfg.handlerUploadVideoJSON))
+	mux.HandleFunc("POST /api/videos/{videoID}/direct-upload", cfg.handlerDirectUploadPolicy)
+	mux.Handle("POST /api/videos/{videoID}/direct-upload/commit", slowHandler(cfg.handlerDirectUploadCommit))
+	mux.HandleFunc("OPTIONS /api/tus", cfg.handlerTusOptions)
+	mux.HandleFunc("POST /api/videos/{videoID}/tus", cfg.handlerTusCreate)
+	mux.HandleFunc("HEAD /api/tus/{uploadID}", cfg.handlerTusHead)
+	mux.Handle("PATCH /api/tus/{uploadID}", slowHandler(cfg.handlerTusPatch))
 	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.Handle("GET /api/videos/{videoID}/status", slowHandler(cfg.handlerVideoStatus))
+	mux.HandleFunc("GET /api/videos/{videoID}/events", cfg.handlerUploadEvents)
+	mux.HandleFunc("GET /api/videos/{videoID}/analytics", cfg.handlerVideoAnalytics)
+	mux.HandleFunc("GET /api/videos/{videoID}/renditions", cfg.handlerVideoRenditions)
+	mux.HandleFunc("GET /api/videos/{videoID}/thumbnail", cfg.handlerVideoThumbnail)
+	mux.Handle("GET /api/videos/{videoID}/captions.zip", slowHandler(cfg.handlerVideoCaptionsZip))
+	mux.HandleFunc("GET /api/videos/{videoID}/similar", cfg.handlerVideoSimilar)
+	mux.Handle("GET /api/videos/{videoID}/probe", slowHandler(cfg.handlerVideoProbe))
+	mux.Handle("GET /api/videos/{videoID}/stream", slowHandler(cfg.handlerVideoStream))
+	mux.Handle("POST /api/videos/{videoID}/extract-audio", slowHandler(cfg.handlerExtractAudio))
+	mux.HandleFunc("POST /api/videos/{videoID}/chapters", cfg.handlerVideoChapters)
+	mux.HandleFunc("POST /api/videos/{videoID}/cookies", cfg.handlerVideoSignedCookies)
+	mux.HandleFunc("POST /api/videos/{videoID}/original/restore", cfg.handlerRestoreOriginal)
+	mux.HandleFunc("POST /api/videos/{videoID}/share", cfg.handlerShareCreate)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/share/{shareID}", cfg.handlerShareRevoke)
+	mux.HandleFunc("GET /api/shared/{shareToken}", cfg.handlerShareResolve)
+	mux.HandleFunc("PATCH /api/videos/{videoID}", cfg.handlerVideoMetaUpdate)
+	mux.HandleFunc("POST /api/videos/{videoID}/publish", cfg.handlerVideoPublish)
+	mux.HandleFunc("POST /api/videos/{videoID}/invalidate", cfg.handlerVideoInvalidate)
+	mux.Handle("GET /api/videos/{videoID}/cost", slowHandler(cfg.handlerVideoCost))
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
 
+	mux.HandleFunc("GET /api/admin/workers", cfg.handlerAdminWorkers)
+	mux.HandleFunc("PUT /api/admin/users/{userID}/tenant", cfg.handlerAdminUserTenant)
+
 	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
 
+	mux.HandleFunc("GET /v/{videoID}", cfg.handlerVideoRedirect)
+
 	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+		Addr:              ":" + port,
+		Handler:           requestIDMiddleware(mux),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		slog.Info(fmt.Sprintf("Serving on: http://localhost:%s/app/", port))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	<-ctx.Done()
+	// a second signal kills the server outright
+	stop()
+
+	slog.Info("Shutting down, waiting for uploads in progress")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Couldn't finish open requests", "err", err)
 	}
+	cfg.uploadJobs.Wait()
 
-	log.Printf("Serving on: http://localhost:%s/app/\n", port)
-	log.Fatal(srv.ListenAndServe())
+	stopViews()
+	<-viewsDone
+	if err := cfg.db.Close(); err != nil {
+		slog.Warn("Couldn't close database", "err", err)
+	}
 }
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// newTestConfig returns an apiConfig backed by a fresh database and memory
+// storage, with the same defaults main falls back to when nothing is set.
+// ffmpeg and ffprobe are left unset, tests that need them install fakes
+// with fakeCommand.
+func newTestConfig(t *testing.T) (*apiConfig, *storage.MemoryStorage) {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := database.NewClient(filepath.Join(dir, "tubely.db"))
+	if err != nil {
+		t.Fatalf("Couldn't create database: %v", err)
+	}
+	thumbnailSizes, err := parseThumbnailSizes("small=320x180,medium=640x360,large=1280x720")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bitrateThresholds, err := parseBitrateThresholds("2160=12000,1080=4000,720=2000,480=800")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodingProfiles := defaultEncodingProfiles()
+	store := storage.NewMemoryStorage()
+
+	cfg := &apiConfig{
+		db:               db,
+		jwtSecret:        "test-secret",
+		jwtLeeway:        5 * time.Second,
+		jwtAlgorithms:    auth.DefaultAlgorithms,
+		platform:         "dev",
+		assetsRoot:       filepath.Join(dir, "assets"),
+		assetBaseURL:     "http://localhost:8091/assets",
+		s3Bucket:         "tubely-test",
+		s3Region:         "us-east-1",
+		s3CfDistribution: "cdn.example.com",
+		storage:          store,
+		storageTimeout:   time.Minute,
+		presignCache:     newPresignCache(),
+		tusLocks:         newTusLocks(),
+		tusDir:           filepath.Join(dir, "tus"),
+		tusUploadTTL:     24 * time.Hour,
+		uploadLimiter:    newUploadLimiter(2),
+		workers:          newWorkerPool(2, 64),
+		adminUserIDs:     map[uuid.UUID]bool{},
+		statusWatchers:   newStatusBroadcaster(),
+		uploadJobs:       &sync.WaitGroup{},
+		views:            newViewCounter(1024),
+
+		maxUploadSize:       1 << 30,
+		multipartMemory:     32 << 20,
+		maxJSONUploadSize:   10 << 20,
+		videoFieldNames:     []string{"video"},
+		thumbnailFieldNames: []string{"thumbnail"},
+		maxVideoDimension:   7680,
+		uploadTypeCheck:     uploadTypeCheckLenient,
+		mediaTypeOverrides:  []string{"application/octet-stream", "video/quicktime"},
+		thumbnailSizes:      thumbnailSizes,
+
+		transcodeWorkDir: filepath.Join(dir, "transcode"),
+
+		thumbnailAspectTolerance: 0.1,
+		thumbnailCacheMaxAge:     time.Hour,
+
+		durationTolerance: 500 * time.Millisecond,
+
+		keyNaming:     keyNamings["random"],
+		outputProfile: outputProfiles["faststart"],
+
+		encodingProfiles: encodingProfiles,
+		encodingProfile:  encodingProfiles["baseline"],
+
+		statusWaitTimeout: 30 * time.Second,
+
+		presignTTL: time.Hour,
+		shareTTL:   7 * 24 * time.Hour,
+
+		verifyConcurrency: 8,
+
+		similarDistance: 10,
+
+		processingStatusCode: http.StatusOK,
+
+		bitrateThresholds: bitrateThresholds,
+
+		presignRetries: 2,
+
+		variantParallelism: 2,
+
+		inlineThumbnailMaxBytes: 8 << 10,
+
+		costRates: costRates{
+			storagePerGB: 0.023,
+			egressPerGB:  0.09,
+		},
+	}
+	for _, dir := range []string{cfg.assetsRoot, cfg.tusDir, cfg.transcodeWorkDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg, store
+}
+
+// newTestVideo creates a user and a video owned by them, and returns the
+// video along with a bearer token for its owner.
+func newTestVideo(t *testing.T, cfg *apiConfig) (database.Video, string) {
+	t.Helper()
+	user, err := cfg.db.CreateUser(database.CreateUserParams{
+		Email:    uuid.NewString() + "@example.com",
+		Password: "password",
+	})
+	if err != nil {
+		t.Fatalf("Couldn't create user: %v", err)
+	}
+	video, err := cfg.db.CreateVideo(database.CreateVideoParams{
+		Title:       "Test video",
+		Description: "A video for tests",
+		UserID:      user.ID,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't create video: %v", err)
+	}
+	token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("Couldn't create JWT: %v", err)
+	}
+	return video, token
+}
+
+// fakeCommand writes an executable shell script standing in for a tool
+// like ffmpeg and returns its path.
+func fakeCommand(t *testing.T, name, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newVideoRequest builds a request for a /api/videos/{videoID}/... route,
+// authenticated with token unless it's empty.
+func newVideoRequest(method, target string, videoID uuid.UUID, body io.Reader, token string) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.SetPathValue("videoID", videoID.String())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// decodeData decodes the data of a response envelope into dst.
+func decodeData(t *testing.T, rec *httptest.ResponseRecorder, dst any) {
+	t.Helper()
+	env := struct {
+		Data json.RawMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("Couldn't decode response %q: %v", rec.Body, err)
+	}
+	if err := json.Unmarshal(env.Data, dst); err != nil {
+		t.Fatalf("Couldn't decode response data %s: %v", env.Data, err)
+	}
+}
+
+// multipartBody builds a multipart form holding data as a file in field,
+// plus values, and returns it with its Content-Type. An empty contentType
+// leaves the file part without one.
+func multipartBody(t *testing.T, field, fileName, contentType string, data []byte, values map[string]string) (io.Reader, string) {
+	t.Helper()
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for k, v := range values {
+		mw.WriteField(k, v)
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, field, fileName))
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	mw.Close()
+	return body, mw.FormDataContentType()
+}
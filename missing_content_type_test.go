@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadHandlersMissingContentType(t *testing.T) {
+	const wantMsg = "Missing Content-Type on file part"
+
+	tests := []struct {
+		name        string
+		thumbnail   bool
+		contentType string
+		wantCode    int
+	}{
+		{name: "video without a content type", contentType: "", wantCode: http.StatusBadRequest},
+		{name: "video with a content type", contentType: "video/mp4", wantCode: http.StatusOK},
+		{name: "thumbnail without a content type", thumbnail: true, contentType: "", wantCode: http.StatusBadRequest},
+		{name: "thumbnail with a content type", thumbnail: true, contentType: "image/png", wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			if tt.thumbnail {
+				cfg.handlerUploadThumbnail(rec, newThumbnailRequest(t, video.ID, token, tt.contentType, encodePNG(t, 64, 36), nil))
+			} else {
+				cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", tt.contentType, []byte("fake video"), nil))
+			}
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if got := strings.Contains(rec.Body.String(), wantMsg); got != (tt.contentType == "") {
+				t.Errorf("body = %s, want %q only without a content type", rec.Body, wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// isFastStart walks the top-level MP4 boxes and reports whether the moov
+// atom comes before mdat, i.e. whether the file can start playing before it
+// has fully downloaded.
+func isFastStart(filePath string) (bool, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(f, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return false, errors.New("no moov or mdat atom found")
+			}
+			return false, err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		headerLen := int64(8)
+
+		switch boxType {
+		case "moov":
+			return true, nil
+		case "mdat":
+			return false, nil
+		}
+
+		switch size {
+		case 0:
+			// box runs to the end of the file
+			return false, errors.New("no moov or mdat atom found")
+		case 1:
+			if _, err := io.ReadFull(f, header); err != nil {
+				return false, err
+			}
+			size = int64(binary.BigEndian.Uint64(header))
+			headerLen = 16
+		}
+		if size < headerLen {
+			return false, fmt.Errorf("invalid size %d for %q atom", size, boxType)
+		}
+
+		if _, err := f.Seek(size-headerLen, io.SeekCurrent); err != nil {
+			return false, err
+		}
+	}
+}
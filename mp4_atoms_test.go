@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// box builds an MP4 box of the given type around payload.
+func box(boxType string, payload []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	b = append(b, boxType...)
+	return append(b, payload...)
+}
+
+// largeBox builds a box with a 64-bit size, as used for big mdat boxes.
+func largeBox(boxType string, payload []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, 1)
+	b = append(b, boxType...)
+	b = binary.BigEndian.AppendUint64(b, uint64(16+len(payload)))
+	return append(b, payload...)
+}
+
+func TestIsFastStart(t *testing.T) {
+	join := func(boxes ...[]byte) []byte {
+		var b []byte
+		for _, box := range boxes {
+			b = append(b, box...)
+		}
+		return b
+	}
+	ftyp := box("ftyp", []byte("isom\x00\x00\x02\x00"))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    bool
+		wantErr bool
+	}{
+		{name: "moov first", data: join(ftyp, box("moov", make([]byte, 16)), box("mdat", make([]byte, 32))), want: true},
+		{name: "mdat first", data: join(ftyp, box("mdat", make([]byte, 32)), box("moov", make([]byte, 16)))},
+		{name: "skips free boxes", data: join(ftyp, box("free", make([]byte, 4)), box("moov", nil)), want: true},
+		{name: "64-bit box sizes", data: join(ftyp, largeBox("wide", make([]byte, 8)), box("moov", nil)), want: true},
+		{name: "no moov or mdat", data: join(ftyp, box("free", nil)), wantErr: true},
+		{name: "box size too small", data: join(ftyp, []byte{0, 0, 0, 4, 'f', 'r', 'e', 'e'}), wantErr: true},
+		{name: "empty file", data: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "video.mp4")
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := isFastStart(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("isFastStart err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("isFastStart = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
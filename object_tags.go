@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// objectTagTemplate is a tag whose value may reference upload details:
+// {user_id}, {video_id}, {aspect_ratio} and {platform}.
+type objectTagTemplate struct {
+	key   string
+	value string
+}
+
+// parseObjectTags reads a comma separated key=value list such as
+// "user={user_id},aspect={aspect_ratio},env=prod".
+func parseObjectTags(spec string) ([]objectTagTemplate, error) {
+	templates := []objectTagTemplate{}
+	if strings.TrimSpace(spec) == "" {
+		return templates, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", pair)
+		}
+		templates = append(templates, objectTagTemplate{key: key, value: strings.TrimSpace(value)})
+	}
+	return templates, nil
+}
+
+func (cfg *apiConfig) objectTags(video database.Video, aspectRatio string) map[string]string {
+	replacer := strings.NewReplacer(
+		"{user_id}", video.UserID.String(),
+		"{video_id}", video.ID.String(),
+		"{aspect_ratio}", aspectRatio,
+		"{platform}", cfg.platform,
+	)
+	tags := make(map[string]string, len(cfg.objectTagTemplates))
+	for _, t := range cfg.objectTagTemplates {
+		tags[t.key] = replacer.Replace(t.value)
+	}
+	return tags
+}
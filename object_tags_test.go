@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestParseObjectTags(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []objectTagTemplate
+		wantErr bool
+	}{
+		{spec: "", want: []objectTagTemplate{}},
+		{spec: "env=prod", want: []objectTagTemplate{{key: "env", value: "prod"}}},
+		{spec: " user = {user_id} , env=", want: []objectTagTemplate{{key: "user", value: "{user_id}"}, {key: "env", value: ""}}},
+		{spec: "env", wantErr: true},
+		{spec: "=prod", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseObjectTags(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseObjectTags err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseObjectTags = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectTags(t *testing.T) {
+	templates, err := parseObjectTags("user={user_id},video={video_id},aspect={aspect_ratio},env={platform},team=video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _ := newTestConfig(t)
+	cfg.objectTagTemplates = templates
+	video := database.Video{ID: uuid.New(), CreateVideoParams: database.CreateVideoParams{UserID: uuid.New()}}
+
+	want := map[string]string{
+		"user":   video.UserID.String(),
+		"video":  video.ID.String(),
+		"aspect": "16:9",
+		"env":    "dev",
+		"team":   "video",
+	}
+	if got := cfg.objectTags(video, "16:9"); !reflect.DeepEqual(got, want) {
+		t.Errorf("objectTags = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+// outputProfile decides how processed MP4s are laid out. Progressive
+// faststart files suit plain <video> playback, fragmented ones DASH/CMAF
+// players.
+type outputProfile struct {
+	movflags string
+}
+
+var outputProfiles = map[string]outputProfile{
+	"faststart": {movflags: "faststart"},
+	"fmp4":      {movflags: "frag_keyframe+empty_moov"},
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHandlerUploadVideoOutputProfile(t *testing.T) {
+	tests := []struct {
+		name         string
+		global       string
+		requested    string
+		wantCode     int
+		wantMovflags string
+	}{
+		{name: "global default", global: "faststart", wantCode: http.StatusOK, wantMovflags: "faststart"},
+		{name: "global fmp4", global: "fmp4", wantCode: http.StatusOK, wantMovflags: "frag_keyframe+empty_moov"},
+		{name: "fmp4 per upload", global: "faststart", requested: "fmp4", wantCode: http.StatusOK, wantMovflags: "frag_keyframe+empty_moov"},
+		{name: "faststart per upload", global: "fmp4", requested: "faststart", wantCode: http.StatusOK, wantMovflags: "faststart"},
+		{name: "unknown profile", global: "faststart", requested: "hls", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.outputProfile = outputProfiles[tt.global]
+			logPath := installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			video, token := newTestVideo(t, cfg)
+
+			var values map[string]string
+			if tt.requested != "" {
+				values = map[string]string{"output_profile": tt.requested}
+			}
+			req := newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), values)
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			log, err := os.ReadFile(logPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			commands := strings.Split(strings.TrimSpace(string(log)), "\n")
+			for _, command := range commands {
+				if !strings.Contains(command, "-movflags "+tt.wantMovflags+" ") {
+					t.Errorf("ffmpeg ran %q, want -movflags %s", command, tt.wantMovflags)
+				}
+			}
+		})
+	}
+}
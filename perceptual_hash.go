@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"os/exec"
+	"slices"
+	"strconv"
+)
+
+const (
+	// phashFrames is how many frames, spread over the video, are averaged
+	// into the image that gets hashed.
+	phashFrames = 8
+	// phashSize is the side of the grayscale image the DCT runs on, only
+	// its lowest 8x8 frequencies make it into the hash.
+	phashSize = 32
+)
+
+// perceptualHash computes a 64 bit pHash of the video at filePath. Frames
+// sampled evenly across the video are scaled down to grayscale and
+// averaged, so re-encodes, resizes and small quality changes land within a
+// few bits of the original while different videos don't. It's returned as
+// 16 hex digits. Cancelling ctx stops ffmpeg.
+func (cfg *apiConfig) perceptualHash(ctx context.Context, filePath string, duration float64) (string, error) {
+	sampling := "fps=1"
+	if duration > 0 {
+		sampling = fmt.Sprintf("fps=%f", phashFrames/duration)
+	}
+	cmd := exec.CommandContext(
+		ctx,
+		cfg.ffmpegPath,
+		"-i", filePath,
+		"-an",
+		"-vf", fmt.Sprintf("%s,scale=%d:%d,format=gray", sampling, phashSize, phashSize),
+		"-frames:v", strconv.Itoa(phashFrames),
+		"-f", "rawvideo",
+		"pipe:1",
+	)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	logCommand(cmd)
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ffmpeg frame extraction failed: %w", err)
+	}
+
+	frameSize := phashSize * phashSize
+	frames := out.Len() / frameSize
+	if frames == 0 {
+		return "", errors.New("no frames extracted")
+	}
+	var pixels [phashSize][phashSize]float64
+	data := out.Bytes()
+	for f := 0; f < frames; f++ {
+		for i, p := range data[f*frameSize : (f+1)*frameSize] {
+			pixels[i/phashSize][i%phashSize] += float64(p) / float64(frames)
+		}
+	}
+	return fmt.Sprintf("%016x", phash(pixels)), nil
+}
+
+// phash sets a bit for each of the 8x8 lowest DCT frequencies of pixels
+// that lies above their median. The DC term is left out of the median, it
+// only carries overall brightness.
+func phash(pixels [phashSize][phashSize]float64) uint64 {
+	coeffs := dct2D(pixels)
+	low := make([]float64, 0, 64)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			low = append(low, coeffs[y][x])
+		}
+	}
+	sorted := slices.Clone(low[1:])
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for i, c := range low {
+		if c > median {
+			hash |= 1 << uint(63-i)
+		}
+	}
+	return hash
+}
+
+// dct2D is a separable type-II DCT, first over rows then over columns.
+func dct2D(in [phashSize][phashSize]float64) [phashSize][phashSize]float64 {
+	var rows, out [phashSize][phashSize]float64
+	for y := 0; y < phashSize; y++ {
+		rows[y] = dct1D(in[y])
+	}
+	for x := 0; x < phashSize; x++ {
+		var col [phashSize]float64
+		for y := 0; y < phashSize; y++ {
+			col[y] = rows[y][x]
+		}
+		col = dct1D(col)
+		for y := 0; y < phashSize; y++ {
+			out[y][x] = col[y]
+		}
+	}
+	return out
+}
+
+func dct1D(in [phashSize]float64) [phashSize]float64 {
+	var out [phashSize]float64
+	for k := 0; k < phashSize; k++ {
+		var sum float64
+		for n, v := range in {
+			sum += v * math.Cos(math.Pi/phashSize*(float64(n)+0.5)*float64(k))
+		}
+		out[k] = sum
+	}
+	return out
+}
+
+// hammingDistance counts the bits two hashes from perceptualHash differ in.
+func hammingDistance(a, b string) (int, error) {
+	x, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	y, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	return bits.OnesCount64(x ^ y), nil
+}
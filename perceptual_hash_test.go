@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// rawFrames renders phashFrames grayscale frames of pattern the way ffmpeg
+// hands them to perceptualHash. noise, if not zero, jitters every pixel by
+// up to that much, like a lossy re-encode would, and brightness shifts them.
+func rawFrames(pattern func(x, y, frame int) float64, noise, brightness float64) []byte {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, 0, phashFrames*phashSize*phashSize)
+	for f := 0; f < phashFrames; f++ {
+		for y := 0; y < phashSize; y++ {
+			for x := 0; x < phashSize; x++ {
+				v := pattern(x, y, f) + brightness
+				if noise > 0 {
+					v += (rng.Float64()*2 - 1) * noise
+				}
+				data = append(data, byte(math.Max(0, math.Min(255, v))))
+			}
+		}
+	}
+	return data
+}
+
+func wavesPattern(x, y, frame int) float64 {
+	return 128 + 60*math.Sin(float64(x+frame)/3) + 40*math.Cos(float64(x+2*y)/5)
+}
+
+func blobPattern(x, y, frame int) float64 {
+	dx, dy := float64(x-10-frame), float64(y-20)
+	if dx*dx+dy*dy < 40 {
+		return 230
+	}
+	return 40
+}
+
+func stripesPattern(x, y, frame int) float64 {
+	if (y/4)%2 == 0 {
+		return 200
+	}
+	return 30
+}
+
+// installFrameFFmpeg makes ffmpeg print its input, which tests fill with raw
+// frames, and log its arguments.
+func installFrameFFmpeg(t *testing.T, cfg *apiConfig) string {
+	t.Helper()
+	logPath := filepath.Join(t.TempDir(), "ffmpeg.log")
+	cfg.ffmpegPath = fakeCommand(t, "ffmpeg", `echo "$@" >> `+logPath+`
+cat "$2"
+`)
+	return logPath
+}
+
+func hashFrames(t *testing.T, cfg *apiConfig, frames []byte, duration float64) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, frames, 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := cfg.perceptualHash(context.Background(), path, duration)
+	if err != nil {
+		t.Fatalf("perceptualHash: %v", err)
+	}
+	return hash
+}
+
+func TestPerceptualHash(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []byte
+		// the hashes differ in wantMin to wantMax bits
+		wantMin, wantMax int
+	}{
+		{
+			name:    "identical videos",
+			a:       rawFrames(wavesPattern, 0, 0),
+			b:       rawFrames(wavesPattern, 0, 0),
+			wantMax: 0,
+		},
+		{
+			name:    "re-encoded waves",
+			a:       rawFrames(wavesPattern, 0, 0),
+			b:       rawFrames(wavesPattern, 8, 5),
+			wantMax: 10,
+		},
+		{
+			name:    "re-encoded shapes",
+			a:       rawFrames(blobPattern, 0, 0),
+			b:       rawFrames(blobPattern, 12, -6),
+			wantMax: 10,
+		},
+		{
+			name:    "different videos",
+			a:       rawFrames(blobPattern, 0, 0),
+			b:       rawFrames(stripesPattern, 0, 0),
+			wantMin: 11,
+			wantMax: 64,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			installFrameFFmpeg(t, cfg)
+			a := hashFrames(t, cfg, tt.a, 10)
+			b := hashFrames(t, cfg, tt.b, 10)
+			if len(a) != 16 {
+				t.Errorf("hash %q isn't 16 hex digits", a)
+			}
+			distance, err := hammingDistance(a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if distance < tt.wantMin || distance > tt.wantMax {
+				t.Errorf("distance between %s and %s = %d, want %d..%d", a, b, distance, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestPerceptualHashSampling(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration float64
+		wantFPS  string
+		frames   int
+		wantErr  bool
+	}{
+		{name: "spread over the video", duration: 16, wantFPS: "fps=0.500000", frames: phashFrames},
+		{name: "unknown duration", duration: 0, wantFPS: "fps=1", frames: phashFrames},
+		{name: "fewer frames than asked for", duration: 2, wantFPS: "fps=4.000000", frames: 3},
+		{name: "no frames", duration: 10, wantFPS: "fps=0.800000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			logPath := installFrameFFmpeg(t, cfg)
+			path := filepath.Join(t.TempDir(), "video.mp4")
+			frames := rawFrames(wavesPattern, 0, 0)[:tt.frames*phashSize*phashSize]
+			if err := os.WriteFile(path, frames, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := cfg.perceptualHash(context.Background(), path, tt.duration)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("perceptualHash err = %v, want one %v", err, tt.wantErr)
+			}
+			log, err := os.ReadFile(logPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.wantFPS + ",scale=32:32,format=gray"; !strings.Contains(string(log), want) {
+				t.Errorf("ffmpeg args %q lack %s", log, want)
+			}
+		})
+	}
+}
+
+func TestHammingDistance(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		want    int
+		wantErr bool
+	}{
+		{name: "equal", a: "00ff00ff00ff00ff", b: "00ff00ff00ff00ff", want: 0},
+		{name: "one bit", a: "0000000000000000", b: "0000000000000001", want: 1},
+		{name: "every bit", a: "0000000000000000", b: "ffffffffffffffff", want: 64},
+		{name: "nibbles", a: "f0f0f0f0f0f0f0f0", b: "0ff0f0f0f0f0f0f0", want: 8},
+		{name: "not hex", a: "zz", b: "00", wantErr: true},
+		{name: "empty", a: "", b: "00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hammingDistance(tt.a, tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("hammingDistance(%q, %q) err = %v, want one %v", tt.a, tt.b, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("hammingDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerVideoSimilar(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		noHash     bool
+		otherUser  bool
+		wantCode   int
+		wantTitles []string
+	}{
+		{name: "default distance", wantCode: http.StatusOK, wantTitles: []string{"identical", "re-encoded"}},
+		{name: "exact matches only", query: "?max_distance=0", wantCode: http.StatusOK, wantTitles: []string{"identical"}},
+		{name: "everything", query: "?max_distance=64", wantCode: http.StatusOK, wantTitles: []string{"identical", "re-encoded", "different"}},
+		{name: "distance out of range", query: "?max_distance=65", wantCode: http.StatusBadRequest},
+		{name: "video without a hash", noHash: true, wantCode: http.StatusUnprocessableEntity},
+		{name: "someone else's video", otherUser: true, wantCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+			if !tt.noHash {
+				video.PHash = "00000000000000ff"
+			}
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range []struct{ title, hash string }{
+				{"different", "ffffffffffff0000"},
+				{"re-encoded", "00000000000003fe"},
+				{"identical", "00000000000000ff"},
+				{"unhashed", ""},
+			} {
+				candidate := newUserVideo(t, cfg, video)
+				candidate.Title = c.title
+				candidate.PHash = c.hash
+				if err := cfg.db.UpdateVideo(candidate); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// another user's identical video isn't theirs to see
+			other, otherToken := newTestVideo(t, cfg)
+			other.PHash = video.PHash
+			if err := cfg.db.UpdateVideo(other); err != nil {
+				t.Fatal(err)
+			}
+			if tt.otherUser {
+				token = otherToken
+			}
+
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoSimilar(rec, newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/similar"+tt.query, video.ID, nil, token))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var resp []struct {
+				database.Video
+				Distance int `json:"distance"`
+			}
+			decodeData(t, rec, &resp)
+			var titles []string
+			for i, v := range resp {
+				titles = append(titles, v.Title)
+				if i > 0 && v.Distance < resp[i-1].Distance {
+					t.Errorf("results aren't sorted by distance: %d after %d", v.Distance, resp[i-1].Distance)
+				}
+			}
+			if strings.Join(titles, ",") != strings.Join(tt.wantTitles, ",") {
+				t.Errorf("similar = %v, want %v", titles, tt.wantTitles)
+			}
+		})
+	}
+}
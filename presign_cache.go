@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// presignCache hands out the same presigned URL for an object until it gets
+// close to expiring, which saves signing work and lets clients cache the
+// response.
+type presignCache struct {
+	mu      sync.Mutex
+	entries map[presignCacheKey]presignEntry
+}
+
+type presignCacheKey struct {
+	key     string
+	options storage.PresignOptions
+}
+
+type presignEntry struct {
+	url     string
+	expires time.Time
+}
+
+func newPresignCache() *presignCache {
+	return &presignCache{
+		entries: map[presignCacheKey]presignEntry{},
+	}
+}
+
+// get returns a cached URL usable for a request wanting ttl: it mustn't
+// outlive ttl, and has to have at least a quarter of ttl left so clients
+// don't receive a URL that's about to expire.
+func (c *presignCache) get(k presignCacheKey, ttl time.Duration, now time.Time) (presignEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[k]
+	if !ok || e.expires.After(now.Add(ttl)) || e.expires.Sub(now) < ttl/4 {
+		return presignEntry{}, false
+	}
+	return e, true
+}
+
+func (c *presignCache) set(k presignCacheKey, e presignEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if !entry.expires.After(now) {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[k] = e
+}
+
+// invalidate drops every cached URL for the given keys, whatever options
+// they were signed with, and returns how many were dropped.
+func (c *presignCache) invalidate(keys []string) int {
+	drop := map[string]bool{}
+	for _, key := range keys {
+		drop[key] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for k := range c.entries {
+		if drop[k.key] {
+			delete(c.entries, k)
+			n++
+		}
+	}
+	return n
+}
+
+// presignGet presigns key through the cache and reports when the returned
+// URL expires.
+func (cfg *apiConfig) presignGet(ctx context.Context, key string, ttl time.Duration, opts ...func(*storage.PresignOptions)) (string, time.Time, error) {
+	var options storage.PresignOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	k := presignCacheKey{key: key, options: options}
+
+	now := time.Now()
+	if e, ok := cfg.presignCache.get(k, ttl, now); ok {
+		return e.url, e.expires, nil
+	}
+
+	ctx, cancel := cfg.storageContext(ctx)
+	defer cancel()
+	url, err := cfg.presignWithRetry(ctx, key, ttl, opts...)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	e := presignEntry{url: url, expires: now.Add(ttl)}
+	cfg.presignCache.set(k, e, now)
+	return e.url, e.expires, nil
+}
+
+// invalidateVideoURLs drops the cached URLs of every object of the video,
+// so replaced, deleted or newly private objects aren't handed out anymore.
+func (cfg *apiConfig) invalidateVideoURLs(video database.Video) (int, error) {
+	keys, err := cfg.videoObjectKeys(video)
+	if err != nil {
+		return 0, err
+	}
+	return cfg.presignCache.invalidate(keys), nil
+}
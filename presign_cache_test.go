@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// countingStorage hands out a new URL on every presign and counts them.
+type countingStorage struct {
+	storage.Storage
+	presigns atomic.Int32
+}
+
+func (s *countingStorage) PresignGet(ctx context.Context, key string, ttl time.Duration, opts ...func(*storage.PresignOptions)) (string, error) {
+	n := s.presigns.Add(1)
+	return fmt.Sprintf("https://example.com/%s?n=%d", key, n), nil
+}
+
+func TestPresignCacheGet(t *testing.T) {
+	now := time.Now()
+	k := presignCacheKey{key: "landscape/abc.mp4"}
+	tests := []struct {
+		name    string
+		expires time.Time
+		ttl     time.Duration
+		wantHit bool
+	}{
+		{name: "fresh entry", expires: now.Add(50 * time.Minute), ttl: time.Hour, wantHit: true},
+		{name: "exactly a quarter left", expires: now.Add(15 * time.Minute), ttl: time.Hour, wantHit: true},
+		{name: "close to expiring", expires: now.Add(14 * time.Minute), ttl: time.Hour},
+		{name: "expired", expires: now.Add(-time.Minute), ttl: time.Hour},
+		{name: "outlives a shorter ttl", expires: now.Add(50 * time.Minute), ttl: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newPresignCache()
+			c.set(k, presignEntry{url: "https://example.com/a", expires: tt.expires}, now)
+			_, hit := c.get(k, tt.ttl, now)
+			if hit != tt.wantHit {
+				t.Errorf("hit = %v, want %v", hit, tt.wantHit)
+			}
+		})
+	}
+}
+
+func TestPresignCacheKeysOnOptions(t *testing.T) {
+	now := time.Now()
+	c := newPresignCache()
+	plain := presignCacheKey{key: "a.mp4"}
+	download := presignCacheKey{key: "a.mp4", options: storage.PresignOptions{ResponseContentDisposition: "attachment"}}
+	c.set(plain, presignEntry{url: "plain", expires: now.Add(time.Hour)}, now)
+
+	if _, hit := c.get(download, time.Hour, now); hit {
+		t.Error("a download URL was served from the plain URL's entry")
+	}
+	c.set(download, presignEntry{url: "download", expires: now.Add(time.Hour)}, now)
+	if e, _ := c.get(plain, time.Hour, now); e.url != "plain" {
+		t.Errorf("plain entry = %q, want %q", e.url, "plain")
+	}
+}
+
+func TestPresignCacheSetEvicts(t *testing.T) {
+	now := time.Now()
+	c := newPresignCache()
+	c.set(presignCacheKey{key: "old.mp4"}, presignEntry{url: "old", expires: now.Add(time.Minute)}, now)
+	c.set(presignCacheKey{key: "live.mp4"}, presignEntry{url: "live", expires: now.Add(time.Hour)}, now)
+
+	later := now.Add(2 * time.Minute)
+	c.set(presignCacheKey{key: "new.mp4"}, presignEntry{url: "new", expires: later.Add(time.Hour)}, later)
+	if _, ok := c.entries[presignCacheKey{key: "old.mp4"}]; ok {
+		t.Error("expired entry wasn't evicted")
+	}
+	if len(c.entries) != 2 {
+		t.Errorf("entries = %d, want 2", len(c.entries))
+	}
+}
+
+func TestPresignCacheInvalidate(t *testing.T) {
+	now := time.Now()
+	c := newPresignCache()
+	for _, k := range []presignCacheKey{
+		{key: "a.mp4"},
+		{key: "a.mp4", options: storage.PresignOptions{ResponseContentDisposition: "attachment"}},
+		{key: "b.mp4"},
+	} {
+		c.set(k, presignEntry{url: k.key, expires: now.Add(time.Hour)}, now)
+	}
+
+	if n := c.invalidate([]string{"a.mp4", "missing.mp4"}); n != 2 {
+		t.Errorf("invalidate dropped %d entries, want 2", n)
+	}
+	if _, hit := c.get(presignCacheKey{key: "b.mp4"}, time.Hour, now); !hit {
+		t.Error("invalidate dropped an unrelated key")
+	}
+}
+
+func TestPresignGetCaches(t *testing.T) {
+	tests := []struct {
+		name         string
+		ttls         []time.Duration
+		wantPresigns int32
+	}{
+		{name: "repeated request within the ttl", ttls: []time.Duration{time.Hour, time.Hour, time.Hour}, wantPresigns: 1},
+		{name: "shorter ttl signs again", ttls: []time.Duration{time.Hour, time.Minute}, wantPresigns: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			counting := &countingStorage{Storage: mem}
+			cfg.storage = counting
+
+			var first string
+			for i, ttl := range tt.ttls {
+				url, expires, err := cfg.presignGet(context.Background(), "landscape/abc.mp4", ttl)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if time.Until(expires) > ttl {
+					t.Errorf("URL expires in %v, beyond the %v asked for", time.Until(expires), ttl)
+				}
+				if i == 0 {
+					first = url
+				} else if ttl == tt.ttls[0] && url != first {
+					t.Errorf("request %d got %s, want the cached %s", i, url, first)
+				}
+			}
+			if got := counting.presigns.Load(); got != tt.wantPresigns {
+				t.Errorf("presigns = %d, want %d", got, tt.wantPresigns)
+			}
+		})
+	}
+}
+
+func TestPresignGetRenewsNearExpiry(t *testing.T) {
+	cfg, mem := newTestConfig(t)
+	counting := &countingStorage{Storage: mem}
+	cfg.storage = counting
+
+	first, _, err := cfg.presignGet(context.Background(), "landscape/abc.mp4", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// age the cached URL until it's about to expire
+	k := presignCacheKey{key: "landscape/abc.mp4"}
+	e := cfg.presignCache.entries[k]
+	e.expires = time.Now().Add(time.Minute)
+	cfg.presignCache.entries[k] = e
+
+	second, expires, err := cfg.presignGet(context.Background(), "landscape/abc.mp4", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Error("a URL about to expire was handed out again")
+	}
+	if time.Until(expires) < 59*time.Minute {
+		t.Errorf("renewed URL expires in %v, want about an hour", time.Until(expires))
+	}
+	if got := counting.presigns.Load(); got != 2 {
+		t.Errorf("presigns = %d, want 2", got)
+	}
+}
+
+func TestPresignGetConcurrent(t *testing.T) {
+	cfg, mem := newTestConfig(t)
+	cfg.storage = &countingStorage{Storage: mem}
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := fmt.Sprintf("landscape/%d.mp4", i%4)
+			if _, _, err := cfg.presignGet(context.Background(), key, time.Hour); err != nil {
+				t.Error(err)
+			}
+			cfg.presignCache.invalidate([]string{key})
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// presignRetryBase is the wait before the first retry of a failed presign,
+// it doubles with every further attempt.
+const presignRetryBase = 100 * time.Millisecond
+
+// presignWithRetry presigns key, retrying transient failures such as a
+// credential refresh hiccup up to cfg.presignRetries times with
+// exponential backoff. Permanent errors are returned right away.
+func (cfg *apiConfig) presignWithRetry(ctx context.Context, key string, ttl time.Duration, opts ...func(*storage.PresignOptions)) (string, error) {
+	backoff := presignRetryBase
+	for attempt := 1; ; attempt++ {
+		url, err := cfg.storage.PresignGet(ctx, key, ttl, opts...)
+		if err == nil || attempt > cfg.presignRetries || !storage.Retryable(err) {
+			return url, err
+		}
+		slog.WarnContext(ctx, "Presign failed, retrying", "key", key, "attempt", attempt, "backoff", backoff, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
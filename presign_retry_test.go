@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// transientError is classified as retryable by the AWS SDK, like a failed
+// credential refresh would be.
+type transientError struct{}
+
+func (transientError) Error() string        { return "credential refresh failed" }
+func (transientError) RetryableError() bool { return true }
+
+// flakyPresignStorage fails PresignGet with each of errs in turn before
+// passing through to the wrapped storage.
+type flakyPresignStorage struct {
+	storage.Storage
+	errs  []error
+	calls int
+}
+
+func (s *flakyPresignStorage) PresignGet(ctx context.Context, key string, ttl time.Duration, opts ...func(*storage.PresignOptions)) (string, error) {
+	s.calls++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return "", err
+	}
+	return s.Storage.PresignGet(ctx, key, ttl, opts...)
+}
+
+func TestPresignWithRetry(t *testing.T) {
+	permanent := errors.New("invalid bucket configuration")
+
+	tests := []struct {
+		name      string
+		retries   int
+		errs      []error
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "succeeds first time", retries: 2, wantCalls: 1},
+		{name: "transient failure then success", retries: 2, errs: []error{transientError{}}, wantCalls: 2},
+		{name: "permanent failure", retries: 2, errs: []error{permanent}, wantErr: permanent, wantCalls: 1},
+		{name: "transient failures outlast retries", retries: 1, errs: []error{transientError{}, transientError{}, transientError{}}, wantErr: transientError{}, wantCalls: 2},
+		{name: "retries disabled", retries: 0, errs: []error{transientError{}}, wantErr: transientError{}, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.presignRetries = tt.retries
+			flaky := &flakyPresignStorage{Storage: mem, errs: tt.errs}
+			cfg.storage = flaky
+
+			url, err := cfg.presignWithRetry(context.Background(), "landscape/abc.mp4", time.Hour)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !strings.HasPrefix(url, "memory://landscape/abc.mp4?") {
+				t.Errorf("url = %q, want a presigned URL", url)
+			}
+			if flaky.calls != tt.wantCalls {
+				t.Errorf("PresignGet called %d times, want %d", flaky.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestPresignWithRetryCancelled(t *testing.T) {
+	cfg, mem := newTestConfig(t)
+	cfg.storage = &flakyPresignStorage{Storage: mem, errs: []error{transientError{}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := cfg.presignWithRetry(ctx, "landscape/abc.mp4", time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestHandlerVideoRedirectPresignRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		errs     []error
+		wantCode int
+	}{
+		{name: "transient failure", errs: []error{transientError{}}, wantCode: http.StatusFound},
+		{name: "permanent failure", errs: []error{errors.New("invalid bucket configuration")}, wantCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			video, _ := newTestVideo(t, cfg)
+			mem.Put(context.Background(), "landscape/abc.mp4", strings.NewReader("video"), "video/mp4")
+			videoURL := cfg.videoURL("landscape/abc.mp4")
+			video.VideoURL = &videoURL
+			video.Visibility = database.VideoVisibilityPublic
+			video.PublishState = database.VideoPublishPublished
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+			cfg.storage = &flakyPresignStorage{Storage: mem, errs: tt.errs}
+
+			req := newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/redirect", video.ID, nil, "")
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoRedirect(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// generatePreviewGIF renders a short looping preview of the video at
+// filePath. Videos much longer than the preview are sampled evenly across
+// their whole length instead of only showing the first seconds. The caller
+// removes the returned file.
+func (cfg *apiConfig) generatePreviewGIF(filePath string, duration float64) (string, error) {
+	frames := cfg.previewGIFSeconds * cfg.previewGIFFPS
+	if frames <= 0 {
+		return "", fmt.Errorf("preview GIF needs a positive length and fps")
+	}
+
+	sampling := fmt.Sprintf("fps=%d", cfg.previewGIFFPS)
+	if duration > 2*float64(cfg.previewGIFSeconds) {
+		// pick frames at the rate that spreads them over the whole video,
+		// then retime them to play back at the configured fps
+		sampling = fmt.Sprintf("fps=%f,setpts=N/(%d*TB)", float64(frames)/duration, cfg.previewGIFFPS)
+	}
+	filter := fmt.Sprintf(
+		"%s,scale=%d:-2:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse",
+		sampling, cfg.previewGIFWidth,
+	)
+
+	outputFilePath, err := tempOutputPath(filePath, "tubely-preview-*.gif")
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command(
+		cfg.ffmpegPath,
+		"-y",
+		"-i", filePath,
+		"-an",
+		"-filter_complex", filter,
+		"-frames:v", fmt.Sprint(frames),
+		"-r", fmt.Sprint(cfg.previewGIFFPS),
+		"-loop", "0",
+		"-f", "gif",
+		outputFilePath,
+	)
+
+	logCommand(cmd)
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputFilePath)
+		return "", err
+	}
+	return outputFilePath, nil
+}
+
+// previewGIFKey derives the preview's key from the primary key, e.g.
+// landscape/abc.mp4 becomes landscape/abc_preview.gif.
+func previewGIFKey(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + "_preview.gif"
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGeneratePreviewGIF(t *testing.T) {
+	tests := []struct {
+		name       string
+		seconds    int
+		fps        int
+		width      int
+		duration   float64
+		wantFilter string
+		wantFrames string
+		wantRate   string
+		wantErr    bool
+	}{
+		{
+			name:       "short video plays from the start",
+			seconds:    3,
+			fps:        10,
+			width:      320,
+			duration:   5,
+			wantFilter: "fps=10,scale=320:-2:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse",
+			wantFrames: "30",
+			wantRate:   "10",
+		},
+		{
+			name:       "configured fps and size",
+			seconds:    2,
+			fps:        5,
+			width:      160,
+			duration:   4,
+			wantFilter: "fps=5,scale=160:-2:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse",
+			wantFrames: "10",
+			wantRate:   "5",
+		},
+		{
+			name:       "long video is sampled throughout",
+			seconds:    3,
+			fps:        10,
+			width:      320,
+			duration:   600,
+			wantFilter: "fps=0.050000,setpts=N/(10*TB),scale=320:-2:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse",
+			wantFrames: "30",
+			wantRate:   "10",
+		},
+		{name: "zero fps", seconds: 3, width: 320, duration: 5, wantErr: true},
+		{name: "zero length", fps: 10, width: 320, duration: 5, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.previewGIFSeconds = tt.seconds
+			cfg.previewGIFFPS = tt.fps
+			cfg.previewGIFWidth = tt.width
+			logPath := installFakeFFmpeg(t, cfg, fakeProbe(1280, 720))
+			source := filepath.Join(t.TempDir(), "source.mp4")
+			if err := os.WriteFile(source, []byte("fake video"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			gifPath, err := cfg.generatePreviewGIF(source, tt.duration)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("generatePreviewGIF err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer os.Remove(gifPath)
+			if !strings.HasSuffix(gifPath, ".gif") {
+				t.Errorf("output %s isn't a .gif", gifPath)
+			}
+
+			log, err := os.ReadFile(logPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			args := strings.Fields(string(log))
+			flag := func(name string) string {
+				i := slices.Index(args, name)
+				if i < 0 || i+1 >= len(args) {
+					return ""
+				}
+				return args[i+1]
+			}
+			if got := flag("-filter_complex"); got != tt.wantFilter {
+				t.Errorf("filter = %q, want %q", got, tt.wantFilter)
+			}
+			if got := flag("-frames:v"); got != tt.wantFrames {
+				t.Errorf("frames = %s, want %s", got, tt.wantFrames)
+			}
+			if got := flag("-r"); got != tt.wantRate {
+				t.Errorf("output fps = %s, want %s", got, tt.wantRate)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoPreviewGIF(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     bool
+		wantPreview bool
+	}{
+		{name: "enabled", enabled: true, wantPreview: true},
+		{name: "disabled", enabled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.previewGIF = tt.enabled
+			cfg.previewGIFSeconds = 3
+			cfg.previewGIFFPS = 10
+			cfg.previewGIFWidth = 320
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			video, token := newTestVideo(t, cfg)
+
+			req := newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil)
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := stored.PreviewGIFURL != nil; got != tt.wantPreview {
+				t.Fatalf("preview URL set = %v, want %v", got, tt.wantPreview)
+			}
+			var gifKeys []string
+			for _, key := range mem.Keys() {
+				if strings.HasSuffix(key, "_preview.gif") {
+					gifKeys = append(gifKeys, key)
+				}
+			}
+			if (len(gifKeys) == 1) != tt.wantPreview {
+				t.Errorf("stored previews = %v, want one %v", gifKeys, tt.wantPreview)
+			}
+		})
+	}
+}
+
+func TestPreviewGIFKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "landscape/abc.mp4", want: "landscape/abc_preview.gif"},
+		{key: "abc", want: "abc_preview.gif"},
+		{key: "a.b/c.mov", want: "a.b/c_preview.gif"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := previewGIFKey(tt.key); got != tt.want {
+				t.Errorf("previewGIFKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
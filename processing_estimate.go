@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// processingModel is how fast processing runs on this deployment, as
+// seconds of video handled per wall-clock second: remuxSpeed for the
+// faststart pass, encodeSpeeds for each variant of the ladder.
+type processingModel struct {
+	remuxSpeed   float64
+	encodeSpeeds map[string]float64
+}
+
+// parseEncodeSpeeds reads a comma separated NAME=SPEED list such as
+// "1080p=1,720p=2". Every rung of the ladder needs a speed.
+func parseEncodeSpeeds(spec string) (map[string]float64, error) {
+	speeds := map[string]float64{}
+	for _, pair := range strings.Split(spec, ",") {
+		name, s, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		speed, err := strconv.ParseFloat(s, 64)
+		if !ok || err != nil || speed <= 0 {
+			return nil, fmt.Errorf("invalid speed %q, expected NAME=SPEED", pair)
+		}
+		speeds[name] = speed
+	}
+	for _, v := range variantLadder {
+		if _, ok := speeds[v.Name]; !ok {
+			return nil, fmt.Errorf("missing speed for %s", v.Name)
+		}
+	}
+	return speeds, nil
+}
+
+type variantEstimate struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+}
+
+type processingEstimate struct {
+	EstimatedSeconds float64           `json:"estimatedSeconds"`
+	RemuxSeconds     float64           `json:"remuxSeconds"`
+	Variants         []variantEstimate `json:"variants"`
+}
+
+// estimate predicts how long processing a video of the given length into
+// variants takes. Variants are encoded parallel at a time, so their share
+// is their total spread over that many encoders, but never less than the
+// slowest single one.
+func (m processingModel) estimate(duration float64, variants []Variant, parallel int) processingEstimate {
+	est := processingEstimate{
+		RemuxSeconds: duration / m.remuxSpeed,
+		Variants:     []variantEstimate{},
+	}
+	var total, slowest float64
+	for _, v := range variants {
+		seconds := duration / m.encodeSpeeds[v.Name]
+		est.Variants = append(est.Variants, variantEstimate{Name: v.Name, Seconds: seconds})
+		total += seconds
+		slowest = max(slowest, seconds)
+	}
+	est.EstimatedSeconds = est.RemuxSeconds + max(slowest, total/float64(max(parallel, 1)))
+	return est
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testProcessingModel remuxes at 50x and encodes 1080p at 1x, 720p at 2x
+// and 480p at 4x real time.
+var testProcessingModel = processingModel{
+	remuxSpeed:   50,
+	encodeSpeeds: map[string]float64{"1080p": 1, "720p": 2, "480p": 4},
+}
+
+func TestParseEncodeSpeeds(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{name: "every rung", spec: "1080p=1, 720p=2.5,480p=4", want: map[string]float64{"1080p": 1, "720p": 2.5, "480p": 4}},
+		{name: "missing a rung", spec: "1080p=1,720p=2", wantErr: true},
+		{name: "not a number", spec: "1080p=fast,720p=2,480p=4", wantErr: true},
+		{name: "zero speed", spec: "1080p=0,720p=2,480p=4", wantErr: true},
+		{name: "no speed", spec: "1080p,720p=2,480p=4", wantErr: true},
+		{name: "empty", spec: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEncodeSpeeds(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("speeds = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessingModelEstimate(t *testing.T) {
+	v1080, v720, v480 := variantLadder[0], variantLadder[1], variantLadder[2]
+
+	tests := []struct {
+		name     string
+		duration float64
+		variants []Variant
+		parallel int
+		want     float64
+	}{
+		{name: "remux only", duration: 100, want: 2},
+		{name: "one variant", duration: 100, variants: []Variant{v720}, parallel: 1, want: 52},
+		{name: "two variants", duration: 100, variants: []Variant{v720, v480}, parallel: 1, want: 77},
+		{name: "three variants", duration: 100, variants: []Variant{v1080, v720, v480}, parallel: 1, want: 177},
+		{name: "twice the duration", duration: 200, variants: []Variant{v1080, v720, v480}, parallel: 1, want: 354},
+		{name: "spread over encoders", duration: 100, variants: []Variant{v1080, v720, v480}, parallel: 3, want: 102},
+		{name: "bounded by the slowest encode", duration: 100, variants: []Variant{v720, v480}, parallel: 2, want: 52},
+		{name: "no parallelism counts as one", duration: 100, variants: []Variant{v720, v480}, parallel: 0, want: 77},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := testProcessingModel.estimate(tt.duration, tt.variants, tt.parallel)
+			if got.EstimatedSeconds != tt.want {
+				t.Errorf("estimate = %v, want %v", got.EstimatedSeconds, tt.want)
+			}
+			if got.RemuxSeconds != tt.duration/50 {
+				t.Errorf("remux = %v, want %v", got.RemuxSeconds, tt.duration/50)
+			}
+			if len(got.Variants) != len(tt.variants) {
+				t.Errorf("variants = %+v, want %d", got.Variants, len(tt.variants))
+			}
+		})
+	}
+}
+
+func TestHandlerVideoEstimate(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		noToken      bool
+		wantCode     int
+		wantSeconds  float64
+		wantVariants []string
+	}{
+		{name: "ladder for the resolution", body: `{"durationSeconds":100,"resolution":"1920x1080"}`, wantCode: http.StatusOK, wantSeconds: 52, wantVariants: []string{"720p", "480p"}},
+		{name: "chosen variants", body: `{"durationSeconds":100,"resolution":"1920x1080","variants":["480p"]}`, wantCode: http.StatusOK, wantSeconds: 27, wantVariants: []string{"480p"}},
+		{name: "no variants", body: `{"durationSeconds":100,"resolution":"1920x1080","variants":[]}`, wantCode: http.StatusOK, wantSeconds: 2, wantVariants: []string{}},
+		{name: "variant bigger than the source", body: `{"durationSeconds":100,"resolution":"1280x720","variants":["1080p"]}`, wantCode: http.StatusBadRequest},
+		{name: "bad resolution", body: `{"durationSeconds":100,"resolution":"hd"}`, wantCode: http.StatusBadRequest},
+		{name: "negative duration", body: `{"durationSeconds":-5,"resolution":"1920x1080"}`, wantCode: http.StatusBadRequest},
+		{name: "missing duration", body: `{"resolution":"1920x1080"}`, wantCode: http.StatusBadRequest},
+		{name: "no token", body: `{"durationSeconds":100,"resolution":"1920x1080"}`, noToken: true, wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.processingModel = testProcessingModel
+			_, token := newTestVideo(t, cfg)
+			if tt.noToken {
+				token = ""
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/videos/estimate", strings.NewReader(tt.body))
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoEstimate(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var got processingEstimate
+			decodeData(t, rec, &got)
+			if got.EstimatedSeconds != tt.wantSeconds {
+				t.Errorf("estimatedSeconds = %v, want %v", got.EstimatedSeconds, tt.wantSeconds)
+			}
+			names := []string{}
+			for _, v := range got.Variants {
+				names = append(names, v.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantVariants) {
+				t.Errorf("variants = %v, want %v", names, tt.wantVariants)
+			}
+		})
+	}
+}
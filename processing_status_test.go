@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerVideoGetStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         string
+		processingCode int
+		// failures are recorded upload failures, oldest first
+		failures      []string
+		wantCode      int
+		wantURL       bool
+		wantStatusErr string
+	}{
+		{name: "processing", status: database.VideoStatusProcessing, processingCode: http.StatusOK, wantCode: http.StatusOK},
+		{name: "processing with 202", status: database.VideoStatusProcessing, processingCode: http.StatusAccepted, wantCode: http.StatusAccepted},
+		{name: "ready", status: database.VideoStatusReady, processingCode: http.StatusAccepted, wantCode: http.StatusOK, wantURL: true},
+		{
+			name:           "failed",
+			status:         database.VideoStatusFailed,
+			processingCode: http.StatusOK,
+			failures:       []string{"Unable to process video: ffmpeg exited with 1"},
+			wantCode:       http.StatusOK,
+			wantURL:        true,
+			wantStatusErr:  "Unable to process video",
+		},
+		{
+			name:           "failed again",
+			status:         database.VideoStatusFailed,
+			processingCode: http.StatusOK,
+			failures:       []string{"Invalid file type", "Video is too large: 5 bytes over"},
+			wantCode:       http.StatusOK,
+			wantURL:        true,
+			wantStatusErr:  "Video is too large",
+		},
+		{name: "failed without details", status: database.VideoStatusFailed, processingCode: http.StatusOK, wantCode: http.StatusOK, wantURL: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.processingStatusCode = tt.processingCode
+			video, token := newTestVideo(t, cfg)
+			// every state has a previous upload's URL around
+			videoURL := cfg.videoURL("landscape/old.mp4")
+			video.VideoURL = &videoURL
+			previewURL := cfg.videoURL("landscape/old.gif")
+			video.PreviewGIFURL = &previewURL
+			video.Status = tt.status
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+			for _, details := range tt.failures {
+				cfg.recordUploadEvent(video.ID, database.UploadEventFailed, details)
+			}
+
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoGet(rec, newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String(), video.ID, nil, token))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status code = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			var resp videoResponse
+			decodeData(t, rec, &resp)
+			if resp.Status != tt.status {
+				t.Errorf("status = %q, want %q", resp.Status, tt.status)
+			}
+			if gotURL := resp.VideoURL != nil; gotURL != tt.wantURL {
+				t.Errorf("video URL handed out = %v, want %v", gotURL, tt.wantURL)
+			}
+			if gotPreview := resp.PreviewGIFURL != nil; gotPreview != tt.wantURL {
+				t.Errorf("preview URL handed out = %v, want %v", gotPreview, tt.wantURL)
+			}
+			if resp.StatusError != tt.wantStatusErr {
+				t.Errorf("status error = %q, want %q", resp.StatusError, tt.wantStatusErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDMiddleware tags every request with an ID, reusing one set by a
+// proxy in front of us. It's echoed in the X-Request-ID response header,
+// where respondWithJSON and respondWithError pick it up for the envelope.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
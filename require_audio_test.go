@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// probeWithoutAudio is fakeProbe for a silent video, one with no audio
+// stream at all.
+func probeWithoutAudio(width, height int) string {
+	return fmt.Sprintf(`{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "h264", "width": %d, "height": %d}
+		],
+		"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "10.000000", "bit_rate": "8000000"}
+	}`, width, height)
+}
+
+func TestHandlerUploadVideoRequireAudio(t *testing.T) {
+	tests := []struct {
+		name         string
+		requireAudio bool
+		probe        string
+		wantCode     int
+	}{
+		{name: "audio required and present", requireAudio: true, probe: fakeProbe(320, 180), wantCode: http.StatusOK},
+		{name: "audio required and missing", requireAudio: true, probe: probeWithoutAudio(320, 180), wantCode: http.StatusUnprocessableEntity},
+		{name: "silent video allowed by default", requireAudio: false, probe: probeWithoutAudio(320, 180), wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.requireAudio = tt.requireAudio
+			installFakeFFmpeg(t, cfg, tt.probe)
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := stored.VideoURL != nil; got != (tt.wantCode == http.StatusOK) {
+				t.Errorf("video stored = %v, want %v", got, tt.wantCode == http.StatusOK)
+			}
+			if tt.wantCode == http.StatusOK {
+				return
+			}
+
+			events, err := cfg.db.GetUploadEvents(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			last := events[len(events)-1]
+			if last.Event != database.UploadEventFailed || last.Details != "Video must have an audio track" {
+				t.Errorf("last upload event = %s %q, want the audio rejection", last.Event, last.Details)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"unicode"
+)
+
+var errUnsafeKey = errors.New("unsafe object key")
+
+// sanitizeKey makes a storage key that's built from user input safe to use
+// both in the bucket and as a path below a local directory. Backslashes
+// become slashes, leading slashes and duplicate separators are dropped.
+// Control characters, and anything that would climb out of the root with
+// "..", are rejected rather than guessed around.
+func sanitizeKey(key string) (string, error) {
+	if strings.IndexFunc(key, unicode.IsControl) >= 0 {
+		return "", errUnsafeKey
+	}
+	key = strings.ReplaceAll(key, `\`, "/")
+	key = strings.TrimLeft(key, "/")
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return "", errUnsafeKey
+		}
+	}
+	key = path.Clean(key)
+	if key == "." || key == "" {
+		return "", errUnsafeKey
+	}
+	return key, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSanitizeKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		want    string
+		wantErr error
+	}{
+		{name: "plain key", key: "landscape/abc.mp4", want: "landscape/abc.mp4"},
+		{name: "leading slash", key: "/etc/passwd", want: "etc/passwd"},
+		{name: "several leading slashes", key: "///abc.mp4", want: "abc.mp4"},
+		{name: "duplicate separators", key: "a//b///c.mp4", want: "a/b/c.mp4"},
+		{name: "current directory segments", key: "./a/./b.mp4", want: "a/b.mp4"},
+		{name: "backslashes", key: `a\b.mp4`, want: "a/b.mp4"},
+		{name: "windows absolute path", key: `\windows\system32`, want: "windows/system32"},
+		{name: "dots inside a name", key: "a..b.mp4", want: "a..b.mp4"},
+		{name: "parent segment", key: "../secret", wantErr: errUnsafeKey},
+		{name: "parent segment in the middle", key: "a/../../secret", wantErr: errUnsafeKey},
+		{name: "parent segment that stays inside", key: "a/b/../c", wantErr: errUnsafeKey},
+		{name: "backslash traversal", key: `..\..\secret`, wantErr: errUnsafeKey},
+		{name: "absolute traversal", key: "/../secret", wantErr: errUnsafeKey},
+		{name: "trailing parent", key: "a/..", wantErr: errUnsafeKey},
+		{name: "null byte", key: "abc.mp4\x00.png", wantErr: errUnsafeKey},
+		{name: "newline", key: "abc\n.mp4", wantErr: errUnsafeKey},
+		{name: "delete character", key: "abc\x7f.mp4", wantErr: errUnsafeKey},
+		{name: "empty", key: "", wantErr: errUnsafeKey},
+		{name: "only slashes", key: "///", wantErr: errUnsafeKey},
+		{name: "only dot", key: ".", wantErr: errUnsafeKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sanitizeKey(tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("sanitizeKey(%q) err = %v, want %v", tt.key, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("sanitizeKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
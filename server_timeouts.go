@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// slowHandler lifts the server's read and write timeouts for routes that
+// legitimately take long, like large uploads that are processed before
+// responding or large downloads. Clients that are slow to send headers are
+// still cut off by ReadHeaderTimeout.
+func slowHandler(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		if err := rc.SetReadDeadline(time.Time{}); err != nil {
+			slog.Warn("Couldn't lift read deadline", "path", r.URL.Path, "err", err)
+		}
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			slog.Warn("Couldn't lift write deadline", "path", r.URL.Path, "err", err)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTimeoutServer serves handler with short timeouts, like main does with
+// the configured ones.
+func newTimeoutServer(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Config.ReadHeaderTimeout = 50 * time.Millisecond
+	srv.Config.ReadTimeout = 100 * time.Millisecond
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Config.IdleTimeout = time.Second
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestServerTimesOutSlowHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.Handler
+	}{
+		{name: "regular route", handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})},
+		{name: "slow route", handler: slowHandler(func(w http.ResponseWriter, r *http.Request) {})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTimeoutServer(t, tt.handler)
+			conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			// the request line arrives, the rest of the headers never do
+			if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\n"); err != nil {
+				t.Fatal(err)
+			}
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			start := time.Now()
+			_, err = bufio.NewReader(conn).ReadByte()
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatal("server kept waiting for the headers")
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("connection closed after %v, want about the header timeout", elapsed)
+			}
+		})
+	}
+}
+
+func TestSlowHandlerLiftsDeadlines(t *testing.T) {
+	tests := []struct {
+		name string
+		slow bool
+		// slowBody trickles the request body in, otherwise the handler
+		// takes long before responding
+		slowBody bool
+		wantOK   bool
+	}{
+		{name: "slow response on a regular route", wantOK: false},
+		{name: "slow response on a slow route", slow: true, wantOK: true},
+		{name: "slow body on a regular route", slowBody: true, wantOK: false},
+		{name: "slow body on a slow route", slow: true, slowBody: true, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusRequestTimeout)
+					return
+				}
+				if !tt.slowBody {
+					time.Sleep(250 * time.Millisecond)
+				}
+				io.WriteString(w, "done "+string(body))
+			}
+			var h http.Handler = http.HandlerFunc(handler)
+			if tt.slow {
+				h = slowHandler(handler)
+			}
+			srv := newTimeoutServer(t, h)
+
+			body, bodyWriter := io.Pipe()
+			go func() {
+				defer bodyWriter.Close()
+				if tt.slowBody {
+					for range 5 {
+						time.Sleep(50 * time.Millisecond)
+						if _, err := io.WriteString(bodyWriter, "x"); err != nil {
+							return
+						}
+					}
+					return
+				}
+				io.WriteString(bodyWriter, "xxxxx")
+			}()
+			req, err := http.NewRequest(http.MethodPost, srv.URL, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := srv.Client().Do(req)
+			ok := false
+			if err == nil {
+				data, readErr := io.ReadAll(res.Body)
+				res.Body.Close()
+				ok = readErr == nil && res.StatusCode == http.StatusOK && strings.HasPrefix(string(data), "done xxxxx")
+			}
+			if ok != tt.wantOK {
+				t.Errorf("completed = %v, want %v (err %v)", ok, tt.wantOK, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"context"
+)
+
+// storageContext bounds a storage operation by cfg.storageTimeout on top of
+// parent, normally the request's context, so neither a client hang-up nor a
+// stalled backend leaves the call running.
+func (cfg *apiConfig) storageContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, cfg.storageTimeout)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+func TestStorageContextCancels(t *testing.T) {
+	// the server holds every request until the test is over
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	client := s3.New(s3.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(srv.URL),
+		UsePathStyle:     true,
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		// hangUp cancels the parent context after a while, like a client
+		// going away mid request
+		hangUp  bool
+		op      func(ctx context.Context, store storage.Storage) error
+		wantErr error
+	}{
+		{
+			name:    "put canceled by the client",
+			timeout: time.Minute,
+			hangUp:  true,
+			op: func(ctx context.Context, store storage.Storage) error {
+				return store.Put(ctx, "a.mp4", strings.NewReader("data"), "video/mp4")
+			},
+			wantErr: context.Canceled,
+		},
+		{
+			name:    "head canceled by the client",
+			timeout: time.Minute,
+			hangUp:  true,
+			op: func(ctx context.Context, store storage.Storage) error {
+				_, err := store.Head(ctx, "a.mp4")
+				return err
+			},
+			wantErr: context.Canceled,
+		},
+		{
+			name:    "get past the storage timeout",
+			timeout: 20 * time.Millisecond,
+			op: func(ctx context.Context, store storage.Storage) error {
+				_, err := store.Get(ctx, "a.mp4", "")
+				return err
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{
+				storage:        storage.NewShardedS3Storage(client, []string{"bucket"}),
+				storageTimeout: tt.timeout,
+			}
+			parent, cancelParent := context.WithCancel(context.Background())
+			defer cancelParent()
+			if tt.hangUp {
+				time.AfterFunc(20*time.Millisecond, cancelParent)
+			}
+
+			ctx, cancel := cfg.storageContext(parent)
+			defer cancel()
+			start := time.Now()
+			err := tt.op(ctx, cfg.storage)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("operation took %v to give up", elapsed)
+			}
+		})
+	}
+}
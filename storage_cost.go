@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// costWindowDays is the period views are counted over to estimate a
+// month of egress.
+const costWindowDays = 30
+
+const bytesPerGB = 1 << 30
+
+// costRates are the provider's prices per GB: stored for a month, and
+// transferred out.
+type costRates struct {
+	storagePerGB float64
+	egressPerGB  float64
+}
+
+type costEstimate struct {
+	StorageBytes int64   `json:"storage_bytes"`
+	StorageCost  float64 `json:"storage_cost"`
+	EgressBytes  int64   `json:"egress_bytes"`
+	EgressCost   float64 `json:"egress_cost"`
+	MonthlyCost  float64 `json:"monthly_cost"`
+}
+
+// estimate prices a month of keeping storageBytes and serving egressBytes.
+func (rates costRates) estimate(storageBytes, egressBytes int64) costEstimate {
+	storageCost := float64(storageBytes) / bytesPerGB * rates.storagePerGB
+	egressCost := float64(egressBytes) / bytesPerGB * rates.egressPerGB
+	return costEstimate{
+		StorageBytes: storageBytes,
+		StorageCost:  storageCost,
+		EgressBytes:  egressBytes,
+		EgressCost:   egressCost,
+		MonthlyCost:  storageCost + egressCost,
+	}
+}
+
+type objectSize struct {
+	Key       string `json:"key"`
+	SizeBytes int64  `json:"size_bytes"`
+	// SharedBy counts the videos storing the object, this one included,
+	// when others reuse it. Each of them is charged its share.
+	SharedBy int `json:"shared_by,omitempty"`
+}
+
+// chargedBytes is the part of the object's size one of the videos
+// sharing it pays for.
+func (o objectSize) chargedBytes() int64 {
+	if o.SharedBy > 1 {
+		return o.SizeBytes / int64(o.SharedBy)
+	}
+	return o.SizeBytes
+}
+
+// objectShares counts, for each of video's keys, how many videos store
+// it. Keys only video has are left out.
+func (cfg *apiConfig) objectShares(video database.Video, keys []string) (map[string]int, error) {
+	sharing, err := cfg.sharingVideos(video)
+	if err != nil {
+		return nil, err
+	}
+	own := map[string]bool{}
+	for _, key := range keys {
+		own[key] = true
+	}
+	shares := map[string]int{}
+	for _, other := range sharing {
+		otherKeys, err := cfg.videoObjectKeys(other)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range otherKeys {
+			if !own[key] {
+				continue
+			}
+			if shares[key] == 0 {
+				shares[key] = 1
+			}
+			shares[key]++
+		}
+	}
+	return shares, nil
+}
+
+// objectSizes heads every key and returns the sizes of those that exist.
+// Keys that were never written, like the audio of a video nobody
+// extracted audio from, are left out.
+func (cfg *apiConfig) objectSizes(ctx context.Context, keys []string) ([]objectSize, error) {
+	sizes := []objectSize{}
+	for _, key := range keys {
+		headCtx, cancel := cfg.storageContext(ctx)
+		info, err := cfg.storage.Head(headCtx, key)
+		cancel()
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, objectSize{Key: key, SizeBytes: info.Size})
+	}
+	return sizes, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestCostRatesEstimate(t *testing.T) {
+	rates := costRates{storagePerGB: 0.023, egressPerGB: 0.09}
+
+	tests := []struct {
+		name         string
+		storageBytes int64
+		egressBytes  int64
+		want         costEstimate
+	}{
+		{name: "nothing", want: costEstimate{}},
+		{name: "a GB stored", storageBytes: bytesPerGB, want: costEstimate{StorageBytes: bytesPerGB, StorageCost: 0.023, MonthlyCost: 0.023}},
+		{name: "half a GB served", egressBytes: bytesPerGB / 2, want: costEstimate{EgressBytes: bytesPerGB / 2, EgressCost: 0.045, MonthlyCost: 0.045}},
+		{name: "both", storageBytes: 2 * bytesPerGB, egressBytes: 10 * bytesPerGB, want: costEstimate{
+			StorageBytes: 2 * bytesPerGB, StorageCost: 0.046,
+			EgressBytes: 10 * bytesPerGB, EgressCost: 0.9,
+			MonthlyCost: 0.946,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rates.estimate(tt.storageBytes, tt.egressBytes)
+			if got.StorageBytes != tt.want.StorageBytes || got.EgressBytes != tt.want.EgressBytes {
+				t.Errorf("bytes = %d stored, %d served, want %d, %d", got.StorageBytes, got.EgressBytes, tt.want.StorageBytes, tt.want.EgressBytes)
+			}
+			for _, c := range []struct {
+				field     string
+				got, want float64
+			}{
+				{"storage_cost", got.StorageCost, tt.want.StorageCost},
+				{"egress_cost", got.EgressCost, tt.want.EgressCost},
+				{"monthly_cost", got.MonthlyCost, tt.want.MonthlyCost},
+			} {
+				if diff := c.got - c.want; diff > 1e-9 || diff < -1e-9 {
+					t.Errorf("%s = %v, want %v", c.field, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestChargedBytes(t *testing.T) {
+	tests := []struct {
+		sharedBy int
+		want     int64
+	}{
+		{sharedBy: 0, want: 900},
+		{sharedBy: 1, want: 900},
+		{sharedBy: 2, want: 450},
+		{sharedBy: 3, want: 300},
+	}
+
+	for _, tt := range tests {
+		obj := objectSize{Key: "landscape/abc.mp4", SizeBytes: 900, SharedBy: tt.sharedBy}
+		if got := obj.chargedBytes(); got != tt.want {
+			t.Errorf("chargedBytes shared by %d = %d, want %d", tt.sharedBy, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerVideoCost(t *testing.T) {
+	cfg, mem := newTestConfig(t)
+	// a price per byte keeps the expected costs readable
+	cfg.costRates = costRates{storagePerGB: bytesPerGB, egressPerGB: 2 * bytesPerGB}
+
+	put := func(key string, size int) {
+		t.Helper()
+		if err := mem.Put(context.Background(), key, bytes.NewReader(make([]byte, size)), "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("landscape/abc.mp4", 1000)
+	put("landscape/abc_720p.mp4", 400)
+	put("captions/abc.en.vtt", 50)
+	put("thumbnails/abc.jpg", 30)
+	put("landscape/shared.mp4", 600)
+
+	video, ownerToken := newTestVideo(t, cfg)
+	videoURL := cfg.videoURL("landscape/abc.mp4")
+	thumbnailURL := cfg.videoURL("thumbnails/abc.jpg")
+	video.VideoURL = &videoURL
+	video.ThumbnailURL = &thumbnailURL
+	variants := []database.VideoVariant{
+		{Name: "720p", Width: 1280, Height: 720, URL: cfg.videoURL("landscape/abc_720p.mp4"), Status: database.VariantStatusReady},
+		{Name: "480p", Width: 854, Height: 480, Status: database.VariantStatusFailed},
+	}
+	captions := []database.VideoCaption{{Language: "en", Label: "English", URL: cfg.videoURL("captions/abc.en.vtt")}}
+	if err := cfg.db.UpdateVideoUpload(video, variants, captions); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.db.AddVideoViews([]database.VideoViewCount{
+		{VideoID: video.ID, Bucket: time.Now(), Count: 2},
+		{VideoID: video.ID, Bucket: time.Now().Add(-48 * time.Hour), Count: 1},
+		// outside the window
+		{VideoID: video.ID, Bucket: time.Now().Add(-60 * 24 * time.Hour), Count: 10},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// two videos reusing one stored upload each pay for half of it
+	shared, sharedToken := newTestVideo(t, cfg)
+	sharedURL := cfg.videoURL("landscape/shared.mp4")
+	shared.VideoURL = &sharedURL
+	if err := cfg.db.UpdateVideo(shared); err != nil {
+		t.Fatal(err)
+	}
+	reuse := newUserVideo(t, cfg, shared)
+	reuse.VideoURL = &sharedURL
+	if err := cfg.db.UpdateVideo(reuse); err != nil {
+		t.Fatal(err)
+	}
+
+	admin, adminToken := newTestVideo(t, cfg)
+	cfg.adminUserIDs[admin.UserID] = true
+	_, strangerToken := newTestVideo(t, cfg)
+
+	type costResponse struct {
+		costEstimate
+		Views   int64        `json:"views"`
+		Objects []objectSize `json:"objects"`
+	}
+
+	tests := []struct {
+		name     string
+		video    database.Video
+		token    string
+		wantCode int
+		want     costResponse
+	}{
+		{name: "owner", video: video, token: ownerToken, wantCode: http.StatusOK, want: costResponse{
+			// the preview GIF and audio were never made and don't count
+			costEstimate: costEstimate{
+				StorageBytes: 1000 + 30 + 400 + 50, StorageCost: 1480,
+				EgressBytes: 3 * 1000, EgressCost: 6000,
+				MonthlyCost: 7480,
+			},
+			Views: 3,
+			Objects: []objectSize{
+				{Key: "landscape/abc.mp4", SizeBytes: 1000},
+				{Key: "landscape/abc_720p.mp4", SizeBytes: 400},
+				{Key: "captions/abc.en.vtt", SizeBytes: 50},
+				{Key: "thumbnails/abc.jpg", SizeBytes: 30},
+			},
+		}},
+		{name: "admin", video: video, token: adminToken, wantCode: http.StatusOK},
+		{name: "shared upload", video: shared, token: sharedToken, wantCode: http.StatusOK, want: costResponse{
+			costEstimate: costEstimate{StorageBytes: 300, StorageCost: 300, MonthlyCost: 300},
+			Objects:      []objectSize{{Key: "landscape/shared.mp4", SizeBytes: 600, SharedBy: 2}},
+		}},
+		{name: "no token", video: video, wantCode: http.StatusUnauthorized},
+		{name: "stranger", video: video, token: strangerToken, wantCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newVideoRequest(http.MethodGet, "/api/videos/"+tt.video.ID.String()+"/cost", tt.video.ID, nil, tt.token)
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoCost(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.want.Objects == nil {
+				return
+			}
+			var got costResponse
+			decodeData(t, rec, &got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cost = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
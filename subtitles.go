@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// bcp47Languages maps the ISO 639-2 codes containers tag tracks with to the
+// shorter BCP-47 codes players expect. Both the bibliographic and the
+// terminology forms are listed where they differ.
+var bcp47Languages = map[string]string{
+	"ara": "ar",
+	"chi": "zh",
+	"zho": "zh",
+	"cze": "cs",
+	"ces": "cs",
+	"dan": "da",
+	"dut": "nl",
+	"nld": "nl",
+	"eng": "en",
+	"fin": "fi",
+	"fre": "fr",
+	"fra": "fr",
+	"ger": "de",
+	"deu": "de",
+	"gre": "el",
+	"ell": "el",
+	"heb": "he",
+	"hin": "hi",
+	"hun": "hu",
+	"ind": "id",
+	"ita": "it",
+	"jpn": "ja",
+	"kor": "ko",
+	"nor": "no",
+	"pol": "pl",
+	"por": "pt",
+	"rus": "ru",
+	"spa": "es",
+	"swe": "sv",
+	"tha": "th",
+	"tur": "tr",
+	"ukr": "uk",
+	"vie": "vi",
+}
+
+// bcp47Language turns a container's language tag into a BCP-47 code.
+// Languages without a two letter code keep their three letter one, which
+// BCP-47 accepts as is, and untagged tracks are "und".
+func bcp47Language(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "und"
+	}
+	if code, ok := bcp47Languages[tag]; ok {
+		return code
+	}
+	return tag
+}
+
+// extractSubtitle converts one embedded subtitle stream to WebVTT. The
+// caller removes the returned file.
+func (cfg *apiConfig) extractSubtitle(ctx context.Context, filePath string, streamIndex int) (string, error) {
+	outputFilePath, err := tempOutputPath(filePath, "tubely-subtitle-*.vtt")
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(
+		ctx,
+		cfg.ffmpegPath,
+		"-y",
+		"-i", filePath,
+		"-map", fmt.Sprintf("0:%d", streamIndex),
+		"-c:s", "webvtt",
+		"-f", "webvtt",
+		outputFilePath,
+	)
+
+	logCommand(cmd)
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputFilePath)
+		return "", err
+	}
+	return outputFilePath, nil
+}
+
+// subtitleKey places the n-th subtitle track next to the primary object,
+// named after the video since identical uploads can share the object, e.g.
+// landscape/<video id>_subtitles_0_en.vtt.
+func subtitleKey(key string, videoID uuid.UUID, n int, language string) string {
+	return path.Join(path.Dir(key), fmt.Sprintf("%s_subtitles_%d_%s.vtt", videoID, n, language))
+}
+
+// storeSubtitles extracts every embedded subtitle track of the processed
+// upload and stores it next to the primary object. Like the preview,
+// captions are a nice to have: tracks that can't be converted, such as
+// bitmap subtitles, are skipped. It returns the stored keys and captions.
+func (cfg *apiConfig) storeSubtitles(ctx context.Context, videoID uuid.UUID, sourcePath, primaryKey string, subtitles []subtitleStream, opts ...func(*storage.PutOptions)) ([]string, []database.VideoCaption) {
+	keys := []string{}
+	captions := []database.VideoCaption{}
+	for n, sub := range subtitles {
+		language := bcp47Language(sub.Language)
+		var vttPath string
+		err := cfg.workers.run(ctx, func() error {
+			var err error
+			vttPath, err = cfg.extractSubtitle(ctx, sourcePath, sub.Index)
+			return err
+		})
+		if err != nil {
+			slog.Warn("Couldn't extract subtitles", "video_id", videoID, "stream", sub.Index, "err", err)
+			continue
+		}
+
+		key := subtitleKey(primaryKey, videoID, n, language)
+		err = cfg.storeSubtitleFile(ctx, key, vttPath, opts...)
+		os.Remove(vttPath)
+		if err != nil {
+			slog.Warn("Couldn't store subtitles", "video_id", videoID, "stream", sub.Index, "err", err)
+			continue
+		}
+
+		keys = append(keys, key)
+		captions = append(captions, database.VideoCaption{
+			Language: language,
+			Label:    sub.Title,
+			URL:      cfg.videoURL(key),
+		})
+	}
+	return keys, captions
+}
+
+func (cfg *apiConfig) storeSubtitleFile(ctx context.Context, key, vttPath string, opts ...func(*storage.PutOptions)) error {
+	f, err := os.Open(vttPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	length, err := contentLength(f)
+	if err != nil {
+		return err
+	}
+	return cfg.storePromoted(ctx, key, f, "text/vtt", append(opts, length)...)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBCP47Language(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{tag: "eng", want: "en"},
+		{tag: "ger", want: "de"},
+		{tag: "deu", want: "de"},
+		{tag: "FRE", want: "fr"},
+		{tag: " spa ", want: "es"},
+		{tag: "", want: "und"},
+		{tag: "und", want: "und"},
+		{tag: "yue", want: "yue"},
+		{tag: "en", want: "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := bcp47Language(tt.tag); got != tt.want {
+				t.Errorf("bcp47Language(%q) = %q, want %q", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubtitleKey(t *testing.T) {
+	videoID := uuid.MustParse("7b8e4a36-4a39-4a38-9c3e-1f5d6a2b9c10")
+	tests := []struct {
+		key      string
+		n        int
+		language string
+		want     string
+	}{
+		{key: "landscape/abc.mp4", n: 0, language: "en", want: "landscape/" + videoID.String() + "_subtitles_0_en.vtt"},
+		{key: "tenants/acme/portrait/abc.mp4", n: 2, language: "und", want: "tenants/acme/portrait/" + videoID.String() + "_subtitles_2_und.vtt"},
+		{key: "abc.mp4", n: 1, language: "de", want: videoID.String() + "_subtitles_1_de.vtt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := subtitleKey(tt.key, videoID, tt.n, tt.language); got != tt.want {
+				t.Errorf("subtitleKey(%q, %d, %q) = %q, want %q", tt.key, tt.n, tt.language, got, tt.want)
+			}
+		})
+	}
+}
+
+// probeWithSubtitles is fakeProbe plus subtitle streams, given as ffprobe
+// stream JSON, from index 2 on.
+func probeWithSubtitles(streams ...string) string {
+	var b strings.Builder
+	for i, s := range streams {
+		fmt.Fprintf(&b, `, {"index": %d, "codec_type": "subtitle", %s}`, i+2, s)
+	}
+	return strings.Replace(fakeProbe(320, 180), `"codec_name": "aac"}`, `"codec_name": "aac"}`+b.String(), 1)
+}
+
+func TestHandlerUploadVideoSubtitles(t *testing.T) {
+	tests := []struct {
+		name    string
+		streams []string
+		// failStream makes extracting that stream index fail, like a bitmap
+		// track would
+		failStream   int
+		wantCaptions [][2]string
+	}{
+		{name: "no subtitles"},
+		{
+			name:         "one subtitle track",
+			streams:      []string{`"codec_name": "mov_text", "tags": {"language": "ger", "title": "Deutsch"}`},
+			wantCaptions: [][2]string{{"de", "Deutsch"}},
+		},
+		{
+			name: "untagged and unconvertible tracks",
+			streams: []string{
+				`"codec_name": "mov_text"`,
+				`"codec_name": "dvd_subtitle", "tags": {"language": "eng"}`,
+			},
+			failStream:   3,
+			wantCaptions: [][2]string{{"und", ""}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			installFakeFFmpeg(t, cfg, probeWithSubtitles(tt.streams...))
+			logPath := filepath.Join(t.TempDir(), "ffmpeg.log")
+			copyFFmpeg := cfg.ffmpegPath
+			cfg.ffmpegPath = fakeCommand(t, "ffmpeg", fmt.Sprintf(`echo "$@" >> %s
+for arg; do out=$arg; done
+case "$out" in
+*.vtt)
+	case "$*" in *"-map 0:%d "*) exit 1 ;; esac
+	printf 'WEBVTT\n\n00:00.000 --> 00:01.000\nHallo\n' > "$out" ;;
+*) exec %s "$@" ;;
+esac
+`, logPath, tt.failStream, copyFFmpeg))
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+
+			log, _ := os.ReadFile(logPath)
+			for i := range tt.streams {
+				if want := fmt.Sprintf("-map 0:%d -c:s webvtt", i+2); !strings.Contains(string(log), want) {
+					t.Errorf("no ffmpeg command with %s in %s", want, log)
+				}
+			}
+			if len(tt.streams) == 0 && strings.Contains(string(log), "webvtt") {
+				t.Errorf("subtitles extracted from a video without any: %s", log)
+			}
+
+			rec = httptest.NewRecorder()
+			cfg.handlerVideoGet(rec, newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String(), video.ID, nil, token))
+			var resp videoResponse
+			decodeData(t, rec, &resp)
+			if len(resp.Captions) != len(tt.wantCaptions) {
+				t.Fatalf("captions = %+v, want %v", resp.Captions, tt.wantCaptions)
+			}
+			for i, caption := range resp.Captions {
+				if caption.Language != tt.wantCaptions[i][0] || caption.Label != tt.wantCaptions[i][1] {
+					t.Errorf("caption %d = %s %q, want %s %q", i, caption.Language, caption.Label, tt.wantCaptions[i][0], tt.wantCaptions[i][1])
+				}
+				key, ok := cfg.videoKeyFromURL(caption.URL)
+				if !ok {
+					t.Fatalf("caption URL %s isn't ours", caption.URL)
+				}
+				obj, ok := mem.Lookup(key)
+				if !ok {
+					t.Fatalf("caption %s wasn't stored", key)
+				}
+				if obj.ContentType != "text/vtt" || !strings.HasPrefix(string(obj.Data), "WEBVTT") {
+					t.Errorf("caption object = %q of %s, want WebVTT", obj.Data, obj.ContentType)
+				}
+				if !strings.HasSuffix(key, fmt.Sprintf("_subtitles_%d_%s.vtt", i, caption.Language)) {
+					t.Errorf("caption key = %s", key)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// tempCleanup collects temp files to remove in one deferred call, which
+// also runs when the handler panics. Files that are already gone are fine,
+// steps hand their output on and sometimes remove it themselves. It's safe
+// for concurrent use, variants are encoded in parallel.
+type tempCleanup struct {
+	mu      sync.Mutex
+	entries []tempEntry
+}
+
+type tempEntry struct {
+	path string
+	// file, if set, is closed before path is removed
+	file *os.File
+}
+
+func (c *tempCleanup) track(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, tempEntry{path: path})
+}
+
+// trackFile tracks an open temp file, which is closed before it's removed.
+func (c *tempCleanup) trackFile(f *os.File) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, tempEntry{path: f.Name(), file: f})
+}
+
+// remove deletes a tracked file right away, for steps done with their
+// output before the rest of the upload is.
+func (c *tempCleanup) remove(path string) {
+	removeTemp(path)
+}
+
+// handOff moves every tracked file to a new tempCleanup, for work that
+// carries on after the function that tracked them returns. Running the old
+// one afterwards removes nothing.
+func (c *tempCleanup) handOff() *tempCleanup {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	next := &tempCleanup{entries: c.entries}
+	c.entries = nil
+	return next
+}
+
+// run closes and removes the tracked files, newest first.
+func (c *tempCleanup) run() {
+	c.mu.Lock()
+	entries := c.entries
+	c.entries = nil
+	c.mu.Unlock()
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].file != nil {
+			entries[i].file.Close()
+		}
+		removeTemp(entries[i].path)
+	}
+}
+
+func removeTemp(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Couldn't remove temp file", "path", path, "err", err)
+	}
+}
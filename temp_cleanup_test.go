@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+func TestTempCleanup(t *testing.T) {
+	tests := []struct {
+		name string
+		// use tracks a, b and the open file f, and returns the cleanup
+		// that should remove them
+		use       func(c *tempCleanup, a, b string, f *os.File) *tempCleanup
+		wantAlive []string
+	}{
+		{name: "run removes everything", use: func(c *tempCleanup, a, b string, f *os.File) *tempCleanup {
+			c.track(a)
+			c.track(b)
+			c.trackFile(f)
+			return c
+		}},
+		{name: "files already gone are fine", use: func(c *tempCleanup, a, b string, f *os.File) *tempCleanup {
+			c.track(a)
+			c.track(b)
+			c.trackFile(f)
+			c.remove(a)
+			os.Remove(b)
+			return c
+		}},
+		{name: "handed off files stay", use: func(c *tempCleanup, a, b string, f *os.File) *tempCleanup {
+			c.track(a)
+			next := c.handOff()
+			c.track(b)
+			c.trackFile(f)
+			c.run()
+			return next
+		}, wantAlive: []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			paths := map[string]string{}
+			for _, name := range []string{"a", "b"} {
+				paths[name] = filepath.Join(dir, name)
+				if err := os.WriteFile(paths[name], []byte(name), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			f, err := os.Create(filepath.Join(dir, "c"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths["c"] = f.Name()
+
+			c := &tempCleanup{}
+			later := tt.use(c, paths["a"], paths["b"], f)
+			for _, name := range tt.wantAlive {
+				if _, err := os.Stat(paths[name]); err != nil {
+					t.Errorf("%s before the final run: %v", name, err)
+				}
+			}
+			later.run()
+			for name, path := range paths {
+				if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("%s left behind: %v", name, err)
+				}
+			}
+			if _, err := f.Write([]byte("x")); err == nil {
+				t.Error("tracked file is still open")
+			}
+		})
+	}
+}
+
+// installFailingFFmpeg is installFakeFFmpeg with ffmpeg failing whenever its
+// arguments contain failOn, after the output has been written.
+func installFailingFFmpeg(t *testing.T, cfg *apiConfig, failOn string) {
+	t.Helper()
+	installFakeFFmpeg(t, cfg, fakeProbe(1920, 1080))
+	cfg.ffmpegPath = fakeCommand(t, "ffmpeg", `in=
+prev=
+for arg; do
+	if [ "$prev" = "-i" ] && [ -z "$in" ]; then in=$arg; fi
+	prev=$arg
+done
+cp "$in" "$arg"
+case "$*" in
+*"`+failOn+`"*) exit 1 ;;
+esac
+`)
+}
+
+type panickingStorage struct {
+	storage.Storage
+}
+
+func (s *panickingStorage) Put(ctx context.Context, key string, r io.Reader, contentType string, opts ...func(*storage.PutOptions)) error {
+	panic("injected panic")
+}
+
+func TestHandlerUploadVideoTempCleanup(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(t *testing.T, cfg *apiConfig)
+		wantCode  int
+		wantPanic bool
+	}{
+		{name: "probe fails", wantCode: http.StatusInternalServerError, setup: func(t *testing.T, cfg *apiConfig) {
+			installFakeFFmpeg(t, cfg, fakeProbe(1920, 1080))
+			cfg.ffprobePath = fakeCommand(t, "ffprobe", "exit 1\n")
+		}},
+		{name: "faststart fails", wantCode: http.StatusInternalServerError, setup: func(t *testing.T, cfg *apiConfig) {
+			cfg.faststartStrict = true
+			installFailingFFmpeg(t, cfg, "-c copy")
+		}},
+		{name: "variant encode fails", wantCode: http.StatusInternalServerError, setup: func(t *testing.T, cfg *apiConfig) {
+			cfg.variantsStrict = true
+			// one at a time, killing the fake ffmpeg could orphan its cp
+			cfg.variantParallelism = 1
+			installFailingFFmpeg(t, cfg, "libx264")
+		}},
+		{name: "storage fails", wantCode: http.StatusInternalServerError, setup: func(t *testing.T, cfg *apiConfig) {
+			installFakeFFmpeg(t, cfg, fakeProbe(1920, 1080))
+			cfg.storage = &faultyStorage{Storage: cfg.storage, putErr: errors.New("injected failure")}
+		}},
+		{name: "handler panics", wantPanic: true, setup: func(t *testing.T, cfg *apiConfig) {
+			installFakeFFmpeg(t, cfg, fakeProbe(1920, 1080))
+			cfg.storage = &panickingStorage{Storage: cfg.storage}
+		}},
+		{name: "success", wantCode: http.StatusOK, setup: func(t *testing.T, cfg *apiConfig) {
+			installFakeFFmpeg(t, cfg, fakeProbe(1920, 1080))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			t.Setenv("TMPDIR", tmp)
+			cfg, _ := newTestConfig(t)
+			tt.setup(t, cfg)
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			panicked := func() (panicked bool) {
+				defer func() { panicked = recover() != nil }()
+				cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil))
+				return false
+			}()
+			if panicked != tt.wantPanic {
+				t.Fatalf("panicked = %v, want %v", panicked, tt.wantPanic)
+			}
+			if !tt.wantPanic && rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+
+			leftovers, err := os.ReadDir(tmp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range leftovers {
+				t.Errorf("temp file left behind: %s", entry.Name())
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tempFilePrefix starts the name of every temp file uploads and processing
+// create, see tempOutputPath's callers.
+const tempFilePrefix = "tubely-"
+
+// sweepTempFiles removes temp files a crashed process left in dir. Only
+// files, not the tus and transcode work directories, are considered, and
+// only those untouched for maxAge: another instance sharing dir may still
+// be working on the younger ones. It returns how many files were removed.
+func sweepTempFiles(dir string, maxAge time.Duration, now time.Time) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasPrefix(entry.Name(), tempFilePrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		if now.Sub(info.ModTime()) < maxAge {
+			continue
+		}
+		err = os.Remove(filepath.Join(dir, entry.Name()))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		if err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSweepTempFiles(t *testing.T) {
+	now := time.Now()
+	stale := now.Add(-2 * time.Hour)
+	fresh := now.Add(-time.Minute)
+
+	tests := []struct {
+		name    string
+		files   map[string]time.Time
+		dirs    map[string]time.Time
+		maxAge  time.Duration
+		want    int
+		wantOut []string
+	}{
+		{
+			name: "stale upload files go, fresh ones stay",
+			files: map[string]time.Time{
+				"tubely-upload.mp41234":            stale,
+				"tubely-processed-5678.mp4":        stale,
+				"tubely-upload.mp49999":            fresh,
+				"tubely-variant-42.mp4.processing": fresh,
+			},
+			maxAge:  time.Hour,
+			want:    2,
+			wantOut: []string{"tubely-upload.mp49999", "tubely-variant-42.mp4.processing"},
+		},
+		{
+			name:    "other programs' files stay",
+			files:   map[string]time.Time{"upload.mp4": stale, "go-build123": stale},
+			maxAge:  time.Hour,
+			want:    0,
+			wantOut: []string{"go-build123", "upload.mp4"},
+		},
+		{
+			name:    "work directories stay",
+			dirs:    map[string]time.Time{"tubely-tus": stale, "tubely-transcode": stale},
+			maxAge:  time.Hour,
+			want:    0,
+			wantOut: []string{"tubely-transcode", "tubely-tus"},
+		},
+		{
+			name:    "age boundary",
+			files:   map[string]time.Time{"tubely-upload.mp41": now.Add(-time.Hour)},
+			maxAge:  time.Hour,
+			want:    1,
+			wantOut: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, modTime := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.WriteFile(path, []byte("partial"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, modTime, modTime); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, modTime := range tt.dirs {
+				path := filepath.Join(dir, name)
+				if err := os.Mkdir(path, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, modTime, modTime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			removed, err := sweepTempFiles(dir, tt.maxAge, now)
+			if err != nil {
+				t.Fatalf("sweepTempFiles: %v", err)
+			}
+			if removed != tt.want {
+				t.Errorf("removed = %d, want %d", removed, tt.want)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			left := []string{}
+			for _, entry := range entries {
+				left = append(left, entry.Name())
+			}
+			if !slices.Equal(left, tt.wantOut) {
+				t.Errorf("left behind %v, want %v", left, tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestSweepTempFilesMissingDir(t *testing.T) {
+	if _, err := sweepTempFiles(filepath.Join(t.TempDir(), "missing"), time.Hour, time.Now()); err == nil {
+		t.Error("sweeping a missing dir succeeded, want an error")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// tenantIDPattern keeps tenant IDs usable as a single key segment, and in
+// bucket policies matching on it.
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// userTenant returns the tenant a user belongs to, empty for users outside
+// any tenant.
+func (cfg *apiConfig) userTenant(userID uuid.UUID) (string, error) {
+	user, err := cfg.db.GetUser(userID)
+	if err != nil || user == nil {
+		return "", err
+	}
+	return user.TenantID, nil
+}
+
+// tenantKeyPrefix is prepended to every object key of a tenant's videos so
+// their objects stay under tenants/{tenantID}/ and can be fenced off by
+// bucket policy.
+func tenantKeyPrefix(tenantID string) string {
+	if tenantID == "" {
+		return ""
+	}
+	return "tenants/" + tenantID + "/"
+}
+
+// tenantScope returns key's tenants/{tenantID}/ prefix, along with the
+// bucket in front of it if any, so objects derived from a video's can be
+// fenced off with it. It's empty for keys outside any tenant.
+func tenantScope(key string) string {
+	segments := strings.Split(key, "/")
+	// the tenant prefix comes first, or second behind a bucket
+	for i := 0; i < 2 && i+2 < len(segments); i++ {
+		if segments[i] == "tenants" {
+			return strings.Join(segments[:i+2], "/") + "/"
+		}
+	}
+	return ""
+}
+
+// canInspect reports whether userID may look at the video's internals: its
+// owner can, and so can admins, but only within their own tenant.
+func (cfg *apiConfig) canInspect(userID uuid.UUID, video database.Video) (bool, error) {
+	if video.UserID == userID {
+		return true, nil
+	}
+	if !cfg.isAdmin(userID) {
+		return false, nil
+	}
+	callerTenant, err := cfg.userTenant(userID)
+	if err != nil {
+		return false, err
+	}
+	ownerTenant, err := cfg.userTenant(video.UserID)
+	if err != nil {
+		return false, err
+	}
+	return callerTenant == ownerTenant, nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// newTenantVideo is newTestVideo for a user in tenantID.
+func newTenantVideo(t *testing.T, cfg *apiConfig, tenantID string) (database.Video, string) {
+	t.Helper()
+	video, token := newTestVideo(t, cfg)
+	if err := cfg.db.SetUserTenant(video.UserID, tenantID); err != nil {
+		t.Fatal(err)
+	}
+	return video, token
+}
+
+func TestTenantKeyPrefix(t *testing.T) {
+	tests := []struct {
+		tenantID string
+		want     string
+	}{
+		{tenantID: "", want: ""},
+		{tenantID: "acme", want: "tenants/acme/"},
+		{tenantID: "acme-eu-1", want: "tenants/acme-eu-1/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tenantID, func(t *testing.T) {
+			if got := tenantKeyPrefix(tt.tenantID); got != tt.want {
+				t.Errorf("tenantKeyPrefix(%q) = %q, want %q", tt.tenantID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTenantScope(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "landscape/a.mp4", want: ""},
+		{key: "tenants/acme/landscape/a.mp4", want: "tenants/acme/"},
+		{key: "bucket-b/tenants/acme/landscape/a.mp4", want: "bucket-b/tenants/acme/"},
+		{key: "bucket-b/landscape/a.mp4", want: ""},
+		{key: "a/b/tenants/acme/a.mp4", want: ""},
+		{key: "tenants/acme", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := tenantScope(tt.key); got != tt.want {
+				t.Errorf("tenantScope(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoTenantPrefix(t *testing.T) {
+	tests := []struct {
+		tenantID   string
+		wantPrefix string
+	}{
+		{tenantID: "", wantPrefix: "landscape/"},
+		{tenantID: "acme", wantPrefix: "tenants/acme/landscape/"},
+		{tenantID: "globex", wantPrefix: "tenants/globex/landscape/"},
+	}
+
+	for _, tt := range tests {
+		t.Run("tenant "+tt.tenantID, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.preserveOriginals = true
+			installFakeFFmpeg(t, cfg, fakeProbe(1280, 720))
+			video, token := newTenantVideo(t, cfg, tt.tenantID)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, ok := cfg.videoKeyFromURL(*stored.VideoURL)
+			if !ok || !strings.HasPrefix(key, tt.wantPrefix) {
+				t.Errorf("video key = %q, want it under %s", key, tt.wantPrefix)
+			}
+			// everything derived from the video stays in the tenant too
+			for _, k := range mem.Keys() {
+				if !strings.HasPrefix(k, tenantKeyPrefix(tt.tenantID)) {
+					t.Errorf("object %s is outside tenant %q", k, tt.tenantID)
+				}
+			}
+		})
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	tests := []struct {
+		name         string
+		callerTenant string
+		ownerTenant  string
+		admin        bool
+		wantCode     int
+	}{
+		{name: "admin in the same tenant", callerTenant: "acme", ownerTenant: "acme", admin: true, wantCode: http.StatusOK},
+		{name: "admin in another tenant", callerTenant: "globex", ownerTenant: "acme", admin: true, wantCode: http.StatusForbidden},
+		{name: "admin outside any tenant", ownerTenant: "acme", admin: true, wantCode: http.StatusForbidden},
+		{name: "admins without tenants", admin: true, wantCode: http.StatusOK},
+		{name: "user in the same tenant", callerTenant: "acme", ownerTenant: "acme", wantCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			video, _ := newTenantVideo(t, cfg, tt.ownerTenant)
+			video.ProbeJSON = fakeProbe(1280, 720)
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+			caller, token := newTenantVideo(t, cfg, tt.callerTenant)
+			cfg.adminUserIDs[caller.UserID] = tt.admin
+
+			allowed, err := cfg.canInspect(caller.UserID, video)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != (tt.wantCode == http.StatusOK) {
+				t.Errorf("canInspect = %v, want %v", allowed, tt.wantCode == http.StatusOK)
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoProbe(rec, newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/probe", video.ID, nil, token))
+			if rec.Code != tt.wantCode {
+				t.Errorf("probe status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
+
+func TestHandlerDirectUploadCommitTenant(t *testing.T) {
+	tests := []struct {
+		name      string
+		keyTenant string
+		wantCode  int
+	}{
+		{name: "own tenant", keyTenant: "acme", wantCode: http.StatusOK},
+		{name: "another tenant", keyTenant: "globex", wantCode: http.StatusBadRequest},
+		{name: "outside the tenant", keyTenant: "", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			video, token := newTenantVideo(t, cfg, "acme")
+			key := directUploadPrefix(tt.keyTenant, video.ID) + "abc.mp4"
+			mem.Put(context.Background(), key, strings.NewReader("fake video"), "video/mp4")
+
+			req := newVideoRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/direct-upload/commit", video.ID, strings.NewReader(`{"key": "`+key+`"}`), token)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cfg.handlerDirectUploadCommit(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if _, kept := mem.Lookup(key); kept != (tt.wantCode != http.StatusOK) {
+				t.Errorf("uploaded object kept = %v, want only another tenant's kept", kept)
+			}
+		})
+	}
+}
+
+func TestHandlerAdminUserTenant(t *testing.T) {
+	tests := []struct {
+		name         string
+		admin        bool
+		callerTenant string
+		self         bool
+		unknown      bool
+		body         string
+		wantCode     int
+		wantTenant   string
+	}{
+		{name: "assigns a tenant", admin: true, body: `{"tenant_id":"acme"}`, wantCode: http.StatusNoContent, wantTenant: "acme"},
+		{name: "removes the tenant", admin: true, body: `{"tenant_id":""}`, wantCode: http.StatusNoContent},
+		{name: "invalid tenant", admin: true, body: `{"tenant_id":"../acme"}`, wantCode: http.StatusBadRequest, wantTenant: "old"},
+		{name: "uppercase tenant", admin: true, body: `{"tenant_id":"Acme"}`, wantCode: http.StatusBadRequest, wantTenant: "old"},
+		{name: "unknown user", admin: true, unknown: true, body: `{"tenant_id":"acme"}`, wantCode: http.StatusNotFound, wantTenant: "old"},
+		{name: "not an admin", body: `{"tenant_id":"acme"}`, wantCode: http.StatusForbidden, wantTenant: "old"},
+		{name: "own tenant's user", admin: true, callerTenant: "old", body: `{"tenant_id":"old"}`, wantCode: http.StatusNoContent, wantTenant: "old"},
+		{name: "into another tenant", admin: true, callerTenant: "old", body: `{"tenant_id":"acme"}`, wantCode: http.StatusForbidden, wantTenant: "old"},
+		{name: "out of the tenant", admin: true, callerTenant: "old", body: `{"tenant_id":""}`, wantCode: http.StatusForbidden, wantTenant: "old"},
+		{name: "another tenant's user", admin: true, callerTenant: "acme", body: `{"tenant_id":"acme"}`, wantCode: http.StatusForbidden, wantTenant: "old"},
+		{name: "themselves", admin: true, self: true, body: `{"tenant_id":"acme"}`, wantCode: http.StatusForbidden, wantTenant: "old"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			target, _ := newTenantVideo(t, cfg, "old")
+			caller, token := newTenantVideo(t, cfg, tt.callerTenant)
+			if tt.self {
+				caller, token = newTenantVideo(t, cfg, "old")
+				target = caller
+			}
+			cfg.adminUserIDs[caller.UserID] = tt.admin
+			targetID := target.UserID
+			if tt.unknown {
+				targetID = uuid.New()
+			}
+
+			req := httptest.NewRequest(http.MethodPut, "/api/admin/users/"+targetID.String()+"/tenant", strings.NewReader(tt.body))
+			req.SetPathValue("userID", targetID.String())
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cfg.handlerAdminUserTenant(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			tenant, err := cfg.userTenant(target.UserID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tenant != tt.wantTenant {
+				t.Errorf("tenant = %q, want %q", tenant, tt.wantTenant)
+			}
+		})
+	}
+}
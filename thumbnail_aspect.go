@@ -0,0 +1,23 @@
+package main
+
+import "math"
+
+// aspectRatios maps the labels stored by getVideoAspectRatio to their
+// width/height ratio. "other" is deliberately missing, there is nothing to
+// compare against.
+var aspectRatios = map[string]float64{
+	"16:9": 16.0 / 9.0,
+	"9:16": 9.0 / 16.0,
+}
+
+// thumbnailAspectMismatch reports whether an image of the given size is
+// further than tolerance (relative to the video's ratio) from the video's
+// stored aspect ratio.
+func thumbnailAspectMismatch(width, height int, videoAspect string, tolerance float64) bool {
+	want, ok := aspectRatios[videoAspect]
+	if !ok || width <= 0 || height <= 0 {
+		return false
+	}
+	got := float64(width) / float64(height)
+	return math.Abs(got-want)/want > tolerance
+}
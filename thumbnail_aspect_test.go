@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestThumbnailAspectMismatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		videoAspect   string
+		tolerance     float64
+		want          bool
+	}{
+		{name: "exact landscape", width: 1280, height: 720, videoAspect: "16:9", tolerance: 0.05},
+		{name: "exact portrait", width: 720, height: 1280, videoAspect: "9:16", tolerance: 0.05},
+		{name: "within tolerance", width: 1280, height: 740, videoAspect: "16:9", tolerance: 0.05},
+		{name: "square for landscape", width: 720, height: 720, videoAspect: "16:9", tolerance: 0.05, want: true},
+		{name: "landscape for portrait", width: 1280, height: 720, videoAspect: "9:16", tolerance: 0.05, want: true},
+		{name: "zero tolerance", width: 1280, height: 721, videoAspect: "16:9", tolerance: 0, want: true},
+		{name: "other has nothing to compare", width: 100, height: 900, videoAspect: "other", tolerance: 0.05},
+		{name: "unknown aspect", width: 100, height: 900, videoAspect: "", tolerance: 0.05},
+		{name: "empty image", width: 0, height: 0, videoAspect: "16:9", tolerance: 0.05},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := thumbnailAspectMismatch(tt.width, tt.height, tt.videoAspect, tt.tolerance)
+			if got != tt.want {
+				t.Errorf("thumbnailAspectMismatch(%d, %d, %q, %v) = %v, want %v",
+					tt.width, tt.height, tt.videoAspect, tt.tolerance, got, tt.want)
+			}
+		})
+	}
+}
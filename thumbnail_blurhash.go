@@ -0,0 +1,19 @@
+package main
+
+import (
+	"image"
+	"log/slog"
+
+	"github.com/buckket/go-blurhash"
+)
+
+// thumbnailBlurHash computes a BlurHash placeholder for an image. Failures
+// aren't fatal to an upload, they just leave the placeholder empty.
+func thumbnailBlurHash(img image.Image) string {
+	hash, err := blurhash.Encode(4, 3, img)
+	if err != nil {
+		slog.Warn("Couldn't compute blurhash", "err", err)
+		return ""
+	}
+	return hash
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/buckket/go-blurhash"
+)
+
+func solidImage(width, height int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+	return img
+}
+
+func TestThumbnailBlurHash(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		want color.RGBA
+	}{
+		{name: "red", img: solidImage(64, 36, color.RGBA{255, 0, 0, 255}), want: color.RGBA{255, 0, 0, 255}},
+		{name: "blue portrait", img: solidImage(36, 64, color.RGBA{0, 0, 255, 255}), want: color.RGBA{0, 0, 255, 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := thumbnailBlurHash(tt.img)
+			// 4x3 components take 6 characters plus 2 per AC component
+			if len(hash) != 28 {
+				t.Fatalf("hash %q has %d characters, want 28", hash, len(hash))
+			}
+			decoded, err := blurhash.Decode(hash, 4, 4, 1)
+			if err != nil {
+				t.Fatalf("hash %q doesn't decode: %v", hash, err)
+			}
+			r, g, b, _ := decoded.At(1, 1).RGBA()
+			got := color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 255}
+			if absDiff(got.R, tt.want.R) > 8 || absDiff(got.G, tt.want.G) > 8 || absDiff(got.B, tt.want.B) > 8 {
+				t.Errorf("placeholder color = %v, want about %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// cropAspect is a target width:height ratio thumbnails are center-cropped
+// to. The zero value disables cropping.
+type cropAspect struct {
+	width  int
+	height int
+}
+
+// parseCropAspect reads a ratio such as "16:9", an empty string disables
+// cropping.
+func parseCropAspect(spec string) (cropAspect, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return cropAspect{}, nil
+	}
+	w, h, ok := strings.Cut(spec, ":")
+	width, werr := strconv.Atoi(w)
+	height, herr := strconv.Atoi(h)
+	if !ok || werr != nil || herr != nil || width <= 0 || height <= 0 {
+		return cropAspect{}, fmt.Errorf("invalid aspect ratio %q, expected W:H", spec)
+	}
+	return cropAspect{width: width, height: height}, nil
+}
+
+func (a cropAspect) enabled() bool {
+	return a.width > 0 && a.height > 0
+}
+
+// rect returns the largest centered rectangle of bounds with the target
+// aspect ratio.
+func (a cropAspect) rect(bounds image.Rectangle) image.Rectangle {
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	width, height := srcWidth, srcWidth*a.height/a.width
+	if height > srcHeight {
+		width, height = srcHeight*a.width/a.height, srcHeight
+	}
+	x0 := bounds.Min.X + (srcWidth-width)/2
+	y0 := bounds.Min.Y + (srcHeight-height)/2
+	return image.Rect(x0, y0, x0+width, y0+height)
+}
+
+// centerCrop copies the centered a-shaped part of img into a new image.
+func centerCrop(img image.Image, a cropAspect) image.Image {
+	r := a.rect(img.Bounds())
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst
+}
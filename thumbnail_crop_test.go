@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCropAspect(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    cropAspect
+		wantErr bool
+	}{
+		{spec: "", want: cropAspect{}},
+		{spec: "16:9", want: cropAspect{width: 16, height: 9}},
+		{spec: " 4:3 ", want: cropAspect{width: 4, height: 3}},
+		{spec: "16x9", wantErr: true},
+		{spec: "16:", wantErr: true},
+		{spec: "0:9", wantErr: true},
+		{spec: "-16:9", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseCropAspect(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCropAspect(%q) err = %v, want error %v", tt.spec, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseCropAspect(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCropAspectRect(t *testing.T) {
+	wide := cropAspect{width: 16, height: 9}
+	tests := []struct {
+		name   string
+		aspect cropAspect
+		bounds image.Rectangle
+		want   image.Rectangle
+	}{
+		{name: "square to 16:9", aspect: wide, bounds: image.Rect(0, 0, 1000, 1000), want: image.Rect(0, 219, 1000, 781)},
+		{name: "portrait to 16:9", aspect: wide, bounds: image.Rect(0, 0, 720, 1280), want: image.Rect(0, 437, 720, 842)},
+		{name: "ultrawide to 16:9", aspect: wide, bounds: image.Rect(0, 0, 2560, 720), want: image.Rect(640, 0, 1920, 720)},
+		{name: "already 16:9", aspect: wide, bounds: image.Rect(0, 0, 1280, 720), want: image.Rect(0, 0, 1280, 720)},
+		{name: "offset bounds", aspect: cropAspect{width: 1, height: 1}, bounds: image.Rect(10, 20, 110, 70), want: image.Rect(35, 20, 85, 70)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.aspect.rect(tt.bounds); got != tt.want {
+				t.Errorf("rect(%v) = %v, want %v", tt.bounds, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCenterCrop(t *testing.T) {
+	// a square with a red band across its middle rows, which is all a
+	// 16:9 center crop keeps
+	src := image.NewRGBA(image.Rect(0, 0, 160, 160))
+	red := color.RGBA{255, 0, 0, 255}
+	for y := 35; y < 125; y++ {
+		for x := 0; x < 160; x++ {
+			src.Set(x, y, red)
+		}
+	}
+
+	got := centerCrop(src, cropAspect{width: 16, height: 9})
+	if got.Bounds() != image.Rect(0, 0, 160, 90) {
+		t.Fatalf("bounds = %v, want 160x90", got.Bounds())
+	}
+	for _, p := range []image.Point{{0, 0}, {80, 45}, {159, 89}} {
+		if c := color.RGBAModel.Convert(got.At(p.X, p.Y)); c != red {
+			t.Errorf("pixel %v = %v, want %v", p, c, red)
+		}
+	}
+}
+
+func TestHandlerUploadThumbnailCrop(t *testing.T) {
+	tests := []struct {
+		name          string
+		crop          cropAspect
+		width, height int
+		wantBounds    image.Rectangle
+	}{
+		{name: "square cropped to 16:9", crop: cropAspect{width: 16, height: 9}, width: 900, height: 900, wantBounds: image.Rect(0, 0, 900, 506)},
+		{name: "portrait cropped to 16:9", crop: cropAspect{width: 16, height: 9}, width: 360, height: 640, wantBounds: image.Rect(0, 0, 360, 202)},
+		{name: "cropping disabled", width: 900, height: 900, wantBounds: image.Rect(0, 0, 900, 900)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.thumbnailCrop = tt.crop
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadThumbnail(rec, newThumbnailRequest(t, video.ID, token, "image/png", encodePNG(t, tt.width, tt.height), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			var resp videoResponse
+			decodeData(t, rec, &resp)
+
+			stored, err := os.ReadFile(filepath.Join(cfg.assetsRoot, filepath.Base(strings.Split(*resp.ThumbnailURL, "?")[0])))
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := png.Decode(bytes.NewReader(stored))
+			if err != nil {
+				t.Fatalf("stored thumbnail isn't a PNG: %v", err)
+			}
+			if img.Bounds() != tt.wantBounds {
+				t.Errorf("stored thumbnail bounds = %v, want %v", img.Bounds(), tt.wantBounds)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/jpeg"
+	"os"
+
+	"golang.org/x/image/draw"
+)
+
+// inlineThumbnailSize is the box thumbnails are scaled into before being
+// inlined, big enough for an email or a list preview.
+var inlineThumbnailSize = thumbnailSize{name: "inline", width: 160, height: 160}
+
+// inlineThumbnail returns the thumbnail behind thumbnailURL as a JPEG data
+// URI, scaled down to inlineThumbnailSize. ok is false when it isn't one of
+// our assets or still encodes to more than cfg.inlineThumbnailMaxBytes,
+// the caller then sticks to the URL.
+func (cfg *apiConfig) inlineThumbnail(thumbnailURL string) (string, bool) {
+	path, ok := cfg.thumbnailAssetPath(thumbnailURL)
+	if !ok {
+		return "", false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return "", false
+	}
+
+	bounds := img.Bounds()
+	if width, height, ok := inlineThumbnailSize.fit(bounds.Dx(), bounds.Dy()); ok {
+		dst := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+		img = dst
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 75}); err != nil {
+		return "", false
+	}
+	if buf.Len() > cfg.inlineThumbnailMaxBytes {
+		return "", false
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// encodeNoisePNG encodes random pixels, which no amount of downscaling
+// makes compress well.
+func encodeNoisePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestHandlerVideoGetInlineThumbnail(t *testing.T) {
+	tests := []struct {
+		name       string
+		thumbnail  []byte
+		query      string
+		maxBytes   int
+		wantInline bool
+	}{
+		{name: "small thumbnail", thumbnail: encodePNG(t, 1280, 720), query: "?inlineThumbnail=true", maxBytes: 2 << 10, wantInline: true},
+		{name: "large thumbnail", thumbnail: encodeNoisePNG(t, 640, 360), query: "?inlineThumbnail=true", maxBytes: 2 << 10, wantInline: false},
+		{name: "over a tight cap", thumbnail: encodePNG(t, 1280, 720), query: "?inlineThumbnail=true", maxBytes: 64, wantInline: false},
+		{name: "not asked for", thumbnail: encodePNG(t, 1280, 720), query: "", maxBytes: 8 << 10, wantInline: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.inlineThumbnailMaxBytes = tt.maxBytes
+			video, token := newTestVideo(t, cfg)
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadThumbnail(rec, newThumbnailRequest(t, video.ID, token, "image/png", tt.thumbnail, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("thumbnail upload status = %d: %s", rec.Code, rec.Body)
+			}
+			var uploaded videoResponse
+			decodeData(t, rec, &uploaded)
+
+			req := newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+tt.query, video.ID, nil, token)
+			rec = httptest.NewRecorder()
+			cfg.handlerVideoGet(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var resp videoResponse
+			decodeData(t, rec, &resp)
+			if resp.ThumbnailInline != tt.wantInline {
+				t.Errorf("thumbnail_inline = %v, want %v", resp.ThumbnailInline, tt.wantInline)
+			}
+			if !tt.wantInline {
+				if *resp.ThumbnailURL != *uploaded.ThumbnailURL {
+					t.Errorf("thumbnail_url = %q, want %q", *resp.ThumbnailURL, *uploaded.ThumbnailURL)
+				}
+				return
+			}
+
+			encoded, ok := strings.CutPrefix(*resp.ThumbnailURL, "data:image/jpeg;base64,")
+			if !ok {
+				t.Fatalf("thumbnail_url = %.40q, want a JPEG data URI", *resp.ThumbnailURL)
+			}
+			data, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) > tt.maxBytes {
+				t.Errorf("inlined %d bytes, want at most %d", len(data), tt.maxBytes)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := img.Bounds(); b.Dx() != 160 || b.Dy() != 90 {
+				t.Errorf("inlined thumbnail is %dx%d, want 160x90", b.Dx(), b.Dy())
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// thumbnailSize is a bounding box a thumbnail is scaled down to fit in.
+type thumbnailSize struct {
+	name   string
+	width  int
+	height int
+}
+
+// parseThumbnailSizes reads a comma separated name=WIDTHxHEIGHT list such as
+// "small=320x180,medium=640x360".
+func parseThumbnailSizes(spec string) ([]thumbnailSize, error) {
+	sizes := []thumbnailSize{}
+	if strings.TrimSpace(spec) == "" {
+		return sizes, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		name, dims, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid size %q, expected name=WIDTHxHEIGHT", pair)
+		}
+		w, h, ok := strings.Cut(strings.TrimSpace(dims), "x")
+		width, werr := strconv.Atoi(w)
+		height, herr := strconv.Atoi(h)
+		if !ok || werr != nil || herr != nil || width <= 0 || height <= 0 {
+			return nil, fmt.Errorf("invalid dimensions %q for size %s", dims, name)
+		}
+		sizes = append(sizes, thumbnailSize{name: name, width: width, height: height})
+	}
+	return sizes, nil
+}
+
+// fit returns the largest dimensions with the source's aspect ratio that fit
+// in s. ok is false when that would upscale the source.
+func (s thumbnailSize) fit(srcWidth, srcHeight int) (width, height int, ok bool) {
+	if srcWidth <= s.width && srcHeight <= s.height {
+		return srcWidth, srcHeight, false
+	}
+	width, height = s.width, srcHeight*s.width/srcWidth
+	if height > s.height {
+		width, height = srcWidth*s.height/srcHeight, s.height
+	}
+	return max(width, 1), max(height, 1), true
+}
+
+// storeThumbnailSizes writes a scaled copy of img for every configured size
+// into the assets directory and returns their URLs by size name. Sizes the
+// image is already smaller than are skipped.
+func (cfg *apiConfig) storeThumbnailSizes(img image.Image, baseName, mediaType string) (map[string]string, error) {
+	urls := map[string]string{}
+	bounds := img.Bounds()
+	ext := strings.Split(mediaType, "/")[1]
+
+	for _, size := range cfg.thumbnailSizes {
+		width, height, ok := size.fit(bounds.Dx(), bounds.Dy())
+		if !ok {
+			continue
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+
+		fileName := fmt.Sprintf("%s_%s.%s", baseName, size.name, ext)
+		if err := writeImage(filepath.Join(cfg.assetsRoot, fileName), dst, mediaType); err != nil {
+			return nil, fmt.Errorf("couldn't store %s thumbnail: %w", size.name, err)
+		}
+		urls[size.name] = cfg.assetURL(fileName)
+	}
+	return urls, nil
+}
+
+func writeImage(path string, img image.Image, mediaType string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if mediaType == "image/png" {
+		err = png.Encode(f, img)
+	} else {
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// capToVideoFrame scales img down to fit the video's frame, a thumbnail
+// larger than the video it stands for only costs storage. ok is false when
+// the video's dimensions aren't known yet or img already fits.
+func capToVideoFrame(img image.Image, videoWidth, videoHeight int) (image.Image, bool) {
+	if videoWidth <= 0 || videoHeight <= 0 {
+		return img, false
+	}
+	bounds := img.Bounds()
+	frame := thumbnailSize{width: videoWidth, height: videoHeight}
+	width, height, ok := frame.fit(bounds.Dx(), bounds.Dy())
+	if !ok {
+		return img, false
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst, true
+}
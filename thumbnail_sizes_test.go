@@ -0,0 +1,197 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseThumbnailSizes(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []thumbnailSize
+		wantErr bool
+	}{
+		{spec: "", want: []thumbnailSize{}},
+		{spec: "small=320x180", want: []thumbnailSize{{name: "small", width: 320, height: 180}}},
+		{spec: "small=320x180, large = 1280x720", want: []thumbnailSize{{name: "small", width: 320, height: 180}, {name: "large", width: 1280, height: 720}}},
+		{spec: "small", wantErr: true},
+		{spec: "=320x180", wantErr: true},
+		{spec: "small=320", wantErr: true},
+		{spec: "small=0x180", wantErr: true},
+		{spec: "small=axb", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseThumbnailSizes(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseThumbnailSizes err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseThumbnailSizes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThumbnailSizeFit(t *testing.T) {
+	box := thumbnailSize{name: "medium", width: 640, height: 360}
+	tests := []struct {
+		name                string
+		srcWidth, srcHeight int
+		wantW, wantH        int
+		wantOK              bool
+	}{
+		{name: "same aspect", srcWidth: 1920, srcHeight: 1080, wantW: 640, wantH: 360, wantOK: true},
+		{name: "wider than the box", srcWidth: 2000, srcHeight: 500, wantW: 640, wantH: 160, wantOK: true},
+		{name: "taller than the box", srcWidth: 1080, srcHeight: 1920, wantW: 202, wantH: 360, wantOK: true},
+		{name: "already fits", srcWidth: 320, srcHeight: 180, wantW: 320, wantH: 180},
+		{name: "extreme ratio keeps a pixel", srcWidth: 100000, srcHeight: 10, wantW: 640, wantH: 1, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h, ok := box.fit(tt.srcWidth, tt.srcHeight)
+			if w != tt.wantW || h != tt.wantH || ok != tt.wantOK {
+				t.Errorf("fit(%d, %d) = %d, %d, %v, want %d, %d, %v", tt.srcWidth, tt.srcHeight, w, h, ok, tt.wantW, tt.wantH, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestStoreThumbnailSizes(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		wantSizes     map[string]image.Point
+	}{
+		{
+			name:  "large source gets every size",
+			width: 1920, height: 1080,
+			wantSizes: map[string]image.Point{"small": {320, 180}, "medium": {640, 360}, "large": {1280, 720}},
+		},
+		{
+			name:  "sizes above the source are skipped",
+			width: 800, height: 450,
+			wantSizes: map[string]image.Point{"small": {320, 180}, "medium": {640, 360}},
+		},
+		{
+			name:  "small source",
+			width: 100, height: 100,
+			wantSizes: map[string]image.Point{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			img := solidImage(tt.width, tt.height, color.RGBA{0, 128, 0, 255})
+
+			urls, err := cfg.storeThumbnailSizes(img, "thumb", "image/png")
+			if err != nil {
+				t.Fatalf("storeThumbnailSizes: %v", err)
+			}
+			if len(urls) != len(tt.wantSizes) {
+				t.Errorf("stored sizes %v, want %v", urls, tt.wantSizes)
+			}
+			for name, want := range tt.wantSizes {
+				if urls[name] != cfg.assetURL("thumb_"+name+".png") {
+					t.Errorf("%s URL = %q", name, urls[name])
+				}
+				f, err := os.Open(filepath.Join(cfg.assetsRoot, "thumb_"+name+".png"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				decoded, _, err := image.DecodeConfig(f)
+				f.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := (image.Point{decoded.Width, decoded.Height}); got != want {
+					t.Errorf("%s is %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCapToVideoFrame(t *testing.T) {
+	tests := []struct {
+		name                    string
+		imgWidth, imgHeight     int
+		videoWidth, videoHeight int
+		wantW, wantH            int
+		wantOK                  bool
+	}{
+		{name: "1080p thumbnail of a 480p video", imgWidth: 1920, imgHeight: 1080, videoWidth: 854, videoHeight: 480, wantW: 854, wantH: 480, wantOK: true},
+		{name: "portrait", imgWidth: 1080, imgHeight: 1920, videoWidth: 480, videoHeight: 854, wantW: 480, wantH: 853, wantOK: true},
+		{name: "already fits", imgWidth: 640, imgHeight: 360, videoWidth: 1280, videoHeight: 720, wantW: 640, wantH: 360},
+		{name: "dimensions unknown", imgWidth: 1920, imgHeight: 1080, wantW: 1920, wantH: 1080},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewRGBA(image.Rect(0, 0, tt.imgWidth, tt.imgHeight))
+			got, ok := capToVideoFrame(img, tt.videoWidth, tt.videoHeight)
+			b := got.Bounds()
+			if b.Dx() != tt.wantW || b.Dy() != tt.wantH || ok != tt.wantOK {
+				t.Errorf("capToVideoFrame = %dx%d, %v, want %dx%d, %v", b.Dx(), b.Dy(), ok, tt.wantW, tt.wantH, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadThumbnailCapToVideo(t *testing.T) {
+	tests := []struct {
+		name                    string
+		capToVideo              bool
+		videoWidth, videoHeight int
+		wantW, wantH            int
+	}{
+		{name: "capped to a 480p video", capToVideo: true, videoWidth: 854, videoHeight: 480, wantW: 854, wantH: 480},
+		{name: "cap off", capToVideo: false, videoWidth: 854, videoHeight: 480, wantW: 1920, wantH: 1080},
+		{name: "video not probed yet", capToVideo: true, wantW: 1920, wantH: 1080},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.thumbnailCapToVideo = tt.capToVideo
+			video, token := newTestVideo(t, cfg)
+			video.Width, video.Height = tt.videoWidth, tt.videoHeight
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadThumbnail(rec, newThumbnailRequest(t, video.ID, token, "image/png", encodePNG(t, 1920, 1080), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var resp videoResponse
+			decodeData(t, rec, &resp)
+			path, ok := cfg.thumbnailAssetPath(*resp.ThumbnailURL)
+			if !ok {
+				t.Fatalf("thumbnail_url %q isn't an asset", *resp.ThumbnailURL)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			config, _, err := image.DecodeConfig(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Width != tt.wantW || config.Height != tt.wantH {
+				t.Errorf("stored thumbnail is %dx%d, want %dx%d", config.Width, config.Height, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
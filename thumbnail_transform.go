@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"image"
+	"image/draw"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// thumbnailTransform rotates a thumbnail clockwise and then mirrors it,
+// "h" flipping it left to right and "v" top to bottom.
+type thumbnailTransform struct {
+	Rotate int    `json:"rotate"`
+	Flip   string `json:"flip"`
+}
+
+func validateThumbnailTransform(t thumbnailTransform) *validationError {
+	var errs []fieldError
+	switch t.Rotate {
+	case 0, 90, 180, 270:
+	default:
+		errs = append(errs, fieldError{Field: "rotate", Message: "must be 90, 180 or 270"})
+	}
+	switch t.Flip {
+	case "", "h", "v":
+	default:
+		errs = append(errs, fieldError{Field: "flip", Message: `must be "h" or "v"`})
+	}
+	if len(errs) == 0 && t.Rotate == 0 && t.Flip == "" {
+		errs = append(errs, fieldError{Field: "body", Message: "needs a rotation or a flip"})
+	}
+	if len(errs) > 0 {
+		return &validationError{Fields: errs}
+	}
+	return nil
+}
+
+// apply returns a transformed copy of img. Quarter turns swap its width and
+// height.
+func (t thumbnailTransform) apply(img image.Image) image.Image {
+	src := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dstWidth, dstHeight := width, height
+	if t.Rotate == 90 || t.Rotate == 270 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dx, dy := x, y
+			switch t.Rotate {
+			case 90:
+				dx, dy = height-1-y, x
+			case 180:
+				dx, dy = width-1-x, height-1-y
+			case 270:
+				dx, dy = y, width-1-x
+			}
+			switch t.Flip {
+			case "h":
+				dx = dstWidth - 1 - dx
+			case "v":
+				dy = dstHeight - 1 - dy
+			}
+			dst.SetRGBA(dx, dy, src.RGBAAt(x, y))
+		}
+	}
+	return dst
+}
+
+// newAssetBaseName returns a random name for files stored in the assets
+// directory.
+func newAssetBaseName() (string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+// thumbnailAssetPath maps a thumbnail URL handed out by the upload handler
+// back to its file in the assets directory.
+func (cfg *apiConfig) thumbnailAssetPath(thumbnailURL string) (string, bool) {
+	fileName, ok := cfg.assetFileName(thumbnailURL)
+	if !ok {
+		return "", false
+	}
+	fileName, err := sanitizeKey(fileName)
+	if err != nil || strings.Contains(fileName, "/") {
+		return "", false
+	}
+	return filepath.Join(cfg.assetsRoot, fileName), true
+}
+
+// thumbnailMediaType guesses a stored thumbnail's type from its extension,
+// uploads are only ever JPEG or PNG.
+func thumbnailMediaType(fileName string) string {
+	if strings.EqualFold(path.Ext(fileName), ".png") {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidateThumbnailTransform(t *testing.T) {
+	tests := []struct {
+		name       string
+		transform  thumbnailTransform
+		wantFields []string
+	}{
+		{name: "rotate", transform: thumbnailTransform{Rotate: 90}},
+		{name: "flip", transform: thumbnailTransform{Flip: "v"}},
+		{name: "both", transform: thumbnailTransform{Rotate: 270, Flip: "h"}},
+		{name: "nothing to do", wantFields: []string{"body"}},
+		{name: "odd angle", transform: thumbnailTransform{Rotate: 45}, wantFields: []string{"rotate"}},
+		{name: "full turn", transform: thumbnailTransform{Rotate: 360}, wantFields: []string{"rotate"}},
+		{name: "counter clockwise", transform: thumbnailTransform{Rotate: -90}, wantFields: []string{"rotate"}},
+		{name: "unknown flip", transform: thumbnailTransform{Flip: "x"}, wantFields: []string{"flip"}},
+		{name: "both wrong", transform: thumbnailTransform{Rotate: 1, Flip: "H"}, wantFields: []string{"rotate", "flip"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verr := validateThumbnailTransform(tt.transform)
+			var got []string
+			if verr != nil {
+				for _, f := range verr.Fields {
+					got = append(got, f.Field)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("invalid fields = %v, want %v", got, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestThumbnailTransformApply(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	tests := []struct {
+		name      string
+		transform thumbnailTransform
+		wantSize  image.Point
+		// wantRed is where the 3x2 image's top left pixel ends up
+		wantRed image.Point
+	}{
+		{name: "rotate 90", transform: thumbnailTransform{Rotate: 90}, wantSize: image.Pt(2, 3), wantRed: image.Pt(1, 0)},
+		{name: "rotate 180", transform: thumbnailTransform{Rotate: 180}, wantSize: image.Pt(3, 2), wantRed: image.Pt(2, 1)},
+		{name: "rotate 270", transform: thumbnailTransform{Rotate: 270}, wantSize: image.Pt(2, 3), wantRed: image.Pt(0, 2)},
+		{name: "flip h", transform: thumbnailTransform{Flip: "h"}, wantSize: image.Pt(3, 2), wantRed: image.Pt(2, 0)},
+		{name: "flip v", transform: thumbnailTransform{Flip: "v"}, wantSize: image.Pt(3, 2), wantRed: image.Pt(0, 1)},
+		{name: "rotate then flip", transform: thumbnailTransform{Rotate: 90, Flip: "h"}, wantSize: image.Pt(2, 3), wantRed: image.Pt(0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := image.NewRGBA(image.Rect(10, 10, 13, 12))
+			for y := 10; y < 12; y++ {
+				for x := 10; x < 13; x++ {
+					src.SetRGBA(x, y, color.RGBA{0, 0, 255, 255})
+				}
+			}
+			src.SetRGBA(10, 10, red)
+
+			got := tt.transform.apply(src)
+			if size := got.Bounds().Size(); size != tt.wantSize {
+				t.Fatalf("size = %v, want %v", size, tt.wantSize)
+			}
+			for y := 0; y < tt.wantSize.Y; y++ {
+				for x := 0; x < tt.wantSize.X; x++ {
+					isRed := color.RGBAModel.Convert(got.At(x, y)) == red
+					if isRed != (image.Pt(x, y) == tt.wantRed) {
+						t.Errorf("pixel %d,%d red = %v, want the red pixel at %v", x, y, isRed, tt.wantRed)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerThumbnailTransform(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		noUpload   bool
+		wantCode   int
+		wantBounds image.Point
+	}{
+		{name: "rotate 90 swaps dimensions", body: `{"rotate":90}`, wantCode: http.StatusOK, wantBounds: image.Pt(36, 64)},
+		{name: "rotate 180 keeps them", body: `{"rotate":180}`, wantCode: http.StatusOK, wantBounds: image.Pt(64, 36)},
+		{name: "flip", body: `{"flip":"h"}`, wantCode: http.StatusOK, wantBounds: image.Pt(64, 36)},
+		{name: "invalid rotation", body: `{"rotate":45}`, wantCode: http.StatusBadRequest},
+		{name: "no thumbnail", body: `{"rotate":90}`, noUpload: true, wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+			if !tt.noUpload {
+				uploadThumbnail(t, cfg, video.ID, token, nil)
+			}
+
+			req := newVideoRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/thumbnail/transform", video.ID, strings.NewReader(tt.body), token)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cfg.handlerThumbnailTransform(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var resp videoResponse
+			decodeData(t, rec, &resp)
+			if len(resp.Thumbnails) != 2 {
+				t.Errorf("thumbnails = %d, want the original and the transformed one", len(resp.Thumbnails))
+			}
+			assetPath, ok := cfg.thumbnailAssetPath(*resp.ThumbnailURL)
+			if !ok {
+				t.Fatalf("thumbnail URL %s isn't an asset", *resp.ThumbnailURL)
+			}
+			f, err := os.Open(assetPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			img, err := png.Decode(f)
+			if err != nil {
+				t.Fatalf("stored thumbnail isn't a PNG: %v", err)
+			}
+			if size := img.Bounds().Size(); size != tt.wantBounds {
+				t.Errorf("stored thumbnail size = %v, want %v", size, tt.wantBounds)
+			}
+		})
+	}
+}
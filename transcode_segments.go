@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// transcodeVariantResumable encodes long sources in segments of
+// cfg.transcodeSegmentSeconds and concatenates them. Finished segments are
+// kept in cfg.transcodeWorkDir and recorded in the database, so when the
+// same source is uploaded again after a crash only the missing segments are
+// encoded. Short sources, or a zero segment length, use transcodeVariant.
+func (cfg *apiConfig) transcodeVariantResumable(ctx context.Context, videoID uuid.UUID, sourcePath string, v Variant, probe videoProbe, profile outputProfile, encoding encodingProfile) (string, error) {
+	segmentSeconds := cfg.transcodeSegmentSeconds
+	if segmentSeconds <= 0 || probe.Duration <= float64(segmentSeconds) {
+		return cfg.transcodeVariant(ctx, sourcePath, v, probe.Width, probe.Height, profile, encoding)
+	}
+
+	sourceHash, err := fileSHA256(sourcePath)
+	if err != nil {
+		return "", err
+	}
+	// the job is tied to the exact source bytes and settings, a different
+	// upload of the same video never reuses stale segments
+	job := fmt.Sprintf("%s-%s-%s", sourceHash[:16], v.Name, encoding.name)
+	videoDir := filepath.Join(cfg.transcodeWorkDir, videoID.String())
+	jobDir := filepath.Join(videoDir, job)
+	// progress of an earlier source can never be resumed, only one upload of
+	// a video is processed at a time so none of it is in use either
+	if err := cfg.clearStaleSegments(videoID, videoDir, sourceHash[:16]); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		return "", err
+	}
+
+	completed, err := cfg.db.GetCompletedSegments(videoID, job)
+	if err != nil {
+		return "", err
+	}
+	done := map[int]bool{}
+	for _, segment := range completed {
+		done[segment] = true
+	}
+
+	count := int(math.Ceil(probe.Duration / float64(segmentSeconds)))
+	segmentPaths := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		segmentPath := filepath.Join(jobDir, fmt.Sprintf("segment-%05d.mp4", i))
+		segmentPaths = append(segmentPaths, segmentPath)
+		if _, err := os.Stat(segmentPath); err == nil && done[i] {
+			continue
+		}
+		if err := cfg.transcodeSegment(ctx, sourcePath, segmentPath, v, probe, encoding, i*segmentSeconds, segmentSeconds); err != nil {
+			return "", fmt.Errorf("couldn't encode segment %d: %w", i, err)
+		}
+		if err := cfg.db.MarkSegmentDone(videoID, job, i); err != nil {
+			return "", err
+		}
+	}
+
+	outputPath, err := cfg.concatSegments(sourcePath, jobDir, segmentPaths, profile)
+	if err != nil {
+		return "", err
+	}
+
+	os.RemoveAll(jobDir)
+	if err := cfg.db.DeleteTranscodeSegments(videoID, job); err != nil {
+		return outputPath, fmt.Errorf("couldn't clear segment progress: %w", err)
+	}
+	return outputPath, nil
+}
+
+// clearStaleSegments drops the segments, on disk and in the database, of
+// every job of the video that isn't for the source hashed to sourcePrefix.
+func (cfg *apiConfig) clearStaleSegments(videoID uuid.UUID, videoDir, sourcePrefix string) error {
+	entries, err := os.ReadDir(videoDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), sourcePrefix+"-") {
+			os.RemoveAll(filepath.Join(videoDir, entry.Name()))
+		}
+	}
+	return cfg.db.DeleteStaleTranscodeSegments(videoID, sourcePrefix+"-")
+}
+
+// removeEmptyTranscodeDir removes the video's directory under
+// cfg.transcodeWorkDir once all of its jobs were assembled. Jobs that failed
+// keep it, their segments are resumed by the next upload of the source.
+func (cfg *apiConfig) removeEmptyTranscodeDir(videoID uuid.UUID) {
+	videoDir := filepath.Join(cfg.transcodeWorkDir, videoID.String())
+	// fails on its own while the directory isn't empty
+	os.Remove(videoDir)
+}
+
+// removeTranscodeWork removes whatever segments of a deleted video's
+// transcodes are left on disk, its progress rows go with the video.
+func (cfg *apiConfig) removeTranscodeWork(videoID uuid.UUID) {
+	videoDir := filepath.Join(cfg.transcodeWorkDir, videoID.String())
+	if err := os.RemoveAll(videoDir); err != nil {
+		slog.Warn("Couldn't remove transcode segments", "video_id", videoID, "err", err)
+	}
+}
+
+func (cfg *apiConfig) transcodeSegment(ctx context.Context, sourcePath, segmentPath string, v Variant, probe videoProbe, encoding encodingProfile, start, length int) error {
+	// write next to the final name so a crash never leaves a partial segment
+	// that looks finished
+	partialPath := segmentPath + ".partial"
+	args := []string{
+		"-y",
+		"-ss", fmt.Sprint(start),
+		"-t", fmt.Sprint(length),
+		"-i", sourcePath,
+	}
+	args = append(args, v.encodeArgs(probe.Width, probe.Height, encoding)...)
+	args = append(args, "-c:a", "aac", "-f", "mp4", partialPath)
+
+	cmd := exec.CommandContext(ctx, cfg.ffmpegPath, args...)
+	logCommand(cmd)
+	if err := cmd.Run(); err != nil {
+		os.Remove(partialPath)
+		return err
+	}
+	return os.Rename(partialPath, segmentPath)
+}
+
+func (cfg *apiConfig) concatSegments(sourcePath, jobDir string, segmentPaths []string, profile outputProfile) (string, error) {
+	var list strings.Builder
+	for _, p := range segmentPaths {
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(p, "'", `'\''`))
+	}
+	listPath := filepath.Join(jobDir, "segments.txt")
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		return "", err
+	}
+
+	outputPath, err := tempOutputPath(sourcePath, "tubely-variant-*.mp4")
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command(
+		cfg.ffmpegPath,
+		"-y",
+		"-f", "concat",
+		"-safe", "0",
+		"-i", listPath,
+		"-c", "copy",
+		"-movflags", profile.movflags,
+		"-f", "mp4",
+		outputPath,
+	)
+	logCommand(cmd)
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+	return outputPath, nil
+}
+
+func fileSHA256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
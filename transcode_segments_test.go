@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// installSegmentFFmpeg points cfg at an ffmpeg stand-in that writes the
+// start offset of the segment it encodes to its output, and fails for the
+// offset in the returned file if there's one. Every command line is
+// appended to the returned log.
+func installSegmentFFmpeg(t *testing.T, cfg *apiConfig) (logPath, failPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	logPath = filepath.Join(dir, "ffmpeg.log")
+	failPath = filepath.Join(dir, "fail-at")
+	cfg.ffmpegPath = fakeCommand(t, "ffmpeg", `echo "$@" >> `+logPath+`
+prev=
+ss=
+for arg; do
+	if [ "$prev" = "-ss" ]; then ss=$arg; fi
+	prev=$arg
+done
+if [ -n "$ss" ] && [ -f `+failPath+` ] && [ "$ss" = "$(cat `+failPath+`)" ]; then exit 1; fi
+echo "segment $ss" > "$arg"
+`)
+	return logPath, failPath
+}
+
+// encodedOffsets returns the -ss offsets of the segment encodes in the log.
+func encodedOffsets(t *testing.T, logPath string) []string {
+	t.Helper()
+	data, err := os.ReadFile(logPath)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var offsets []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.Fields(line)
+		if i := slices.Index(fields, "-ss"); i >= 0 && i+1 < len(fields) {
+			offsets = append(offsets, fields[i+1])
+		}
+	}
+	return offsets
+}
+
+func TestTranscodeVariantResumable(t *testing.T) {
+	tests := []struct {
+		name      string
+		duration  float64
+		segment   int
+		crashAt   string
+		wantFirst []string
+		// wantDone is the progress recorded by the crashed run
+		wantDone   []int
+		wantResume []string
+	}{
+		{
+			name:       "resumes after the last finished segment",
+			duration:   45,
+			segment:    10,
+			crashAt:    "20",
+			wantFirst:  []string{"0", "10", "20"},
+			wantDone:   []int{0, 1},
+			wantResume: []string{"20", "30", "40"},
+		},
+		{
+			name:       "crash on the first segment",
+			duration:   25,
+			segment:    10,
+			crashAt:    "0",
+			wantFirst:  []string{"0"},
+			wantDone:   []int{},
+			wantResume: []string{"0", "10", "20"},
+		},
+		{
+			name:       "crash on the last segment",
+			duration:   30,
+			segment:    10,
+			crashAt:    "20",
+			wantFirst:  []string{"0", "10", "20"},
+			wantDone:   []int{0, 1},
+			wantResume: []string{"20"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.transcodeSegmentSeconds = tt.segment
+			logPath, failPath := installSegmentFFmpeg(t, cfg)
+			video, _ := newTestVideo(t, cfg)
+			source := filepath.Join(t.TempDir(), "source.mp4")
+			if err := os.WriteFile(source, []byte("fake video"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			v := Variant{Name: "480p", Height: 480}
+			probe := videoProbe{Width: 1280, Height: 720, Duration: tt.duration}
+			ctx := context.Background()
+
+			if err := os.WriteFile(failPath, []byte(tt.crashAt), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := cfg.transcodeVariantResumable(ctx, video.ID, source, v, probe, cfg.outputProfile, cfg.encodingProfile); err == nil {
+				t.Fatal("transcode with a crashing segment succeeded")
+			}
+			if got := encodedOffsets(t, logPath); !slices.Equal(got, tt.wantFirst) {
+				t.Errorf("first run encoded %v, want %v", got, tt.wantFirst)
+			}
+			hash, err := fileSHA256(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			job := hash[:16] + "-480p-baseline"
+			done, err := cfg.db.GetCompletedSegments(video.ID, job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(done, tt.wantDone) {
+				t.Errorf("recorded segments = %v, want %v", done, tt.wantDone)
+			}
+
+			os.Remove(failPath)
+			os.Remove(logPath)
+			outputPath, err := cfg.transcodeVariantResumable(ctx, video.ID, source, v, probe, cfg.outputProfile, cfg.encodingProfile)
+			if err != nil {
+				t.Fatalf("resumed transcode: %v", err)
+			}
+			defer os.Remove(outputPath)
+			if got := encodedOffsets(t, logPath); !slices.Equal(got, tt.wantResume) {
+				t.Errorf("resumed run encoded %v, want %v", got, tt.wantResume)
+			}
+			if _, err := os.Stat(filepath.Join(cfg.transcodeWorkDir, video.ID.String(), job)); !os.IsNotExist(err) {
+				t.Errorf("segments left behind after assembling, stat err = %v", err)
+			}
+			done, err = cfg.db.GetCompletedSegments(video.ID, job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(done) != 0 {
+				t.Errorf("segment progress left behind: %v", done)
+			}
+		})
+	}
+}
+
+func TestTranscodeVariantResumableShortSource(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	cfg.transcodeSegmentSeconds = 10
+	logPath, _ := installSegmentFFmpeg(t, cfg)
+	video, _ := newTestVideo(t, cfg)
+	source := filepath.Join(t.TempDir(), "source.mp4")
+	if err := os.WriteFile(source, []byte("fake video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	probe := videoProbe{Width: 1280, Height: 720, Duration: 10}
+	outputPath, err := cfg.transcodeVariantResumable(context.Background(), video.ID, source, Variant{Name: "480p", Height: 480}, probe, cfg.outputProfile, cfg.encodingProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(outputPath)
+	if got := encodedOffsets(t, logPath); len(got) != 0 {
+		t.Errorf("short source was encoded in segments %v", got)
+	}
+}
+
+func TestClearStaleSegments(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	video, _ := newTestVideo(t, cfg)
+	videoDir := filepath.Join(cfg.transcodeWorkDir, video.ID.String())
+	jobs := []string{"aaaa-480p-baseline", "aaaa-720p-baseline", "bbbb-480p-baseline"}
+	for _, job := range jobs {
+		if err := os.MkdirAll(filepath.Join(videoDir, job), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.db.MarkSegmentDone(video.ID, job, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cfg.clearStaleSegments(video.ID, videoDir, "aaaa"); err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range jobs {
+		_, statErr := os.Stat(filepath.Join(videoDir, job))
+		done, err := cfg.db.GetCompletedSegments(video.ID, job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantKept := strings.HasPrefix(job, "aaaa-")
+		if kept := statErr == nil; kept != wantKept {
+			t.Errorf("%s directory kept = %v, want %v", job, kept, wantKept)
+		}
+		if kept := len(done) > 0; kept != wantKept {
+			t.Errorf("%s progress kept = %v, want %v", job, kept, wantKept)
+		}
+	}
+
+	// a video that never had segments has nothing to clear
+	if err := cfg.clearStaleSegments(video.ID, filepath.Join(cfg.transcodeWorkDir, "missing"), "aaaa"); err != nil {
+		t.Errorf("clearing a missing directory: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// tusVersion is the only version of the tus resumable upload protocol we
+// speak, see https://tus.io/protocols/resumable-upload.
+const tusVersion = "1.0.0"
+
+// statusChecksumMismatch is the status the tus checksum extension answers
+// a chunk that doesn't match its Upload-Checksum with.
+const statusChecksumMismatch = 460
+
+// tusChecksumAlgorithms are the Upload-Checksum algorithms we verify, in
+// the order Tus-Checksum-Algorithm advertises them.
+var tusChecksumAlgorithms = []struct {
+	name string
+	hash func() hash.Hash
+}{
+	{"sha1", sha1.New},
+	{"sha256", sha256.New},
+	{"md5", md5.New},
+}
+
+// tusLocks makes sure only one PATCH appends to an upload at a time.
+type tusLocks struct {
+	mu     sync.Mutex
+	active map[uuid.UUID]bool
+}
+
+func newTusLocks() *tusLocks {
+	return &tusLocks{
+		active: map[uuid.UUID]bool{},
+	}
+}
+
+func (l *tusLocks) tryLock(id uuid.UUID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[id] {
+		return false
+	}
+	l.active[id] = true
+	return true
+}
+
+func (l *tusLocks) unlock(id uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.active, id)
+}
+
+func (cfg *apiConfig) tusUploadPath(id uuid.UUID) string {
+	return filepath.Join(cfg.tusDir, id.String())
+}
+
+// removeTusUpload deletes an upload's file and record.
+func (cfg *apiConfig) removeTusUpload(id uuid.UUID) {
+	if err := os.Remove(cfg.tusUploadPath(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("Couldn't remove tus upload file", "upload_id", id, "err", err)
+	}
+	if err := cfg.db.DeleteTusUpload(id); err != nil {
+		slog.Warn("Couldn't delete tus upload", "upload_id", id, "err", err)
+	}
+}
+
+// reapAbandonedTusUploads removes uploads nothing was written to for
+// cfg.tusUploadTTL, complete ones that never got processed included.
+// Uploads with a PATCH in flight are left for the next run.
+func (cfg *apiConfig) reapAbandonedTusUploads(now time.Time) error {
+	uploads, err := cfg.db.GetAbandonedTusUploads(now.Add(-cfg.tusUploadTTL))
+	if err != nil {
+		return err
+	}
+	for _, upload := range uploads {
+		if !cfg.tusLocks.tryLock(upload.ID) {
+			continue
+		}
+		cfg.removeTusUpload(upload.ID)
+		cfg.tusLocks.unlock(upload.ID)
+		slog.Info("Reaped abandoned tus upload", "upload_id", upload.ID, "video_id", upload.VideoID)
+	}
+	return nil
+}
+
+// checkTusResumable rejects requests speaking another protocol version. It
+// also advertises ours on every response.
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		respondWithError(w, http.StatusPreconditionFailed, "Unsupported tus version", nil)
+		return false
+	}
+	return true
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma separated
+// pairs of a key and an optional base64 encoded value.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("empty metadata key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for metadata key %s: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// parseTusChecksum decodes an Upload-Checksum header: an algorithm name and
+// the base64 encoded digest of the chunk. A missing header returns a nil
+// hash, the chunk then goes unverified.
+func parseTusChecksum(header string) (hash.Hash, []byte, error) {
+	if strings.TrimSpace(header) == "" {
+		return nil, nil, nil
+	}
+	name, encoded, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok {
+		return nil, nil, fmt.Errorf("expected an algorithm and a digest")
+	}
+	digest, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid digest: %w", err)
+	}
+	for _, algorithm := range tusChecksumAlgorithms {
+		if algorithm.name == name {
+			return algorithm.hash(), digest, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("unsupported algorithm %q", name)
+}
+
+// tusChecksumAlgorithmNames lists tusChecksumAlgorithms for
+// Tus-Checksum-Algorithm.
+func tusChecksumAlgorithmNames() string {
+	names := make([]string, len(tusChecksumAlgorithms))
+	for i, algorithm := range tusChecksumAlgorithms {
+		names[i] = algorithm.name
+	}
+	return strings.Join(names, ",")
+}
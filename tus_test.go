@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// tusCreate starts a tus upload of length bytes for videoID.
+func tusCreate(cfg *apiConfig, videoID uuid.UUID, token string, length int, metadata string) *httptest.ResponseRecorder {
+	req := newVideoRequest(http.MethodPost, "/api/videos/"+videoID.String()+"/tus", videoID, nil, token)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Upload-Length", strconv.Itoa(length))
+	if metadata != "" {
+		req.Header.Set("Upload-Metadata", metadata)
+	}
+	rec := httptest.NewRecorder()
+	cfg.handlerTusCreate(rec, req)
+	return rec
+}
+
+// tusPatch appends data at offset to the upload at location.
+func tusPatch(cfg *apiConfig, location, token string, offset int, data []byte, checksum string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, location, bytes.NewReader(data))
+	req.SetPathValue("uploadID", path.Base(location))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	if checksum != "" {
+		req.Header.Set("Upload-Checksum", checksum)
+	}
+	rec := httptest.NewRecorder()
+	cfg.handlerTusPatch(rec, req)
+	return rec
+}
+
+func tusHead(cfg *apiConfig, location, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodHead, location, nil)
+	req.SetPathValue("uploadID", path.Base(location))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	rec := httptest.NewRecorder()
+	cfg.handlerTusHead(rec, req)
+	return rec
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func TestParseTusMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", header: "", want: map[string]string{}},
+		{
+			name:   "several pairs",
+			header: "filename " + b64("clip.mp4") + ", filetype " + b64("video/mp4"),
+			want:   map[string]string{"filename": "clip.mp4", "filetype": "video/mp4"},
+		},
+		{name: "key without a value", header: "is_confidential", want: map[string]string{"is_confidential": ""}},
+		{name: "value isn't base64", header: "filename clip.mp4", wantErr: true},
+		{name: "empty key", header: "filename " + b64("a") + ",,", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTusMetadata(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTusMetadata err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseTusMetadata = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerTusCreate(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   string
+		length    string
+		metadata  string
+		otherUser bool
+		wantCode  int
+	}{
+		{name: "valid", version: tusVersion, length: "100", wantCode: http.StatusCreated},
+		{name: "with metadata", version: tusVersion, length: "100", metadata: "filename " + b64("clip.mp4") + ",filetype " + b64("video/mp4"), wantCode: http.StatusCreated},
+		{name: "other tus version", version: "0.2.2", length: "100", wantCode: http.StatusPreconditionFailed},
+		{name: "missing length", version: tusVersion, wantCode: http.StatusBadRequest},
+		{name: "zero length", version: tusVersion, length: "0", wantCode: http.StatusBadRequest},
+		{name: "beyond the max size", version: tusVersion, length: "2000", wantCode: http.StatusRequestEntityTooLarge},
+		{name: "invalid metadata", version: tusVersion, length: "100", metadata: "filename !!", wantCode: http.StatusBadRequest},
+		{name: "not mp4", version: tusVersion, length: "100", metadata: "filetype " + b64("video/webm"), wantCode: http.StatusBadRequest},
+		{name: "someone else's video", version: tusVersion, length: "100", otherUser: true, wantCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.maxUploadSize = 1000
+			video, token := newTestVideo(t, cfg)
+			if tt.otherUser {
+				_, token = newTestVideo(t, cfg)
+			}
+
+			req := newVideoRequest(http.MethodPost, "/api/videos/"+video.ID.String()+"/tus", video.ID, nil, token)
+			req.Header.Set("Tus-Resumable", tt.version)
+			req.Header.Set("Upload-Length", tt.length)
+			req.Header.Set("Upload-Metadata", tt.metadata)
+			rec := httptest.NewRecorder()
+			cfg.handlerTusCreate(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if got := rec.Header().Get("Tus-Resumable"); got != tusVersion {
+				t.Errorf("Tus-Resumable = %q, want %q", got, tusVersion)
+			}
+			if rec.Code != http.StatusCreated {
+				return
+			}
+			location := rec.Header().Get("Location")
+			if _, err := os.Stat(cfg.tusUploadPath(uuid.MustParse(path.Base(location)))); err != nil {
+				t.Errorf("upload file wasn't created: %v", err)
+			}
+		})
+	}
+}
+
+func TestTusUploadInTwoChunks(t *testing.T) {
+	cfg, mem := newTestConfig(t)
+	installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+	video, token := newTestVideo(t, cfg)
+	data := []byte("first chunk, second chunk")
+	first, second := data[:13], data[13:]
+
+	rec := tusCreate(cfg, video.ID, token, len(data), "filename "+b64("clip.mp4"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body)
+	}
+	location := rec.Header().Get("Location")
+
+	rec = tusPatch(cfg, location, token, 0, first, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("first chunk status = %d: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Upload-Offset"); got != strconv.Itoa(len(first)) {
+		t.Errorf("Upload-Offset after the first chunk = %s, want %d", got, len(first))
+	}
+
+	rec = tusHead(cfg, location, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("head status = %d: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Upload-Offset"); got != strconv.Itoa(len(first)) {
+		t.Errorf("resumed Upload-Offset = %s, want %d", got, len(first))
+	}
+	if got := rec.Header().Get("Upload-Length"); got != strconv.Itoa(len(data)) {
+		t.Errorf("Upload-Length = %s, want %d", got, len(data))
+	}
+
+	// a chunk sent for an offset the server doesn't have is refused
+	if rec := tusPatch(cfg, location, token, 0, first, ""); rec.Code != http.StatusConflict {
+		t.Errorf("stale offset status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	rec = tusPatch(cfg, location, token, len(first), second, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("last chunk status = %d: %s", rec.Code, rec.Body)
+	}
+
+	stored, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.VideoURL == nil {
+		t.Fatal("video URL wasn't set")
+	}
+	key, _ := cfg.videoKeyFromURL(*stored.VideoURL)
+	if obj, ok := mem.Lookup(key); !ok || !bytes.Equal(obj.Data, data) {
+		t.Errorf("stored %q, want the assembled upload %q", obj.Data, data)
+	}
+	uploadID := uuid.MustParse(path.Base(location))
+	if _, err := os.Stat(cfg.tusUploadPath(uploadID)); !os.IsNotExist(err) {
+		t.Errorf("upload file left behind, stat err = %v", err)
+	}
+	if rec := tusHead(cfg, location, token); rec.Code != http.StatusNotFound {
+		t.Errorf("head of a finished upload status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandlerTusPatchRejects(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		version     string
+		otherUser   bool
+		wantCode    int
+	}{
+		{name: "wrong content type", contentType: "video/mp4", version: tusVersion, wantCode: http.StatusUnsupportedMediaType},
+		{name: "other tus version", contentType: "application/offset+octet-stream", version: "0.2.2", wantCode: http.StatusPreconditionFailed},
+		{name: "someone else's upload", contentType: "application/offset+octet-stream", version: tusVersion, otherUser: true, wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+			rec := tusCreate(cfg, video.ID, token, 10, "")
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("create status = %d: %s", rec.Code, rec.Body)
+			}
+			location := rec.Header().Get("Location")
+			if tt.otherUser {
+				_, token = newTestVideo(t, cfg)
+			}
+
+			req := httptest.NewRequest(http.MethodPatch, location, bytes.NewReader([]byte("chunk")))
+			req.SetPathValue("uploadID", path.Base(location))
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Tus-Resumable", tt.version)
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("Upload-Offset", "0")
+			rec = httptest.NewRecorder()
+			cfg.handlerTusPatch(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
+
+func TestParseTusChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte("chunk"))
+
+	tests := []struct {
+		name       string
+		header     string
+		wantHash   bool
+		wantDigest []byte
+		wantErr    bool
+	}{
+		{name: "missing", header: ""},
+		{name: "sha256", header: "sha256 " + b64(string(sum[:])), wantHash: true, wantDigest: sum[:]},
+		{name: "no digest", header: "sha256", wantErr: true},
+		{name: "digest not base64", header: "sha256 !!!", wantErr: true},
+		{name: "unsupported algorithm", header: "crc32 " + b64("abcd"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, digest, err := parseTusChecksum(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (h != nil) != tt.wantHash {
+				t.Errorf("hash = %v, want one: %v", h, tt.wantHash)
+			}
+			if !bytes.Equal(digest, tt.wantDigest) {
+				t.Errorf("digest = %x, want %x", digest, tt.wantDigest)
+			}
+		})
+	}
+}
+
+func TestHandlerTusPatchChecksum(t *testing.T) {
+	first, second := []byte("first chunk, "), []byte("second chunk")
+	sha1Sum := sha1.Sum(first)
+	sha256Sum := sha256.Sum256(first)
+	md5Sum := md5.Sum(first)
+	corrupt := sha256.Sum256([]byte("something else"))
+
+	tests := []struct {
+		name       string
+		checksum   string
+		wantCode   int
+		wantOffset int
+	}{
+		{name: "no checksum", checksum: "", wantCode: http.StatusNoContent, wantOffset: len(first)},
+		{name: "sha1", checksum: "sha1 " + b64(string(sha1Sum[:])), wantCode: http.StatusNoContent, wantOffset: len(first)},
+		{name: "sha256", checksum: "sha256 " + b64(string(sha256Sum[:])), wantCode: http.StatusNoContent, wantOffset: len(first)},
+		{name: "md5", checksum: "md5 " + b64(string(md5Sum[:])), wantCode: http.StatusNoContent, wantOffset: len(first)},
+		{name: "corrupted chunk", checksum: "sha256 " + b64(string(corrupt[:])), wantCode: statusChecksumMismatch, wantOffset: 0},
+		{name: "unsupported algorithm", checksum: "crc32 " + b64("abcd"), wantCode: http.StatusBadRequest, wantOffset: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			video, token := newTestVideo(t, cfg)
+			rec := tusCreate(cfg, video.ID, token, len(first)+len(second), "filename "+b64("clip.mp4"))
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("create status = %d: %s", rec.Code, rec.Body)
+			}
+			location := rec.Header().Get("Location")
+
+			rec = tusPatch(cfg, location, token, 0, first, tt.checksum)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			rec = tusHead(cfg, location, token)
+			if got := rec.Header().Get("Upload-Offset"); got != strconv.Itoa(tt.wantOffset) {
+				t.Fatalf("Upload-Offset = %s, want %d", got, tt.wantOffset)
+			}
+
+			// a rejected chunk can be resent on its own, the upload then
+			// completes as if it had never been corrupted
+			if tt.wantOffset == 0 {
+				if rec := tusPatch(cfg, location, token, 0, first, "sha256 "+b64(string(sha256Sum[:]))); rec.Code != http.StatusNoContent {
+					t.Fatalf("retry status = %d: %s", rec.Code, rec.Body)
+				}
+			}
+			if rec := tusPatch(cfg, location, token, len(first), second, ""); rec.Code != http.StatusOK {
+				t.Fatalf("last chunk status = %d: %s", rec.Code, rec.Body)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, _ := cfg.videoKeyFromURL(*stored.VideoURL)
+			want := append(append([]byte{}, first...), second...)
+			if obj, ok := mem.Lookup(key); !ok || !bytes.Equal(obj.Data, want) {
+				t.Errorf("stored %q, want %q", obj.Data, want)
+			}
+		})
+	}
+}
+
+func TestReapAbandonedTusUploads(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	cfg.tusUploadTTL = time.Hour
+	video, token := newTestVideo(t, cfg)
+	rec := tusCreate(cfg, video.ID, token, 10, "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body)
+	}
+	location := rec.Header().Get("Location")
+	uploadID := uuid.MustParse(path.Base(location))
+
+	// nothing is reaped before the TTL runs out
+	if err := cfg.reapAbandonedTusUploads(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if rec := tusHead(cfg, location, token); rec.Code != http.StatusOK {
+		t.Fatalf("fresh upload head status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// a locked upload has a PATCH in flight and is left alone
+	cfg.tusLocks.tryLock(uploadID)
+	if err := cfg.reapAbandonedTusUploads(time.Now().Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if rec := tusHead(cfg, location, token); rec.Code != http.StatusOK {
+		t.Fatalf("locked upload head status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	cfg.tusLocks.unlock(uploadID)
+
+	if err := cfg.reapAbandonedTusUploads(time.Now().Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if rec := tusHead(cfg, location, token); rec.Code != http.StatusNotFound {
+		t.Errorf("abandoned upload head status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if _, err := os.Stat(cfg.tusUploadPath(uploadID)); !os.IsNotExist(err) {
+		t.Errorf("abandoned upload file left behind, stat err = %v", err)
+	}
+}
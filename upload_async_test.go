@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestPreferAsync(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		prefer []string
+		want   bool
+	}{
+		{name: "nothing asked", want: false},
+		{name: "respond-async", prefer: []string{"respond-async"}, want: true},
+		{name: "among other preferences", prefer: []string{"return=minimal, respond-async; wait=10"}, want: true},
+		{name: "in a second header", prefer: []string{"return=minimal", "Respond-Async"}, want: true},
+		{name: "other preferences only", prefer: []string{"return=minimal, wait=10"}, want: false},
+		{name: "query flag", query: "?async=true", want: true},
+		{name: "query flag off", query: "?async=false", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/video_upload/abc"+tt.query, nil)
+			for _, prefer := range tt.prefer {
+				req.Header.Add("Prefer", prefer)
+			}
+			if got := preferAsync(req); got != tt.want {
+				t.Errorf("preferAsync = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// waitForStatus polls the video until it leaves processing, so background
+// processing doesn't outlive the test.
+func waitForStatus(t *testing.T, cfg *apiConfig, videoID uuid.UUID) database.Video {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		video, err := cfg.db.GetVideo(videoID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if video.Status != database.VideoStatusProcessing {
+			return video
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("video is still processing")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestHandlerUploadVideoAsync(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		prefer    string
+		wantCode  int
+		wantAsync bool
+	}{
+		{name: "synchronous by default", wantCode: http.StatusOK},
+		{name: "Prefer header", prefer: "respond-async", wantCode: http.StatusAccepted, wantAsync: true},
+		{name: "query flag", query: "async=true", wantCode: http.StatusAccepted, wantAsync: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			video, token := newTestVideo(t, cfg)
+
+			req := newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil)
+			req.URL.RawQuery = tt.query
+			if tt.prefer != "" {
+				req.Header.Set("Prefer", tt.prefer)
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+
+			if tt.wantAsync {
+				statusURL := "/api/videos/" + video.ID.String() + "/status"
+				if got := rec.Header().Get("Location"); got != statusURL {
+					t.Errorf("Location = %q, want %q", got, statusURL)
+				}
+				if got := rec.Header().Get("Preference-Applied"); got != "respond-async" {
+					t.Errorf("Preference-Applied = %q, want respond-async", got)
+				}
+				var resp struct {
+					Status    string `json:"status"`
+					StatusURL string `json:"status_url"`
+				}
+				decodeData(t, rec, &resp)
+				if resp.Status != database.VideoStatusProcessing || resp.StatusURL != statusURL {
+					t.Errorf("response = %+v, want processing at %s", resp, statusURL)
+				}
+			} else {
+				var resp videoResponse
+				decodeData(t, rec, &resp)
+				if resp.VideoURL == nil {
+					t.Error("synchronous response has no video URL")
+				}
+			}
+
+			// either way the upload ends up processed
+			stored := waitForStatus(t, cfg, video.ID)
+			if stored.Status != database.VideoStatusReady || stored.VideoURL == nil {
+				t.Errorf("video status = %q, url = %v, want a ready, stored video", stored.Status, stored.VideoURL)
+			}
+		})
+	}
+}
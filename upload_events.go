@@ -0,0 +1,15 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/google/uuid"
+)
+
+// recordUploadEvent appends to a video's upload audit trail. The trail is
+// diagnostic only, so failing to write it never fails the upload.
+func (cfg *apiConfig) recordUploadEvent(videoID uuid.UUID, event, details string) {
+	if err := cfg.db.AppendUploadEvent(videoID, event, details); err != nil {
+		slog.Error("Couldn't record upload event", "event", event, "video_id", videoID, "err", err)
+	}
+}
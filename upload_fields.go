@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"mime/multipart"
+	"net/http"
+)
+
+// formFileAny returns the file of the first of names the multipart form
+// has, so frontends that name the input differently can share an endpoint.
+// It fails with http.ErrMissingFile when none of them is present.
+func formFileAny(r *http.Request, names []string) (multipart.File, *multipart.FileHeader, error) {
+	for _, name := range names {
+		file, header, err := r.FormFile(name)
+		if errors.Is(err, http.ErrMissingFile) {
+			continue
+		}
+		return file, header, err
+	}
+	return nil, nil, http.ErrMissingFile
+}
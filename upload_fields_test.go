@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFormFileAny(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    string
+		names    []string
+		wantErr  error
+		wantFile bool
+	}{
+		{name: "first name", field: "video", names: []string{"video", "file"}, wantFile: true},
+		{name: "later name", field: "file", names: []string{"video", "file"}, wantFile: true},
+		{name: "no match", field: "upload", names: []string{"video", "file"}, wantErr: http.ErrMissingFile},
+		{name: "no names", field: "video", names: nil, wantErr: http.ErrMissingFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, formType := multipartBody(t, tt.field, "clip.mp4", "video/mp4", []byte("data"), nil)
+			req := httptest.NewRequest(http.MethodPost, "/", body)
+			req.Header.Set("Content-Type", formType)
+			file, header, err := formFileAny(req, tt.names)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !tt.wantFile {
+				return
+			}
+			defer file.Close()
+			data, err := io.ReadAll(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "data" || header.Filename != "clip.mp4" {
+				t.Errorf("file = %q named %q, want %q named %q", data, header.Filename, "data", "clip.mp4")
+			}
+		})
+	}
+}
+
+func TestUploadHandlersFieldNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		thumbnail bool
+		field     string
+		wantCode  int
+	}{
+		{name: "video under an alternate name", field: "file", wantCode: http.StatusOK},
+		{name: "video under the default name", field: "video", wantCode: http.StatusOK},
+		{name: "video under an unknown name", field: "upload", wantCode: http.StatusBadRequest},
+		{name: "thumbnail under an alternate name", thumbnail: true, field: "image", wantCode: http.StatusOK},
+		{name: "thumbnail under the default name", thumbnail: true, field: "thumbnail", wantCode: http.StatusOK},
+		{name: "thumbnail under an unknown name", thumbnail: true, field: "upload", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.videoFieldNames = []string{"file", "video"}
+			cfg.thumbnailFieldNames = []string{"image", "thumbnail"}
+			installFakeFFmpeg(t, cfg, fakeProbe(1920, 1080))
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			if tt.thumbnail {
+				body, formType := multipartBody(t, tt.field, "thumb.png", "image/png", encodePNG(t, 64, 36), nil)
+				req := newVideoRequest(http.MethodPost, "/api/thumbnail_upload/"+video.ID.String(), video.ID, body, token)
+				req.Header.Set("Content-Type", formType)
+				cfg.handlerUploadThumbnail(rec, req)
+			} else {
+				cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, tt.field, "clip.mp4", "video/mp4", []byte("fake video"), nil))
+			}
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
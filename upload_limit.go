@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// uploadLimiter caps the number of uploads a single user can have in flight.
+// A max of zero or less disables the limit.
+type uploadLimiter struct {
+	mu     sync.Mutex
+	max    int
+	active map[uuid.UUID]int
+}
+
+func newUploadLimiter(max int) *uploadLimiter {
+	return &uploadLimiter{
+		max:    max,
+		active: map[uuid.UUID]int{},
+	}
+}
+
+func (l *uploadLimiter) acquire(userID uuid.UUID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max > 0 && l.active[userID] >= l.max {
+		return false
+	}
+	l.active[userID]++
+	return true
+}
+
+// retain takes another slot regardless of the limit, for background work
+// that carries on after the request holding a slot is done.
+func (l *uploadLimiter) retain(userID uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active[userID]++
+}
+
+func (l *uploadLimiter) release(userID uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active[userID]--
+	if l.active[userID] <= 0 {
+		delete(l.active, userID)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestUploadLimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		max  int
+		// run acquires and releases slots for one user and returns the
+		// result of a final acquire
+		run  func(l *uploadLimiter, userID uuid.UUID) bool
+		want bool
+	}{
+		{
+			name: "under the limit",
+			max:  2,
+			run: func(l *uploadLimiter, userID uuid.UUID) bool {
+				l.acquire(userID)
+				return l.acquire(userID)
+			},
+			want: true,
+		},
+		{
+			name: "at the limit",
+			max:  2,
+			run: func(l *uploadLimiter, userID uuid.UUID) bool {
+				l.acquire(userID)
+				l.acquire(userID)
+				return l.acquire(userID)
+			},
+		},
+		{
+			name: "a release frees a slot",
+			max:  1,
+			run: func(l *uploadLimiter, userID uuid.UUID) bool {
+				l.acquire(userID)
+				l.release(userID)
+				return l.acquire(userID)
+			},
+			want: true,
+		},
+		{
+			name: "retained slots count against the limit",
+			max:  1,
+			run: func(l *uploadLimiter, userID uuid.UUID) bool {
+				l.acquire(userID)
+				l.retain(userID)
+				l.release(userID)
+				return l.acquire(userID)
+			},
+		},
+		{
+			name: "other users don't share slots",
+			max:  1,
+			run: func(l *uploadLimiter, userID uuid.UUID) bool {
+				l.acquire(uuid.New())
+				return l.acquire(userID)
+			},
+			want: true,
+		},
+		{
+			name: "zero disables the limit",
+			max:  0,
+			run: func(l *uploadLimiter, userID uuid.UUID) bool {
+				for range 10 {
+					l.acquire(userID)
+				}
+				return l.acquire(userID)
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newUploadLimiter(tt.max)
+			if got := tt.run(l, uuid.New()); got != tt.want {
+				t.Errorf("acquire = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadLimiterReleaseForgetsIdleUsers(t *testing.T) {
+	l := newUploadLimiter(1)
+	userID := uuid.New()
+	l.acquire(userID)
+	l.release(userID)
+	if _, ok := l.active[userID]; ok {
+		t.Errorf("user with no uploads left is still tracked: %v", l.active)
+	}
+}
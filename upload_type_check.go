@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// uploadTypeCheck controls how strictly the declared content type, the file
+// name's extension and the container ffprobe detects have to agree.
+//
+//	off      nothing is compared
+//	lenient  they only have to belong to the same container family, so a
+//	         .mov file labeled video/mp4 passes (both are ISO BMFF)
+//	strict   they have to name exactly the same type
+type uploadTypeCheck string
+
+const (
+	uploadTypeCheckOff     uploadTypeCheck = "off"
+	uploadTypeCheckLenient uploadTypeCheck = "lenient"
+	uploadTypeCheckStrict  uploadTypeCheck = "strict"
+)
+
+func parseUploadTypeCheck(s string) (uploadTypeCheck, error) {
+	switch c := uploadTypeCheck(s); c {
+	case uploadTypeCheckOff, uploadTypeCheckLenient, uploadTypeCheckStrict:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown upload type check %q", s)
+}
+
+var extensionTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+	".mkv":  "video/x-matroska",
+	".avi":  "video/x-msvideo",
+}
+
+var typeFamilies = map[string]string{
+	"video/mp4":        "isobmff",
+	"video/quicktime":  "isobmff",
+	"video/webm":       "matroska",
+	"video/x-matroska": "matroska",
+	"video/x-msvideo":  "avi",
+}
+
+// normalizeMediaType relabels a declared type browsers are known to
+// misreport as video/mp4 when the file name says the upload is an MP4, and
+// reports whether it did. The label alone isn't trusted: processing makes
+// relabeled uploads pass as MP4 only if ffprobe detects exactly that
+// container, whatever uploadTypeCheck is set to.
+func (cfg *apiConfig) normalizeMediaType(declared, fileName string) (string, bool) {
+	if !slices.Contains(cfg.mediaTypeOverrides, declared) {
+		return declared, false
+	}
+	if extensionTypes[strings.ToLower(filepath.Ext(fileName))] != "video/mp4" {
+		return declared, false
+	}
+	return "video/mp4", true
+}
+
+// containerType maps ffprobe's format name, and for ISO BMFF files the
+// major brand, to a content type. It's empty for containers we don't know.
+func (p videoProbe) containerType() string {
+	switch {
+	case strings.Contains(p.FormatName, "mp4"):
+		if strings.TrimSpace(p.MajorBrand) == "qt" {
+			return "video/quicktime"
+		}
+		return "video/mp4"
+	case strings.Contains(p.FormatName, "webm"):
+		return "video/webm"
+	case strings.Contains(p.FormatName, "avi"):
+		return "video/x-msvideo"
+	}
+	return ""
+}
+
+// checkUploadType compares the declared content type with the type implied
+// by fileName's extension and the detected container. Unknown extensions
+// and containers, and an empty fileName, aren't held against the upload.
+func checkUploadType(mode uploadTypeCheck, declared, fileName string, probe videoProbe) error {
+	if mode == uploadTypeCheckOff {
+		return nil
+	}
+	same := func(a, b string) bool {
+		if mode == uploadTypeCheckStrict {
+			return a == b
+		}
+		return typeFamilies[a] != "" && typeFamilies[a] == typeFamilies[b]
+	}
+
+	if fileName != "" {
+		if byExt, ok := extensionTypes[strings.ToLower(filepath.Ext(fileName))]; ok && !same(declared, byExt) {
+			return fmt.Errorf("file name %s doesn't match content type %s", fileName, declared)
+		}
+	}
+	if detected := probe.containerType(); detected != "" && !same(declared, detected) {
+		return fmt.Errorf("file is %s, not %s", detected, declared)
+	}
+	return nil
+}
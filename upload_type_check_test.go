@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseUploadTypeCheck(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    uploadTypeCheck
+		wantErr bool
+	}{
+		{s: "off", want: uploadTypeCheckOff},
+		{s: "lenient", want: uploadTypeCheckLenient},
+		{s: "strict", want: uploadTypeCheckStrict},
+		{s: "Strict", wantErr: true},
+		{s: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseUploadTypeCheck(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseUploadTypeCheck(%q) err = %v, want error %v", tt.s, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseUploadTypeCheck(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerType(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe videoProbe
+		want  string
+	}{
+		{name: "mp4", probe: videoProbe{FormatName: "mov,mp4,m4a,3gp,3g2,mj2", MajorBrand: "isom"}, want: "video/mp4"},
+		{name: "quicktime", probe: videoProbe{FormatName: "mov,mp4,m4a,3gp,3g2,mj2", MajorBrand: "qt  "}, want: "video/quicktime"},
+		{name: "webm", probe: videoProbe{FormatName: "matroska,webm"}, want: "video/webm"},
+		{name: "avi", probe: videoProbe{FormatName: "avi"}, want: "video/x-msvideo"},
+		{name: "unknown", probe: videoProbe{FormatName: "flv"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.probe.containerType(); got != tt.want {
+				t.Errorf("containerType = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckUploadType(t *testing.T) {
+	mp4 := videoProbe{FormatName: "mov,mp4,m4a,3gp,3g2,mj2", MajorBrand: "isom"}
+	mov := videoProbe{FormatName: "mov,mp4,m4a,3gp,3g2,mj2", MajorBrand: "qt  "}
+	webm := videoProbe{FormatName: "matroska,webm"}
+	tests := []struct {
+		name     string
+		mode     uploadTypeCheck
+		declared string
+		fileName string
+		probe    videoProbe
+		wantErr  bool
+	}{
+		{name: "consistent mp4", mode: uploadTypeCheckStrict, declared: "video/mp4", fileName: "clip.mp4", probe: mp4},
+		{name: "m4v is mp4", mode: uploadTypeCheckStrict, declared: "video/mp4", fileName: "clip.M4V", probe: mp4},
+		{name: "mov named mp4, lenient", mode: uploadTypeCheckLenient, declared: "video/mp4", fileName: "clip.mov", probe: mov},
+		{name: "mov named mp4, strict", mode: uploadTypeCheckStrict, declared: "video/mp4", fileName: "clip.mov", probe: mp4, wantErr: true},
+		{name: "quicktime container, strict", mode: uploadTypeCheckStrict, declared: "video/mp4", fileName: "clip.mp4", probe: mov, wantErr: true},
+		{name: "webm labeled mp4, lenient", mode: uploadTypeCheckLenient, declared: "video/mp4", fileName: "clip.mp4", probe: webm, wantErr: true},
+		{name: "webm file name, lenient", mode: uploadTypeCheckLenient, declared: "video/mp4", fileName: "clip.webm", probe: mp4, wantErr: true},
+		{name: "unknown extension", mode: uploadTypeCheckStrict, declared: "video/mp4", fileName: "clip.bin", probe: mp4},
+		{name: "no file name", mode: uploadTypeCheckStrict, declared: "video/mp4", probe: mp4},
+		{name: "unknown container", mode: uploadTypeCheckStrict, declared: "video/mp4", fileName: "clip.mp4", probe: videoProbe{FormatName: "flv"}},
+		{name: "off ignores everything", mode: uploadTypeCheckOff, declared: "video/mp4", fileName: "clip.webm", probe: webm},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkUploadType(tt.mode, tt.declared, tt.fileName, tt.probe)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkUploadType err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizeMediaType(t *testing.T) {
+	cfg := &apiConfig{mediaTypeOverrides: []string{"application/octet-stream", "video/quicktime"}}
+
+	tests := []struct {
+		name          string
+		declared      string
+		fileName      string
+		want          string
+		wantRelabeled bool
+	}{
+		{name: "octet-stream mp4", declared: "application/octet-stream", fileName: "clip.mp4", want: "video/mp4", wantRelabeled: true},
+		{name: "quicktime mp4", declared: "video/quicktime", fileName: "Clip.MP4", want: "video/mp4", wantRelabeled: true},
+		{name: "octet-stream m4v", declared: "application/octet-stream", fileName: "clip.m4v", want: "video/mp4", wantRelabeled: true},
+		{name: "already mp4", declared: "video/mp4", fileName: "clip.mp4", want: "video/mp4"},
+		{name: "octet-stream with another extension", declared: "application/octet-stream", fileName: "notes.bin", want: "application/octet-stream"},
+		{name: "quicktime mov", declared: "video/quicktime", fileName: "clip.mov", want: "video/quicktime"},
+		{name: "type not in the overrides", declared: "image/png", fileName: "clip.mp4", want: "image/png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, relabeled := cfg.normalizeMediaType(tt.declared, tt.fileName)
+			if got != tt.want || relabeled != tt.wantRelabeled {
+				t.Errorf("normalizeMediaType(%q, %q) = %q, %v, want %q, %v", tt.declared, tt.fileName, got, relabeled, tt.want, tt.wantRelabeled)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoMediaTypeOverrides(t *testing.T) {
+	mp4 := fakeProbe(1920, 1080)
+	webm := strings.Replace(mp4, "mov,mp4,m4a,3gp,3g2,mj2", "matroska,webm", 1)
+	image := `{
+		"streams": [{"index": 0, "codec_type": "video", "codec_name": "png", "width": 640, "height": 360}],
+		"format": {"format_name": "png_pipe"}
+	}`
+
+	tests := []struct {
+		name        string
+		contentType string
+		fileName    string
+		probe       string
+		overrides   []string
+		wantCode    int
+	}{
+		{name: "mp4 reported as octet-stream", contentType: "application/octet-stream", fileName: "clip.mp4", probe: mp4, wantCode: http.StatusOK},
+		{name: "mp4 reported as quicktime", contentType: "video/quicktime", fileName: "clip.mp4", probe: mp4, wantCode: http.StatusOK},
+		{name: "octet-stream that isn't a video", contentType: "application/octet-stream", fileName: "clip.mp4", probe: image, wantCode: http.StatusBadRequest},
+		{name: "octet-stream that is a webm", contentType: "application/octet-stream", fileName: "clip.mp4", probe: webm, wantCode: http.StatusBadRequest},
+		{name: "octet-stream without an mp4 name", contentType: "application/octet-stream", fileName: "clip.bin", probe: mp4, wantCode: http.StatusBadRequest},
+		{name: "octet-stream when not overridden", contentType: "application/octet-stream", fileName: "clip.mp4", probe: mp4, overrides: []string{"video/quicktime"}, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			if tt.overrides != nil {
+				cfg.mediaTypeOverrides = tt.overrides
+			}
+			installFakeFFmpeg(t, cfg, tt.probe)
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", tt.fileName, tt.contentType, []byte("fake video"), nil))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uploaded := stored.VideoURL != nil; uploaded != (tt.wantCode == http.StatusOK) {
+				t.Errorf("video stored = %v, want %v", uploaded, tt.wantCode == http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type validationError struct {
+	Fields []fieldError
+}
+
+func (e *validationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.Field, f.Message))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// decodeJSONBody decodes the request body into dst, rejecting unknown fields,
+// and then checks the `validate` tags on dst's fields. An empty body counts
+// as an empty object.
+//
+//	required  the field must be present (and non-zero if it isn't a pointer)
+//	nonempty  a present string field can't be empty
+//	max=N     a string field can't be longer than N characters
+//
+// Any problem with the body is reported as a list of field errors.
+func decodeJSONBody(r *http.Request, dst any) *validationError {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil && !errors.Is(err, io.EOF) {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return &validationError{Fields: []fieldError{{
+				Field:   strings.Trim(field, `"`),
+				Message: "unknown field",
+			}}}
+		}
+		return &validationError{Fields: []fieldError{{
+			Field:   "body",
+			Message: err.Error(),
+		}}}
+	}
+
+	var errs []fieldError
+	validateStruct(reflect.ValueOf(dst).Elem(), &errs)
+	if len(errs) > 0 {
+		return &validationError{Fields: errs}
+	}
+	return nil
+}
+
+func validateStruct(v reflect.Value, errs *[]fieldError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+		if field.Anonymous && value.Kind() == reflect.Struct {
+			validateStruct(value, errs)
+			continue
+		}
+
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		present := !value.IsZero()
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				present = false
+			} else {
+				present = true
+				value = value.Elem()
+			}
+		}
+
+		for _, rule := range strings.Split(tag, ",") {
+			rule, arg, _ := strings.Cut(rule, "=")
+			switch rule {
+			case "required":
+				if !present {
+					*errs = append(*errs, fieldError{Field: name, Message: "is required"})
+				}
+			case "nonempty":
+				if present && value.Kind() == reflect.String && value.String() == "" {
+					*errs = append(*errs, fieldError{Field: name, Message: "can't be empty"})
+				}
+			case "max":
+				limit, err := strconv.Atoi(arg)
+				if err != nil {
+					panic(fmt.Sprintf("invalid max rule on %s: %v", field.Name, err))
+				}
+				if present && value.Kind() == reflect.String && utf8.RuneCountInString(value.String()) > limit {
+					*errs = append(*errs, fieldError{Field: name, Message: fmt.Sprintf("can't be longer than %d characters", limit)})
+				}
+			}
+		}
+	}
+}
+
+func respondWithValidationError(w http.ResponseWriter, err *validationError) {
+	respondWithEnvelope(w, http.StatusBadRequest, envelope{
+		Error: &envelopeError{
+			Code:    "validation_failed",
+			Message: "Invalid request body",
+			Fields:  err.Fields,
+		},
+	})
+}
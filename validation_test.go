@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSONBody(t *testing.T) {
+	type embedded struct {
+		Name string `json:"name" validate:"required"`
+	}
+	type parameters struct {
+		embedded
+		Title       *string `json:"title" validate:"nonempty,max=5"`
+		Description string  `json:"description" validate:"max=3"`
+		Count       int     `json:"count"`
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantFields []fieldError
+	}{
+		{name: "valid", body: `{"name": "a", "title": "hello", "description": "abc"}`},
+		{name: "max counts characters, not bytes", body: `{"name": "a", "title": "héllo"}`},
+		{name: "missing required field", body: `{"title": "hi"}`, wantFields: []fieldError{{Field: "name", Message: "is required"}}},
+		{name: "empty body", body: ``, wantFields: []fieldError{{Field: "name", Message: "is required"}}},
+		{name: "empty pointer string", body: `{"name": "a", "title": ""}`, wantFields: []fieldError{{Field: "title", Message: "can't be empty"}}},
+		{name: "too long", body: `{"name": "a", "title": "toolong", "description": "abcd"}`, wantFields: []fieldError{
+			{Field: "title", Message: "can't be longer than 5 characters"},
+			{Field: "description", Message: "can't be longer than 3 characters"},
+		}},
+		{name: "unknown field", body: `{"name": "a", "color": "red"}`, wantFields: []fieldError{{Field: "color", Message: "unknown field"}}},
+		{name: "wrong type", body: `{"name": "a", "count": "three"}`, wantFields: []fieldError{{Field: "body"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			var params parameters
+			verr := decodeJSONBody(req, &params)
+			if verr == nil {
+				if tt.wantFields != nil {
+					t.Fatalf("decodeJSONBody accepted the body, want %v", tt.wantFields)
+				}
+				return
+			}
+			if tt.wantFields == nil {
+				t.Fatalf("decodeJSONBody = %v, want no error", verr)
+			}
+			// decode errors come with the decoder's message
+			if tt.wantFields[0].Field == "body" {
+				if len(verr.Fields) != 1 || verr.Fields[0].Field != "body" {
+					t.Errorf("fields = %v, want a body error", verr.Fields)
+				}
+				return
+			}
+			if !reflect.DeepEqual(verr.Fields, tt.wantFields) {
+				t.Errorf("fields = %v, want %v", verr.Fields, tt.wantFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestNewPartialUploadResponse(t *testing.T) {
+	variants := []database.VideoVariant{
+		{Name: "1080p", Status: database.VariantStatusReady},
+		{Name: "720p", Status: database.VariantStatusFailed},
+		{Name: "480p"},
+	}
+	failures := []variantFailure{{Name: "720p", Reason: variantFailureReason}}
+
+	resp := newPartialUploadResponse(videoResponse{}, variants, failures)
+	if want := []string{"1080p", "480p"}; !reflect.DeepEqual(resp.AvailableVariants, want) {
+		t.Errorf("available_variants = %v, want %v", resp.AvailableVariants, want)
+	}
+	if !reflect.DeepEqual(resp.FailedVariants, failures) {
+		t.Errorf("failed_variants = %v, want %v", resp.FailedVariants, failures)
+	}
+}
+
+func TestHandlerUploadVideoPartialVariants(t *testing.T) {
+	tests := []struct {
+		name          string
+		failOn        string
+		strict        bool
+		wantCode      int
+		wantAvailable []string
+		wantFailed    []string
+	}{
+		{name: "all variants encode", failOn: "never-matches", wantCode: http.StatusOK, wantAvailable: []string{"720p", "480p"}},
+		{name: "one variant fails", failOn: "scale=-2:480", wantCode: http.StatusMultiStatus, wantAvailable: []string{"720p"}, wantFailed: []string{"480p"}},
+		{name: "every variant fails", failOn: "libx264", wantCode: http.StatusMultiStatus, wantAvailable: []string{}, wantFailed: []string{"720p", "480p"}},
+		{name: "strict", failOn: "scale=-2:480", strict: true, wantCode: http.StatusInternalServerError},
+		{name: "primary fails", failOn: "-c copy", wantCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.faststartStrict = true
+			cfg.variantsStrict = tt.strict
+			cfg.variantParallelism = 1
+			installFailingFFmpeg(t, cfg, tt.failOn)
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode == http.StatusInternalServerError {
+				if keys := mem.Keys(); len(keys) != 0 {
+					t.Errorf("objects left behind: %v", keys)
+				}
+				return
+			}
+			if tt.wantCode == http.StatusMultiStatus {
+				var resp partialUploadResponse
+				decodeData(t, rec, &resp)
+				if resp.VideoURL == nil {
+					t.Fatal("partial upload has no video URL")
+				}
+				if !reflect.DeepEqual(resp.AvailableVariants, tt.wantAvailable) {
+					t.Errorf("available_variants = %v, want %v", resp.AvailableVariants, tt.wantAvailable)
+				}
+				failed := []string{}
+				for _, f := range resp.FailedVariants {
+					failed = append(failed, f.Name)
+					// ffmpeg's own output stays in the logs
+					if f.Reason != variantFailureReason {
+						t.Errorf("%s reason = %q, want %q", f.Name, f.Reason, variantFailureReason)
+					}
+				}
+				if !reflect.DeepEqual(failed, tt.wantFailed) {
+					t.Errorf("failed_variants = %v, want %v", failed, tt.wantFailed)
+				}
+			}
+
+			stored, err := cfg.db.GetVideoVariants(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			statuses := map[string]string{}
+			for _, v := range stored {
+				statuses[v.Name] = v.Status
+			}
+			for _, name := range tt.wantAvailable {
+				if statuses[name] != database.VariantStatusReady {
+					t.Errorf("%s status = %q, want %q", name, statuses[name], database.VariantStatusReady)
+				}
+			}
+			for _, name := range tt.wantFailed {
+				if statuses[name] != database.VariantStatusFailed {
+					t.Errorf("%s status = %q, want %q", name, statuses[name], database.VariantStatusFailed)
+				}
+				for _, key := range mem.Keys() {
+					if strings.Contains(key, "_"+name) {
+						t.Errorf("failed variant %s was stored as %s", name, key)
+					}
+				}
+			}
+
+			events, err := cfg.db.GetUploadEvents(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			recorded := 0
+			for _, e := range events {
+				if e.Event == database.UploadEventVariantFailed {
+					recorded++
+				}
+			}
+			if recorded != len(tt.wantFailed) {
+				t.Errorf("%d variant_failed events, want %d", recorded, len(tt.wantFailed))
+			}
+		})
+	}
+}
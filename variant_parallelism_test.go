@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// installCountingFFmpeg is installFakeFFmpeg with variant encodes that take
+// a while and record how many were running when each started. Variant
+// encodes exit with an error instead when fail is set. It returns the log
+// of running counts.
+func installCountingFFmpeg(t *testing.T, cfg *apiConfig, fail bool) string {
+	t.Helper()
+	installFakeFFmpeg(t, cfg, fakeProbe(3840, 2160))
+	dir := t.TempDir()
+	running := filepath.Join(dir, "running")
+	countsPath := filepath.Join(dir, "counts.log")
+	exit := ""
+	if fail {
+		exit = "exit 1"
+	}
+	cfg.ffmpegPath = fakeCommand(t, "ffmpeg", `case "$*" in *tubely-variant-*)
+	mkdir -p `+running+`
+	touch `+running+`/$$
+	ls `+running+` | wc -l >> `+countsPath+`
+	sleep 0.3
+	rm `+running+`/$$
+	`+exit+`
+esac
+in=
+prev=
+for arg; do
+	if [ "$prev" = "-i" ] && [ -z "$in" ]; then in=$arg; fi
+	prev=$arg
+done
+cp "$in" "$arg"
+`)
+	return countsPath
+}
+
+// runningCounts reads the log of installCountingFFmpeg.
+func runningCounts(t *testing.T, countsPath string) []int {
+	t.Helper()
+	data, err := os.ReadFile(countsPath)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	counts := []int{}
+	for _, field := range strings.Fields(string(data)) {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts = append(counts, n)
+	}
+	return counts
+}
+
+func TestHandlerUploadVideoVariantParallelism(t *testing.T) {
+	tests := []struct {
+		parallelism int
+		wantMax     int
+	}{
+		{parallelism: 1, wantMax: 1},
+		{parallelism: 2, wantMax: 2},
+		{parallelism: 0, wantMax: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.parallelism), func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			// the shared pool mustn't be what limits the encodes
+			cfg.workers = newWorkerPool(8, 64)
+			cfg.variantParallelism = tt.parallelism
+			countsPath := installCountingFFmpeg(t, cfg, false)
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+
+			counts := runningCounts(t, countsPath)
+			if len(counts) != len(variantLadder) {
+				t.Fatalf("%d variant encodes, want %d", len(counts), len(variantLadder))
+			}
+			if got := slices.Max(counts); got != tt.wantMax {
+				t.Errorf("at most %d encodes ran at once, want %d", got, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoStrictVariantFailure(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	cfg, mem := newTestConfig(t)
+	cfg.workers = newWorkerPool(8, 64)
+	cfg.variantParallelism = 1
+	cfg.variantsStrict = true
+	countsPath := installCountingFFmpeg(t, cfg, true)
+	video, token := newTestVideo(t, cfg)
+
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusInternalServerError, rec.Body)
+	}
+
+	// the first failure cancels the encodes still waiting
+	if counts := runningCounts(t, countsPath); len(counts) != 1 {
+		t.Errorf("%d variant encodes started, want 1", len(counts))
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(os.TempDir(), "tubely-variant-*"))
+	if len(leftovers) != 0 {
+		t.Errorf("temp files left behind: %v", leftovers)
+	}
+	if keys := mem.Keys(); len(keys) != 0 {
+		t.Errorf("objects left behind: %v", keys)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// validCategory reports whether category is one of the configured video
+// categories. The empty category, meaning uncategorized, is always valid.
+func (cfg *apiConfig) validCategory(category string) bool {
+	return category == "" || slices.Contains(cfg.videoCategories, category)
+}
+
+func (cfg *apiConfig) categoryMessage() string {
+	if len(cfg.videoCategories) == 0 {
+		return "No video categories are configured"
+	}
+	return fmt.Sprintf("category must be one of: %s", strings.Join(cfg.videoCategories, ", "))
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+var testCategories = []string{"music", "gaming", "education"}
+
+func TestValidCategory(t *testing.T) {
+	tests := []struct {
+		name       string
+		categories []string
+		category   string
+		want       bool
+	}{
+		{name: "configured", categories: testCategories, category: "gaming", want: true},
+		{name: "uncategorized", categories: testCategories, category: "", want: true},
+		{name: "not configured", categories: testCategories, category: "sports"},
+		{name: "case matters", categories: testCategories, category: "Gaming"},
+		{name: "none configured", category: "gaming"},
+		{name: "uncategorized with none configured", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{videoCategories: tt.categories}
+			if got := cfg.validCategory(tt.category); got != tt.want {
+				t.Errorf("validCategory(%q) = %v, want %v", tt.category, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoCategory(t *testing.T) {
+	tests := []struct {
+		name         string
+		category     string
+		wantCode     int
+		wantCategory string
+	}{
+		{name: "valid category", category: "music", wantCode: http.StatusOK, wantCategory: "music"},
+		{name: "no category", wantCode: http.StatusOK},
+		{name: "invalid category", category: "sports", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.videoCategories = testCategories
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			video, token := newTestVideo(t, cfg)
+
+			values := map[string]string{}
+			if tt.category != "" {
+				values["category"] = tt.category
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), values))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Category != tt.wantCategory {
+				t.Errorf("category = %q, want %q", stored.Category, tt.wantCategory)
+			}
+		})
+	}
+}
+
+func TestHandlerVideoMetaUpdateCategory(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantCode     int
+		wantCategory string
+	}{
+		{name: "valid category", body: `{"category":"education"}`, wantCode: http.StatusOK, wantCategory: "education"},
+		{name: "cleared", body: `{"category":""}`, wantCode: http.StatusOK},
+		{name: "left alone", body: `{"title":"Renamed"}`, wantCode: http.StatusOK, wantCategory: "music"},
+		{name: "invalid category", body: `{"category":"sports"}`, wantCode: http.StatusBadRequest, wantCategory: "music"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.videoCategories = testCategories
+			video, token := newTestVideo(t, cfg)
+			video.Category = "music"
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+
+			req := newVideoRequest(http.MethodPatch, "/api/videos/"+video.ID.String(), video.ID, strings.NewReader(tt.body), token)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoMetaUpdate(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Category != tt.wantCategory {
+				t.Errorf("category = %q, want %q", stored.Category, tt.wantCategory)
+			}
+		})
+	}
+}
+
+func TestHandlerVideosRetrieveCategory(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantCode   int
+		wantTitles []string
+	}{
+		{name: "every video", query: "", wantCode: http.StatusOK, wantTitles: []string{"gaming", "music 1", "music 2", "uncategorized"}},
+		{name: "one category", query: "?category=music", wantCode: http.StatusOK, wantTitles: []string{"music 1", "music 2"}},
+		{name: "an empty category", query: "?category=education", wantCode: http.StatusOK},
+		{name: "unknown category", query: "?category=sports", wantCode: http.StatusBadRequest},
+	}
+
+	cfg, _ := newTestConfig(t)
+	cfg.videoCategories = testCategories
+	first, token := newTestVideo(t, cfg)
+	for i, v := range []struct{ title, category string }{
+		{"music 1", "music"},
+		{"music 2", "music"},
+		{"gaming", "gaming"},
+		{"uncategorized", ""},
+	} {
+		video := first
+		if i > 0 {
+			video = newUserVideo(t, cfg, first)
+		}
+		video.Title = v.title
+		video.Category = v.category
+		if err := cfg.db.UpdateVideo(video); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// someone else's videos in the same category aren't listed
+	other, _ := newTestVideo(t, cfg)
+	other.Category = "music"
+	if err := cfg.db.UpdateVideo(other); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			cfg.handlerVideosRetrieve(rec, newVideoRequest(http.MethodGet, "/api/videos"+tt.query, uuid.Nil, nil, token))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var resp []videoResponse
+			decodeData(t, rec, &resp)
+			var titles []string
+			for _, v := range resp {
+				titles = append(titles, v.Title)
+			}
+			slices.Sort(titles)
+			if strings.Join(titles, ",") != strings.Join(tt.wantTitles, ",") {
+				t.Errorf("titles = %v, want %v", titles, tt.wantTitles)
+			}
+		})
+	}
+}
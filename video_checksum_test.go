@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContentHash(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "empty", content: "", want: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{name: "hello", content: "hello", want: helloSHA256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := strings.NewReader(tt.content)
+			got, err := contentHash(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("contentHash = %s, want %s", got, tt.want)
+			}
+			// rewound for the upload that follows
+			rest, _ := io.ReadAll(r)
+			if string(rest) != tt.content {
+				t.Errorf("read after hashing = %q, want %q", rest, tt.content)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoChecksum(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "known digest", content: "hello", want: helloSHA256},
+		{name: "other content", content: "fake video"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			installFakeFFmpeg(t, cfg, fakeProbe(1920, 1080))
+			video, token := newTestVideo(t, cfg)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", []byte(tt.content), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var resp videoResponse
+			decodeData(t, rec, &resp)
+
+			key, ok := cfg.videoKeyFromURL(*resp.VideoURL)
+			if !ok {
+				t.Fatalf("Couldn't get key from %q", *resp.VideoURL)
+			}
+			obj, ok := mem.Lookup(key)
+			if !ok {
+				t.Fatalf("object %q wasn't stored", key)
+			}
+			sum := sha256.Sum256(obj.Data)
+			want := hex.EncodeToString(sum[:])
+			if tt.want != "" && want != tt.want {
+				t.Fatalf("stored object digest = %s, want %s", want, tt.want)
+			}
+
+			if resp.SHA256 != want {
+				t.Errorf("upload sha256 = %q, want %q", resp.SHA256, want)
+			}
+			if got := obj.Metadata["sha256"]; got != want {
+				t.Errorf("object sha256 metadata = %q, want %q", got, want)
+			}
+
+			req := newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String(), video.ID, nil, token)
+			rec = httptest.NewRecorder()
+			cfg.handlerVideoGet(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET status = %d: %s", rec.Code, rec.Body)
+			}
+			var got videoResponse
+			decodeData(t, rec, &got)
+			if got.SHA256 != want {
+				t.Errorf("GET sha256 = %q, want %q", got.SHA256, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// downloadToTemp copies a stored object into a temp file so ffmpeg/ffprobe
+// can work on it. The caller removes the returned file.
+func (cfg *apiConfig) downloadToTemp(ctx context.Context, key string) (string, error) {
+	ctx, cancel := cfg.storageContext(ctx)
+	defer cancel()
+	obj, err := cfg.storage.Get(ctx, key, "")
+	if err != nil {
+		return "", err
+	}
+	defer obj.Body.Close()
+
+	tempFile, err := os.CreateTemp("", "tubely-download")
+	if err != nil {
+		return "", err
+	}
+	defer tempFile.Close()
+
+	if _, err := io.Copy(tempFile, obj.Body); err != nil {
+		os.Remove(tempFile.Name())
+		return "", err
+	}
+	return tempFile.Name(), nil
+}
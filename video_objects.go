@@ -0,0 +1,111 @@
+package main
+
+import (
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// videoObjectKeys lists every storage key that may belong to a video: the
+// primary file, its variants, the preview GIF, chapters, captions, the
+// archived original and extracted audio.
+// Keys that were never written are harmless to delete.
+func (cfg *apiConfig) videoObjectKeys(video database.Video) ([]string, error) {
+	keys := []string{}
+	if video.VideoURL != nil {
+		if key, ok := cfg.videoKeyFromURL(*video.VideoURL); ok {
+			keys = append(keys, key, previewGIFKey(key))
+			for _, format := range audioFormats {
+				keys = append(keys, audioKey(key, format))
+			}
+		}
+	}
+	if video.ChaptersURL != nil {
+		if key, ok := cfg.videoKeyFromURL(*video.ChaptersURL); ok {
+			keys = append(keys, key)
+		}
+	}
+	if video.OriginalKey != "" {
+		keys = append(keys, video.OriginalKey)
+	}
+
+	variants, err := cfg.db.GetVideoVariants(video.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range variants {
+		if v.Status == database.VariantStatusFailed {
+			continue
+		}
+		if key, ok := cfg.videoKeyFromURL(v.URL); ok {
+			keys = append(keys, key)
+		}
+	}
+
+	captions, err := cfg.db.GetVideoCaptions(video.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, caption := range captions {
+		if key, ok := cfg.videoKeyFromURL(caption.URL); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// unsharedObjectKeys drops the keys that a video outside deleting still
+// references. Deterministic key naming stores identical uploads once, so a
+// shared object has to outlive every video but the last one using it.
+func (cfg *apiConfig) unsharedObjectKeys(keys []string, deleting []database.Video) ([]string, error) {
+	deleted := map[uuid.UUID]bool{}
+	for _, video := range deleting {
+		deleted[video.ID] = true
+	}
+
+	referenced := map[string]bool{}
+	for _, video := range deleting {
+		sharing, err := cfg.sharingVideos(video)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range sharing {
+			if deleted[other.ID] {
+				continue
+			}
+			otherKeys, err := cfg.videoObjectKeys(other)
+			if err != nil {
+				return nil, err
+			}
+			for _, key := range otherKeys {
+				referenced[key] = true
+			}
+		}
+	}
+
+	unshared := []string{}
+	for _, key := range keys {
+		if !referenced[key] {
+			unshared = append(unshared, key)
+		}
+	}
+	return unshared, nil
+}
+
+// sharingVideos lists the other videos, of any user, stored under the same
+// primary object as video, and so sharing the objects derived from it.
+func (cfg *apiConfig) sharingVideos(video database.Video) ([]database.Video, error) {
+	if video.VideoURL == nil {
+		return nil, nil
+	}
+	videos, err := cfg.db.GetVideosByVideoURL(*video.VideoURL)
+	if err != nil {
+		return nil, err
+	}
+	others := []database.Video{}
+	for _, other := range videos {
+		if other.ID != video.ID {
+			others = append(others, other)
+		}
+	}
+	return others, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// videoProbe holds what we care about from ffprobe's output.
+type videoProbe struct {
+	Width          int
+	Height         int
+	VideoCodec     string
+	HasAudio       bool
+	ColorSpace     string
+	ColorTransfer  string
+	ColorPrimaries string
+	Encrypted      bool
+	FormatName     string
+	MajorBrand     string
+	Duration       float64
+	Bitrate        int64
+	Subtitles      []subtitleStream
+}
+
+// subtitleStream is an embedded subtitle track, Index is its stream index
+// in the container.
+type subtitleStream struct {
+	Index    int
+	Language string
+	Title    string
+}
+
+// encryptedCodecTags are the sample entry types of protected (CENC/FairPlay)
+// tracks, ffmpeg can't decode any of them.
+var encryptedCodecTags = map[string]bool{
+	"encv": true,
+	"enca": true,
+	"drmi": true,
+	"drms": true,
+}
+
+type probeSideData struct {
+	Type string `json:"side_data_type"`
+}
+
+func (cfg *apiConfig) probeVideo(filePath string) (videoProbe, error) {
+	out, err := cfg.probeVideoRaw(filePath)
+	if err != nil {
+		return videoProbe{}, err
+	}
+	return parseVideoProbe(out)
+}
+
+// probeVideoRaw returns ffprobe's full JSON description of the file's
+// streams and format.
+func (cfg *apiConfig) probeVideoRaw(filePath string) ([]byte, error) {
+	cmd := exec.Command(
+		cfg.ffprobePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_streams",
+		"-show_format",
+		filePath,
+	)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	logCommand(cmd)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+func parseVideoProbe(data []byte) (videoProbe, error) {
+	var output struct {
+		Streams []struct {
+			Index          int               `json:"index"`
+			CodecType      string            `json:"codec_type"`
+			CodecName      string            `json:"codec_name"`
+			Width          int               `json:"width"`
+			Height         int               `json:"height"`
+			ColorSpace     string            `json:"color_space"`
+			ColorTransfer  string            `json:"color_transfer"`
+			ColorPrimaries string            `json:"color_primaries"`
+			CodecTag       string            `json:"codec_tag_string"`
+			Tags           map[string]string `json:"tags"`
+			SideData       []probeSideData   `json:"side_data_list"`
+			Disposition    struct {
+				AttachedPic int `json:"attached_pic"`
+			} `json:"disposition"`
+		} `json:"streams"`
+		Format struct {
+			FormatName string `json:"format_name"`
+			Duration   string `json:"duration"`
+			BitRate    string `json:"bit_rate"`
+			Tags       struct {
+				MajorBrand string `json:"major_brand"`
+			} `json:"tags"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(data, &output); err != nil {
+		return videoProbe{}, fmt.Errorf("couldn't parse ffprobe output: %w", err)
+	}
+
+	probe := videoProbe{
+		FormatName: output.Format.FormatName,
+		MajorBrand: output.Format.Tags.MajorBrand,
+	}
+	// missing or "N/A" for some streams, which just leaves it at zero
+	probe.Duration, _ = strconv.ParseFloat(output.Format.Duration, 64)
+	probe.Bitrate, _ = strconv.ParseInt(output.Format.BitRate, 10, 64)
+	for _, s := range output.Streams {
+		if streamEncrypted(s.CodecTag, s.Tags, s.SideData) {
+			probe.Encrypted = true
+		}
+		switch s.CodecType {
+		case "video":
+			// cover art is a single attached picture, it can be larger
+			// than the video itself
+			if s.Disposition.AttachedPic != 0 {
+				continue
+			}
+			// containers may carry other extra video streams, the main
+			// video is the largest one
+			if s.Width > 0 && s.Height > 0 && s.Width*s.Height > probe.Width*probe.Height {
+				probe.Width = s.Width
+				probe.Height = s.Height
+				probe.VideoCodec = s.CodecName
+				probe.ColorSpace = s.ColorSpace
+				probe.ColorTransfer = s.ColorTransfer
+				probe.ColorPrimaries = s.ColorPrimaries
+			}
+		case "audio":
+			probe.HasAudio = true
+		case "subtitle":
+			probe.Subtitles = append(probe.Subtitles, subtitleStream{
+				Index:    s.Index,
+				Language: s.Tags["language"],
+				Title:    s.Tags["title"],
+			})
+		}
+	}
+	return probe, nil
+}
+
+// streamEncrypted looks for the signs ffprobe leaves on DRM protected
+// streams: a protected sample entry, an encryption tag or encryption side
+// data.
+func streamEncrypted(codecTag string, tags map[string]string, sideData []probeSideData) bool {
+	if encryptedCodecTags[strings.ToLower(codecTag)] {
+		return true
+	}
+	for key := range tags {
+		if strings.Contains(strings.ToLower(key), "encryption") {
+			return true
+		}
+	}
+	for _, sd := range sideData {
+		if strings.Contains(strings.ToLower(sd.Type), "encryption") {
+			return true
+		}
+	}
+	return false
+}
+
+// dynamicRange classifies the video as "HDR" when it uses a PQ or HLG
+// transfer or BT.2020 colors, and "SDR" otherwise, including when the color
+// metadata is missing altogether.
+func (p videoProbe) dynamicRange() string {
+	switch p.ColorTransfer {
+	case "smpte2084", "arib-std-b67":
+		return "HDR"
+	}
+	if p.ColorPrimaries == "bt2020" || strings.HasPrefix(p.ColorSpace, "bt2020") {
+		return "HDR"
+	}
+	return "SDR"
+}
+
+// getVideoAspectRatio labels a video "16:9", "9:16" or "other". Dimensions
+// that aren't positive are an error rather than a division by zero.
+func getVideoAspectRatio(width, height int) (string, error) {
+	if width <= 0 || height <= 0 {
+		return "", fmt.Errorf("invalid video dimensions %dx%d", width, height)
+	}
+
+	// float math can't overflow for any dimensions an int can hold
+	ratio := float64(width) / float64(height)
+
+	switch {
+	case ratio >= 1.7 && ratio <= 1.85:
+		return "16:9", nil
+	case ratio >= 0.52 && ratio <= 0.6:
+		return "9:16", nil
+	default:
+		return "other", nil
+	}
+}
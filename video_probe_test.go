@@ -0,0 +1,287 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseVideoProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    videoProbe
+		wantErr bool
+	}{
+		{
+			name: "video with audio",
+			output: `{
+				"streams": [
+					{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080},
+					{"index": 1, "codec_type": "audio", "codec_name": "aac"}
+				],
+				"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "12.500000", "bit_rate": "4000000"}
+			}`,
+			want: videoProbe{
+				Width:      1920,
+				Height:     1080,
+				VideoCodec: "h264",
+				HasAudio:   true,
+				FormatName: "mov,mp4,m4a,3gp,3g2,mj2",
+				Duration:   12.5,
+				Bitrate:    4000000,
+			},
+		},
+		{
+			name: "silent portrait video",
+			output: `{
+				"streams": [{"index": 0, "codec_type": "video", "codec_name": "hevc", "width": 1080, "height": 1920}],
+				"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "N/A"}
+			}`,
+			want: videoProbe{
+				Width:      1080,
+				Height:     1920,
+				VideoCodec: "hevc",
+				FormatName: "mov,mp4,m4a,3gp,3g2,mj2",
+			},
+		},
+		{
+			name: "hdr color metadata",
+			output: `{
+				"streams": [{"index": 0, "codec_type": "video", "codec_name": "hevc", "width": 3840, "height": 2160,
+					"color_space": "bt2020nc", "color_transfer": "smpte2084", "color_primaries": "bt2020"}],
+				"format": {}
+			}`,
+			want: videoProbe{
+				Width:          3840,
+				Height:         2160,
+				VideoCodec:     "hevc",
+				ColorSpace:     "bt2020nc",
+				ColorTransfer:  "smpte2084",
+				ColorPrimaries: "bt2020",
+			},
+		},
+		{
+			name: "encrypted video",
+			output: `{
+				"streams": [
+					{"index": 0, "codec_type": "video", "codec_name": "h264", "codec_tag_string": "encv", "width": 1280, "height": 720},
+					{"index": 1, "codec_type": "audio", "codec_name": "aac", "codec_tag_string": "mp4a"}
+				],
+				"format": {}
+			}`,
+			want: videoProbe{
+				Width:      1280,
+				Height:     720,
+				VideoCodec: "h264",
+				HasAudio:   true,
+				Encrypted:  true,
+			},
+		},
+		{
+			name:   "no streams",
+			output: `{"streams": [], "format": {}}`,
+			want:   videoProbe{},
+		},
+		{
+			name:    "not json",
+			output:  `ffprobe: error`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseVideoProbe([]byte(tt.output))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseVideoProbe err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseVideoProbe = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVideoProbeMainStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		streams    string
+		wantWidth  int
+		wantHeight int
+		wantCodec  string
+		wantAspect string
+	}{
+		{
+			name: "small cover before the main video",
+			streams: `{"index": 0, "codec_type": "video", "codec_name": "mjpeg", "width": 300, "height": 300},
+				{"index": 1, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080}`,
+			wantWidth:  1920,
+			wantHeight: 1080,
+			wantCodec:  "h264",
+			wantAspect: "16:9",
+		},
+		{
+			name: "small preview after the main video",
+			streams: `{"index": 0, "codec_type": "video", "codec_name": "hevc", "width": 1080, "height": 1920},
+				{"index": 1, "codec_type": "video", "codec_name": "h264", "width": 320, "height": 240}`,
+			wantWidth:  1080,
+			wantHeight: 1920,
+			wantCodec:  "hevc",
+			wantAspect: "9:16",
+		},
+		{
+			name: "stream without dimensions",
+			streams: `{"index": 0, "codec_type": "video", "codec_name": "h264"},
+				{"index": 1, "codec_type": "video", "codec_name": "h264", "width": 1280, "height": 720}`,
+			wantWidth:  1280,
+			wantHeight: 720,
+			wantCodec:  "h264",
+			wantAspect: "16:9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probe, err := parseVideoProbe([]byte(`{"streams": [` + tt.streams + `], "format": {}}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if probe.Width != tt.wantWidth || probe.Height != tt.wantHeight || probe.VideoCodec != tt.wantCodec {
+				t.Errorf("main stream = %dx%d %s, want %dx%d %s", probe.Width, probe.Height, probe.VideoCodec, tt.wantWidth, tt.wantHeight, tt.wantCodec)
+			}
+			aspect, err := getVideoAspectRatio(probe.Width, probe.Height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if aspect != tt.wantAspect {
+				t.Errorf("aspect ratio = %s, want %s", aspect, tt.wantAspect)
+			}
+		})
+	}
+}
+
+func TestGetVideoAspectRatio(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		want          string
+		wantErr       bool
+	}{
+		{name: "1080p", width: 1920, height: 1080, want: "16:9"},
+		{name: "vertical", width: 1080, height: 1920, want: "9:16"},
+		{name: "square", width: 1000, height: 1000, want: "other"},
+		{name: "8k", width: 7680, height: 4320, want: "16:9"},
+		{name: "largest int dimensions", width: math.MaxInt, height: math.MaxInt / 16 * 9, want: "16:9"},
+		{name: "largest int width", width: math.MaxInt, height: 1, want: "other"},
+		{name: "zero height", width: 1920, height: 0, wantErr: true},
+		{name: "zero width", width: 0, height: 1080, wantErr: true},
+		{name: "negative height", width: 1920, height: -1080, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getVideoAspectRatio(tt.width, tt.height)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getVideoAspectRatio(%d, %d) err = %v, want error %v", tt.width, tt.height, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getVideoAspectRatio(%d, %d) = %q, want %q", tt.width, tt.height, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamEncrypted(t *testing.T) {
+	tests := []struct {
+		name     string
+		codecTag string
+		tags     map[string]string
+		sideData []probeSideData
+		want     bool
+	}{
+		{name: "plain stream", codecTag: "avc1", tags: map[string]string{"language": "und"}, want: false},
+		{name: "protected video entry", codecTag: "encv", want: true},
+		{name: "protected audio entry", codecTag: "ENCA", want: true},
+		{name: "fairplay entry", codecTag: "drmi", want: true},
+		{name: "encryption tag", codecTag: "avc1", tags: map[string]string{"encryption": "cenc-aes-ctr"}, want: true},
+		{name: "encryption side data", codecTag: "avc1", sideData: []probeSideData{{Type: "Encryption info"}}, want: true},
+		{name: "other side data", codecTag: "avc1", sideData: []probeSideData{{Type: "Display Matrix"}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := streamEncrypted(tt.codecTag, tt.tags, tt.sideData); got != tt.want {
+				t.Errorf("streamEncrypted = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDynamicRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe videoProbe
+		want  string
+	}{
+		{name: "no color metadata", want: "SDR"},
+		{name: "bt709", probe: videoProbe{ColorSpace: "bt709", ColorTransfer: "bt709", ColorPrimaries: "bt709"}, want: "SDR"},
+		{name: "pq", probe: videoProbe{ColorTransfer: "smpte2084"}, want: "HDR"},
+		{name: "hlg", probe: videoProbe{ColorTransfer: "arib-std-b67"}, want: "HDR"},
+		{name: "bt2020 primaries", probe: videoProbe{ColorPrimaries: "bt2020"}, want: "HDR"},
+		{name: "bt2020 color space", probe: videoProbe{ColorSpace: "bt2020nc"}, want: "HDR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.probe.dynamicRange(); got != tt.want {
+				t.Errorf("dynamicRange = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeVideoUsesConfiguredBinary(t *testing.T) {
+	tests := []struct {
+		name      string
+		ffprobe   func(t *testing.T) string
+		wantWidth int
+		wantErr   bool
+	}{
+		{
+			name: "configured path",
+			ffprobe: func(t *testing.T) string {
+				return fakeCommand(t, "ffprobe-custom", "echo '"+`{"streams": [{"codec_type": "video", "width": 640, "height": 360}]}`+"'\n")
+			},
+			wantWidth: 640,
+		},
+		{
+			name:    "missing binary",
+			ffprobe: func(t *testing.T) string { return filepath.Join(t.TempDir(), "ffprobe") },
+			wantErr: true,
+		},
+		{
+			name:    "failing binary",
+			ffprobe: func(t *testing.T) string { return fakeCommand(t, "ffprobe", "exit 1\n") },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.ffprobePath = tt.ffprobe(t)
+			probe, err := cfg.probeVideo("video.mp4")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("probeVideo err = %v, want error %v", err, tt.wantErr)
+			}
+			if probe.Width != tt.wantWidth {
+				t.Errorf("width = %d, want %d", probe.Width, tt.wantWidth)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// videoQuotaFor returns how many uploaded videos the video's owner may keep,
+// admins get their own limit. Zero means unlimited.
+func (cfg *apiConfig) videoQuotaFor(video database.Video) int {
+	if cfg.isAdmin(video.UserID) {
+		return cfg.adminVideoQuota
+	}
+	return cfg.videoQuota
+}
+
+// checkVideoQuota rejects an upload to a video when its owner already keeps
+// as many uploaded videos as they're allowed. Re-uploading to a video that
+// already has one doesn't count, and expired videos, which the reaper is
+// about to purge, are left out. It responds itself, and records the
+// rejection in the video's audit trail, when it returns false.
+func (cfg *apiConfig) checkVideoQuota(w http.ResponseWriter, video database.Video) bool {
+	quota := cfg.videoQuotaFor(video)
+	if quota <= 0 {
+		return true
+	}
+	count, err := cfg.db.CountUploadedVideos(video.UserID, video.ID, time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count videos", err)
+		return false
+	}
+	if count >= quota {
+		cfg.failUpload(w, video.ID, http.StatusConflict, fmt.Sprintf("Video limit of %d reached", quota), nil)
+		return false
+	}
+	return true
+}
+
+// fitsStorageQuota reports whether an upload of size bytes to the video keeps
+// its owner within the storage quota. What the video stores now doesn't
+// count, the upload replaces it. This is only a cheap early check on the
+// upload itself, what its objects take up in storage is reserved atomically
+// with reserveStorage before committing.
+func (cfg *apiConfig) fitsStorageQuota(video database.Video, size int64) (bool, error) {
+	if cfg.storageQuota <= 0 {
+		return true, nil
+	}
+	stored, err := cfg.db.GetStoredBytes(video.UserID, video.ID)
+	if err != nil {
+		return false, err
+	}
+	return stored+size <= cfg.storageQuota, nil
+}
+
+// reserveStorage records the video's upload size and the bytes its objects
+// take up in storage, if the latter keeps its owner within the storage
+// quota.
+func (cfg *apiConfig) reserveStorage(video database.Video, size, stored int64) (bool, error) {
+	return cfg.db.ReserveVideoBytes(video.ID, video.UserID, size, stored, cfg.storageQuota)
+}
+
+func storageQuotaMessage(quota int64) string {
+	return fmt.Sprintf("Upload would exceed the storage quota of %d bytes", quota)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// newUserVideo creates another video for the owner of video.
+func newUserVideo(t *testing.T, cfg *apiConfig, video database.Video) database.Video {
+	t.Helper()
+	other, err := cfg.db.CreateVideo(database.CreateVideoParams{
+		Title:       "Another video",
+		Description: "Another video for tests",
+		UserID:      video.UserID,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't create video: %v", err)
+	}
+	return other
+}
+
+// markUploaded gives video an object URL and, if expiresAt isn't nil, an
+// expiry.
+func markUploaded(t *testing.T, cfg *apiConfig, video database.Video, expiresAt *time.Time) {
+	t.Helper()
+	videoURL := cfg.videoURL("landscape/" + video.ID.String() + ".mp4")
+	video.VideoURL = &videoURL
+	video.ExpiresAt = expiresAt
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandlerUploadVideoQuota(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name       string
+		quota      int
+		adminQuota int
+		admin      bool
+		uploaded   int
+		expired    int
+		// reupload uploads to one of the already uploaded videos
+		reupload bool
+		wantCode int
+	}{
+		{name: "no quota", quota: 0, uploaded: 5, wantCode: http.StatusOK},
+		{name: "one below the quota", quota: 3, uploaded: 2, wantCode: http.StatusOK},
+		{name: "quota reached", quota: 3, uploaded: 3, wantCode: http.StatusConflict},
+		{name: "expired videos don't count", quota: 3, uploaded: 2, expired: 2, wantCode: http.StatusOK},
+		{name: "replacing an upload", quota: 1, uploaded: 1, reupload: true, wantCode: http.StatusOK},
+		{name: "admins have their own quota", quota: 1, adminQuota: 5, admin: true, uploaded: 1, wantCode: http.StatusOK},
+		{name: "admin quota reached", quota: 10, adminQuota: 1, admin: true, uploaded: 1, wantCode: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.videoQuota = tt.quota
+			cfg.adminVideoQuota = tt.adminQuota
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			video, token := newTestVideo(t, cfg)
+			if tt.admin {
+				cfg.adminUserIDs = map[uuid.UUID]bool{video.UserID: true}
+			}
+
+			target := video
+			for i := range tt.uploaded {
+				v := newUserVideo(t, cfg, video)
+				markUploaded(t, cfg, v, nil)
+				if i == 0 && tt.reupload {
+					target = v
+				}
+			}
+			for range tt.expired {
+				markUploaded(t, cfg, newUserVideo(t, cfg, video), &past)
+			}
+
+			req := newUploadRequest(t, target.ID, token, "video", "clip.mp4", "video/mp4", []byte("fake video"), nil)
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if rec.Code != http.StatusConflict {
+				return
+			}
+			events, err := cfg.db.GetUploadEvents(target.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) == 0 || events[len(events)-1].Event != database.UploadEventFailed {
+				t.Errorf("events = %+v, want the rejection recorded", events)
+			}
+		})
+	}
+}
+
+func TestHandlerUploadVideoStorageQuota(t *testing.T) {
+	upload := []byte("fake video")
+	tests := []struct {
+		name   string
+		quota  int64
+		stored int64
+		// grow is how many bytes processing adds to the upload
+		grow      int
+		wantCode  int
+		wantBytes int64
+	}{
+		{name: "no quota", quota: 0, stored: 1 << 20, wantCode: http.StatusOK, wantBytes: 10},
+		{name: "fits", quota: 200, stored: 100, wantCode: http.StatusOK, wantBytes: 10},
+		{name: "fills the quota exactly", quota: 110, stored: 100, wantCode: http.StatusOK, wantBytes: 10},
+		{name: "upload pushes over the quota", quota: 105, stored: 100, wantCode: http.StatusRequestEntityTooLarge},
+		{name: "processed objects push over the quota", quota: 150, stored: 100, grow: 100, wantCode: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.storageQuota = tt.quota
+			installFakeFFmpeg(t, cfg, fakeProbe(320, 180))
+			if tt.grow > 0 {
+				cfg.ffmpegPath = fakeCommand(t, "ffmpeg", fmt.Sprintf(`in=
+prev=
+for arg; do
+	if [ "$prev" = "-i" ] && [ -z "$in" ]; then in=$arg; fi
+	prev=$arg
+done
+cp "$in" "$arg"
+head -c %d /dev/zero >> "$arg"
+`, tt.grow))
+			}
+			video, token := newTestVideo(t, cfg)
+			other := newUserVideo(t, cfg, video)
+			if ok, err := cfg.db.ReserveVideoBytes(other.ID, video.UserID, tt.stored, tt.stored, 0); err != nil || !ok {
+				t.Fatalf("recording stored bytes: %v", err)
+			}
+
+			req := newUploadRequest(t, video.ID, token, "video", "clip.mp4", "video/mp4", upload, nil)
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.StoredBytes != tt.wantBytes {
+				t.Errorf("stored bytes = %d, want %d", stored.StoredBytes, tt.wantBytes)
+			}
+			if rec.Code == http.StatusOK {
+				return
+			}
+			if keys := mem.Keys(); len(keys) != 0 {
+				t.Errorf("rejected upload left %v in storage", keys)
+			}
+			if stored.VideoURL != nil {
+				t.Error("rejected upload was committed")
+			}
+		})
+	}
+}
+
+func TestReserveStorage(t *testing.T) {
+	tests := []struct {
+		name   string
+		quota  int64
+		stored int64
+		want   bool
+	}{
+		{name: "no quota", quota: 0, stored: 1000, want: true},
+		{name: "within the quota", quota: 100, stored: 40, want: true},
+		{name: "exactly the quota", quota: 100, stored: 50, want: true},
+		{name: "over the quota", quota: 100, stored: 51, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.storageQuota = tt.quota
+			video, _ := newTestVideo(t, cfg)
+			other := newUserVideo(t, cfg, video)
+			if ok, err := cfg.reserveStorage(other, 50, 50); err != nil || !ok {
+				t.Fatalf("reserving the other video: %v", err)
+			}
+
+			got, err := cfg.reserveStorage(video, tt.stored, tt.stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("reserveStorage = %v, want %v", got, tt.want)
+			}
+			fits, err := cfg.fitsStorageQuota(video, tt.stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fits != tt.want {
+				t.Errorf("fitsStorageQuota = %v, want %v", fits, tt.want)
+			}
+			// re-reserving the same video replaces its bytes instead of
+			// adding to them
+			if tt.want {
+				if again, err := cfg.reserveStorage(video, tt.stored, tt.stored); err != nil || !again {
+					t.Errorf("reserving the same bytes again = %v, %v", again, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// parseExpiresAt reads a retention deadline given as RFC 3339. It has to be
+// in the future and is stored in UTC with second precision so it compares
+// correctly in SQLite.
+func parseExpiresAt(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return validExpiresAt(t)
+}
+
+func validExpiresAt(t time.Time) (time.Time, error) {
+	if !t.After(time.Now()) {
+		return time.Time{}, fmt.Errorf("expiry %s is in the past", t.Format(time.RFC3339))
+	}
+	return t.UTC().Truncate(time.Second), nil
+}
+
+// runVideoReaper purges expired videos and abandoned tus uploads every
+// interval until ctx is done.
+func (cfg *apiConfig) runVideoReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.reapExpiredVideos(ctx); err != nil {
+				slog.Error("Couldn't reap expired videos", "err", err)
+			}
+			if cfg.tusUploadTTL > 0 {
+				if err := cfg.reapAbandonedTusUploads(time.Now()); err != nil {
+					slog.Error("Couldn't reap abandoned tus uploads", "err", err)
+				}
+			}
+		}
+	}
+}
+
+// reapExpiredVideos deletes the stored objects and rows of every expired
+// video. Videos whose objects couldn't all be removed are retried on the
+// next run.
+func (cfg *apiConfig) reapExpiredVideos(ctx context.Context) error {
+	videos, err := cfg.db.GetExpiredVideos(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, video := range videos {
+		keys, err := cfg.videoObjectKeys(video)
+		if err != nil {
+			return err
+		}
+		// a later video reusing the same objects keeps them alive
+		keys, err = cfg.unsharedObjectKeys(keys, []database.Video{video})
+		if err != nil {
+			return err
+		}
+		cfg.presignCache.invalidate(keys)
+		deleteCtx, cancel := cfg.storageContext(ctx)
+		failures, err := cfg.storage.DeleteMany(deleteCtx, keys)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if len(failures) > 0 {
+			slog.Warn("Couldn't delete objects of expired video", "count", len(failures), "video_id", video.ID)
+			continue
+		}
+		if err := cfg.db.DeleteVideo(video.ID); err != nil {
+			return err
+		}
+		cfg.removeTranscodeWork(video.ID)
+		slog.Info("Reaped expired video", "video_id", video.ID)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExpiresAt(t *testing.T) {
+	future := time.Now().Add(time.Hour).Truncate(time.Second)
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "future UTC", value: future.UTC().Format(time.RFC3339), want: future.UTC()},
+		{name: "future with offset", value: future.In(time.FixedZone("", 2*3600)).Format(time.RFC3339), want: future.UTC()},
+		{name: "fractional seconds are dropped", value: future.Add(500 * time.Millisecond).Format(time.RFC3339Nano), want: future.UTC()},
+		{name: "past", value: time.Now().Add(-time.Hour).Format(time.RFC3339), wantErr: true},
+		{name: "not RFC 3339", value: "tomorrow", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExpiresAt(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseExpiresAt(%q) err = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) || (!tt.wantErr && got.Location() != time.UTC) {
+				t.Errorf("parseExpiresAt(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReapExpiredVideos(t *testing.T) {
+	tests := []struct {
+		name        string
+		expiresIn   time.Duration
+		undeletable bool
+		wantReaped  bool
+	}{
+		{name: "expired", expiresIn: -time.Minute, wantReaped: true},
+		{name: "not expired yet", expiresIn: time.Hour},
+		{name: "expired with undeletable objects", expiresIn: -time.Minute, undeletable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			cfg.storage = &faultyStorage{Storage: mem, undeletable: map[string]bool{"landscape/a.mp4": tt.undeletable}}
+			video, _ := newTestVideo(t, cfg)
+			mem.Put(context.Background(), "landscape/a.mp4", strings.NewReader("video"), "video/mp4")
+			videoURL := cfg.videoURL("landscape/a.mp4")
+			expiresAt := time.Now().Add(tt.expiresIn).UTC().Truncate(time.Second)
+			video.VideoURL = &videoURL
+			video.ExpiresAt = &expiresAt
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := cfg.reapExpiredVideos(context.Background()); err != nil {
+				t.Fatalf("reapExpiredVideos: %v", err)
+			}
+			_, stored := mem.Lookup("landscape/a.mp4")
+			stillThere, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reaped := stillThere.ID != video.ID; reaped != tt.wantReaped {
+				t.Errorf("video reaped = %v, want %v", reaped, tt.wantReaped)
+			}
+			if stored == tt.wantReaped {
+				t.Errorf("object still stored = %v, want %v", stored, !tt.wantReaped)
+			}
+		})
+	}
+}
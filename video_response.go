@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// videoResponse is a video as returned by the API, with fields that are
+// derived at request time rather than stored.
+type videoResponse struct {
+	database.Video
+	ThumbnailIsPlaceholder bool                      `json:"thumbnail_is_placeholder"`
+	Thumbnails             []database.VideoThumbnail `json:"thumbnails,omitempty"`
+	StatusError            string                    `json:"status_error,omitempty"`
+	Captions               []database.VideoCaption   `json:"captions,omitempty"`
+	ThumbnailInline        bool                      `json:"thumbnail_inline,omitempty"`
+	FailedVariants         []string                  `json:"failed_variants,omitempty"`
+	SHA256                 string                    `json:"sha256,omitempty"`
+}
+
+func (cfg *apiConfig) videoResponse(video database.Video) videoResponse {
+	resp := videoResponse{Video: video, SHA256: video.ContentHash}
+	if resp.ThumbnailURL == nil && cfg.defaultThumbnailURL != "" {
+		placeholder := cfg.defaultThumbnailURL
+		resp.ThumbnailURL = &placeholder
+		resp.ThumbnailIsPlaceholder = true
+	}
+	if resp.ThumbnailURL != nil {
+		thumbnailURL := cfg.signAssetURL(*resp.ThumbnailURL)
+		resp.ThumbnailURL = &thumbnailURL
+	}
+	resp.ThumbnailSizes = cfg.signAssetURLs(resp.ThumbnailSizes)
+	return resp
+}
+
+// videoDetailResponse is videoResponse plus every candidate thumbnail and
+// caption track, and the variants that failed to encode, for responses
+// about a single video.
+func (cfg *apiConfig) videoDetailResponse(video database.Video) (videoResponse, error) {
+	resp := cfg.videoResponse(video)
+	thumbnails, err := cfg.db.GetVideoThumbnails(video.ID)
+	if err != nil {
+		return videoResponse{}, err
+	}
+	for i := range thumbnails {
+		thumbnails[i].URL = cfg.signAssetURL(thumbnails[i].URL)
+		thumbnails[i].Sizes = cfg.signAssetURLs(thumbnails[i].Sizes)
+	}
+	resp.Thumbnails = thumbnails
+
+	captions, err := cfg.db.GetVideoCaptions(video.ID)
+	if err != nil {
+		return videoResponse{}, err
+	}
+	resp.Captions = captions
+
+	variants, err := cfg.db.GetVideoVariants(video.ID)
+	if err != nil {
+		return videoResponse{}, err
+	}
+	for _, v := range variants {
+		if v.Status == database.VariantStatusFailed {
+			resp.FailedVariants = append(resp.FailedVariants, v.Name)
+		}
+	}
+	return resp, nil
+}
+
+func (cfg *apiConfig) videoResponses(videos []database.Video) []videoResponse {
+	resp := make([]videoResponse, 0, len(videos))
+	for _, video := range videos {
+		resp = append(resp, cfg.videoResponse(video))
+	}
+	return resp
+}
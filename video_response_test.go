@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestVideoResponseThumbnailPlaceholder(t *testing.T) {
+	thumbnailURL := "https://cdn.example.com/thumb.png"
+	tests := []struct {
+		name            string
+		thumbnailURL    *string
+		defaultURL      string
+		wantURL         string
+		wantPlaceholder bool
+	}{
+		{name: "own thumbnail", thumbnailURL: &thumbnailURL, defaultURL: "https://cdn.example.com/default.png", wantURL: thumbnailURL},
+		{name: "placeholder", defaultURL: "https://cdn.example.com/default.png", wantURL: "https://cdn.example.com/default.png", wantPlaceholder: true},
+		{name: "no placeholder configured"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.defaultThumbnailURL = tt.defaultURL
+
+			resp := cfg.videoResponse(database.Video{ThumbnailURL: tt.thumbnailURL})
+			got := ""
+			if resp.ThumbnailURL != nil {
+				got = *resp.ThumbnailURL
+			}
+			if got != tt.wantURL || resp.ThumbnailIsPlaceholder != tt.wantPlaceholder {
+				t.Errorf("thumbnail = %q, placeholder %v, want %q, %v", got, resp.ThumbnailIsPlaceholder, tt.wantURL, tt.wantPlaceholder)
+			}
+		})
+	}
+}
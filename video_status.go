@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// statusBroadcaster wakes up requests waiting for a video's status to
+// change. Every waiter of a video shares one channel which is closed, and
+// replaced on the next wait, when the status changes. A video's entry goes
+// away with its last waiter, whether it was notified or gave up.
+type statusBroadcaster struct {
+	mu      sync.Mutex
+	waiters map[uuid.UUID]*statusWaiters
+}
+
+type statusWaiters struct {
+	ch    chan struct{}
+	count int
+}
+
+func newStatusBroadcaster() *statusBroadcaster {
+	return &statusBroadcaster{
+		waiters: map[uuid.UUID]*statusWaiters{},
+	}
+}
+
+// wait returns a channel closed on the video's next status change, and a
+// func the caller must call once it stops waiting.
+func (b *statusBroadcaster) wait(videoID uuid.UUID) (<-chan struct{}, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	w, ok := b.waiters[videoID]
+	if !ok {
+		w = &statusWaiters{ch: make(chan struct{})}
+		b.waiters[videoID] = w
+	}
+	w.count++
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			w.count--
+			// a notified entry was already replaced or removed
+			if w.count == 0 && b.waiters[videoID] == w {
+				delete(b.waiters, videoID)
+			}
+		})
+	}
+	return w.ch, stop
+}
+
+func (b *statusBroadcaster) notify(videoID uuid.UUID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if w, ok := b.waiters[videoID]; ok {
+		close(w.ch)
+		delete(b.waiters, videoID)
+	}
+}
+
+// setVideoStatus stores status and wakes up anyone long-polling the video.
+func (cfg *apiConfig) setVideoStatus(videoID uuid.UUID, status string) error {
+	if err := cfg.db.SetVideoStatus(videoID, status); err != nil {
+		return err
+	}
+	cfg.statusWatchers.notify(videoID)
+	return nil
+}
+
+// startVideoProcessing marks the video processing, reporting false if
+// another upload of it already is.
+func (cfg *apiConfig) startVideoProcessing(videoID uuid.UUID) (bool, error) {
+	started, err := cfg.db.StartVideoProcessing(videoID)
+	if err != nil || !started {
+		return false, err
+	}
+	cfg.statusWatchers.notify(videoID)
+	return true, nil
+}
+
+func videoStatusSettled(status string) bool {
+	return status != database.VideoStatusPending && status != database.VideoStatusProcessing
+}
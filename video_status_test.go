@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestStatusBroadcaster(t *testing.T) {
+	tests := []struct {
+		name string
+		// run waits on the video with two waiters and reports whether the
+		// first one was woken up
+		run        func(b *statusBroadcaster, videoID uuid.UUID) bool
+		wantWoken  bool
+		wantActive bool
+	}{
+		{
+			name: "notify wakes every waiter",
+			run: func(b *statusBroadcaster, videoID uuid.UUID) bool {
+				ch, stop := b.wait(videoID)
+				defer stop()
+				_, stop2 := b.wait(videoID)
+				defer stop2()
+				b.notify(videoID)
+				return closed(ch)
+			},
+			wantWoken: true,
+		},
+		{
+			name: "waiters that give up unregister",
+			run: func(b *statusBroadcaster, videoID uuid.UUID) bool {
+				ch, stop := b.wait(videoID)
+				_, stop2 := b.wait(videoID)
+				stop()
+				stop2()
+				return closed(ch)
+			},
+		},
+		{
+			name: "a remaining waiter keeps the entry",
+			run: func(b *statusBroadcaster, videoID uuid.UUID) bool {
+				ch, stop := b.wait(videoID)
+				_, _ = b.wait(videoID)
+				stop()
+				// stopping twice doesn't drop the other waiter
+				stop()
+				return closed(ch)
+			},
+			wantActive: true,
+		},
+		{
+			name: "waiting after a notify gets a fresh channel",
+			run: func(b *statusBroadcaster, videoID uuid.UUID) bool {
+				_, stop := b.wait(videoID)
+				b.notify(videoID)
+				stop()
+				ch, stop2 := b.wait(videoID)
+				defer stop2()
+				return closed(ch)
+			},
+		},
+		{
+			name: "notify without waiters is a no-op",
+			run: func(b *statusBroadcaster, videoID uuid.UUID) bool {
+				b.notify(videoID)
+				return false
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newStatusBroadcaster()
+			videoID := uuid.New()
+			if got := tt.run(b, videoID); got != tt.wantWoken {
+				t.Errorf("woken = %v, want %v", got, tt.wantWoken)
+			}
+			b.mu.Lock()
+			_, active := b.waiters[videoID]
+			b.mu.Unlock()
+			if active != tt.wantActive {
+				t.Errorf("entry registered = %v, want %v", active, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestStatusBroadcasterUnblocksWaiter(t *testing.T) {
+	b := newStatusBroadcaster()
+	videoID := uuid.New()
+	ch, stop := b.wait(videoID)
+	defer stop()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.notify(videoID)
+	}()
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("waiter wasn't woken up by notify")
+	}
+}
+
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func (cfg *apiConfig) videoURL(key string) string {
+	return fmt.Sprintf("https://%s/%s", cfg.s3CfDistribution, key)
+}
+
+// videoKeyFromURL recovers the storage key from a URL built by videoURL.
+func (cfg *apiConfig) videoKeyFromURL(videoURL string) (string, bool) {
+	key, ok := strings.CutPrefix(videoURL, fmt.Sprintf("https://%s/", cfg.s3CfDistribution))
+	if !ok || key == "" {
+		return "", false
+	}
+	return key, true
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Variant is a downscaled rendition, named after the length of its short
+// side so portrait and landscape sources share the same ladder.
+type Variant struct {
+	Name   string
+	Height int
+}
+
+var variantLadder = []Variant{
+	{Name: "1080p", Height: 1080},
+	{Name: "720p", Height: 720},
+	{Name: "480p", Height: 480},
+}
+
+// variantsFor picks which renditions are worth encoding for a source of the
+// given size and bitrate. We never upscale, so only rungs below the source
+// are returned and anything 480p or smaller is stored as-is. A rung whose
+// bitrate threshold the source doesn't exceed is skipped too, re-encoding
+// wouldn't make it any smaller. An unknown bitrate skips nothing.
+func variantsFor(width, height int, bitrate int64, thresholds []bitrateThreshold) []Variant {
+	short := min(width, height)
+	variants := []Variant{}
+	for _, v := range variantLadder {
+		if v.Height >= short {
+			continue
+		}
+		if target := bitrateTarget(thresholds, v.Height); bitrate > 0 && target >= bitrate {
+			continue
+		}
+		variants = append(variants, v)
+	}
+	return variants
+}
+
+// dimensions returns the output size of v for a source of the given size,
+// keeping the aspect ratio and rounding the long side to an even number as
+// libx264 requires.
+func (v Variant) dimensions(width, height int) (int, int) {
+	if width >= height {
+		w := (width*v.Height/height + 1) &^ 1
+		return w, v.Height
+	}
+	h := (height*v.Height/width + 1) &^ 1
+	return v.Height, h
+}
+
+// variantCodec is the codec encodeArgs produces, as ffprobe names it.
+const variantCodec = "h264"
+
+// encodeArgs are the ffmpeg output options encoding v for a source of the
+// given size with the settings of encoding.
+func (v Variant) encodeArgs(width, height int, encoding encodingProfile) []string {
+	scale := fmt.Sprintf("scale=-2:%d", v.Height)
+	if width < height {
+		scale = fmt.Sprintf("scale=%d:-2", v.Height)
+	}
+	if encoding.scaler != "" {
+		scale += ":flags=" + encoding.scaler
+	}
+	args := []string{
+		"-vf", scale,
+		"-c:v", "libx264",
+		"-preset", encoding.preset,
+		"-crf", strconv.Itoa(encoding.crf),
+	}
+	if encoding.tune != "" {
+		args = append(args, "-tune", encoding.tune)
+	}
+	return args
+}
+
+// transcodeVariant encodes v, killing ffmpeg if ctx is cancelled first.
+func (cfg *apiConfig) transcodeVariant(ctx context.Context, filePath string, v Variant, width, height int, profile outputProfile, encoding encodingProfile) (string, error) {
+	outputFilePath, err := tempOutputPath(filePath, "tubely-variant-*.mp4")
+	if err != nil {
+		return "", err
+	}
+	args := []string{"-y", "-i", filePath}
+	args = append(args, v.encodeArgs(width, height, encoding)...)
+	args = append(args,
+		"-c:a", "copy",
+		"-movflags", profile.movflags,
+		"-f", "mp4",
+		outputFilePath,
+	)
+	cmd := exec.CommandContext(ctx, cfg.ffmpegPath, args...)
+
+	logCommand(cmd)
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputFilePath)
+		return "", err
+	}
+	return outputFilePath, nil
+}
+
+// variantKey derives a rendition's key from the primary key, e.g.
+// landscape/abc.mp4 becomes landscape/abc_720p.mp4.
+func variantKey(key string, v Variant) string {
+	ext := path.Ext(key)
+	return fmt.Sprintf("%s_%s%s", strings.TrimSuffix(key, ext), v.Name, ext)
+}
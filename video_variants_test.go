@@ -0,0 +1,84 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestVariantsFor(t *testing.T) {
+	thresholds, err := parseBitrateThresholds("2160=12000,1080=4000,720=2000,480=800")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		width, height int
+		bitrate       int64
+		want          []string
+	}{
+		{name: "4k landscape", width: 3840, height: 2160, want: []string{"1080p", "720p", "480p"}},
+		{name: "1080p landscape", width: 1920, height: 1080, want: []string{"720p", "480p"}},
+		{name: "1080p portrait", width: 1080, height: 1920, want: []string{"720p", "480p"}},
+		{name: "just above 480p", width: 854, height: 482, want: []string{"480p"}},
+		{name: "480p", width: 854, height: 480, want: []string{}},
+		{name: "tiny", width: 320, height: 180, want: []string{}},
+		{name: "4k at a high bitrate", width: 3840, height: 2160, bitrate: 20_000_000, want: []string{"1080p", "720p", "480p"}},
+		{name: "4k at a low bitrate", width: 3840, height: 2160, bitrate: 3_000_000, want: []string{"720p", "480p"}},
+		{name: "4k at a 1080p threshold", width: 3840, height: 2160, bitrate: 4_000_000, want: []string{"720p", "480p"}},
+		{name: "4k barely compressed", width: 3840, height: 2160, bitrate: 500_000, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, v := range variantsFor(tt.width, tt.height, tt.bitrate, thresholds) {
+				got = append(got, v.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("variantsFor(%d, %d, %d) = %v, want %v", tt.width, tt.height, tt.bitrate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVariantDimensions(t *testing.T) {
+	tests := []struct {
+		name          string
+		variant       Variant
+		width, height int
+		wantW, wantH  int
+	}{
+		{name: "landscape 16:9", variant: Variant{"720p", 720}, width: 1920, height: 1080, wantW: 1280, wantH: 720},
+		{name: "portrait 9:16", variant: Variant{"720p", 720}, width: 1080, height: 1920, wantW: 720, wantH: 1280},
+		{name: "odd long side is rounded up", variant: Variant{"480p", 480}, width: 1920, height: 1080, wantW: 854, wantH: 480},
+		{name: "square", variant: Variant{"480p", 480}, width: 1000, height: 1000, wantW: 480, wantH: 480},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h := tt.variant.dimensions(tt.width, tt.height)
+			if w != tt.wantW || h != tt.wantH {
+				t.Errorf("dimensions(%d, %d) = %dx%d, want %dx%d", tt.width, tt.height, w, h, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestVariantKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "landscape/abc.mp4", want: "landscape/abc_720p.mp4"},
+		{key: "tenant/portrait/abc.mov", want: "tenant/portrait/abc_720p.mov"},
+		{key: "abc", want: "abc_720p"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := variantKey(tt.key, Variant{"720p", 720}); got != tt.want {
+				t.Errorf("variantKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
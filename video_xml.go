@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/xml"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// videoXML is videoResponse for clients that only read XML. encoding/xml
+// can't marshal maps, so thumbnail sizes become a list of named elements.
+type videoXML struct {
+	XMLName                xml.Name          `xml:"video"`
+	ID                     uuid.UUID         `xml:"id"`
+	UserID                 uuid.UUID         `xml:"user_id"`
+	CreatedAt              time.Time         `xml:"created_at"`
+	UpdatedAt              time.Time         `xml:"updated_at"`
+	Title                  string            `xml:"title"`
+	Description            string            `xml:"description,omitempty"`
+	Status                 string            `xml:"status"`
+	StatusError            string            `xml:"status_error,omitempty"`
+	Visibility             string            `xml:"visibility"`
+	PublishState           string            `xml:"publish_state"`
+	Category               string            `xml:"category,omitempty"`
+	VideoURL               *string           `xml:"video_url,omitempty"`
+	PreviewGIFURL          *string           `xml:"preview_gif_url,omitempty"`
+	ChaptersURL            *string           `xml:"chapters_url,omitempty"`
+	ThumbnailURL           *string           `xml:"thumbnail_url,omitempty"`
+	ThumbnailIsPlaceholder bool              `xml:"thumbnail_is_placeholder"`
+	ThumbnailSizes         *xmlSizeList      `xml:"thumbnail_sizes,omitempty"`
+	BlurHash               string            `xml:"blurhash,omitempty"`
+	AspectRatio            string            `xml:"aspect_ratio,omitempty"`
+	DynamicRange           string            `xml:"dynamic_range,omitempty"`
+	FastStart              bool              `xml:"faststart"`
+	LowBitrate             bool              `xml:"low_bitrate"`
+	SHA256                 string            `xml:"sha256,omitempty"`
+	Duration               float64           `xml:"duration"`
+	SizeBytes              int64             `xml:"size_bytes"`
+	ViewCount              int64             `xml:"view_count"`
+	ExpiresAt              *time.Time        `xml:"expires_at,omitempty"`
+	Captions               *xmlCaptionList   `xml:"captions,omitempty"`
+	Thumbnails             *xmlThumbnailList `xml:"thumbnails,omitempty"`
+}
+
+// the lists are wrapped in pointers to their parent element because
+// omitempty doesn't drop an empty parent>child path
+
+type xmlSizeList struct {
+	Sizes []xmlSize `xml:"size"`
+}
+
+type xmlCaptionList struct {
+	Captions []xmlCaption `xml:"caption"`
+}
+
+type xmlThumbnailList struct {
+	Thumbnails []xmlThumbnail `xml:"thumbnail"`
+}
+
+type xmlSize struct {
+	Name string `xml:"name,attr"`
+	URL  string `xml:",chardata"`
+}
+
+type xmlCaption struct {
+	Language string `xml:"language,attr"`
+	Label    string `xml:"label,attr,omitempty"`
+	URL      string `xml:",chardata"`
+}
+
+type xmlThumbnail struct {
+	ID        uuid.UUID    `xml:"id,attr"`
+	URL       string       `xml:"url"`
+	Sizes     *xmlSizeList `xml:"sizes,omitempty"`
+	BlurHash  string       `xml:"blurhash,omitempty"`
+	CreatedAt time.Time    `xml:"created_at"`
+}
+
+// newXMLSizeList lists sizes by name so the output is stable.
+func newXMLSizeList(sizes map[string]string) *xmlSizeList {
+	if len(sizes) == 0 {
+		return nil
+	}
+	list := &xmlSizeList{}
+	for name, url := range sizes {
+		list.Sizes = append(list.Sizes, xmlSize{Name: name, URL: url})
+	}
+	slices.SortFunc(list.Sizes, func(a, b xmlSize) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return list
+}
+
+func newVideoXML(resp videoResponse) videoXML {
+	v := videoXML{
+		ID:                     resp.ID,
+		UserID:                 resp.UserID,
+		CreatedAt:              resp.CreatedAt,
+		UpdatedAt:              resp.UpdatedAt,
+		Title:                  resp.Title,
+		Description:            resp.Description,
+		Status:                 resp.Status,
+		StatusError:            resp.StatusError,
+		Visibility:             resp.Visibility,
+		PublishState:           resp.PublishState,
+		Category:               resp.Category,
+		VideoURL:               resp.VideoURL,
+		PreviewGIFURL:          resp.PreviewGIFURL,
+		ChaptersURL:            resp.ChaptersURL,
+		ThumbnailURL:           resp.ThumbnailURL,
+		ThumbnailIsPlaceholder: resp.ThumbnailIsPlaceholder,
+		ThumbnailSizes:         newXMLSizeList(resp.ThumbnailSizes),
+		BlurHash:               resp.BlurHash,
+		AspectRatio:            resp.AspectRatio,
+		DynamicRange:           resp.DynamicRange,
+		FastStart:              resp.FastStart,
+		LowBitrate:             resp.LowBitrate,
+		SHA256:                 resp.SHA256,
+		Duration:               resp.Duration,
+		SizeBytes:              resp.SizeBytes,
+		ViewCount:              resp.ViewCount,
+		ExpiresAt:              resp.ExpiresAt,
+	}
+	if len(resp.Captions) > 0 {
+		v.Captions = &xmlCaptionList{}
+	}
+	for _, caption := range resp.Captions {
+		v.Captions.Captions = append(v.Captions.Captions, xmlCaption{
+			Language: caption.Language,
+			Label:    caption.Label,
+			URL:      caption.URL,
+		})
+	}
+	if len(resp.Thumbnails) > 0 {
+		v.Thumbnails = &xmlThumbnailList{}
+	}
+	for _, thumbnail := range resp.Thumbnails {
+		v.Thumbnails.Thumbnails = append(v.Thumbnails.Thumbnails, xmlThumbnail{
+			ID:        thumbnail.ID,
+			URL:       thumbnail.URL,
+			Sizes:     newXMLSizeList(thumbnail.Sizes),
+			BlurHash:  thumbnail.BlurHash,
+			CreatedAt: thumbnail.CreatedAt,
+		})
+	}
+	return v
+}
+
+// acceptsXML reports whether the Accept header ranks XML above JSON. Only
+// explicit XML types count, */* keeps the JSON default.
+func acceptsXML(r *http.Request) bool {
+	var xmlQ, jsonQ float64
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case "application/xml", "text/xml":
+			xmlQ = max(xmlQ, q)
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+	return xmlQ > 0 && xmlQ > jsonQ
+}
+
+// respondWithXML writes payload as an XML document. Unlike JSON responses
+// it isn't wrapped in an envelope, legacy clients expect the bare record.
+func respondWithXML(w http.ResponseWriter, code int, payload any) {
+	dat, err := xml.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		slog.Error("Error marshalling XML", "err", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write([]byte(xml.Header))
+	w.Write(dat)
+}
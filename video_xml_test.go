@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestAcceptsXML(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "", want: false},
+		{accept: "*/*", want: false},
+		{accept: "application/json", want: false},
+		{accept: "application/xml", want: true},
+		{accept: "text/xml", want: true},
+		{accept: "application/json, application/xml", want: false},
+		{accept: "application/json;q=0.5, application/xml", want: true},
+		{accept: "application/xml;q=0.5, application/json", want: false},
+		{accept: "application/xml;q=0", want: false},
+		{accept: "application/xml;q=abc", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/videos/abc", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if got := acceptsXML(req); got != tt.want {
+				t.Errorf("acceptsXML(%q) = %v, want %v", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewXMLSizeList(t *testing.T) {
+	if got := newXMLSizeList(nil); got != nil {
+		t.Errorf("newXMLSizeList(nil) = %+v, want nil", got)
+	}
+	got := newXMLSizeList(map[string]string{"small": "s.png", "large": "l.png", "medium": "m.png"})
+	want := []xmlSize{{Name: "large", URL: "l.png"}, {Name: "medium", URL: "m.png"}, {Name: "small", URL: "s.png"}}
+	if len(got.Sizes) != len(want) {
+		t.Fatalf("sizes = %+v, want %+v", got.Sizes, want)
+	}
+	for i := range want {
+		if got.Sizes[i] != want[i] {
+			t.Errorf("size %d = %+v, want %+v", i, got.Sizes[i], want[i])
+		}
+	}
+}
+
+func TestHandlerVideoGetXML(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	video, token := newTestVideo(t, cfg)
+	videoURL := cfg.videoURL("landscape/abc.mp4")
+	video.VideoURL = &videoURL
+	video.Description = ""
+	captions := []database.VideoCaption{{Language: "en", Label: "English", URL: cfg.videoURL("captions/en.vtt")}}
+	if err := cfg.db.UpdateVideoUpload(video, nil, captions); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		accept          string
+		wantContentType string
+	}{
+		{name: "xml", accept: "application/xml", wantContentType: "application/xml; charset=utf-8"},
+		{name: "text xml", accept: "text/xml", wantContentType: "application/xml; charset=utf-8"},
+		{name: "json by default", accept: "", wantContentType: "application/json"},
+		{name: "json for anything", accept: "*/*", wantContentType: "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String(), video.ID, nil, token)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoGet(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+
+			var id, title, gotVideoURL, language string
+			if tt.wantContentType == "application/json" {
+				var resp videoResponse
+				decodeData(t, rec, &resp)
+				id, title, gotVideoURL = resp.ID.String(), resp.Title, *resp.VideoURL
+				language = resp.Captions[0].Language
+			} else {
+				body := rec.Body.String()
+				if !strings.HasPrefix(body, xml.Header+"<video>") {
+					t.Errorf("body starts %.60q, want an XML declaration and a <video> root", body)
+				}
+				// omitempty fields are dropped, not written empty
+				for _, absent := range []string{"<description>", "<status_error>", "<thumbnails>", "<expires_at>"} {
+					if strings.Contains(body, absent) {
+						t.Errorf("body has %s, want it omitted", absent)
+					}
+				}
+				var resp videoXML
+				if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				id, title, gotVideoURL = resp.ID.String(), resp.Title, *resp.VideoURL
+				language = resp.Captions.Captions[0].Language
+			}
+			if id != video.ID.String() || title != video.Title || language != "en" {
+				t.Errorf("got id %s, title %q, caption %q, want %s, %q, en", id, title, language, video.ID, video.Title)
+			}
+			if gotVideoURL != videoURL {
+				t.Errorf("video_url = %q, want %q", gotVideoURL, videoURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// viewCounter counts video views without making requests wait on the
+// database: views are queued on a buffered channel and written in batches.
+type viewCounter struct {
+	views chan viewKey
+}
+
+type viewKey struct {
+	videoID uuid.UUID
+	bucket  time.Time
+}
+
+func newViewCounter(bufferSize int) *viewCounter {
+	return &viewCounter{
+		views: make(chan viewKey, bufferSize),
+	}
+}
+
+// record queues a view of the video. When the buffer is full the view is
+// dropped rather than blocking the request.
+func (vc *viewCounter) record(videoID uuid.UUID) {
+	select {
+	case vc.views <- viewKey{videoID: videoID, bucket: time.Now().UTC().Truncate(time.Hour)}:
+	default:
+		slog.Debug("View buffer full, dropping view", "video_id", videoID)
+	}
+}
+
+// startsPlayback reports whether a request with the given Range header is
+// the start of a playback rather than a player seeking or fetching the
+// next chunk: no range, or one from offset 0. Safari's two byte probe
+// before the real request doesn't count either.
+func startsPlayback(byteRange string) bool {
+	if byteRange == "" {
+		return true
+	}
+	spec, ok := strings.CutPrefix(strings.TrimSpace(byteRange), "bytes=")
+	if !ok {
+		return false
+	}
+	spec = strings.TrimSpace(spec)
+	return strings.HasPrefix(spec, "0-") && spec != "0-1"
+}
+
+// run writes the queued views every interval until ctx is done, flushing
+// whatever is left on the way out. Views recorded after that are lost.
+func (vc *viewCounter) run(ctx context.Context, db database.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	pending := map[viewKey]int{}
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		counts := make([]database.VideoViewCount, 0, len(pending))
+		for key, n := range pending {
+			counts = append(counts, database.VideoViewCount{
+				VideoID: key.videoID,
+				Bucket:  key.bucket,
+				Count:   n,
+			})
+		}
+		if err := db.AddVideoViews(counts); err != nil {
+			// keep the counts around for the next flush
+			slog.Error("Couldn't save video views", "err", err)
+			return
+		}
+		clear(pending)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// views queued before the cancellation still count
+		drain:
+			for {
+				select {
+				case key := <-vc.views:
+					pending[key]++
+				default:
+					break drain
+				}
+			}
+			flush()
+			return
+		case key := <-vc.views:
+			pending[key]++
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
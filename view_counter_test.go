@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestStartsPlayback(t *testing.T) {
+	tests := []struct {
+		byteRange string
+		want      bool
+	}{
+		{byteRange: "", want: true},
+		{byteRange: "bytes=0-", want: true},
+		{byteRange: "bytes=0-1023", want: true},
+		{byteRange: " bytes= 0-1023", want: true},
+		{byteRange: "bytes=0-1", want: false},
+		{byteRange: "bytes=1024-", want: false},
+		{byteRange: "bytes=-500", want: false},
+		{byteRange: "items=0-", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.byteRange, func(t *testing.T) {
+			if got := startsPlayback(tt.byteRange); got != tt.want {
+				t.Errorf("startsPlayback(%q) = %v, want %v", tt.byteRange, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestViewCounterDropsWhenFull(t *testing.T) {
+	vc := newViewCounter(2)
+	videoID := uuid.New()
+	for range 5 {
+		vc.record(videoID)
+	}
+	if got := len(vc.views); got != 2 {
+		t.Errorf("queued views = %d, want 2", got)
+	}
+}
+
+func TestViewCounterFlushesQueuedOnStop(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	video, _ := newTestVideo(t, cfg)
+	for range 3 {
+		cfg.views.record(video.ID)
+	}
+
+	// cancelled before run reads anything, the queued views still count
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cfg.views.run(ctx, cfg.db, time.Hour)
+
+	stored, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ViewCount != 3 {
+		t.Errorf("view count = %d, want 3", stored.ViewCount)
+	}
+}
+
+func TestViewCounterCountsRedirects(t *testing.T) {
+	tests := []struct {
+		name      string
+		requests  int
+		wantViews int64
+	}{
+		{name: "no views", requests: 0, wantViews: 0},
+		{name: "one view", requests: 1, wantViews: 1},
+		{name: "several views", requests: 5, wantViews: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mem := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+			mem.Put(context.Background(), "landscape/abc.mp4", strings.NewReader("video"), "video/mp4")
+			videoURL := cfg.videoURL("landscape/abc.mp4")
+			video.VideoURL = &videoURL
+			video.Visibility = database.VideoVisibilityPublic
+			video.PublishState = database.VideoPublishPublished
+			if err := cfg.db.UpdateVideo(video); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				cfg.views.run(ctx, cfg.db, time.Hour)
+			}()
+			for range tt.requests {
+				rec := httptest.NewRecorder()
+				cfg.handlerVideoRedirect(rec, newVideoRequest(http.MethodGet, "/v/"+video.ID.String(), video.ID, nil, ""))
+				if rec.Code != http.StatusFound {
+					t.Fatalf("redirect status = %d: %s", rec.Code, rec.Body)
+				}
+			}
+			// stopping flushes whatever is pending, the interval never ran
+			for len(cfg.views.views) > 0 {
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+			<-done
+
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.ViewCount != tt.wantViews {
+				t.Errorf("view count = %d, want %d", stored.ViewCount, tt.wantViews)
+			}
+
+			req := newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/analytics?interval=hour&days=1", video.ID, nil, token)
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoAnalytics(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("analytics status = %d: %s", rec.Code, rec.Body)
+			}
+			var resp struct {
+				TotalViews int64                     `json:"total_views"`
+				Interval   string                    `json:"interval"`
+				Buckets    []database.VideoViewCount `json:"buckets"`
+			}
+			decodeData(t, rec, &resp)
+			if resp.TotalViews != tt.wantViews || resp.Interval != "hour" {
+				t.Errorf("analytics = %d views by %s, want %d by hour", resp.TotalViews, resp.Interval, tt.wantViews)
+			}
+			if len(resp.Buckets) != 24 {
+				t.Fatalf("buckets = %d, want 24 hours", len(resp.Buckets))
+			}
+			if last := resp.Buckets[len(resp.Buckets)-1]; int64(last.Count) != tt.wantViews {
+				t.Errorf("current hour = %d views, want %d", last.Count, tt.wantViews)
+			}
+		})
+	}
+}
+
+func TestHandlerVideoAnalyticsParams(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantCode    int
+		wantBuckets int
+	}{
+		{name: "defaults to a week of days", query: "", wantCode: http.StatusOK, wantBuckets: 7},
+		{name: "days", query: "?interval=day&days=30", wantCode: http.StatusOK, wantBuckets: 30},
+		{name: "hours", query: "?interval=hour&days=2", wantCode: http.StatusOK, wantBuckets: 48},
+		{name: "unknown interval", query: "?interval=week", wantCode: http.StatusBadRequest},
+		{name: "too many days", query: "?days=91", wantCode: http.StatusBadRequest},
+		{name: "no days", query: "?days=0", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+			req := newVideoRequest(http.MethodGet, "/api/videos/"+video.ID.String()+"/analytics"+tt.query, video.ID, nil, token)
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoAnalytics(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Buckets []database.VideoViewCount `json:"buckets"`
+			}
+			decodeData(t, rec, &resp)
+			if len(resp.Buckets) != tt.wantBuckets {
+				t.Errorf("buckets = %d, want %d", len(resp.Buckets), tt.wantBuckets)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// workerPool runs CPU heavy processing jobs, like transcodes, on a fixed
+// number of goroutines so concurrent uploads can't spawn an unbounded number
+// of ffmpeg processes.
+type workerPool struct {
+	jobs chan *poolJob
+
+	mu        sync.Mutex
+	workers   int
+	pending   []*poolJob
+	active    int
+	processed int
+	failed    int
+}
+
+type poolJob struct {
+	run      func() error
+	enqueued time.Time
+	done     chan error
+}
+
+type workerStats struct {
+	Workers              int     `json:"workers"`
+	ActiveWorkers        int     `json:"active_workers"`
+	QueueDepth           int     `json:"queue_depth"`
+	Processed            int     `json:"processed"`
+	Failed               int     `json:"failed"`
+	OldestPendingSeconds float64 `json:"oldest_pending_seconds"`
+}
+
+func newWorkerPool(workers, queueSize int) *workerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &workerPool{
+		jobs:    make(chan *poolJob, queueSize),
+		workers: workers,
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *workerPool) work() {
+	for j := range p.jobs {
+		p.mu.Lock()
+		p.dequeue(j)
+		p.active++
+		p.mu.Unlock()
+
+		err := j.run()
+
+		p.mu.Lock()
+		p.active--
+		if err != nil {
+			p.failed++
+		} else {
+			p.processed++
+		}
+		p.mu.Unlock()
+		j.done <- err
+	}
+}
+
+// dequeue drops j from the pending list, callers must hold p.mu.
+func (p *workerPool) dequeue(j *poolJob) {
+	for i, pending := range p.pending {
+		if pending == j {
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// submit queues run and returns a channel receiving its result. It blocks
+// while the queue is full and gives up once ctx is done.
+func (p *workerPool) submit(ctx context.Context, run func() error) (<-chan error, error) {
+	j := &poolJob{
+		run:      run,
+		enqueued: time.Now(),
+		done:     make(chan error, 1),
+	}
+
+	p.mu.Lock()
+	p.pending = append(p.pending, j)
+	p.mu.Unlock()
+
+	select {
+	case p.jobs <- j:
+		return j.done, nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.dequeue(j)
+		p.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// run submits fn and waits for it to finish.
+func (p *workerPool) run(ctx context.Context, fn func() error) error {
+	done, err := p.submit(ctx, fn)
+	if err != nil {
+		return err
+	}
+	return <-done
+}
+
+func (p *workerPool) stats() workerStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := workerStats{
+		Workers:       p.workers,
+		ActiveWorkers: p.active,
+		QueueDepth:    len(p.pending),
+		Processed:     p.processed,
+		Failed:        p.failed,
+	}
+	if len(p.pending) > 0 {
+		oldest := p.pending[0].enqueued
+		for _, j := range p.pending[1:] {
+			if j.enqueued.Before(oldest) {
+				oldest = j.enqueued
+			}
+		}
+		stats.OldestPendingSeconds = time.Since(oldest).Seconds()
+	}
+	return stats
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolConcurrency(t *testing.T) {
+	tests := []struct {
+		name       string
+		workers    int
+		jobs       int
+		wantMaxRun int32
+	}{
+		{name: "jobs beyond the workers wait", workers: 2, jobs: 6, wantMaxRun: 2},
+		{name: "a single worker serializes", workers: 1, jobs: 3, wantMaxRun: 1},
+		{name: "at least one worker", workers: 0, jobs: 2, wantMaxRun: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newWorkerPool(tt.workers, tt.jobs)
+			var running, maxRunning atomic.Int32
+			var wg sync.WaitGroup
+			for range tt.jobs {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					p.run(context.Background(), func() error {
+						n := running.Add(1)
+						defer running.Add(-1)
+						for {
+							m := maxRunning.Load()
+							if n <= m || maxRunning.CompareAndSwap(m, n) {
+								break
+							}
+						}
+						time.Sleep(10 * time.Millisecond)
+						return nil
+					})
+				}()
+			}
+			wg.Wait()
+
+			if got := maxRunning.Load(); got != tt.wantMaxRun {
+				t.Errorf("max concurrent jobs = %d, want %d", got, tt.wantMaxRun)
+			}
+			if stats := p.stats(); stats.Processed != tt.jobs || stats.QueueDepth != 0 || stats.ActiveWorkers != 0 {
+				t.Errorf("stats = %+v, want %d processed and nothing left", stats, tt.jobs)
+			}
+		})
+	}
+}
+
+func TestWorkerPoolStats(t *testing.T) {
+	p := newWorkerPool(1, 4)
+	errFailed := errors.New("failed")
+	if err := p.run(context.Background(), func() error { return errFailed }); err != errFailed {
+		t.Errorf("run err = %v, want %v", err, errFailed)
+	}
+	p.run(context.Background(), func() error { return nil })
+
+	// hold the only worker so the next job stays queued
+	release := make(chan struct{})
+	started := make(chan struct{})
+	held, _ := p.submit(context.Background(), func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+	queued, _ := p.submit(context.Background(), func() error { return nil })
+
+	stats := p.stats()
+	if stats.Workers != 1 || stats.ActiveWorkers != 1 || stats.QueueDepth != 1 || stats.Processed != 1 || stats.Failed != 1 {
+		t.Errorf("stats = %+v, want 1 active, 1 queued, 1 processed and 1 failed", stats)
+	}
+	close(release)
+	<-held
+	<-queued
+}
+
+func TestWorkerPoolSubmitGivesUp(t *testing.T) {
+	// no queue and a busy worker, so submitting blocks
+	p := newWorkerPool(1, 0)
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	p.submit(context.Background(), func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.submit(ctx, func() error { return nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("submit err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if stats := p.stats(); stats.QueueDepth != 0 {
+		t.Errorf("abandoned job still counts as queued: %+v", stats)
+	}
+}